@@ -0,0 +1,132 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package abtest compares the results of two CEL programs over the same inputs.
+//
+// A typical use is to verify that a rewritten policy expression (the treatment) produces the same
+// results as the expression it replaces (the control) for live traffic.
+package abtest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+// maxDisagreementSamples is the number of disagreeing results retained by an ABTest.
+const maxDisagreementSamples = 100
+
+// ABTest evaluates a control and treatment program against the same activations and records
+// whether their results agree.
+//
+// The ABTest is safe for concurrent use.
+type ABTest struct {
+	control   cel.Program
+	treatment cel.Program
+
+	mu     sync.Mutex
+	report ABReport
+}
+
+// ABResult is the outcome of evaluating the control and treatment against one activation.
+type ABResult struct {
+	Activation interpreter.Activation
+	Control    ref.Val
+	Treatment  ref.Val
+	Agree      bool
+}
+
+// ABReport summarizes the comparisons performed by an ABTest.
+type ABReport struct {
+	total         int
+	agreed        int
+	disagreements []ABResult
+}
+
+// NewABTest creates an ABTest for the control and treatment programs.
+func NewABTest(control, treatment cel.Program) *ABTest {
+	return &ABTest{
+		control:   control,
+		treatment: treatment,
+	}
+}
+
+// Compare evaluates both programs against the activation and records whether the results agree.
+//
+// Results agree when they are equal, or when both are errors. An error is returned, and nothing
+// is recorded, when either program cannot be evaluated.
+func (ab *ABTest) Compare(activation interpreter.Activation) (*ABResult, error) {
+	ctrl, _, err := ab.control.Eval(activation)
+	if ctrl == nil {
+		return nil, fmt.Errorf("control evaluation failed: %v", err)
+	}
+	treat, _, err := ab.treatment.Eval(activation)
+	if treat == nil {
+		return nil, fmt.Errorf("treatment evaluation failed: %v", err)
+	}
+	res := &ABResult{
+		Activation: activation,
+		Control:    ctrl,
+		Treatment:  treat,
+		Agree:      agree(ctrl, treat),
+	}
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	ab.report.total++
+	if res.Agree {
+		ab.report.agreed++
+	} else if len(ab.report.disagreements) < maxDisagreementSamples {
+		ab.report.disagreements = append(ab.report.disagreements, *res)
+	}
+	return res, nil
+}
+
+// Report returns a snapshot of the comparisons recorded so far.
+func (ab *ABTest) Report() ABReport {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	report := ab.report
+	report.disagreements = append([]ABResult{}, ab.report.disagreements...)
+	return report
+}
+
+// AgreeRate returns the fraction of comparisons in which the results agreed, or zero if no
+// comparisons have been made.
+func (r ABReport) AgreeRate() float64 {
+	if r.total == 0 {
+		return 0
+	}
+	return float64(r.agreed) / float64(r.total)
+}
+
+// DisagreementSamples returns up to the first 100 comparisons in which the results disagreed.
+func (r ABReport) DisagreementSamples() []ABResult {
+	return r.disagreements
+}
+
+// TotalRuns returns the number of comparisons made.
+func (r ABReport) TotalRuns() int {
+	return r.total
+}
+
+func agree(ctrl, treat ref.Val) bool {
+	if types.IsError(ctrl) || types.IsError(treat) {
+		return types.IsError(ctrl) && types.IsError(treat)
+	}
+	return ctrl.Equal(treat) == types.True
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abtest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/interpreter"
+)
+
+func TestABTest(t *testing.T) {
+	env, err := cel.NewEnv(cel.Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatalf("cel.NewEnv() failed: %v", err)
+	}
+	control := compile(t, env, `x > 10`)
+	treatment := compile(t, env, `x >= 10`)
+	ab := NewABTest(control, treatment)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(x int) {
+			defer wg.Done()
+			vars, _ := interpreter.NewActivation(map[string]interface{}{"x": x})
+			if _, err := ab.Compare(vars); err != nil {
+				t.Errorf("Compare() failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	report := ab.Report()
+	if report.TotalRuns() != 20 {
+		t.Errorf("got %d runs, wanted 20", report.TotalRuns())
+	}
+	if report.AgreeRate() != 19.0/20 {
+		t.Errorf("got agree rate %v, wanted 0.95", report.AgreeRate())
+	}
+	samples := report.DisagreementSamples()
+	if len(samples) != 1 {
+		t.Fatalf("got %d disagreements, wanted 1", len(samples))
+	}
+	x, _ := samples[0].Activation.ResolveName("x")
+	if x != 10 {
+		t.Errorf("got disagreement for x=%v, wanted x=10", x)
+	}
+}
+
+func compile(t *testing.T, env *cel.Env, expr string) cel.Program {
+	t.Helper()
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prg
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analysis
+
+import (
+	"sort"
+
+	"github.com/google/cel-go/common/walk"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// MessageDependencies returns the sorted names of the proto message types which appear within the
+// types of the expression's nodes.
+//
+// This includes the types of selected fields, the types of function arguments and results, and
+// the types of constructed messages, as well as message types nested within list, map, function,
+// and type-of-type types.
+func MessageDependencies(checked *exprpb.CheckedExpr) []string {
+	names := map[string]bool{}
+	for _, t := range checked.GetTypeMap() {
+		collectMessageTypes(t, names)
+	}
+	return sortedKeys(names)
+}
+
+// FunctionDependencies returns the sorted names of the functions called by the expression,
+// including operators, as resolved by the checker.
+func FunctionDependencies(checked *exprpb.CheckedExpr) []string {
+	names := map[string]bool{}
+	walk.PreOrder(checked.GetExpr(), func(e *exprpb.Expr) bool {
+		if call := e.GetCallExpr(); call != nil {
+			names[call.GetFunction()] = true
+		}
+		return true
+	})
+	return sortedKeys(names)
+}
+
+func collectMessageTypes(t *exprpb.Type, names map[string]bool) {
+	switch t.GetTypeKind().(type) {
+	case *exprpb.Type_MessageType:
+		names[t.GetMessageType()] = true
+	case *exprpb.Type_ListType_:
+		collectMessageTypes(t.GetListType().GetElemType(), names)
+	case *exprpb.Type_MapType_:
+		collectMessageTypes(t.GetMapType().GetKeyType(), names)
+		collectMessageTypes(t.GetMapType().GetValueType(), names)
+	case *exprpb.Type_Function:
+		collectMessageTypes(t.GetFunction().GetResultType(), names)
+		for _, arg := range t.GetFunction().GetArgTypes() {
+			collectMessageTypes(arg, names)
+		}
+	case *exprpb.Type_AbstractType_:
+		for _, param := range t.GetAbstractType().GetParameterTypes() {
+			collectMessageTypes(param, names)
+		}
+	case *exprpb.Type_Type:
+		collectMessageTypes(t.GetType(), names)
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
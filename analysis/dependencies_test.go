@@ -0,0 +1,63 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMessageDependencies(t *testing.T) {
+	tests := []struct {
+		expr string
+		out  []string
+	}{
+		{expr: `user == req.name`, out: []string{}},
+		{expr: `msg.single_int64 > 0 && msg.single_string != ''`,
+			out: []string{"google.expr.proto3.test.TestAllTypes"}},
+		{expr: `TestAllTypes{single_nested_message: msg.single_nested_message}.single_int64`,
+			out: []string{
+				"google.expr.proto3.test.TestAllTypes",
+				"google.expr.proto3.test.TestAllTypes.NestedMessage",
+			}},
+		{expr: `[{'a': msg}].size()`, out: []string{"google.expr.proto3.test.TestAllTypes"}},
+		{expr: `TestAllTypes`, out: []string{"google.expr.proto3.test.TestAllTypes"}},
+	}
+	for _, tc := range tests {
+		out := MessageDependencies(compile(t, tc.expr))
+		if !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("MessageDependencies(%q) got %v, wanted %v", tc.expr, out, tc.out)
+		}
+	}
+}
+
+func TestFunctionDependencies(t *testing.T) {
+	tests := []struct {
+		expr string
+		out  []string
+	}{
+		{expr: `user`, out: []string{}},
+		{expr: `items.exists(i, size(user) == i)`,
+			out: []string{"!_", "@not_strictly_false", "_==_", "_||_", "size"}},
+		{expr: `{'a': user.startsWith('x')}[req.key] && msg.single_bool`,
+			out: []string{"_&&_", "_[_]", "startsWith"}},
+	}
+	for _, tc := range tests {
+		out := FunctionDependencies(compile(t, tc.expr))
+		if !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("FunctionDependencies(%q) got %v, wanted %v", tc.expr, out, tc.out)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analysis
+
+import (
+	"sort"
+
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/walk"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// FindUnreachable returns the sorted ids of the expression nodes which are statically known to
+// never contribute to the result of the expression:
+//
+//   - an operand of `&&` whose other operand is the literal `false`.
+//   - an operand of `||` whose other operand is the literal `true`.
+//   - the second branch of a conditional whose condition is the literal `true`, and the first
+//     branch of a conditional whose condition is the literal `false`.
+//
+// All nodes within an unreachable sub-expression are reported. Only boolean literals are
+// recognized, so expressions such as `1 > 2` should be constant folded before the analysis is
+// run in order to be detected.
+func FindUnreachable(checked *exprpb.CheckedExpr) []int64 {
+	r := &reachability{}
+	r.visit(checked.GetExpr())
+	sort.Slice(r.unreachable, func(i, j int) bool {
+		return r.unreachable[i] < r.unreachable[j]
+	})
+	return r.unreachable
+}
+
+type reachability struct {
+	unreachable []int64
+}
+
+func (r *reachability) visit(e *exprpb.Expr) {
+	if e == nil {
+		return
+	}
+	call := e.GetCallExpr()
+	args := call.GetArgs()
+	switch {
+	case call.GetFunction() == operators.LogicalAnd && len(args) == 2:
+		r.visitLogical(args[0], args[1], false)
+		return
+	case call.GetFunction() == operators.LogicalOr && len(args) == 2:
+		r.visitLogical(args[0], args[1], true)
+		return
+	case call.GetFunction() == operators.Conditional && len(args) == 3:
+		if cond, ok := boolLiteral(args[0]); ok {
+			taken, skipped := args[1], args[2]
+			if !cond {
+				taken, skipped = skipped, taken
+			}
+			r.visit(taken)
+			r.markAll(skipped)
+			return
+		}
+	}
+	for _, c := range walk.Children(e) {
+		r.visit(c)
+	}
+}
+
+// visitLogical marks an operand of a logical operator as unreachable when the other operand is
+// the literal which determines the result of the operator.
+func (r *reachability) visitLogical(lhs, rhs *exprpb.Expr, absorbing bool) {
+	l, lConst := boolLiteral(lhs)
+	rv, rConst := boolLiteral(rhs)
+	lAbsorbs := lConst && l == absorbing
+	rAbsorbs := rConst && rv == absorbing
+	switch {
+	case lAbsorbs && !rAbsorbs:
+		r.markAll(rhs)
+	case rAbsorbs && !lAbsorbs:
+		r.markAll(lhs)
+	default:
+		r.visit(lhs)
+		r.visit(rhs)
+	}
+}
+
+// markAll records the ids of every node within the expression as unreachable.
+func (r *reachability) markAll(e *exprpb.Expr) {
+	walk.PreOrder(e, func(n *exprpb.Expr) bool {
+		r.unreachable = append(r.unreachable, n.GetId())
+		return true
+	})
+}
+
+// boolLiteral returns the value of the expression if it is a boolean literal.
+func boolLiteral(e *exprpb.Expr) (bool, bool) {
+	c, ok := e.GetConstExpr().GetConstantKind().(*exprpb.Constant_BoolValue)
+	if !ok {
+		return false, false
+	}
+	return c.BoolValue, true
+}
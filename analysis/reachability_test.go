@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analysis
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestFindUnreachable(t *testing.T) {
+	tests := []struct {
+		expr  string
+		nodes int
+		names []string
+	}{
+		{expr: `user == 'a' || req.b`},
+		{expr: `(user == 'a' && false) || any`, nodes: 3, names: []string{"user"}},
+		{expr: `false && user == 'a'`, nodes: 3, names: []string{"user"}},
+		{expr: `any || true`, nodes: 1, names: []string{"any"}},
+		{expr: `true || false`, nodes: 1},
+		{expr: `false && false`},
+		{expr: `true ? user : req.name`, nodes: 2, names: []string{"req"}},
+		{expr: `false ? user : req.name`, nodes: 1, names: []string{"user"}},
+		{expr: `[any && false, items.exists(x, x > limit || true)]`, nodes: 4,
+			names: []string{"any", "google.expr.proto3.test.limit", "x"}},
+		{expr: `1 > 2 && any`},
+	}
+	for _, tc := range tests {
+		checked := compile(t, tc.expr)
+		ids := FindUnreachable(checked)
+		if len(ids) != tc.nodes {
+			t.Errorf("FindUnreachable(%q) got %d nodes, wanted %d", tc.expr, len(ids), tc.nodes)
+		}
+		if !sort.SliceIsSorted(ids, func(i, j int) bool { return ids[i] < ids[j] }) {
+			t.Errorf("FindUnreachable(%q) got unsorted ids %v", tc.expr, ids)
+		}
+		names := identNames(checked.GetExpr(), ids)
+		if !reflect.DeepEqual(names, tc.names) {
+			t.Errorf("FindUnreachable(%q) got identifiers %v, wanted %v", tc.expr, names, tc.names)
+		}
+	}
+}
+
+// identNames returns the sorted names of the identifiers among the given expression ids.
+func identNames(e *exprpb.Expr, ids []int64) []string {
+	idSet := map[int64]bool{}
+	for _, id := range ids {
+		idSet[id] = true
+	}
+	var names []string
+	var visit func(e *exprpb.Expr)
+	visit = func(e *exprpb.Expr) {
+		if e == nil {
+			return
+		}
+		if idSet[e.GetId()] && e.GetIdentExpr() != nil {
+			names = append(names, e.GetIdentExpr().GetName())
+		}
+		call := e.GetCallExpr()
+		visit(call.GetTarget())
+		for _, arg := range call.GetArgs() {
+			visit(arg)
+		}
+		for _, elem := range e.GetListExpr().GetElements() {
+			visit(elem)
+		}
+		visit(e.GetSelectExpr().GetOperand())
+		comp := e.GetComprehensionExpr()
+		visit(comp.GetIterRange())
+		visit(comp.GetLoopStep())
+	}
+	visit(e)
+	sort.Strings(names)
+	return names
+}
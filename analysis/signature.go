@@ -0,0 +1,116 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package analysis provides static analyses of checked CEL expressions.
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/walk"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// IdentDecl describes an identifier read by an expression.
+type IdentDecl struct {
+	Name string
+	Type *exprpb.Type
+}
+
+// ExprSignature describes the identifiers an expression reads and the type it returns.
+type ExprSignature struct {
+	inputs     []IdentDecl
+	outputType *exprpb.Type
+}
+
+// Signature computes the signature of a checked expression.
+//
+// Variables introduced by comprehensions are internal to the expression and are not reported as
+// inputs, nor are identifiers which resolve to constants, enum values, or type names.
+func Signature(checked *exprpb.CheckedExpr) ExprSignature {
+	s := &sigCollector{
+		checked: checked,
+		inputs:  map[string]*exprpb.Type{},
+	}
+	walk.Scoped(checked.GetExpr(), func(e *exprpb.Expr, scope walk.Scope) bool {
+		if ident := e.GetIdentExpr(); ident != nil && !scope.Bound(ident.GetName()) {
+			s.visitIdent(e)
+		}
+		return true
+	})
+	inputs := make([]IdentDecl, 0, len(s.inputs))
+	for name, t := range s.inputs {
+		inputs = append(inputs, IdentDecl{Name: name, Type: t})
+	}
+	sort.Slice(inputs, func(i, j int) bool {
+		return inputs[i].Name < inputs[j].Name
+	})
+	out := checked.GetTypeMap()[checked.GetExpr().GetId()]
+	if out == nil {
+		out = decls.Dyn
+	}
+	return ExprSignature{inputs: inputs, outputType: out}
+}
+
+// Inputs returns the identifiers read by the expression, sorted by name.
+func (s ExprSignature) Inputs() []IdentDecl {
+	inputs := make([]IdentDecl, len(s.inputs))
+	copy(inputs, s.inputs)
+	return inputs
+}
+
+// OutputType returns the type of the expression's result.
+func (s ExprSignature) OutputType() *exprpb.Type {
+	return s.outputType
+}
+
+// String formats the signature as a parenthesized input list followed by the result type, for
+// example `(req: Request, user: User) -> bool`.
+func (s ExprSignature) String() string {
+	params := make([]string, len(s.inputs))
+	for i, in := range s.inputs {
+		params[i] = fmt.Sprintf("%s: %s", in.Name, checker.FormatCheckedType(in.Type))
+	}
+	return fmt.Sprintf("(%s) -> %s",
+		strings.Join(params, ", "), checker.FormatCheckedType(s.outputType))
+}
+
+type sigCollector struct {
+	checked *exprpb.CheckedExpr
+	inputs  map[string]*exprpb.Type
+}
+
+func (s *sigCollector) visitIdent(e *exprpb.Expr) {
+	name := e.GetIdentExpr().GetName()
+	ref := s.checked.GetReferenceMap()[e.GetId()]
+	if ref.GetValue() != nil {
+		return
+	}
+	t := s.checked.GetTypeMap()[e.GetId()]
+	if t.GetType() != nil {
+		return
+	}
+	if ref.GetName() != "" {
+		name = ref.GetName()
+	}
+	if t == nil {
+		t = decls.Dyn
+	}
+	s.inputs[name] = t
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analysis
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+
+	proto3pb "github.com/google/cel-go/test/proto3pb"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func compile(t *testing.T, src string) *exprpb.CheckedExpr {
+	t.Helper()
+	env, err := cel.NewEnv(
+		cel.Container("google.expr.proto3.test"),
+		cel.Types(&proto3pb.TestAllTypes{}),
+		cel.Declarations(
+			decls.NewVar("req", decls.NewMapType(decls.String, decls.Dyn)),
+			decls.NewVar("user", decls.String),
+			decls.NewVar("google.expr.proto3.test.limit", decls.Int),
+			decls.NewVar("items", decls.NewListType(decls.Int)),
+			decls.NewVar("any", decls.Dyn),
+			decls.NewVar("msg", decls.NewObjectType("google.expr.proto3.test.TestAllTypes"))))
+	if err != nil {
+		t.Fatalf("cel.NewEnv() failed: %v", err)
+	}
+	ast, iss := env.Compile(src)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checked
+}
+
+func TestSignature(t *testing.T) {
+	tests := []struct {
+		expr string
+		out  string
+	}{
+		{expr: `1 + 2`, out: `() -> int`},
+		{expr: `user == req.name`, out: `(req: map(string, dyn), user: string) -> bool`},
+		{expr: `items.all(x, x < limit)`,
+			out: `(google.expr.proto3.test.limit: int, items: list(int)) -> bool`},
+		{expr: `items.map(x, x * 2)`, out: `(items: list(int)) -> list(int)`},
+		{expr: `any`, out: `(any: dyn) -> dyn`},
+		{expr: `int`, out: `() -> type(int)`},
+	}
+	for _, tc := range tests {
+		sig := Signature(compile(t, tc.expr))
+		if sig.String() != tc.out {
+			t.Errorf("Signature(%q) got %s, wanted %s", tc.expr, sig, tc.out)
+		}
+	}
+}
+
+func TestSignatureInputs(t *testing.T) {
+	sig := Signature(compile(t, `items.exists(i, i == size(user)) && req.x == any`))
+	inputs := sig.Inputs()
+	want := []string{"any", "items", "req", "user"}
+	if len(inputs) != len(want) {
+		t.Fatalf("Inputs() got %v, wanted %v", inputs, want)
+	}
+	for i, in := range inputs {
+		if in.Name != want[i] {
+			t.Errorf("Inputs()[%d] got %s, wanted %s", i, in.Name, want[i])
+		}
+	}
+	if sig.OutputType().GetPrimitive() != exprpb.Type_BOOL {
+		t.Errorf("OutputType() got %v, wanted bool", sig.OutputType())
+	}
+}
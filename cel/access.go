@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+// EvalID is a random (version 4) UUID which identifies an evaluation.
+type EvalID [16]byte
+
+// newEvalID returns a new random EvalID.
+func newEvalID() EvalID {
+	var id EvalID
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(fmt.Sprintf("cel: reading random bytes: %v", err))
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return id
+}
+
+// String returns the canonical textual form of the UUID.
+func (id EvalID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// AccessRecord lists the variable accesses of a single evaluation of a LoggedProgram.
+type AccessRecord struct {
+	EvalID    EvalID
+	ExprHash  uint64
+	Timestamp time.Time
+	Accesses  []interpreter.FieldAccess
+}
+
+// AccessLog buffers the AccessRecords of the programs it wraps, such as for data access auditing.
+// Once the buffer is full, each new record replaces the oldest one.
+type AccessLog struct {
+	mu      sync.Mutex
+	records []AccessRecord
+	// next is the index of the oldest record once the buffer is full.
+	next int
+	full bool
+}
+
+// NewAccessLog creates an AccessLog which buffers up to maxRecords records. A value less than one
+// buffers a single record.
+func NewAccessLog(maxRecords int) *AccessLog {
+	if maxRecords < 1 {
+		maxRecords = 1
+	}
+	return &AccessLog{records: make([]AccessRecord, 0, maxRecords)}
+}
+
+// Wrap returns a LoggedProgram which records the variable accesses of each evaluation of the
+// program within the log.
+//
+// The program must have been created by Env.Program with the ExpressionAccessLogging option, since
+// the accesses of other programs are not recorded.
+func (l *AccessLog) Wrap(prg Program) (*LoggedProgram, error) {
+	p, err := watchedProg(prg)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accessLogging {
+		return nil, errors.New("program was not created with the ExpressionAccessLogging option")
+	}
+	return &LoggedProgram{prg: prg, log: l, exprHash: HashExpression(p.ast)}, nil
+}
+
+// Drain returns the buffered records, oldest first, and clears the buffer.
+func (l *AccessLog) Drain() []AccessRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	drained := make([]AccessRecord, 0, len(l.records))
+	drained = append(drained, l.records[l.next:]...)
+	drained = append(drained, l.records[:l.next]...)
+	l.records = l.records[:0]
+	l.next = 0
+	l.full = false
+	return drained
+}
+
+func (l *AccessLog) add(rec AccessRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		l.records = append(l.records, rec)
+		l.full = len(l.records) == cap(l.records)
+		return
+	}
+	l.records[l.next] = rec
+	l.next = (l.next + 1) % len(l.records)
+}
+
+// LoggedProgram is a Program which records the variable accesses of its evaluations within an
+// AccessLog.
+type LoggedProgram struct {
+	prg      Program
+	log      *AccessLog
+	exprHash uint64
+}
+
+// Eval implements the Program interface method.
+//
+// A record is added for every evaluation, including evaluations which return an error. The
+// accesses are listed in the order in which they completed.
+func (p *LoggedProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	rec := AccessRecord{
+		EvalID:    newEvalID(),
+		ExprHash:  p.exprHash,
+		Timestamp: time.Now(),
+	}
+	activation, err := interpreter.NewActivation(vars)
+	if err != nil {
+		p.log.add(rec)
+		return nil, nil, err
+	}
+	recorder := interpreter.NewAccessRecorder()
+	out, det, err := p.prg.Eval(recorder.Activation(activation))
+	rec.Accesses = recorder.Accesses()
+	p.log.add(rec)
+	return out, det, err
+}
+
+// Program returns the underlying program.
+func (p *LoggedProgram) Program() Program {
+	return p.prg
+}
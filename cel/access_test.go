@@ -0,0 +1,134 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+)
+
+func TestAccessLog(t *testing.T) {
+	env, err := NewEnv(Declarations(
+		decls.NewVar("user", decls.NewMapType(decls.String, decls.Dyn)),
+		decls.NewVar("items", decls.NewListType(decls.Int))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(
+		`user.name == "alice" && (user.admin ? items[0] : items[1]) > 1 && size(items) > 0`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast, ExpressionAccessLogging())
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := NewAccessLog(2)
+	lp, err := log.Wrap(prg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, admin := range []bool{true, false, true} {
+		out, _, err := lp.Eval(map[string]interface{}{
+			"user":  map[string]interface{}{"name": "alice", "admin": admin},
+			"items": []int{1, 2},
+		})
+		if want := types.Bool(!admin); err != nil || out != want {
+			t.Fatalf("Eval(admin=%t) got %v, %v, wanted %v", admin, out, err, want)
+		}
+	}
+	records := log.Drain()
+	if len(records) != 2 {
+		t.Fatalf("got %d records, wanted the 2 most recent", len(records))
+	}
+	if len(log.Drain()) != 0 {
+		t.Error("got records after draining, wanted none")
+	}
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for i, rec := range records {
+		if !uuid.MatchString(rec.EvalID.String()) {
+			t.Errorf("got eval id %s, wanted a version 4 UUID", rec.EvalID)
+		}
+		if rec.ExprHash != HashExpression(ast) || rec.Timestamp.IsZero() {
+			t.Errorf("got hash %d and timestamp %v", rec.ExprHash, rec.Timestamp)
+		}
+		// The oldest remaining record is for the non-admin evaluation.
+		index := "[1]"
+		if i == 1 {
+			index = "[0]"
+		}
+		var got [][3]string
+		for _, access := range rec.Accesses {
+			got = append(got, [3]string{access.VariableName, access.FieldPath, access.ValueType})
+		}
+		want := [][3]string{
+			{"user", "name", "string"},
+			{"user", "admin", "bool"},
+			{"items", index, "int"},
+			{"items", "", "list"},
+		}
+		if i == 1 {
+			// The admin evaluation short-circuits before size(items).
+			want = want[:3]
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("record %d: got accesses %v, wanted %v", i, got, want)
+		}
+	}
+	if records[0].EvalID == records[1].EvalID {
+		t.Error("got the same eval id for two evaluations")
+	}
+}
+
+func TestAccessLog_PartialVars(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int), decls.NewVar("y", decls.Int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`x + y`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast, EvalOptions(OptPartialEval), ExpressionAccessLogging())
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := NewAccessLog(1)
+	lp, err := log.Wrap(prg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ := PartialVars(map[string]interface{}{"x": 1}, AttributePattern("y"))
+	if out, _, err := lp.Eval(vars); !types.IsUnknown(out) {
+		t.Errorf("got %v, %v, wanted an unknown result", out, err)
+	}
+	if records := log.Drain(); len(records) != 1 || len(records[0].Accesses) != 1 ||
+		records[0].Accesses[0].VariableName != "x" {
+		t.Errorf("got records %v, wanted the access to x", records)
+	}
+
+	// Programs which do not record their accesses are rejected.
+	plain, err := env.Program(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Wrap(plain); err == nil {
+		t.Error("Wrap() succeeded for a program without ExpressionAccessLogging")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/walk"
+	"github.com/google/cel-go/parser"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// WithAlias declares `alias` as a short name for the `target` expression, typically a long
+// qualified path such as `request.resource.metadata.annotations`.
+//
+// Aliases are expanded when an Ast is type-checked: every identifier named `alias`, other than
+// comprehension variables of the same name, is replaced by the parsed `target` before checking,
+// so the checked Ast and the programs planned from it contain only the expanded form. Parsed Asts
+// which are not checked are evaluated without expansion. Since the target replaces the identifier
+// in place, names within the target may be shadowed by the variables of enclosing comprehensions.
+//
+// Targets may refer to other aliases. An error is returned if the target cannot be parsed, or if
+// the alias would make an alias refer to itself, directly or through other aliases.
+func WithAlias(alias, target string) EnvOption {
+	return func(e *Env) (*Env, error) {
+		res, errs := parser.ParseWithMacros(common.NewTextSource(target), e.macros)
+		if len(errs.GetErrors()) > 0 {
+			return nil, fmt.Errorf("invalid target for alias %s: %s", alias, errs.ToDisplayString())
+		}
+		aliases := make(map[string]*exprpb.Expr, len(e.aliases)+1)
+		for name, expr := range e.aliases {
+			aliases[name] = expr
+		}
+		aliases[alias] = res.GetExpr()
+		if cycle := findAliasCycle(alias, aliases); cycle != nil {
+			return nil, fmt.Errorf("circular alias: %s", strings.Join(cycle, " -> "))
+		}
+		e.aliases = aliases
+		return e, nil
+	}
+}
+
+// findAliasCycle returns the path of alias names which leads from the alias back to itself, or
+// nil if there is none.
+func findAliasCycle(alias string, aliases map[string]*exprpb.Expr) []string {
+	var visit func(name string, path []string) []string
+	visit = func(name string, path []string) []string {
+		path = append(path, name)
+		for _, ref := range aliasRefs(aliases[name], aliases) {
+			if ref == alias {
+				return append(path, ref)
+			}
+			if cycle := visit(ref, path); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return visit(alias, nil)
+}
+
+// aliasRefs returns the names of the aliases which would be expanded within the expression.
+func aliasRefs(e *exprpb.Expr, aliases map[string]*exprpb.Expr) []string {
+	var refs []string
+	for _, ident := range aliasIdents(e, aliases) {
+		refs = append(refs, ident.GetIdentExpr().GetName())
+	}
+	return refs
+}
+
+// aliasIdents returns the identifiers in the expression which name an alias and are not bound by
+// an enclosing comprehension.
+func aliasIdents(e *exprpb.Expr, aliases map[string]*exprpb.Expr) []*exprpb.Expr {
+	var idents []*exprpb.Expr
+	walk.Scoped(e, func(n *exprpb.Expr, scope walk.Scope) bool {
+		ident := n.GetIdentExpr()
+		if ident == nil || scope.Bound(ident.GetName()) {
+			return true
+		}
+		if _, found := aliases[ident.GetName()]; found {
+			idents = append(idents, n)
+		}
+		return true
+	})
+	return idents
+}
+
+// expandAliases returns a copy of the parsed expression in which alias identifiers have been
+// replaced by their targets.
+//
+// The nodes of each expanded target are given new ids which are greater than every id within the
+// expression, and are positioned at the alias identifier they replace.
+func expandAliases(pe *exprpb.ParsedExpr, aliases map[string]*exprpb.Expr) *exprpb.ParsedExpr {
+	out := proto.Clone(pe).(*exprpb.ParsedExpr)
+	if out.SourceInfo == nil {
+		out.SourceInfo = &exprpb.SourceInfo{}
+	}
+	if out.SourceInfo.Positions == nil {
+		out.SourceInfo.Positions = map[int64]int32{}
+	}
+	x := &aliasExpander{aliases: aliases, info: out.GetSourceInfo()}
+	x.nextID = maxExprID(out.GetExpr())
+	x.expand(out.GetExpr())
+	return out
+}
+
+type aliasExpander struct {
+	aliases map[string]*exprpb.Expr
+	info    *exprpb.SourceInfo
+	nextID  int64
+}
+
+// expand replaces the alias identifiers within the expression in place.
+func (x *aliasExpander) expand(e *exprpb.Expr) {
+	for _, ident := range aliasIdents(e, x.aliases) {
+		pos := x.info.GetPositions()[ident.GetId()]
+		target := proto.Clone(x.aliases[ident.GetIdentExpr().GetName()]).(*exprpb.Expr)
+		x.renumber(target, pos)
+		// Targets may themselves refer to other aliases; registration guarantees termination.
+		x.expand(target)
+		ident.Id = target.GetId()
+		ident.ExprKind = target.GetExprKind()
+	}
+}
+
+// renumber assigns new ids to every node of the expression, positioned at the given offset.
+func (x *aliasExpander) renumber(e *exprpb.Expr, pos int32) {
+	walk.PreOrder(e, func(n *exprpb.Expr) bool {
+		x.nextID++
+		n.Id = x.nextID
+		x.info.Positions[n.Id] = pos
+		for _, entry := range n.GetStructExpr().GetEntries() {
+			x.nextID++
+			entry.Id = x.nextID
+		}
+		return true
+	})
+}
+
+// maxExprID returns the greatest id of the nodes and struct entries within the expression.
+func maxExprID(e *exprpb.Expr) int64 {
+	var max int64
+	update := func(id int64) {
+		if id > max {
+			max = id
+		}
+	}
+	walk.PreOrder(e, func(n *exprpb.Expr) bool {
+		update(n.GetId())
+		for _, entry := range n.GetStructExpr().GetEntries() {
+			update(entry.GetId())
+		}
+		return true
+	})
+	return max
+}
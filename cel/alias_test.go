@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+)
+
+func TestWithAlias(t *testing.T) {
+	env, err := NewEnv(
+		Declarations(decls.NewVar("request", decls.NewMapType(decls.String, decls.Dyn))),
+		WithAlias("meta", "request.resource.metadata"),
+		WithAlias("annotations", "meta.annotations"),
+		WithAlias("sa", `annotations["kubernetes.io/service-account.name"]`),
+		WithAlias("undeclared", "missing.field"))
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	vars := map[string]interface{}{
+		"request": map[string]interface{}{
+			"resource": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": "pod",
+					"annotations": map[string]interface{}{
+						"kubernetes.io/service-account.name": "builder",
+					},
+				},
+			},
+		},
+	}
+	tests := []string{
+		`sa == 'builder'`,
+		`meta.name == 'pod' && has(meta.annotations)`,
+		`annotations.exists(k, annotations[k] == sa)`,
+		`[meta].all(meta, meta.name == 'pod')`,
+		`[{'name': 'pod'}].exists(meta, meta.name == 'pod')`,
+	}
+	for _, src := range tests {
+		ast, iss := env.Compile(src)
+		if iss.Err() != nil {
+			t.Fatalf("Compile(%q) failed: %v", src, iss.Err())
+		}
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("Program(%q) failed: %v", src, err)
+		}
+		out, _, err := prg.Eval(vars)
+		if err != nil || out != types.True {
+			t.Errorf("Eval(%q) got %v, %v, wanted true", src, out, err)
+		}
+	}
+
+	// Errors in expanded targets are reported at the position of the alias.
+	_, iss := env.Compile(`sa == undeclared`)
+	if iss.Err() == nil || !strings.Contains(iss.Err().Error(), ":1:7: undeclared reference") {
+		t.Errorf("Compile() got %v, wanted an error at the alias position", iss.Err())
+	}
+
+	// Extended environments retain the aliases.
+	ext, err := env.Extend(WithAlias("name", "meta.name"))
+	if err != nil {
+		t.Fatalf("Extend() failed: %v", err)
+	}
+	ast, iss := ext.Compile(`name == 'pod' && sa == 'builder'`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := ext.Program(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _, err := prg.Eval(vars); err != nil || out != types.True {
+		t.Errorf("Eval() got %v, %v, wanted true", out, err)
+	}
+	if _, iss := env.Compile(`name == 'pod'`); iss.Err() == nil {
+		t.Error("Compile() in the base environment resolved an alias from an extension")
+	}
+}
+
+func TestWithAliasErrors(t *testing.T) {
+	tests := []struct {
+		opts []EnvOption
+		err  string
+	}{
+		{
+			opts: []EnvOption{WithAlias("a", "a.b")},
+			err:  "circular alias: a -> a",
+		},
+		{
+			opts: []EnvOption{WithAlias("a", "b.c"), WithAlias("b", "c[0]"), WithAlias("c", "a")},
+			err:  "circular alias: c -> a -> b -> c",
+		},
+		{
+			opts: []EnvOption{WithAlias("a", "b ||")},
+			err:  "invalid target for alias a",
+		},
+	}
+	for _, tc := range tests {
+		_, err := NewEnv(tc.opts...)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("NewEnv() got error %v, wanted %s", err, tc.err)
+		}
+	}
+	// Comprehension variables do not refer to aliases.
+	if _, err := NewEnv(WithAlias("a", "[1].all(a, a > 0)")); err != nil {
+		t.Errorf("NewEnv() failed: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// ErrCircuitOpen is returned by a CircuitBreakerProgram which declines to evaluate its program
+// because the circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed permits evaluations.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects evaluations with ErrCircuitOpen.
+	CircuitOpen
+
+	// CircuitHalfOpen permits a single trial evaluation, whose outcome closes or reopens the
+	// circuit.
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreaker stops the evaluation of the programs it wraps after a number of consecutive
+// evaluation errors.
+//
+// After `threshold` consecutive errors the circuit opens, and evaluations return ErrCircuitOpen
+// without evaluating the program. Once `resetAfter` has elapsed the circuit is half-open: the next
+// evaluation is attempted as a trial, while concurrent evaluations continue to be rejected. A
+// successful trial closes the circuit and a failed trial opens it again.
+//
+// The programs wrapped by a single CircuitBreaker share its circuit, so a breaker is typically
+// created for each expression.
+type CircuitBreaker struct {
+	threshold  int
+	resetAfter time.Duration
+	onChange   func(from, to CircuitState)
+	now        func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// CircuitBreakerOption configures a CircuitBreaker.
+type CircuitBreakerOption func(*CircuitBreaker)
+
+// WithStateChangeHook sets a function which is called with the previous and the new state on
+// every state transition, for example to record metrics. The function is called synchronously
+// by the evaluation causing the transition and must not use the breaker.
+func WithStateChangeHook(hook func(from, to CircuitState)) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.onChange = hook
+	}
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker which opens after `threshold` consecutive
+// errors and becomes half-open once `resetAfter` has elapsed since it opened.
+func NewCircuitBreaker(threshold int, resetAfter time.Duration,
+	opts ...CircuitBreakerOption) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		threshold:  threshold,
+		resetAfter: resetAfter,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(cb)
+	}
+	return cb
+}
+
+// Wrap returns a CircuitBreakerProgram which evaluates the program while the circuit permits.
+func (cb *CircuitBreaker) Wrap(prg Program) *CircuitBreakerProgram {
+	return &CircuitBreakerProgram{prg: prg, breaker: cb}
+}
+
+// State returns the current state of the circuit.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == CircuitOpen && cb.now().Sub(cb.openedAt) >= cb.resetAfter {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+// allow reports whether an evaluation may proceed, and whether it is the half-open trial.
+func (cb *CircuitBreaker) allow() (bool, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case CircuitClosed:
+		return true, false
+	case CircuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.resetAfter {
+			return false, false
+		}
+		cb.transition(CircuitHalfOpen)
+	}
+	if cb.trial {
+		return false, false
+	}
+	cb.trial = true
+	return true, true
+}
+
+// done records the outcome of a permitted evaluation.
+func (cb *CircuitBreaker) done(trial bool, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if trial {
+		cb.trial = false
+	}
+	if !failed {
+		cb.failures = 0
+		if cb.state != CircuitClosed {
+			cb.transition(CircuitClosed)
+		}
+		return
+	}
+	cb.failures++
+	if trial || (cb.state == CircuitClosed && cb.failures >= cb.threshold) {
+		cb.openedAt = cb.now()
+		cb.transition(CircuitOpen)
+	}
+}
+
+// transition sets the state and calls the hook. The caller must hold the mutex.
+func (cb *CircuitBreaker) transition(to CircuitState) {
+	from := cb.state
+	cb.state = to
+	if cb.onChange != nil {
+		cb.onChange(from, to)
+	}
+}
+
+// CircuitBreakerProgram is a Program which is not evaluated while its CircuitBreaker is open.
+type CircuitBreakerProgram struct {
+	prg     Program
+	breaker *CircuitBreaker
+}
+
+// Eval implements the Program interface method, returning ErrCircuitOpen without evaluating the
+// program when the circuit does not permit the evaluation.
+//
+// Evaluations which return an error count as failures. Unknown results count as successes.
+// Evaluations which panic also count as failures, and the panic is propagated to the caller.
+func (p *CircuitBreakerProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	allowed, trial := p.breaker.allow()
+	if !allowed {
+		return nil, nil, ErrCircuitOpen
+	}
+	failed := true
+	// Record the outcome even if the evaluation panics, so that a half-open circuit does not
+	// wait forever for the result of its trial.
+	defer func() {
+		p.breaker.done(trial, failed)
+	}()
+	out, det, err := p.prg.Eval(vars)
+	failed = err != nil
+	return out, det, err
+}
+
+// Program returns the underlying program.
+func (p *CircuitBreakerProgram) Program() Program {
+	return p.prg
+}
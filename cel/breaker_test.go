@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+func TestCircuitBreakerProgram(t *testing.T) {
+	prg := compileProgram(t, `10 / x`)
+	good := map[string]interface{}{"x": 2}
+	bad := map[string]interface{}{"x": 0}
+
+	var transitions []string
+	cb := NewCircuitBreaker(2, time.Minute,
+		WithStateChangeHook(func(from, to CircuitState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		}))
+	now := time.Now()
+	cb.now = func() time.Time { return now }
+	cbp := cb.Wrap(prg)
+
+	// A success resets the count of consecutive errors.
+	for _, vars := range []interface{}{bad, good, bad} {
+		cbp.Eval(vars)
+	}
+	if cb.State() != CircuitClosed {
+		t.Fatalf("got state %v, wanted closed", cb.State())
+	}
+	if _, _, err := cbp.Eval(bad); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("Eval() got error %v, wanted a division error", err)
+	}
+	if cb.State() != CircuitOpen {
+		t.Fatalf("got state %v, wanted open", cb.State())
+	}
+	if _, _, err := cbp.Eval(good); err != ErrCircuitOpen {
+		t.Errorf("Eval() got error %v, wanted ErrCircuitOpen", err)
+	}
+
+	// A failed trial reopens the circuit, and a successful trial closes it.
+	now = now.Add(time.Minute)
+	if cb.State() != CircuitHalfOpen {
+		t.Fatalf("got state %v, wanted half-open", cb.State())
+	}
+	cbp.Eval(bad)
+	if _, _, err := cbp.Eval(good); err != ErrCircuitOpen {
+		t.Errorf("Eval() got error %v, wanted ErrCircuitOpen", err)
+	}
+	now = now.Add(time.Minute)
+	out, _, err := cbp.Eval(good)
+	if err != nil || out != types.Int(5) {
+		t.Fatalf("Eval() got %v, %v, wanted 5", out, err)
+	}
+	if cb.State() != CircuitClosed {
+		t.Errorf("got state %v, wanted closed", cb.State())
+	}
+
+	want := []string{
+		"closed->open",
+		"open->half-open",
+		"half-open->open",
+		"open->half-open",
+		"half-open->closed",
+	}
+	if !reflect.DeepEqual(transitions, want) {
+		t.Errorf("got transitions %v, wanted %v", transitions, want)
+	}
+}
+
+func TestCircuitBreakerProgram_PanickingTrial(t *testing.T) {
+	cb := NewCircuitBreaker(1, time.Minute)
+	now := time.Now()
+	cb.now = func() time.Time { return now }
+	cbp := cb.Wrap(panicProgram{})
+	eval := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		_, _, err = cbp.Eval(NoVars())
+		return err
+	}
+	if err := eval(); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("Eval() got error %v, wanted a panic", err)
+	}
+	if cb.State() != CircuitOpen {
+		t.Fatalf("got state %v, wanted open", cb.State())
+	}
+
+	// A panicking trial reopens the circuit, and a trial is attempted again after the reset.
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Minute)
+		if err := eval(); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("trial #%d got error %v, wanted a panic", i, err)
+		}
+		if cb.State() != CircuitOpen {
+			t.Fatalf("got state %v after trial #%d, wanted open", cb.State(), i)
+		}
+	}
+}
+
+// panicProgram is a Program whose evaluations panic.
+type panicProgram struct{}
+
+func (panicProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	panic("evaluation failed")
+}
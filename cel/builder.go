@@ -0,0 +1,259 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/walk"
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// CheckedExprBuilder constructs type-annotated expressions without running the type-checker.
+//
+// The builder is intended for expressions which are known to be correct. Identifier and field
+// selection types are supplied by the caller, while the result type of each call is determined
+// from the function declarations of the Env.
+type CheckedExprBuilder struct {
+	env     *Env
+	nextID  int64
+	root    *exprpb.Expr
+	typeMap map[int64]*exprpb.Type
+	refMap  map[int64]*exprpb.Reference
+	errs    []error
+}
+
+// NewCheckedExprBuilder creates a CheckedExprBuilder which resolves function overloads using the
+// declarations of the given environment.
+func NewCheckedExprBuilder(env *Env) *CheckedExprBuilder {
+	return &CheckedExprBuilder{
+		env:     env,
+		nextID:  1,
+		typeMap: map[int64]*exprpb.Type{},
+		refMap:  map[int64]*exprpb.Reference{},
+	}
+}
+
+// AddIdent returns an identifier expression of the given type.
+func (b *CheckedExprBuilder) AddIdent(name string, t *exprpb.Type) *exprpb.Expr {
+	e := &exprpb.Expr{
+		Id: b.id(),
+		ExprKind: &exprpb.Expr_IdentExpr{
+			IdentExpr: &exprpb.Expr_Ident{Name: name},
+		},
+	}
+	b.setType(e, t)
+	b.refMap[e.GetId()] = &exprpb.Reference{Name: name}
+	return e
+}
+
+// AddSelect returns an expression which selects the field of the given type from the operand.
+func (b *CheckedExprBuilder) AddSelect(operand *exprpb.Expr,
+	field string, t *exprpb.Type) *exprpb.Expr {
+	e := &exprpb.Expr{
+		Id: b.id(),
+		ExprKind: &exprpb.Expr_SelectExpr{
+			SelectExpr: &exprpb.Expr_Select{Operand: operand, Field: field},
+		},
+	}
+	b.setType(e, t)
+	return e
+}
+
+// AddCall returns a call of the function with the given arguments.
+//
+// The overload is resolved from the types of the arguments. When the resolved overload is an
+// instance function, the first argument is used as the call target. Failures to resolve an
+// overload are reported by Build.
+func (b *CheckedExprBuilder) AddCall(fn string, args ...*exprpb.Expr) *exprpb.Expr {
+	e := &exprpb.Expr{Id: b.id()}
+	call := &exprpb.Expr_Call{Function: fn, Args: args}
+	e.ExprKind = &exprpb.Expr_CallExpr{CallExpr: call}
+
+	argTypes := make([]*exprpb.Type, len(args))
+	for i, arg := range args {
+		argTypes[i] = b.typeMap[arg.GetId()]
+		if argTypes[i] == nil {
+			b.errs = append(b.errs,
+				fmt.Errorf("argument %d of call to '%s' has no type", i, fn))
+			return e
+		}
+	}
+	ov, resultType := b.resolveOverload(fn, argTypes)
+	if ov == nil {
+		b.errs = append(b.errs, fmt.Errorf("no matching overload for '%s'", fn))
+		return e
+	}
+	if ov.GetIsInstanceFunction() {
+		call.Target = args[0]
+		call.Args = args[1:]
+	}
+	b.typeMap[e.GetId()] = resultType
+	b.refMap[e.GetId()] = &exprpb.Reference{OverloadId: []string{ov.GetOverloadId()}}
+	return e
+}
+
+// SetRoot sets the root of the expression to build.
+func (b *CheckedExprBuilder) SetRoot(e *exprpb.Expr) {
+	b.root = e
+}
+
+// Build returns the checked expression rooted at the expression given to SetRoot.
+//
+// Build fails if any call could not be resolved, if an expression id appears more than once
+// within the expression, or if any expression has no type.
+func (b *CheckedExprBuilder) Build() (*exprpb.CheckedExpr, error) {
+	if len(b.errs) != 0 {
+		return nil, b.errs[0]
+	}
+	if b.root == nil {
+		return nil, errors.New("no root expression set")
+	}
+	seen := map[int64]bool{}
+	typeMap := map[int64]*exprpb.Type{}
+	refMap := map[int64]*exprpb.Reference{}
+	var err error
+	walk.PreOrder(b.root, func(e *exprpb.Expr) bool {
+		if err != nil {
+			return false
+		}
+		id := e.GetId()
+		if seen[id] {
+			err = fmt.Errorf("expression id %d is not unique", id)
+			return false
+		}
+		seen[id] = true
+		t, found := b.typeMap[id]
+		if !found {
+			err = fmt.Errorf("expression id %d has no type", id)
+			return false
+		}
+		typeMap[id] = t
+		if ref, found := b.refMap[id]; found {
+			refMap[id] = ref
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &exprpb.CheckedExpr{
+		Expr:         b.root,
+		TypeMap:      typeMap,
+		ReferenceMap: refMap,
+		SourceInfo:   &exprpb.SourceInfo{},
+	}, nil
+}
+
+func (b *CheckedExprBuilder) id() int64 {
+	id := b.nextID
+	b.nextID++
+	return id
+}
+
+func (b *CheckedExprBuilder) setType(e *exprpb.Expr, t *exprpb.Type) {
+	if t != nil {
+		b.typeMap[e.GetId()] = t
+	}
+}
+
+// resolveOverload returns the first overload of the function whose parameters accept the
+// argument types, along with the overload's result type.
+func (b *CheckedExprBuilder) resolveOverload(fn string,
+	argTypes []*exprpb.Type) (*exprpb.Decl_FunctionDecl_Overload, *exprpb.Type) {
+	for _, d := range b.env.declarations {
+		if d.GetName() != fn || d.GetFunction() == nil {
+			continue
+		}
+		for _, ov := range d.GetFunction().GetOverloads() {
+			params := ov.GetParams()
+			if len(params) != len(argTypes) {
+				continue
+			}
+			bindings := map[string]*exprpb.Type{}
+			matched := true
+			for i, param := range params {
+				if !bindType(param, argTypes[i], bindings) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return ov, substituteType(ov.GetResultType(), bindings)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// bindType reports whether an argument of type arg may be passed to a parameter of type param,
+// recording the bindings of any type parameters.
+func bindType(param, arg *exprpb.Type, bindings map[string]*exprpb.Type) bool {
+	if name := param.GetTypeParam(); name != "" {
+		if bound, found := bindings[name]; found {
+			return proto.Equal(bound, arg) || isDyn(bound) || isDyn(arg)
+		}
+		bindings[name] = arg
+		return true
+	}
+	if isDyn(param) || isDyn(arg) {
+		return true
+	}
+	switch param.GetTypeKind().(type) {
+	case *exprpb.Type_ListType_:
+		if arg.GetListType() == nil {
+			return false
+		}
+		return bindType(param.GetListType().GetElemType(), arg.GetListType().GetElemType(),
+			bindings)
+	case *exprpb.Type_MapType_:
+		if arg.GetMapType() == nil {
+			return false
+		}
+		return bindType(param.GetMapType().GetKeyType(), arg.GetMapType().GetKeyType(),
+			bindings) &&
+			bindType(param.GetMapType().GetValueType(), arg.GetMapType().GetValueType(),
+				bindings)
+	}
+	return proto.Equal(param, arg)
+}
+
+// substituteType replaces the type parameters within t with their bindings, or with dyn when a
+// type parameter is unbound.
+func substituteType(t *exprpb.Type, bindings map[string]*exprpb.Type) *exprpb.Type {
+	switch t.GetTypeKind().(type) {
+	case *exprpb.Type_TypeParam:
+		if bound, found := bindings[t.GetTypeParam()]; found {
+			return bound
+		}
+		return decls.Dyn
+	case *exprpb.Type_ListType_:
+		return decls.NewListType(substituteType(t.GetListType().GetElemType(), bindings))
+	case *exprpb.Type_MapType_:
+		return decls.NewMapType(
+			substituteType(t.GetMapType().GetKeyType(), bindings),
+			substituteType(t.GetMapType().GetValueType(), bindings))
+	}
+	return t
+}
+
+func isDyn(t *exprpb.Type) bool {
+	return t.GetDyn() != nil
+}
+
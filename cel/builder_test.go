@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestCheckedExprBuilder(t *testing.T) {
+	env, _ := NewEnv()
+	b := NewCheckedExprBuilder(env)
+	items := b.AddIdent("items", decls.NewListType(decls.String))
+	count := b.AddIdent("count", decls.Int)
+	name := b.AddIdent("name", decls.String)
+	prefix := b.AddIdent("prefix", decls.String)
+	b.SetRoot(b.AddCall(operators.LogicalAnd,
+		b.AddCall(operators.Greater, b.AddCall("size", items), count),
+		b.AddCall("startsWith", name, prefix)))
+	checked, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	ast := CheckedExprToAst(checked)
+	if !proto.Equal(ast.ResultType(), decls.Bool) {
+		t.Errorf("got result type %v, wanted bool", ast.ResultType())
+	}
+	startsWith := checked.GetExpr().GetCallExpr().GetArgs()[1].GetCallExpr()
+	if startsWith.GetTarget().GetIdentExpr().GetName() != "name" {
+		t.Errorf("got target %v, wanted name", startsWith.GetTarget())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("env.Program() failed: %v", err)
+	}
+	out, _, err := prg.Eval(map[string]interface{}{
+		"items":  []string{"a", "b"},
+		"count":  1,
+		"name":   "alice",
+		"prefix": "al",
+	})
+	if err != nil || out != types.True {
+		t.Errorf("prg.Eval() got %v, %v, wanted true", out, err)
+	}
+}
+
+func TestCheckedExprBuilderErrors(t *testing.T) {
+	env, _ := NewEnv()
+	tests := []struct {
+		name  string
+		build func(b *CheckedExprBuilder) *exprpb.Expr
+	}{
+		{
+			name:  "no root",
+			build: func(b *CheckedExprBuilder) *exprpb.Expr { return nil },
+		},
+		{
+			name: "duplicate id",
+			build: func(b *CheckedExprBuilder) *exprpb.Expr {
+				x := b.AddIdent("x", decls.Int)
+				return b.AddCall(operators.Add, x, x)
+			},
+		},
+		{
+			name: "missing type",
+			build: func(b *CheckedExprBuilder) *exprpb.Expr {
+				return b.AddSelect(b.AddIdent("x", decls.Dyn), "y", nil)
+			},
+		},
+		{
+			name: "no matching overload",
+			build: func(b *CheckedExprBuilder) *exprpb.Expr {
+				return b.AddCall(operators.Add, b.AddIdent("x", decls.Int),
+					b.AddIdent("y", decls.String))
+			},
+		},
+	}
+	for _, tc := range tests {
+		b := NewCheckedExprBuilder(env)
+		b.SetRoot(tc.build(b))
+		if _, err := b.Build(); err == nil {
+			t.Errorf("%s: Build() succeeded, wanted error", tc.name)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bulk loads corpora of checked CEL expressions, such as the policies of a deployment,
+// from archives produced by a build step.
+package bulk
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Import reads a gzip-compressed tar archive in which each regular file holds a serialized
+// CheckedExpr, and returns a map from expression id to Program. The id of an expression is the
+// base name of its file without the extension, so `policies/allow_admin.pb` has the id
+// `allow_admin`.
+//
+// Each expression is checked again against the environment, so expressions which refer to
+// identifiers or functions which are no longer declared, or whose result type has changed, are
+// rejected. Failures for individual expressions do not prevent other expressions from being
+// loaded: the programs which were validated successfully are returned alongside a cel.LoadErrors
+// value which records the failures by expression id. An archive which cannot be read is reported
+// as a plain error, together with the programs loaded before the failure.
+func Import(r io.Reader, env *cel.Env) (map[string]cel.Program, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	progs := make(map[string]cel.Program)
+	errs := make(cel.LoadErrors)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return progs, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		base := path.Base(hdr.Name)
+		id := strings.TrimSuffix(base, path.Ext(base))
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return progs, err
+		}
+		if _, found := progs[id]; found {
+			errs[id] = fmt.Errorf("duplicate expression id in %s", hdr.Name)
+			delete(progs, id)
+			continue
+		}
+		if _, found := errs[id]; found {
+			continue
+		}
+		prg, err := load(env, data)
+		if err != nil {
+			errs[id] = err
+			continue
+		}
+		progs[id] = prg
+	}
+	if len(errs) != 0 {
+		return progs, errs
+	}
+	return progs, nil
+}
+
+// load decodes a CheckedExpr, checks it again against the environment, and plans it.
+func load(env *cel.Env, data []byte) (cel.Program, error) {
+	var checked exprpb.CheckedExpr
+	if err := proto.Unmarshal(data, &checked); err != nil {
+		return nil, err
+	}
+	if checked.GetExpr() == nil {
+		return nil, errors.New("missing expression")
+	}
+	parsed := cel.ParsedExprToAst(&exprpb.ParsedExpr{
+		Expr:       checked.GetExpr(),
+		SourceInfo: checked.GetSourceInfo(),
+	})
+	ast, iss := env.Check(parsed)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if want := cel.CheckedExprToAst(&checked).ResultType(); want != nil &&
+		!proto.Equal(ast.ResultType(), want) {
+		return nil, fmt.Errorf("result type changed from %s to %s",
+			checker.FormatCheckedType(want), checker.FormatCheckedType(ast.ResultType()))
+	}
+	return env.Program(ast)
+}
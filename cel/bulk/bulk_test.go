@@ -0,0 +1,118 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulk
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestImport(t *testing.T) {
+	// The expressions are checked by an older environment which also declares `legacy`, and
+	// which declares `x` as an int rather than a string.
+	oldEnv, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("user", decls.String),
+		decls.NewVar("legacy", decls.Bool),
+		decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("user", decls.String),
+		decls.NewVar("x", decls.String)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	writeFile := func(name string, data []byte) {
+		if err := tw.WriteHeader(&tar.Header{
+			Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeExpr := func(name, expr string) {
+		ast, iss := oldEnv.Compile(expr)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		checked, err := cel.AstToCheckedExpr(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := proto.Marshal(checked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(name, data)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "policies/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	writeExpr("policies/is_admin.pb", `user == "admin"`)
+	writeExpr("policies/any_admin.pb", `[user, "root"].exists(u, u == "admin")`)
+	writeExpr("policies/uses_legacy.pb", `legacy && user == "admin"`)
+	writeExpr("policies/retyped.pb", `x`)
+	writeFile("policies/corrupt.pb", []byte{0xff, 0xff, 0xff})
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	progs, err := Import(&buf, env)
+	loadErrs, isLoadErrs := err.(cel.LoadErrors)
+	if !isLoadErrs {
+		t.Fatalf("got error %v, wanted cel.LoadErrors", err)
+	}
+	for _, id := range []string{"uses_legacy", "retyped", "corrupt"} {
+		if loadErrs[id] == nil {
+			t.Errorf("got no error for %s, wanted a validation error", id)
+		}
+	}
+	if len(progs) != 2 || len(loadErrs) != 3 {
+		t.Fatalf("got %d programs and errors %v, wanted 2 programs and 3 errors", len(progs), err)
+	}
+	for _, id := range []string{"is_admin", "any_admin"} {
+		prg, found := progs[id]
+		if !found {
+			t.Fatalf("got no program for %s", id)
+		}
+		out, _, err := prg.Eval(map[string]interface{}{"user": "admin"})
+		if err != nil || out != types.True {
+			t.Errorf("%s: got %v, %v, wanted true", id, out, err)
+		}
+	}
+}
+
+func TestImport_NotGzip(t *testing.T) {
+	if _, err := Import(bytes.NewReader([]byte("not an archive")), nil); err == nil {
+		t.Error("got no error, wanted a gzip error")
+	}
+}
@@ -15,13 +15,16 @@
 package cel
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"reflect"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/google/cel-go/checker"
 	"github.com/google/cel-go/checker/decls"
 	"github.com/google/cel-go/common"
 	"github.com/google/cel-go/common/operators"
@@ -33,6 +36,8 @@ import (
 	"github.com/google/cel-go/interpreter/functions"
 	"github.com/google/cel-go/parser"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -415,6 +420,32 @@ func TestHomogeneousAggregateLiterals(t *testing.T) {
 	})
 }
 
+func TestJSONNameMapping(t *testing.T) {
+	reg, err := types.NewRegistryWithOptions(
+		[]types.TypeProviderOption{types.WithJSONNameMapping()}, &proto3pb.TestAllTypes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEnv(
+		CustomTypeAdapter(reg),
+		CustomTypeProvider(reg),
+		Container("google.expr.proto3.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := e.Compile(`TestAllTypes{singleInt64: 7}.singleInt64 == 7`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := e.Program(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _, err := prg.Eval(NoVars()); out != types.True {
+		t.Errorf("got %v, %v, wanted true", out, err)
+	}
+}
+
 func TestCustomTypes(t *testing.T) {
 	exprType := decls.NewObjectType("google.api.expr.v1alpha1.Expr")
 	reg := types.NewEmptyRegistry()
@@ -1239,3 +1270,486 @@ func TestResidualAst_Modified(t *testing.T) {
 		}
 	}
 }
+
+func TestListEnumValues(t *testing.T) {
+	env, err := NewEnv(
+		Container("google.expr.proto3.test"),
+		Types(&proto3pb.TestAllTypes{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ref.EnumValue{
+		{Name: "FOO", Number: 0},
+		{Name: "BAR", Number: 1},
+		{Name: "BAZ", Number: 2},
+	}
+	for _, name := range []string{
+		"TestAllTypes.NestedEnum",
+		"google.expr.proto3.test.TestAllTypes.NestedEnum",
+	} {
+		got := env.ListEnumValues(name)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ListEnumValues(%q) got %v, wanted %v", name, got, want)
+		}
+	}
+	if got := env.ListEnumValues("TestAllTypes"); len(got) != 0 {
+		t.Errorf("ListEnumValues() got %v for a message type, wanted none", got)
+	}
+}
+
+func TestCheckerMiddleware(t *testing.T) {
+	var idents []string
+	collect := checker.MiddlewareFunc(func(next checker.CheckFn) checker.CheckFn {
+		return func(e *exprpb.Expr) {
+			if ident := e.GetIdentExpr(); ident != nil {
+				idents = append(idents, ident.GetName())
+			}
+			next(e)
+		}
+	})
+	env, err := NewEnv(
+		Declarations(decls.NewVar("a", decls.Int), decls.NewVar("b", decls.Int)),
+		CheckerMiddleware(collect))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := env.Extend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, iss := ext.Compile(`a + b`); iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	if !reflect.DeepEqual(idents, []string{"a", "b"}) {
+		t.Errorf("got idents %v, wanted [a b]", idents)
+	}
+}
+
+// countingSpan records the attributes of a span. The remaining trace.Span methods are those of a
+// no-op span.
+type countingSpan struct {
+	trace.Span
+	attrs map[attribute.Key]attribute.Value
+}
+
+func (s *countingSpan) SetAttributes(kvs ...attribute.KeyValue) {
+	for _, kv := range kvs {
+		s.attrs[kv.Key] = kv.Value
+	}
+}
+
+type countingTracer struct {
+	spans []*countingSpan
+}
+
+func (t *countingTracer) Start(ctx context.Context, name string,
+	opts ...trace.SpanOption) (context.Context, trace.Span) {
+	span := &countingSpan{
+		Span:  trace.SpanFromContext(context.Background()),
+		attrs: map[attribute.Key]attribute.Value{},
+	}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func TestExpressionTracer(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("l", decls.NewListType(decls.Int))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`l.filter(x, x > 1).size() == 2`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	tracer := &countingTracer{}
+	prg, err := env.Program(ast, ExpressionTracer(tracer, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, err := interpreter.NewActivation(map[string]interface{}{"l": []int{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := prg.Eval(interpreter.NewContextActivation(context.Background(), vars))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+	if len(tracer.spans) != 1 ||
+		tracer.spans[0].attrs[interpreter.AttrComprehensionIterations].AsInt64() != 3 {
+		t.Errorf("got spans %v, wanted one span with three iterations", tracer.spans)
+	}
+}
+
+func TestInterpreterStats(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("l", decls.NewListType(decls.Int))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`l.exists(x, x > 1)`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	stats := interpreter.NewStats()
+	for _, opt := range []EvalOption{OptOptimize, OptExhaustiveEval} {
+		prg, err := env.Program(ast, EvalOptions(opt), InterpreterStats(stats))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, _, err := prg.Eval(map[string]interface{}{"l": []int{1, 2, 3}}); out != types.True {
+			t.Fatalf("got %v, %v, wanted true", out, err)
+		}
+	}
+	snap := stats.Snapshot()
+	if snap.TotalEvals != 2 || snap.ComprehensionEvals != 2 || snap.ShortCircuits != 1 {
+		t.Errorf("got snapshot %+v", snap)
+	}
+}
+
+func TestExpressionContextFunctions(t *testing.T) {
+	type ctxKey struct{}
+	env, err := NewEnv(Declarations(
+		decls.NewVar("name", decls.String),
+		decls.NewFunction("greet",
+			decls.NewOverload("greet_string", []*exprpb.Type{decls.String}, decls.String))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`greet(name)`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast, ExpressionContextFunctions(map[string]functions.ContextFunctionOp{
+		"greet": func(ctx context.Context, args ...ref.Val) ref.Val {
+			greeting, _ := ctx.Value(ctxKey{}).(string)
+			return types.String(greeting + ", " + string(args[0].(types.String)))
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, greeting := range []string{"hello", "goodbye"} {
+		vars, err := interpreter.NewActivation(map[string]interface{}{"name": "world"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.WithValue(context.Background(), ctxKey{}, greeting)
+		out, _, err := prg.Eval(interpreter.NewContextActivation(ctx, vars))
+		if want := types.String(greeting + ", world"); out != want {
+			t.Errorf("got %v, %v, wanted %v", out, err, want)
+		}
+	}
+}
+
+func TestWrapStats(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`10 / x`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := interpreter.NewStats()
+	sp := WrapStats(stats, prg)
+	if deps, _ := ProgramDependencies(sp); !reflect.DeepEqual(deps, []string{"x"}) {
+		t.Errorf("got dependencies %v, wanted [x]", deps)
+	}
+	if out, _, err := sp.Eval(map[string]interface{}{"x": 2}); out != types.Int(5) {
+		t.Fatalf("got %v, %v, wanted 5", out, err)
+	}
+	if _, _, err := sp.Eval(map[string]interface{}{"x": 0}); err == nil {
+		t.Fatal("got no error for a division by zero")
+	}
+	if snap := stats.Snapshot(); snap.TotalEvals != 2 || snap.ErrorReturns != 1 {
+		t.Errorf("got snapshot %+v, wanted 2 evaluations and 1 error", snap)
+	}
+
+	// Programs which already count into the stats are not counted a second time.
+	stats.Reset()
+	prg, err = env.Program(ast, InterpreterStats(stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := WrapStats(stats, prg).Eval(map[string]interface{}{"x": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if snap := stats.Snapshot(); snap.TotalEvals != 1 {
+		t.Errorf("got %d evaluations, wanted 1", snap.TotalEvals)
+	}
+}
+
+type recordingMetricsHook struct {
+	interpreter.NopMetricsHook
+	hashes     []uint64
+	errs       []error
+	iterations []int
+	calls      map[string]int
+}
+
+func (h *recordingMetricsHook) RecordEval(exprHash uint64, duration time.Duration, err error) {
+	h.hashes = append(h.hashes, exprHash)
+	h.errs = append(h.errs, err)
+}
+
+func (h *recordingMetricsHook) RecordComprehension(exprID int64, iterations int) {
+	h.iterations = append(h.iterations, iterations)
+}
+
+func (h *recordingMetricsHook) RecordFunctionCall(name string, duration time.Duration) {
+	h.calls[name]++
+}
+
+func TestInterpreterMetricsHook(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("l", decls.NewListType(decls.Int))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`l.exists(x, x > 1)`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	hook := &recordingMetricsHook{calls: map[string]int{}}
+	prg, err := env.Program(ast, InterpreterMetricsHook(hook))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _, err := prg.Eval(map[string]interface{}{"l": []int{1, 2, 3}}); out != types.True {
+		t.Fatalf("got %v, %v, wanted true", out, err)
+	}
+	if _, _, err := prg.Eval(map[string]interface{}{}); err == nil {
+		t.Fatal("got no error, wanted an error for the missing variable")
+	}
+	hash := HashExpression(ast)
+	if len(hook.hashes) != 2 || hook.hashes[0] != hash || hook.hashes[1] != hash {
+		t.Errorf("got hashes %v, wanted two of %d", hook.hashes, hash)
+	}
+	if hook.errs[0] != nil || hook.errs[1] == nil {
+		t.Errorf("got errors %v, wanted nil then an error", hook.errs)
+	}
+	if !reflect.DeepEqual(hook.iterations, []int{2}) {
+		t.Errorf("got iterations %v, wanted [2]", hook.iterations)
+	}
+	if hook.calls[operators.Greater] != 2 {
+		t.Errorf("got calls %v, wanted 2 calls to %s", hook.calls, operators.Greater)
+	}
+}
+
+func TestSubExprDeduplication(t *testing.T) {
+	env, err := NewEnv(
+		Declarations(
+			decls.NewVar("x", decls.Int),
+			decls.NewFunction("twice",
+				decls.NewOverload("twice_int", []*exprpb.Type{decls.Int}, decls.Int))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`twice(x) > 2 && twice(x) < 10`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	var calls int
+	twice := &functions.Overload{
+		Operator: "twice_int",
+		Unary: func(arg ref.Val) ref.Val {
+			calls++
+			return arg.(types.Int) * 2
+		},
+	}
+	prg, err := env.Program(ast, Functions(twice), SubExprDeduplication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _, err := prg.Eval(map[string]interface{}{"x": 2}); out != types.True {
+		t.Fatalf("got %v, %v, wanted true", out, err)
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls, wanted 1", calls)
+	}
+}
+
+func TestReplayProtection(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`x > 0`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	store := &nonceStore{seen: map[string]bool{}}
+	for _, opt := range []EvalOption{OptOptimize, OptExhaustiveEval} {
+		prg, err := env.Program(ast, EvalOptions(opt), ReplayProtection(store, []byte("secret")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, _, err := prg.Eval(map[string]interface{}{"x": int(opt)}); out != types.True {
+			t.Fatalf("got %v, %v, wanted true", out, err)
+		}
+		out, _, err := prg.Eval(map[string]interface{}{"x": int(opt)})
+		if e, isErr := err.(*types.Err); !isErr || e.Value() != interpreter.ErrReplay {
+			t.Errorf("got %v, %v, wanted ErrReplay", out, err)
+		}
+	}
+	if _, err := env.Program(ast, ReplayProtection(store, nil)); err == nil {
+		t.Error("ReplayProtection() with an empty secret created a program, wanted an error")
+	}
+
+	env, err = NewEnv(Declarations(decls.NewVar("a", decls.NewMapType(decls.String, decls.Int))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expr := range []string{`a.b`, `a['b']`} {
+		ast, iss := env.Compile(expr)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		prg, err := env.Program(ast, ReplayProtection(store, []byte("secret")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vars := map[string]interface{}{"a": map[string]int{"b": 1}}
+		if out, _, err := prg.Eval(vars); out != types.Int(1) {
+			t.Fatalf("%s: got %v, %v, wanted 1", expr, out, err)
+		}
+		out, _, err := prg.Eval(vars)
+		if e, isErr := err.(*types.Err); !isErr || e.Value() != interpreter.ErrReplay {
+			t.Errorf("%s: got %v, %v, wanted ErrReplay", expr, out, err)
+		}
+	}
+}
+
+func TestExpressionIsolation(t *testing.T) {
+	env, err := NewEnv(
+		Declarations(
+			decls.NewVar("x", decls.Int),
+			decls.NewFunction("wait",
+				decls.NewOverload("wait_int", []*exprpb.Type{decls.Int}, decls.Bool))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`[1, 2].exists(y, y == x) || wait(x)`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	wait := &functions.Overload{
+		Operator: "wait_int",
+		Unary: func(arg ref.Val) ref.Val {
+			time.Sleep(time.Duration(arg.(types.Int)) * time.Millisecond)
+			return types.True
+		},
+	}
+	for _, opt := range []EvalOption{OptOptimize, OptExhaustiveEval} {
+		prg, err := env.Program(ast, Functions(wait), EvalOptions(opt),
+			ExpressionIsolation(50*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, _, err := prg.Eval(map[string]interface{}{"x": 1}); out != types.True {
+			t.Errorf("got %v, %v, wanted true", out, err)
+		}
+		out, _, err := prg.Eval(map[string]interface{}{"x": 200})
+		if e, isErr := out.(*types.Err); !isErr ||
+			interpreter.ErrorCodeOf(e) != interpreter.ErrIsolationTimeout {
+			t.Errorf("got %v, %v, wanted an isolation timeout", out, err)
+		}
+	}
+}
+
+func TestExpressionInterpreterSampler(t *testing.T) {
+	env, err := NewEnv(Declarations(
+		decls.NewVar("x", decls.Int),
+		decls.NewVar("id", decls.String)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`x > 0`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	for _, tst := range []struct {
+		rate float64
+		out  ref.Val
+	}{
+		{rate: 0, out: types.True},
+		{rate: 1, out: types.False},
+	} {
+		prg, err := env.Program(ast, ExpressionInterpreterSampler(tst.rate, types.True,
+			interpreter.WithDeterministicSampling("id")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _, err := prg.Eval(map[string]interface{}{"x": 0, "id": "req-1"})
+		if out != tst.out {
+			t.Errorf("rate %v: got %v, %v, wanted %v", tst.rate, out, err, tst.out)
+		}
+	}
+	if _, err := env.Program(ast, ExpressionInterpreterSampler(0.5, nil)); err == nil {
+		t.Error("got a program without a passthrough value, wanted an error")
+	}
+}
+
+type nonceStore struct {
+	seen map[string]bool
+}
+
+func (s *nonceStore) CheckAndStore(nonce string) (bool, error) {
+	if s.seen[nonce] {
+		return false, nil
+	}
+	s.seen[nonce] = true
+	return true, nil
+}
+
+func TestProgramDependencies(t *testing.T) {
+	env, err := NewEnv(Declarations(
+		decls.NewVar("x", decls.Int),
+		decls.NewVar("y", decls.Int),
+		decls.NewVar("z", decls.Int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compile := func(expr string, opts ...ProgramOption) Program {
+		t.Helper()
+		ast, iss := env.Compile(expr)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		prg, err := env.Program(ast, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return prg
+	}
+	primary := compile(`[1, 2].exists(i, i == x) || y > 0`)
+	exhaustive := compile(`z > x`, EvalOptions(OptExhaustiveEval))
+	for _, tst := range []struct {
+		prg  Program
+		deps []string
+	}{
+		{prg: primary, deps: []string{"x", "y"}},
+		{prg: exhaustive, deps: []string{"x", "z"}},
+		{prg: NewFallbackProgram(primary, exhaustive), deps: []string{"x", "y", "z"}},
+		{prg: NewTaggedProgram(exhaustive, nil), deps: []string{"x", "z"}},
+	} {
+		if deps, found := ProgramDependencies(tst.prg); !found || !reflect.DeepEqual(deps, tst.deps) {
+			t.Errorf("got %v, %v, wanted %v", deps, found, tst.deps)
+		}
+	}
+	if deps, found := ProgramDependencies(struct{ Program }{primary}); found {
+		t.Errorf("got dependencies %v for a program which does not report them", deps)
+	}
+	ast, iss := env.Compile(`x + y`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	if deps := ast.Dependencies(); !reflect.DeepEqual(deps, []string{"x", "y"}) {
+		t.Errorf("got Ast dependencies %v, wanted [x y]", deps)
+	}
+}
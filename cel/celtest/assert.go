@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package celtest provides helpers for writing table-driven tests of CEL expressions.
+package celtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// ExprAssert compiles and evaluates expressions against an environment, failing the test with
+// t.Fatalf when an expression does not compile, evaluate, or produce the expected result.
+type ExprAssert struct {
+	t   *testing.T
+	env *cel.Env
+}
+
+// NewExprAssert creates an ExprAssert which compiles expressions in the given environment.
+//
+// When the container is non-empty, identifiers are resolved relative to it in place of the
+// environment's own container.
+func NewExprAssert(t *testing.T, env *cel.Env, container string) *ExprAssert {
+	t.Helper()
+	if container != "" {
+		var err error
+		env, err = env.Extend(cel.Container(container))
+		if err != nil {
+			t.Fatalf("env.Extend(cel.Container(%q)) failed: %v", container, err)
+		}
+	}
+	return &ExprAssert{t: t, env: env}
+}
+
+// MustCheck parses and type-checks the expression, failing the test if either step reports an
+// error, and returns the checked Ast.
+func (a *ExprAssert) MustCheck(src string) *cel.Ast {
+	a.t.Helper()
+	ast, iss := a.env.Compile(src)
+	if iss.Err() != nil {
+		a.t.Fatalf("Compile(%q) failed: %v", src, iss.Err())
+	}
+	return ast
+}
+
+// CheckFails parses and type-checks the expression, failing the test unless compilation reports
+// an error which contains wantError.
+func (a *ExprAssert) CheckFails(src string, wantError string) {
+	a.t.Helper()
+	_, iss := a.env.Compile(src)
+	if iss.Err() == nil {
+		a.t.Fatalf("Compile(%q) succeeded, wanted error containing %q", src, wantError)
+	}
+	if !strings.Contains(iss.Err().Error(), wantError) {
+		a.t.Fatalf("Compile(%q) got error %v, wanted error containing %q",
+			src, iss.Err(), wantError)
+	}
+}
+
+// Eval compiles and evaluates the expression against the activation, failing the test if either
+// step reports an error, and returns the result.
+func (a *ExprAssert) Eval(src string, activation map[string]interface{}) ref.Val {
+	a.t.Helper()
+	ast := a.MustCheck(src)
+	prg, err := a.env.Program(ast)
+	if err != nil {
+		a.t.Fatalf("Program(%q) failed: %v", src, err)
+	}
+	if activation == nil {
+		activation = map[string]interface{}{}
+	}
+	out, _, err := prg.Eval(activation)
+	if err != nil {
+		a.t.Fatalf("Eval(%q) failed: %v", src, err)
+	}
+	return out
+}
+
+// EvalBool evaluates the expression as with Eval, failing the test if the result is not a bool.
+func (a *ExprAssert) EvalBool(src string, activation map[string]interface{}) bool {
+	a.t.Helper()
+	out := a.Eval(src, activation)
+	b, ok := out.(types.Bool)
+	if !ok {
+		a.t.Fatalf("Eval(%q) got %v of type %v, wanted bool", src, out, out.Type())
+	}
+	return bool(b)
+}
+
+// EvalEquals evaluates the expression as with Eval, failing the test unless the result has the
+// same type as want and is equal to it.
+func (a *ExprAssert) EvalEquals(src string, activation map[string]interface{}, want ref.Val) {
+	a.t.Helper()
+	out := a.Eval(src, activation)
+	if out.Type() != want.Type() || out.Equal(want) != types.True {
+		a.t.Fatalf("Eval(%q) got %v, wanted %v", src, out, want)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package celtest
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+)
+
+func TestExprAssert(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Declarations(
+			decls.NewVar("x", decls.Int),
+			decls.NewVar("acme.name", decls.String),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewExprAssert(t, env, "acme")
+	a.MustCheck(`x + 1`)
+	a.MustCheck(`name.startsWith('a')`)
+	a.CheckFails(`x + 'a'`, "found no matching overload for '_+_'")
+	a.CheckFails(`y`, "undeclared reference to 'y'")
+	a.EvalEquals(`x * 2`, map[string]interface{}{"x": 21}, types.Int(42))
+	a.EvalEquals(`[1, 2] + [3]`, nil, types.NewDynamicList(types.DefaultTypeAdapter, []int{1, 2, 3}))
+	if !a.EvalBool(`name == 'acme'`, map[string]interface{}{"acme.name": "acme"}) {
+		t.Error("EvalBool() got false, wanted true")
+	}
+	if out := a.Eval(`size(name)`, map[string]interface{}{"acme.name": "acme"}); out != types.Int(4) {
+		t.Errorf("Eval() got %v, wanted 4", out)
+	}
+}
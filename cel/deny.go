@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+// DefaultDenyProgram is a Program for default-deny policies, which evaluates to false rather than
+// an error when its expression refers to data which is absent from the input.
+type DefaultDenyProgram struct {
+	prg   Program
+	codes map[interpreter.ErrorCode]bool
+}
+
+// DefaultDenyOption configures a DefaultDenyProgram.
+type DefaultDenyOption func(*DefaultDenyProgram)
+
+// WithErrorsAsFalse sets the codes of the errors which the program reports as false, replacing
+// the default codes.
+func WithErrorsAsFalse(codes ...interpreter.ErrorCode) DefaultDenyOption {
+	return func(p *DefaultDenyProgram) {
+		p.codes = make(map[interpreter.ErrorCode]bool, len(codes))
+		for _, code := range codes {
+			p.codes[code] = true
+		}
+	}
+}
+
+// NewDefaultDenyProgram wraps the program so that errors with the codes ErrNoSuchKey,
+// ErrNoSuchField, and ErrUndeclaredIdent, or those set by WithErrorsAsFalse, evaluate to false.
+func NewDefaultDenyProgram(prg Program, opts ...DefaultDenyOption) *DefaultDenyProgram {
+	p := &DefaultDenyProgram{prg: prg}
+	WithErrorsAsFalse(
+		interpreter.ErrNoSuchKey,
+		interpreter.ErrNoSuchField,
+		interpreter.ErrUndeclaredIdent)(p)
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Eval implements the Program interface method, returning false in place of an error whose code
+// is one of the program's codes. Error codes are determined by interpreter.ErrorCodeOf.
+//
+// When errors have been aggregated with interpreter.WithErrorAggregation, the result is false only
+// if every aggregated error has one of the codes. Other errors are returned unchanged.
+func (p *DefaultDenyProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	out, det, err := p.prg.Eval(vars)
+	if err != nil && p.denies(err) {
+		return types.False, det, nil
+	}
+	return out, det, err
+}
+
+// Program returns the underlying program.
+func (p *DefaultDenyProgram) Program() Program {
+	return p.prg
+}
+
+func (p *DefaultDenyProgram) denies(err error) bool {
+	if e, isErr := err.(*types.Err); isErr {
+		if agg, isAgg := e.Value().(*interpreter.AggregatedError); isAgg {
+			for _, evalErr := range agg.Errors() {
+				if !p.codes[interpreter.ErrorCodeOf(evalErr)] {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return p.codes[interpreter.ErrorCodeOf(err)]
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+
+	proto3pb "github.com/google/cel-go/test/proto3pb"
+)
+
+func TestDefaultDenyProgram(t *testing.T) {
+	env, err := NewEnv(
+		Types(&proto3pb.TestAllTypes{}),
+		Declarations(
+			decls.NewVar("request", decls.NewMapType(decls.String, decls.Dyn)),
+			decls.NewVar("msg", decls.Dyn),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr    string
+		parse   bool
+		codes   []interpreter.ErrorCode
+		vars    map[string]interface{}
+		want    ref.Val
+		wantErr string
+	}{
+		{
+			expr: `request.user == 'admin'`,
+			vars: map[string]interface{}{"request": map[string]interface{}{"user": "admin"}},
+			want: types.True,
+		},
+		{
+			expr: `request.user == 'admin'`,
+			vars: map[string]interface{}{"request": map[string]interface{}{}},
+			want: types.False,
+		},
+		{
+			expr: `msg.no_such_field == 1`,
+			vars: map[string]interface{}{"msg": &proto3pb.TestAllTypes{}},
+			want: types.False,
+		},
+		{
+			expr:  `undeclared == 1`,
+			parse: true,
+			vars:  map[string]interface{}{},
+			want:  types.False,
+		},
+		{
+			expr:    `1 / request.zero == 1`,
+			vars:    map[string]interface{}{"request": map[string]interface{}{"zero": 0}},
+			wantErr: "divide by zero",
+		},
+		{
+			expr:    `undeclared == 1`,
+			parse:   true,
+			codes:   []interpreter.ErrorCode{interpreter.ErrNoSuchKey},
+			vars:    map[string]interface{}{},
+			wantErr: "no such attribute",
+		},
+	}
+	for _, tc := range tests {
+		var ast *Ast
+		var iss *Issues
+		if tc.parse {
+			ast, iss = env.Parse(tc.expr)
+		} else {
+			ast, iss = env.Compile(tc.expr)
+		}
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var opts []DefaultDenyOption
+		if tc.codes != nil {
+			opts = append(opts, WithErrorsAsFalse(tc.codes...))
+		}
+		out, _, err := NewDefaultDenyProgram(prg, opts...).Eval(tc.vars)
+		if tc.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				t.Errorf("Eval(%q) got %v, %v, wanted error %s", tc.expr, out, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Eval(%q) failed: %v", tc.expr, err)
+		} else if out != tc.want {
+			t.Errorf("Eval(%q) got %v, wanted %v", tc.expr, out, tc.want)
+		}
+	}
+}
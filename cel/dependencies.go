@@ -0,0 +1,104 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"sort"
+
+	"github.com/google/cel-go/common/walk"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// DependencyReporter is implemented by Programs which report the variables referenced by their
+// expressions. Programs created by Env.Program implement it.
+type DependencyReporter interface {
+	// Dependencies returns the sorted names of the variables referenced by the program's
+	// expression, excluding comprehension variables.
+	//
+	// When the Ast has been checked, variables are reported by their fully qualified names.
+	Dependencies() []string
+}
+
+// ProgramDependencies returns the dependencies of a program which implements DependencyReporter,
+// looking through the wrappers which return their underlying program. The boolean result is
+// false when no dependencies are reported.
+func ProgramDependencies(prg Program) ([]string, bool) {
+	for {
+		switch p := prg.(type) {
+		case DependencyReporter:
+			return p.Dependencies(), true
+		case interface{ Program() Program }:
+			prg = p.Program()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// Dependencies returns the sorted names of the variables referenced by the expression, as
+// described by DependencyReporter.
+func (ast *Ast) Dependencies() []string {
+	return dependencies(ast)
+}
+
+// dependencies returns the sorted, de-duplicated names of the free variables referenced within
+// the Ast.
+//
+// Identifiers bound by comprehensions are excluded. When the Ast has been checked, identifiers
+// are reported by their fully qualified names, and identifiers which resolve to constants, enum
+// values, or type names are excluded.
+func dependencies(ast *Ast) []string {
+	names := map[string]struct{}{}
+	walk.Scoped(ast.Expr(), func(e *exprpb.Expr, scope walk.Scope) bool {
+		ident := e.GetIdentExpr()
+		if ident == nil || scope.Bound(ident.GetName()) {
+			return true
+		}
+		if ref, found := ast.refMap[e.GetId()]; found && ref.GetValue() != nil {
+			return true
+		}
+		if t, found := ast.typeMap[e.GetId()]; found && t.GetType() != nil {
+			return true
+		}
+		names[ident.GetName()] = struct{}{}
+		return true
+	})
+	deps := make([]string, 0, len(names))
+	for name := range names {
+		deps = append(deps, name)
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+// mergeProgramDependencies returns the sorted union of the dependencies reported by two programs.
+func mergeProgramDependencies(x, y Program) []string {
+	a, _ := ProgramDependencies(x)
+	b, _ := ProgramDependencies(y)
+	merged := make([]string, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			merged, a = append(merged, a[0]), a[1:]
+		case b[0] < a[0]:
+			merged, b = append(merged, b[0]), b[1:]
+		default:
+			merged, a, b = append(merged, a[0]), a[1:], b[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// ExpressionDoc holds human-readable documentation describing the intent of an expression.
+//
+// The Expression is not serialized to JSON. Programs must be re-attached to documentation which
+// has been restored from JSON before the documented program can be evaluated.
+type ExpressionDoc struct {
+	Expression  Program   `json:"-"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// DocumentedProgram is a Program which carries an ExpressionDoc.
+type DocumentedProgram struct {
+	doc ExpressionDoc
+}
+
+// NewDocumented associates the documentation with the program.
+//
+// The `prog` value takes precedence over any Expression already set on the `doc`.
+func NewDocumented(prog Program, doc ExpressionDoc) *DocumentedProgram {
+	doc.Expression = prog
+	return &DocumentedProgram{doc: doc}
+}
+
+// Doc returns the documentation associated with the program.
+func (dp *DocumentedProgram) Doc() ExpressionDoc {
+	return dp.doc
+}
+
+// Eval implements the Program interface method by delegating to the documented expression.
+func (dp *DocumentedProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	if dp.doc.Expression == nil {
+		return nil, nil, errors.New("documented program has no expression")
+	}
+	return dp.doc.Expression.Eval(vars)
+}
+
+// Program returns the documented program.
+func (dp *DocumentedProgram) Program() Program {
+	return dp.doc.Expression
+}
+
+// MarshalJSON implements the json.Marshaler interface, serializing the documentation.
+func (dp *DocumentedProgram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dp.doc)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, restoring the documentation.
+//
+// The expression associated with the program is left unchanged.
+func (dp *DocumentedProgram) UnmarshalJSON(data []byte) error {
+	doc := ExpressionDoc{Expression: dp.doc.Expression}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	dp.doc = doc
+	return nil
+}
+
+// DocRegistry indexes documented programs by id and tag.
+//
+// The registry is safe for concurrent use.
+type DocRegistry struct {
+	mu    sync.RWMutex
+	progs map[string]*DocumentedProgram
+}
+
+// NewDocRegistry creates an empty DocRegistry.
+func NewDocRegistry() *DocRegistry {
+	return &DocRegistry{progs: make(map[string]*DocumentedProgram)}
+}
+
+// Register adds the documented program to the registry, replacing any program with the same id.
+func (r *DocRegistry) Register(id string, dp *DocumentedProgram) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progs[id] = dp
+}
+
+// Lookup returns the documented program registered with the given id, if present.
+func (r *DocRegistry) Lookup(id string) (*DocumentedProgram, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	dp, found := r.progs[id]
+	return dp, found
+}
+
+// Search returns the documented programs tagged with `tag` in id order.
+func (r *DocRegistry) Search(tag string) []*DocumentedProgram {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var matches []*DocumentedProgram
+	for _, id := range r.sortedIDs() {
+		dp := r.progs[id]
+		for _, t := range dp.doc.Tags {
+			if t == tag {
+				matches = append(matches, dp)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// MarshalJSON implements the json.Marshaler interface, serializing the registered documentation
+// as an object keyed by id.
+func (r *DocRegistry) MarshalJSON() ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return json.Marshal(r.progs)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+//
+// Documentation restored from JSON has no associated expression. Use Lookup to find the entry and
+// Register a new DocumentedProgram to attach the compiled expression.
+func (r *DocRegistry) UnmarshalJSON(data []byte) error {
+	progs := make(map[string]*DocumentedProgram)
+	if err := json.Unmarshal(data, &progs); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progs = progs
+	return nil
+}
+
+func (r *DocRegistry) sortedIDs() []string {
+	ids := make([]string, 0, len(r.progs))
+	for id := range r.progs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/common/types"
+)
+
+func TestDocRegistry(t *testing.T) {
+	env, err := NewEnv()
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	ast, iss := env.Compile(`1 < 2`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	reg := NewDocRegistry()
+	reg.Register("allow", NewDocumented(prg, ExpressionDoc{
+		Title:     "Allow",
+		Owner:     "security",
+		Tags:      []string{"authz", "prod"},
+		CreatedAt: created,
+	}))
+	reg.Register("audit", NewDocumented(prg, ExpressionDoc{Title: "Audit", Tags: []string{"prod"}}))
+
+	if found := reg.Search("prod"); len(found) != 2 {
+		t.Errorf("got %d programs tagged prod, wanted 2", len(found))
+	}
+	found := reg.Search("authz")
+	if len(found) != 1 || found[0].Doc().Title != "Allow" {
+		t.Fatalf("got %v, wanted the Allow program", found)
+	}
+	out, _, err := found[0].Eval(NoVars())
+	if err != nil || out != types.True {
+		t.Errorf("got %v, %v, wanted true", out, err)
+	}
+
+	data, err := json.Marshal(reg)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	restored := NewDocRegistry()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	dp, found2 := restored.Lookup("allow")
+	if !found2 {
+		t.Fatal("got not found, wanted the Allow program")
+	}
+	doc := dp.Doc()
+	if doc.Owner != "security" || !doc.CreatedAt.Equal(created) || len(doc.Tags) != 2 {
+		t.Errorf("got %+v after round trip, wanted the original documentation", doc)
+	}
+	if _, _, err := dp.Eval(NoVars()); err == nil {
+		t.Error("got nil error evaluating a restored program, wanted error")
+	}
+}
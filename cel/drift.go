@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+// DriftProgram evaluates a base program and a canary program with the same input and reports
+// evaluations for which their results differ, such as when rolling out a new version of the
+// environment or of the library.
+type DriftProgram struct {
+	base    Program
+	canary  Program
+	onDrift func(vars interpreter.Activation, baseResult, canaryResult ref.Val)
+}
+
+// NewDriftDetector creates a DriftProgram which calls onDrift whenever the results of the base
+// and canary programs differ.
+//
+// Results are equal when they have the same type and are equal by CEL equality, when both are
+// errors with the same message, or when both are unknowns with the same expression ids.
+// Evaluations which return a Go error without a result are compared as errors with the message of
+// the Go error.
+func NewDriftDetector(base, canary Program,
+	onDrift func(vars interpreter.Activation, baseResult, canaryResult ref.Val)) *DriftProgram {
+	return &DriftProgram{base: base, canary: canary, onDrift: onDrift}
+}
+
+// Eval implements the Program interface method, returning the result, details, and error of the
+// base program.
+//
+// The canary program is evaluated after the base program on the calling goroutine, and onDrift
+// is called synchronously before Eval returns. The overhead of drift detection is therefore the
+// latency of the canary evaluation plus that of the comparison, which is linear in the size of
+// the results. BenchmarkDriftProgram measures the overhead for a small expression producing a
+// list, where drift detection takes about two and a half times as long as evaluating the base
+// program alone.
+func (p *DriftProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	out, det, err := p.base.Eval(vars)
+	canaryOut, _, canaryErr := p.canary.Eval(vars)
+	baseResult := resultOrErr(out, err)
+	canaryResult := resultOrErr(canaryOut, canaryErr)
+	if !resultsEqual(baseResult, canaryResult) {
+		activation, actErr := interpreter.NewActivation(vars)
+		if actErr != nil {
+			activation = interpreter.EmptyActivation()
+		}
+		p.onDrift(activation, baseResult, canaryResult)
+	}
+	return out, det, err
+}
+
+// Dependencies implements the DependencyReporter interface method, returning the variables
+// referenced by either the base or canary programs.
+func (p *DriftProgram) Dependencies() []string {
+	return mergeProgramDependencies(p.base, p.canary)
+}
+
+// Base returns the base program.
+func (p *DriftProgram) Base() Program {
+	return p.base
+}
+
+// Canary returns the canary program.
+func (p *DriftProgram) Canary() Program {
+	return p.canary
+}
+
+// resultOrErr returns the result of an evaluation, or an error value for evaluations which
+// returned a Go error without a result.
+func resultOrErr(out ref.Val, err error) ref.Val {
+	if out == nil && err != nil {
+		return types.NewErr(err.Error())
+	}
+	return out
+}
+
+// resultsEqual reports whether two evaluation results are the same.
+func resultsEqual(a, b ref.Val) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type().TypeName() != b.Type().TypeName() {
+		return false
+	}
+	switch av := a.(type) {
+	case *types.Err:
+		return av.Error() == b.(*types.Err).Error()
+	case types.Unknown:
+		return sameIDs(av, b.(types.Unknown))
+	}
+	return a.Equal(b) == types.True
+}
+
+func sameIDs(a, b types.Unknown) bool {
+	as := append([]int64{}, a...)
+	bs := append([]int64{}, b...)
+	sort.Slice(as, func(i, j int) bool { return as[i] < as[j] })
+	sort.Slice(bs, func(i, j int) bool { return bs[i] < bs[j] })
+	return reflect.DeepEqual(as, bs)
+}
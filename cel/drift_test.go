@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+func TestDriftProgram(t *testing.T) {
+	var drifts []int64
+	onDrift := func(vars interpreter.Activation, base, canary ref.Val) {
+		x, _ := vars.ResolveName("x")
+		drifts = append(drifts, int64(x.(int)))
+	}
+	dp := NewDriftDetector(
+		compileProgram(t, `x < 10 ? [x, 1] : [x]`),
+		compileProgram(t, `x < 5 ? [x, 1] : [x]`),
+		onDrift)
+	for _, x := range []int{1, 7, 12} {
+		out, _, err := dp.Eval(map[string]interface{}{"x": x})
+		want := []int{x, 1}
+		if x >= 10 {
+			want = []int{x}
+		}
+		if err != nil || out.Equal(types.DefaultTypeAdapter.NativeToValue(want)) != types.True {
+			t.Errorf("Eval(x=%d) got %v, %v, wanted the base result %v", x, out, err, want)
+		}
+	}
+	if len(drifts) != 1 || drifts[0] != 7 {
+		t.Errorf("got drifts for %v, wanted [7]", drifts)
+	}
+
+	// Errors are compared by message, and differ from values of any type.
+	drifts = nil
+	dp = NewDriftDetector(compileProgram(t, `10 / x`), compileProgram(t, `10 / (x + x - x)`), onDrift)
+	dp.Eval(map[string]interface{}{"x": 0})
+	dp = NewDriftDetector(compileProgram(t, `10 / x`), compileProgram(t, `x`), onDrift)
+	dp.Eval(map[string]interface{}{"x": 0})
+	if len(drifts) != 1 {
+		t.Errorf("got %d drifts, wanted 1", len(drifts))
+	}
+}
+
+func BenchmarkDriftProgram(b *testing.B) {
+	prg := compileProgram(b, `x < 10 ? [x, 1] : [x]`)
+	dp := NewDriftDetector(prg, compileProgram(b, `x < 5 ? [x, 1] : [x]`),
+		func(interpreter.Activation, ref.Val, ref.Val) {})
+	vars := map[string]interface{}{"x": 3}
+	b.Run("base", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			prg.Eval(vars)
+		}
+	})
+	b.Run("drift", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dp.Eval(vars)
+		}
+	})
+}
@@ -0,0 +1,276 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dsl builds CEL expressions from Go code, for tools such as query builders which would
+// otherwise assemble expression strings for the parser.
+//
+// Expressions are composed bottom-up:
+//
+//     e := dsl.And(
+//         dsl.Call(operators.Equals, dsl.Select(dsl.Ident("user"), "role"), dsl.Const("admin")),
+//         dsl.Call(operators.In, dsl.Ident("group"), dsl.List(dsl.Const("a"), dsl.Const("b"))))
+//     checked, err := dsl.Check(e, env)
+//
+// Every node is given an id from a counter shared by all expressions, so expressions built
+// separately may be combined without id collisions.
+package dsl
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/parser"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// lastID is the id most recently assigned to an expression node.
+var lastID int64
+
+func nextID() int64 {
+	return atomic.AddInt64(&lastID, 1)
+}
+
+// Expr is a CEL expression built with the functions of this package.
+type Expr struct {
+	expr *exprpb.Expr
+	err  error
+	// used records whether the expression is part of another expression, in which case it is
+	// copied with new ids if used again.
+	used int32
+}
+
+// KV is a key-value entry of a map literal.
+type KV struct {
+	Key, Value *Expr
+}
+
+// Expr returns the expression proto, which must not be modified.
+func (e *Expr) Expr() *exprpb.Expr {
+	return e.expr
+}
+
+// Err returns the first error encountered while building the expression, such as a constant of
+// an unsupported type.
+func (e *Expr) Err() error {
+	return e.err
+}
+
+// String returns the expression in CEL syntax.
+func (e *Expr) String() string {
+	if e.err != nil {
+		return fmt.Sprintf("<invalid: %v>", e.err)
+	}
+	src, err := parser.Unparse(e.expr, &exprpb.SourceInfo{})
+	if err != nil {
+		return fmt.Sprintf("<invalid: %v>", err)
+	}
+	return src
+}
+
+// Ident returns an identifier expression, which may be a dot-qualified name.
+func Ident(name string) *Expr {
+	return &Expr{expr: &exprpb.Expr{
+		Id:       nextID(),
+		ExprKind: &exprpb.Expr_IdentExpr{IdentExpr: &exprpb.Expr_Ident{Name: name}},
+	}}
+}
+
+// Select returns an expression which selects the field of the base expression.
+func Select(base *Expr, field string) *Expr {
+	out := &Expr{err: firstErr(base)}
+	out.expr = &exprpb.Expr{
+		Id: nextID(),
+		ExprKind: &exprpb.Expr_SelectExpr{
+			SelectExpr: &exprpb.Expr_Select{Operand: base.take(), Field: field},
+		},
+	}
+	return out
+}
+
+// Call returns a call of a global function or operator, such as `size` or operators.Equals, with
+// the arguments.
+func Call(fn string, args ...*Expr) *Expr {
+	out := &Expr{err: firstErr(args...)}
+	out.expr = &exprpb.Expr{
+		Id: nextID(),
+		ExprKind: &exprpb.Expr_CallExpr{
+			CallExpr: &exprpb.Expr_Call{Function: fn, Args: takeAll(args)},
+		},
+	}
+	return out
+}
+
+// Const returns a literal of a Go value: nil, a bool, a signed or unsigned integer, a float, a
+// string, or a byte slice. Values of other types produce an expression whose Err is set.
+func Const(v interface{}) *Expr {
+	var c *exprpb.Constant
+	switch v := v.(type) {
+	case nil:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_NullValue{
+			NullValue: structpb.NullValue_NULL_VALUE}}
+	case bool:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_BoolValue{BoolValue: v}}
+	case int:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_Int64Value{Int64Value: int64(v)}}
+	case int32:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_Int64Value{Int64Value: int64(v)}}
+	case int64:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_Int64Value{Int64Value: v}}
+	case uint:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_Uint64Value{Uint64Value: uint64(v)}}
+	case uint32:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_Uint64Value{Uint64Value: uint64(v)}}
+	case uint64:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_Uint64Value{Uint64Value: v}}
+	case float32:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_DoubleValue{DoubleValue: v}}
+	case string:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_StringValue{StringValue: v}}
+	case []byte:
+		c = &exprpb.Constant{ConstantKind: &exprpb.Constant_BytesValue{BytesValue: v}}
+	default:
+		return &Expr{
+			expr: &exprpb.Expr{Id: nextID()},
+			err:  fmt.Errorf("unsupported constant type: %T", v),
+		}
+	}
+	return &Expr{expr: &exprpb.Expr{
+		Id:       nextID(),
+		ExprKind: &exprpb.Expr_ConstExpr{ConstExpr: c},
+	}}
+}
+
+// List returns a list literal of the elements.
+func List(elems ...*Expr) *Expr {
+	out := &Expr{err: firstErr(elems...)}
+	out.expr = &exprpb.Expr{
+		Id: nextID(),
+		ExprKind: &exprpb.Expr_ListExpr{
+			ListExpr: &exprpb.Expr_CreateList{Elements: takeAll(elems)},
+		},
+	}
+	return out
+}
+
+// Map returns a map literal of the entries.
+func Map(pairs ...KV) *Expr {
+	out := &Expr{}
+	entries := make([]*exprpb.Expr_CreateStruct_Entry, len(pairs))
+	for i, kv := range pairs {
+		if out.err == nil {
+			out.err = firstErr(kv.Key, kv.Value)
+		}
+		entries[i] = &exprpb.Expr_CreateStruct_Entry{
+			Id:      nextID(),
+			KeyKind: &exprpb.Expr_CreateStruct_Entry_MapKey{MapKey: kv.Key.take()},
+			Value:   kv.Value.take(),
+		}
+	}
+	out.expr = &exprpb.Expr{
+		Id: nextID(),
+		ExprKind: &exprpb.Expr_StructExpr{
+			StructExpr: &exprpb.Expr_CreateStruct{Entries: entries},
+		},
+	}
+	return out
+}
+
+// And returns the logical conjunction of the expressions.
+func And(a, b *Expr) *Expr {
+	return Call(operators.LogicalAnd, a, b)
+}
+
+// Or returns the logical disjunction of the expressions.
+func Or(a, b *Expr) *Expr {
+	return Call(operators.LogicalOr, a, b)
+}
+
+// Check type-checks the expression against the environment.
+//
+// Since the expression has no source text, the errors of an expression which fails to check have
+// no locations. The expression is left unchanged, so it may be checked against other environments.
+func Check(e *Expr, env *cel.Env) (*exprpb.CheckedExpr, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	// The checker qualifies names in place, so it checks a copy of the expression.
+	ast, iss := env.Check(cel.ParsedExprToAst(&exprpb.ParsedExpr{
+		Expr:       proto.Clone(e.expr).(*exprpb.Expr),
+		SourceInfo: &exprpb.SourceInfo{Positions: map[int64]int32{}},
+	}))
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	return cel.AstToCheckedExpr(ast)
+}
+
+// take returns the expression proto for use as a child of another expression, copying it with new
+// ids if it is already a child of another expression.
+func (e *Expr) take() *exprpb.Expr {
+	if atomic.CompareAndSwapInt32(&e.used, 0, 1) {
+		return e.expr
+	}
+	out := proto.Clone(e.expr).(*exprpb.Expr)
+	renumber(out)
+	return out
+}
+
+func takeAll(exprs []*Expr) []*exprpb.Expr {
+	out := make([]*exprpb.Expr, len(exprs))
+	for i, e := range exprs {
+		out[i] = e.take()
+	}
+	return out
+}
+
+func firstErr(exprs ...*Expr) error {
+	for _, e := range exprs {
+		if e.err != nil {
+			return e.err
+		}
+	}
+	return nil
+}
+
+// renumber assigns new ids to the nodes of an expression built by this package, which contains
+// no comprehensions.
+func renumber(e *exprpb.Expr) {
+	e.Id = nextID()
+	switch e.GetExprKind().(type) {
+	case *exprpb.Expr_SelectExpr:
+		renumber(e.GetSelectExpr().GetOperand())
+	case *exprpb.Expr_CallExpr:
+		for _, arg := range e.GetCallExpr().GetArgs() {
+			renumber(arg)
+		}
+	case *exprpb.Expr_ListExpr:
+		for _, elem := range e.GetListExpr().GetElements() {
+			renumber(elem)
+		}
+	case *exprpb.Expr_StructExpr:
+		for _, entry := range e.GetStructExpr().GetEntries() {
+			entry.Id = nextID()
+			renumber(entry.GetMapKey())
+			renumber(entry.GetValue())
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestDSL(t *testing.T) {
+	role := Select(Ident("user"), "role")
+	e := Or(
+		And(
+			Call(operators.Equals, role, Const("admin")),
+			Call(operators.In, Ident("group"), List(Const("a"), Const("b")))),
+		Call(operators.Equals, role, Const("root")))
+	if got, want := e.String(),
+		`user.role == "admin" && group in ["a", "b"] || user.role == "root"`; got != want {
+		t.Errorf("String() got %s, wanted %s", got, want)
+	}
+	// The reused role expression is copied with new ids.
+	ids := map[int64]bool{}
+	var visit func(e *exprpb.Expr)
+	visit = func(e *exprpb.Expr) {
+		if e == nil {
+			return
+		}
+		if ids[e.GetId()] {
+			t.Errorf("duplicate id %d", e.GetId())
+		}
+		ids[e.GetId()] = true
+		visit(e.GetSelectExpr().GetOperand())
+		for _, arg := range e.GetCallExpr().GetArgs() {
+			visit(arg)
+		}
+		for _, elem := range e.GetListExpr().GetElements() {
+			visit(elem)
+		}
+	}
+	visit(e.Expr())
+
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("user", decls.NewMapType(decls.String, decls.String)),
+		decls.NewVar("group", decls.String),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked, err := Check(e, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(checked.GetTypeMap()[e.Expr().GetId()], decls.Bool) {
+		t.Errorf("Check() got type %v, wanted bool", checked.GetTypeMap()[e.Expr().GetId()])
+	}
+	prg, err := env.Program(cel.CheckedExprToAst(checked))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := prg.Eval(map[string]interface{}{
+		"user":  map[string]string{"role": "dev"},
+		"group": "b",
+	})
+	if err != nil || out != types.False {
+		t.Errorf("Eval() got %v, %v, wanted false", out, err)
+	}
+
+	m := Map(KV{Key: Const("k"), Value: Const(int64(1))})
+	if _, err := Check(Call(operators.Index, m, Const("k")), env); err != nil {
+		t.Errorf("Check() of map index failed: %v", err)
+	}
+	if _, err := Check(Call(operators.Add, Ident("group"), Const(1)), env); err == nil ||
+		!strings.Contains(err.Error(), "found no matching overload") {
+		t.Errorf("Check() got %v, wanted no matching overload error", err)
+	}
+	if got := Const(nil).String(); got != "null" {
+		t.Errorf("Const(nil).String() got %s, wanted null", got)
+	}
+	if _, err := Check(List(Const(struct{}{})), env); err == nil {
+		t.Error("Check() got no error for an unsupported constant")
+	}
+
+	// Checking resolves the qualified name without rewriting the expression.
+	qualified := Select(Ident("ns"), "flag")
+	nsEnv, err := cel.NewEnv(cel.Declarations(decls.NewVar("ns.flag", decls.Bool)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Check(qualified, nsEnv); err != nil {
+		t.Fatal(err)
+	}
+	if qualified.Expr().GetSelectExpr() == nil {
+		t.Errorf("Check() rewrote the expression to %v", qualified.Expr())
+	}
+	if _, err := Check(qualified, nsEnv); err != nil {
+		t.Errorf("Check() of a checked expression failed: %v", err)
+	}
+}
@@ -91,11 +91,21 @@ type Env struct {
 	features     map[int]bool
 	// program options tied to the environment.
 	progOpts []ProgramOption
+	// middleware applied when type-checking.
+	chkMiddleware []checker.Middleware
+	// aliases expanded before type-checking, keyed by alias name.
+	aliases map[string]*exprpb.Expr
 
 	// Internal checker representation
 	chk    *checker.Env
 	chkErr error
 	once   sync.Once
+
+	// watchers are notified when the environment is updated. The set is created when the first
+	// program is created within the Env, and is shared by the Env values created from one another
+	// by Update once a watcher has been registered.
+	watchers     *watcherSet
+	watchersOnce sync.Once
 }
 
 // NewEnv creates a program environment configured with the standard library of CEL functions and
@@ -145,10 +155,13 @@ func NewCustomEnv(opts ...EnvOption) (*Env, error) {
 func (e *Env) Check(ast *Ast) (*Ast, *Issues) {
 	// Note, errors aren't currently possible on the Ast to ParsedExpr conversion.
 	pe, _ := AstToParsedExpr(ast)
+	if len(e.aliases) > 0 {
+		pe = expandAliases(pe, e.aliases)
+	}
 
 	// Construct the internal checker env, erroring if there is an issue adding the declarations.
 	e.once.Do(func() {
-		ce := checker.NewEnv(e.Container, e.provider)
+		ce := checker.NewEnv(e.Container, e.provider, checker.WithMiddleware(e.chkMiddleware...))
 		ce.EnableDynamicAggregateLiterals(true)
 		if e.HasFeature(FeatureDisableDynamicAggregateLiterals) {
 			ce.EnableDynamicAggregateLiterals(false)
@@ -229,9 +242,11 @@ func (e *Env) Extend(opts ...EnvOption) (*Env, error) {
 	decsCopy := make([]*exprpb.Decl, len(e.declarations))
 	macsCopy := make([]parser.Macro, len(e.macros))
 	progOptsCopy := make([]ProgramOption, len(e.progOpts))
+	chkMiddlewareCopy := make([]checker.Middleware, len(e.chkMiddleware))
 	copy(decsCopy, e.declarations)
 	copy(macsCopy, e.macros)
 	copy(progOptsCopy, e.progOpts)
+	copy(chkMiddlewareCopy, e.chkMiddleware)
 
 	// Copy the adapter / provider if they appear to be mutable.
 	adapter := e.adapter
@@ -266,13 +281,15 @@ func (e *Env) Extend(opts ...EnvOption) (*Env, error) {
 	}
 
 	ext := &Env{
-		Container:    e.Container,
-		declarations: decsCopy,
-		macros:       macsCopy,
-		progOpts:     progOptsCopy,
-		adapter:      adapter,
-		features:     featuresCopy,
-		provider:     provider,
+		Container:     e.Container,
+		declarations:  decsCopy,
+		macros:        macsCopy,
+		progOpts:      progOptsCopy,
+		chkMiddleware: chkMiddlewareCopy,
+		aliases:       e.aliases,
+		adapter:       adapter,
+		features:      featuresCopy,
+		provider:      provider,
 	}
 	return ext.configure(opts)
 }
@@ -315,14 +332,7 @@ func (e *Env) ParseSource(src common.Source) (*Ast, *Issues) {
 
 // Program generates an evaluable instance of the Ast within the environment (Env).
 func (e *Env) Program(ast *Ast, opts ...ProgramOption) (Program, error) {
-	optSet := e.progOpts
-	if len(opts) != 0 {
-		mergedOpts := []ProgramOption{}
-		mergedOpts = append(mergedOpts, e.progOpts...)
-		mergedOpts = append(mergedOpts, opts...)
-		optSet = mergedOpts
-	}
-	return newProgram(e, ast, optSet)
+	return newProgram(e, ast, opts)
 }
 
 // SetFeature sets the given feature flag, as enumerated in options.go.
@@ -330,11 +340,62 @@ func (e *Env) SetFeature(flag int) {
 	e.features[flag] = true
 }
 
+// Update creates a new Env by extending the environment with the given options, as with Extend,
+// and recompiles the programs watched by any ProgramWatcher created for the environment within
+// the new Env.
+//
+// The environment itself is not modified, so programs created before the update continue to
+// evaluate their original plan. Watchers follow the new Env, and are notified of its updates in
+// turn.
+func (e *Env) Update(opts ...EnvOption) (*Env, error) {
+	next, err := e.Extend(opts...)
+	if err != nil {
+		return nil, err
+	}
+	set := e.watcherSet()
+	if !set.watching() {
+		return next, nil
+	}
+	next.watchersOnce.Do(func() {
+		next.watchers = set
+		set.retain(next)
+	})
+	set.notify(next)
+	return next, nil
+}
+
+// watcherSet returns the set of watchers notified when the environment is updated, creating the
+// set on first use.
+func (e *Env) watcherSet() *watcherSet {
+	e.watchersOnce.Do(func() {
+		e.watchers = &watcherSet{pending: e}
+	})
+	return e.watchers
+}
+
 // TypeAdapter returns the `ref.TypeAdapter` configured for the environment.
 func (e *Env) TypeAdapter() ref.TypeAdapter {
 	return e.adapter
 }
 
+// ListEnumValues returns the values of the named enum type, ordered by number.
+//
+// The enum type name is resolved against the environment's container. An empty list is returned
+// if the enum type is not found, or if the type provider does not implement
+// ref.EnumValueProvider.
+func (e *Env) ListEnumValues(enumTypeName string) []ref.EnumValue {
+	provider, ok := e.provider.(ref.EnumValueProvider)
+	if !ok {
+		return []ref.EnumValue{}
+	}
+	for _, candidate := range e.Container.ResolveCandidateNames(enumTypeName) {
+		if vals := provider.LookupEnumValues(candidate); len(vals) != 0 {
+			return vals
+		}
+	}
+	return []ref.EnumValue{}
+}
+
 // TypeProvider returns the `ref.TypeProvider` configured for the environment.
 func (e *Env) TypeProvider() ref.TypeProvider {
 	return e.provider
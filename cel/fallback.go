@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// FallbackReason describes how the primary program of a FallbackProgram failed to produce a
+// result.
+type FallbackReason int
+
+const (
+	// FallbackNone indicates that the primary program produced a result, so the fallback was not
+	// evaluated.
+	FallbackNone FallbackReason = iota
+
+	// PrimaryError indicates that the primary program returned an error, so the fallback was
+	// evaluated.
+	PrimaryError
+
+	// PrimaryUnknown indicates that the primary program produced an unknown result. The unknown is
+	// returned, since the fallback cannot resolve the variables it depends upon.
+	PrimaryUnknown
+)
+
+// FallbackHook is called by a FallbackProgram when its primary program fails to produce a result,
+// with the reason and the error returned by the primary program, if any. The hook may be called
+// concurrently when the program is evaluated concurrently.
+type FallbackHook func(reason FallbackReason, err error)
+
+// String returns the name of the reason.
+func (r FallbackReason) String() string {
+	switch r {
+	case FallbackNone:
+		return "FallbackNone"
+	case PrimaryError:
+		return "PrimaryError"
+	case PrimaryUnknown:
+		return "PrimaryUnknown"
+	}
+	return fmt.Sprintf("FallbackReason(%d)", int(r))
+}
+
+// FallbackProgram evaluates a primary program and, when it fails to produce a result, a fallback
+// program, such as the current version of a policy while a new version is rolled out.
+type FallbackProgram struct {
+	primary  Program
+	fallback Program
+	hook     FallbackHook
+}
+
+// FallbackOption configures a FallbackProgram.
+type FallbackOption func(*FallbackProgram)
+
+// WithFallbackHook sets a hook which is called whenever the primary program fails to produce a
+// result, for example to log the failure or count it.
+func WithFallbackHook(hook FallbackHook) FallbackOption {
+	return func(p *FallbackProgram) {
+		p.hook = hook
+	}
+}
+
+// NewFallbackProgram creates a FallbackProgram which evaluates the fallback program when the
+// primary program returns an error.
+func NewFallbackProgram(primary, fallback Program, opts ...FallbackOption) *FallbackProgram {
+	p := &FallbackProgram{primary: primary, fallback: fallback}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Eval implements the Program interface method.
+//
+// When the primary program returns an error, the fallback program is evaluated on the calling
+// goroutine with the same input, and its result, details, and error are returned in place of the
+// primary's. Unknown results of the primary program are returned unchanged.
+func (p *FallbackProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	out, det, err := p.primary.Eval(vars)
+	reason := FallbackNone
+	switch {
+	case err != nil:
+		reason = PrimaryError
+	case types.IsUnknown(out):
+		reason = PrimaryUnknown
+	}
+	if reason != FallbackNone && p.hook != nil {
+		p.hook(reason, err)
+	}
+	if reason != PrimaryError {
+		return out, det, err
+	}
+	return p.fallback.Eval(vars)
+}
+
+// Dependencies implements the DependencyReporter interface method, returning the variables
+// referenced by either the primary or fallback programs.
+func (p *FallbackProgram) Dependencies() []string {
+	return mergeProgramDependencies(p.primary, p.fallback)
+}
+
+// Primary returns the primary program.
+func (p *FallbackProgram) Primary() Program {
+	return p.primary
+}
+
+// Fallback returns the fallback program.
+func (p *FallbackProgram) Fallback() Program {
+	return p.fallback
+}
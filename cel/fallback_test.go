@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+)
+
+func TestFallbackProgram(t *testing.T) {
+	var reasons []FallbackReason
+	var errs []error
+	hook := func(reason FallbackReason, err error) {
+		reasons = append(reasons, reason)
+		errs = append(errs, err)
+	}
+	fp := NewFallbackProgram(compileProgram(t, `10 / x`), compileProgram(t, `x + 1`),
+		WithFallbackHook(hook))
+	out, _, err := fp.Eval(map[string]interface{}{"x": 2})
+	if err != nil || out != types.Int(5) {
+		t.Errorf("Eval(x=2) got %v, %v, wanted 5", out, err)
+	}
+	if len(reasons) != 0 {
+		t.Errorf("hook got reasons %v, wanted no fallback", reasons)
+	}
+	out, _, err = fp.Eval(map[string]interface{}{"x": 0})
+	if err != nil || out != types.Int(1) {
+		t.Errorf("Eval(x=0) got %v, %v, wanted the fallback result 1", out, err)
+	}
+	if len(errs) != 1 || errs[0] == nil {
+		t.Errorf("hook got errors %v, wanted the primary's error", errs)
+	}
+
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int), decls.NewVar("y", decls.Int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`x + y`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	primary, err := env.Program(ast, EvalOptions(OptPartialEval))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp = NewFallbackProgram(primary, compileProgram(t, `x`), WithFallbackHook(hook))
+	vars, _ := PartialVars(map[string]interface{}{"x": 3}, AttributePattern("y"))
+	out, _, err = fp.Eval(vars)
+	if err != nil || !types.IsUnknown(out) {
+		t.Errorf("Eval() got %v, %v, wanted the unknown result of the primary", out, err)
+	}
+	if !reflect.DeepEqual(reasons, []FallbackReason{PrimaryError, PrimaryUnknown}) {
+		t.Errorf("hook got reasons %v, wanted [PrimaryError PrimaryUnknown]", reasons)
+	}
+	if errs[1] != nil {
+		t.Errorf("hook got error %v for an unknown result, wanted nil", errs[1])
+	}
+	// Programs without a hook fall back silently.
+	fp = NewFallbackProgram(compileProgram(t, `10 / x`), compileProgram(t, `x + 1`))
+	if out, _, err := fp.Eval(map[string]interface{}{"x": 0}); err != nil || out != types.Int(1) {
+		t.Errorf("Eval(x=0) got %v, %v, wanted the fallback result 1", out, err)
+	}
+}
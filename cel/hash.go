@@ -0,0 +1,197 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// hashFormatVersion is written at the start of every expression hash.
+//
+// Any change to the hash algorithm or to the encoding of expression nodes must increment the
+// version. Doing so invalidates all previously stored fingerprints.
+const hashFormatVersion byte = 1
+
+// Tags identifying the kind of each hashed node.
+const (
+	hashTagNil byte = iota
+	hashTagConst
+	hashTagIdent
+	hashTagSelect
+	hashTagTest
+	hashTagCall
+	hashTagList
+	hashTagStruct
+	hashTagMapEntry
+	hashTagFieldEntry
+	hashTagComprehension
+)
+
+// Tags identifying the kind of each hashed constant.
+const (
+	hashTagNull byte = iota
+	hashTagBool
+	hashTagInt
+	hashTagUint
+	hashTagDouble
+	hashTagString
+	hashTagBytes
+)
+
+// HashExpression returns a fingerprint of the structure of the Ast's expression.
+//
+// The hash is computed using 64-bit FNV-1a over a format version byte followed by an encoding of
+// the expression in which all integers are written in big-endian byte order, so the result is the
+// same across machine architectures and Go versions. Expression ids, source positions, and type
+// information do not contribute to the hash, so a parsed and a checked Ast for the same source
+// produce the same fingerprint.
+//
+// The format version changes whenever the hash algorithm or encoding changes, which invalidates
+// all stored fingerprints.
+func HashExpression(ast *Ast) uint64 {
+	h := &exprHasher{h: fnv.New64a()}
+	h.writeByte(hashFormatVersion)
+	h.writeExpr(ast.Expr())
+	return h.h.Sum64()
+}
+
+type exprHasher struct {
+	h   hash.Hash64
+	buf [8]byte
+}
+
+func (h *exprHasher) writeByte(b byte) {
+	h.buf[0] = b
+	h.h.Write(h.buf[:1])
+}
+
+func (h *exprHasher) writeBool(b bool) {
+	if b {
+		h.writeByte(1)
+	} else {
+		h.writeByte(0)
+	}
+}
+
+func (h *exprHasher) writeUint64(v uint64) {
+	binary.BigEndian.PutUint64(h.buf[:], v)
+	h.h.Write(h.buf[:])
+}
+
+func (h *exprHasher) writeBytes(b []byte) {
+	h.writeUint64(uint64(len(b)))
+	h.h.Write(b)
+}
+
+func (h *exprHasher) writeString(s string) {
+	h.writeBytes([]byte(s))
+}
+
+func (h *exprHasher) writeExpr(e *exprpb.Expr) {
+	if e == nil {
+		h.writeByte(hashTagNil)
+		return
+	}
+	switch e.GetExprKind().(type) {
+	case *exprpb.Expr_ConstExpr:
+		h.writeByte(hashTagConst)
+		h.writeConst(e.GetConstExpr())
+	case *exprpb.Expr_IdentExpr:
+		h.writeByte(hashTagIdent)
+		h.writeString(e.GetIdentExpr().GetName())
+	case *exprpb.Expr_SelectExpr:
+		sel := e.GetSelectExpr()
+		if sel.GetTestOnly() {
+			h.writeByte(hashTagTest)
+		} else {
+			h.writeByte(hashTagSelect)
+		}
+		h.writeExpr(sel.GetOperand())
+		h.writeString(sel.GetField())
+	case *exprpb.Expr_CallExpr:
+		call := e.GetCallExpr()
+		h.writeByte(hashTagCall)
+		h.writeString(call.GetFunction())
+		h.writeExpr(call.GetTarget())
+		h.writeUint64(uint64(len(call.GetArgs())))
+		for _, arg := range call.GetArgs() {
+			h.writeExpr(arg)
+		}
+	case *exprpb.Expr_ListExpr:
+		elems := e.GetListExpr().GetElements()
+		h.writeByte(hashTagList)
+		h.writeUint64(uint64(len(elems)))
+		for _, elem := range elems {
+			h.writeExpr(elem)
+		}
+	case *exprpb.Expr_StructExpr:
+		s := e.GetStructExpr()
+		h.writeByte(hashTagStruct)
+		h.writeString(s.GetMessageName())
+		h.writeUint64(uint64(len(s.GetEntries())))
+		for _, entry := range s.GetEntries() {
+			if entry.GetMapKey() != nil {
+				h.writeByte(hashTagMapEntry)
+				h.writeExpr(entry.GetMapKey())
+			} else {
+				h.writeByte(hashTagFieldEntry)
+				h.writeString(entry.GetFieldKey())
+			}
+			h.writeExpr(entry.GetValue())
+		}
+	case *exprpb.Expr_ComprehensionExpr:
+		comp := e.GetComprehensionExpr()
+		h.writeByte(hashTagComprehension)
+		h.writeString(comp.GetIterVar())
+		h.writeExpr(comp.GetIterRange())
+		h.writeString(comp.GetAccuVar())
+		h.writeExpr(comp.GetAccuInit())
+		h.writeExpr(comp.GetLoopCondition())
+		h.writeExpr(comp.GetLoopStep())
+		h.writeExpr(comp.GetResult())
+	default:
+		h.writeByte(hashTagNil)
+	}
+}
+
+func (h *exprHasher) writeConst(c *exprpb.Constant) {
+	switch c.GetConstantKind().(type) {
+	case *exprpb.Constant_BoolValue:
+		h.writeByte(hashTagBool)
+		h.writeBool(c.GetBoolValue())
+	case *exprpb.Constant_Int64Value:
+		h.writeByte(hashTagInt)
+		h.writeUint64(uint64(c.GetInt64Value()))
+	case *exprpb.Constant_Uint64Value:
+		h.writeByte(hashTagUint)
+		h.writeUint64(c.GetUint64Value())
+	case *exprpb.Constant_DoubleValue:
+		h.writeByte(hashTagDouble)
+		h.writeUint64(math.Float64bits(c.GetDoubleValue()))
+	case *exprpb.Constant_StringValue:
+		h.writeByte(hashTagString)
+		h.writeString(c.GetStringValue())
+	case *exprpb.Constant_BytesValue:
+		h.writeByte(hashTagBytes)
+		h.writeBytes(c.GetBytesValue())
+	default:
+		h.writeByte(hashTagNull)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+)
+
+func TestHashStability(t *testing.T) {
+	env, _ := NewEnv(Declarations(decls.NewVar("x", decls.NewMapType(decls.String, decls.Int))))
+	ast, iss := env.Compile(`x.all(k, x[k] > 1) && has(x.a) && [1u, 2.5, b'b', null, true] != []`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	// Changing this value requires incrementing hashFormatVersion.
+	want := uint64(0x75f510036b464211)
+	if got := HashExpression(ast); got != want {
+		t.Errorf("HashExpression() got %#x, wanted %#x", got, want)
+	}
+}
+
+func TestHashExpression(t *testing.T) {
+	env, _ := NewEnv(Declarations(
+		decls.NewVar("a", decls.Int),
+		decls.NewVar("b", decls.Int)))
+	hash := func(src string, check bool) uint64 {
+		t.Helper()
+		var ast *Ast
+		var iss *Issues
+		if check {
+			ast, iss = env.Compile(src)
+		} else {
+			ast, iss = env.Parse(src)
+		}
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		return HashExpression(ast)
+	}
+	if hash("a + b", false) != hash("a  +  b", true) {
+		t.Error("parsed and checked asts for the same expression hashed differently")
+	}
+	distinct := []string{"a + b", "b + a", "a - b", "a + 1", "a + 1.0", "{'a': b}", "[a, b]"}
+	seen := map[uint64]string{}
+	for _, src := range distinct {
+		h := hash(src, false)
+		if prev, found := seen[h]; found {
+			t.Errorf("HashExpression(%q) collided with %q", src, prev)
+		}
+		seen[h] = src
+	}
+}
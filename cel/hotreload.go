@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/cel-go/common/types/ref"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// HotReloadProgram is a Program whose underlying program can be replaced while it is being
+// evaluated, such as when the policy it implements is updated.
+//
+// Each evaluation uses the program which was current when the evaluation began. The programs
+// delivered by a ProgramWatcher may be passed directly to Reload.
+type HotReloadProgram struct {
+	resultType *exprpb.Type
+	// current holds a reloadedProgram, since an atomic.Value requires every stored value to have
+	// the same concrete type.
+	current atomic.Value
+}
+
+type reloadedProgram struct {
+	Program
+}
+
+// NewHotReloadProgram creates a HotReloadProgram which initially evaluates the given program.
+//
+// The program must have been created by Env.Program. Its result type is the type which every
+// reloaded program must have.
+func NewHotReloadProgram(initial Program) (*HotReloadProgram, error) {
+	p, err := watchedProg(initial)
+	if err != nil {
+		return nil, err
+	}
+	r := &HotReloadProgram{resultType: p.ast.ResultType()}
+	r.current.Store(reloadedProgram{initial})
+	return r, nil
+}
+
+// Reload atomically replaces the program evaluated by subsequent calls to Eval.
+//
+// An error is returned, and the current program retained, if the next program was not created by
+// Env.Program or its result type differs from that of the initial program.
+func (r *HotReloadProgram) Reload(next Program) error {
+	p, err := watchedProg(next)
+	if err != nil {
+		return err
+	}
+	if t := p.ast.ResultType(); !proto.Equal(t, r.resultType) {
+		return fmt.Errorf("program result type '%s' does not match '%s'",
+			FormatType(t), FormatType(r.resultType))
+	}
+	r.current.Store(reloadedProgram{next})
+	return nil
+}
+
+// Program returns the current program.
+func (r *HotReloadProgram) Program() Program {
+	return r.current.Load().(reloadedProgram).Program
+}
+
+// ResultType returns the result type shared by the programs.
+func (r *HotReloadProgram) ResultType() *exprpb.Type {
+	return r.resultType
+}
+
+// Eval implements the Program interface method by evaluating the current program.
+func (r *HotReloadProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	return r.Program().Eval(vars)
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+)
+
+func TestHotReloadProgram(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	compile := func(src string, opts ...ProgramOption) Program {
+		t.Helper()
+		ast, iss := env.Compile(src)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		prg, err := env.Program(ast, opts...)
+		if err != nil {
+			t.Fatalf("env.Program() failed: %v", err)
+		}
+		return prg
+	}
+	r, err := NewHotReloadProgram(compile(`x > 1`))
+	if err != nil {
+		t.Fatalf("NewHotReloadProgram() failed: %v", err)
+	}
+	vars := map[string]interface{}{"x": 2}
+	if out, _, err := r.Eval(vars); err != nil || out != types.True {
+		t.Errorf("Eval() got %v, %v, wanted true", out, err)
+	}
+
+	// Programs with state tracking are created by a factory, and may replace plain programs.
+	if err := r.Reload(compile(`x > 2`, EvalOptions(OptTrackState))); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if out, _, err := r.Eval(vars); err != nil || out != types.False {
+		t.Errorf("Eval() after Reload() got %v, %v, wanted false", out, err)
+	}
+
+	err = r.Reload(compile(`x + 1`))
+	if err == nil || !strings.Contains(err.Error(), "result type 'int' does not match 'bool'") {
+		t.Errorf("Reload() got error %v, wanted result type mismatch", err)
+	}
+	if err := r.Reload(r); err == nil {
+		t.Error("Reload() of a program not created by an Env got nil error")
+	}
+	if out, _, err := r.Eval(vars); err != nil || out != types.False {
+		t.Errorf("Eval() after failed Reload() got %v, %v, wanted false", out, err)
+	}
+}
+
+func TestHotReloadProgramConcurrent(t *testing.T) {
+	env, err := NewEnv()
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	programs := make([]Program, 2)
+	for i, src := range []string{`'a'`, `'b'`} {
+		ast, iss := env.Compile(src)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		if programs[i], err = env.Program(ast); err != nil {
+			t.Fatalf("env.Program() failed: %v", err)
+		}
+	}
+	r, err := NewHotReloadProgram(programs[0])
+	if err != nil {
+		t.Fatalf("NewHotReloadProgram() failed: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				out, _, err := r.Eval(NoVars())
+				if err != nil || (out != types.String("a") && out != types.String("b")) {
+					t.Errorf("Eval() got %v, %v", out, err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		if err := r.Reload(programs[i%2]); err != nil {
+			t.Fatalf("Reload() failed: %v", err)
+		}
+	}
+	wg.Wait()
+}
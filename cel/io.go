@@ -16,10 +16,13 @@ package cel
 
 import (
 	"fmt"
+	"regexp"
 
 	"github.com/google/cel-go/common"
 	"github.com/google/cel-go/parser"
 
+	"google.golang.org/protobuf/encoding/prototext"
+
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
 )
 
@@ -87,3 +90,34 @@ func AstToString(a *Ast) (string, error) {
 	info := a.SourceInfo()
 	return parser.Unparse(expr, info)
 }
+
+// CheckedExprToProtoText serializes a checked expression to the protobuf text format.
+//
+// The output is stable for a given input, with fields written in declaration order, map entries
+// sorted by key, and a single space following each field name, which makes it suitable for storage
+// in version control. Note, the prototext package randomly varies the whitespace of its output to
+// discourage reliance on byte-for-byte stability; this function removes the variation.
+func CheckedExprToProtoText(checkedExpr *exprpb.CheckedExpr) (string, error) {
+	out, err := protoTextOptions.Marshal(checkedExpr)
+	if err != nil {
+		return "", err
+	}
+	return string(protoTextFieldSeparator.ReplaceAll(out, []byte("$1 "))), nil
+}
+
+// ProtoTextToCheckedExpr parses a checked expression from the protobuf text format.
+func ProtoTextToCheckedExpr(text string) (*exprpb.CheckedExpr, error) {
+	checkedExpr := &exprpb.CheckedExpr{}
+	if err := prototext.Unmarshal([]byte(text), checkedExpr); err != nil {
+		return nil, err
+	}
+	return checkedExpr, nil
+}
+
+var (
+	protoTextOptions = prototext.MarshalOptions{Multiline: true, Indent: "  "}
+
+	// protoTextFieldSeparator matches a field name at the start of a line along with the spaces
+	// which follow it. String values are escaped, and so never span multiple lines.
+	protoTextFieldSeparator = regexp.MustCompile(`(?m)^( *[^ :]+:) +`)
+)
@@ -96,3 +96,92 @@ func TestCheckedExprToAst_ConstantExpr(t *testing.T) {
 		t.Fatalf("got ast %v, wanted %v", ast2, ast)
 	}
 }
+
+func TestCheckedExprToProtoText(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("a", decls.Int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`a`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	checked, err := AstToCheckedExpr(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := CheckedExprToProtoText(checked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `reference_map: {
+  key: 1
+  value: {
+    name: "a"
+  }
+}
+type_map: {
+  key: 1
+  value: {
+    primitive: INT64
+  }
+}
+source_info: {
+  location: "<input>"
+  line_offsets: 2
+  positions: {
+    key: 1
+    value: 0
+  }
+}
+expr: {
+  id: 1
+  ident_expr: {
+    name: "a"
+  }
+}
+`
+	if text != want {
+		t.Errorf("got %s, wanted %s", text, want)
+	}
+}
+
+func TestProtoTextToCheckedExpr(t *testing.T) {
+	env, err := NewEnv(Declarations(
+		decls.NewVar("a", decls.Int),
+		decls.NewVar("b", decls.NewMapType(decls.String, decls.String))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`a + 1 > 2 && b['k  v'] == "x:  y" && [1, 2].all(x, x > 0)`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	checked, err := AstToCheckedExpr(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := CheckedExprToProtoText(checked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		again, err := CheckedExprToProtoText(checked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != text {
+			t.Fatalf("got unstable output %s, wanted %s", again, text)
+		}
+	}
+	parsed, err := ProtoTextToCheckedExpr(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(parsed, checked) {
+		t.Errorf("got %v, wanted %v", parsed, checked)
+	}
+	if _, err := ProtoTextToCheckedExpr(`expr: {`); err == nil {
+		t.Error("got no error for malformed text")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/overloads"
+	"github.com/google/cel-go/common/walk"
+	"github.com/google/cel-go/parser"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// PreferEmptyCheck returns a lint rule which reports comparisons of a size to zero, such as
+// `size(x) == 0`, which are more simply written as a comparison to the empty value of the type,
+// such as `x == []` or `x == ""`.
+//
+// Sizes of values whose type is not known at check time, such as `dyn` values, are not reported
+// since there is no single empty value to compare against.
+func PreferEmptyCheck() Validator {
+	return &emptyCheckRule{empty: true}
+}
+
+// PreferNonEmptyCheck returns a lint rule which reports tests for a non-zero size, such as
+// `size(x) > 0` or `size(x) != 0`, which are more simply written as a comparison to the empty
+// value of the type, such as `x != []`.
+//
+// As with PreferEmptyCheck, sizes of values of unknown type are not reported.
+func PreferNonEmptyCheck() Validator {
+	return &emptyCheckRule{empty: false}
+}
+
+type emptyCheckRule struct {
+	empty bool
+}
+
+// Validate implements the Validator interface method.
+func (r *emptyCheckRule) Validate(e *Env, ast *Ast) []*ValidationIssue {
+	var issues []*ValidationIssue
+	walk.PreOrder(ast.Expr(), func(expr *exprpb.Expr) bool {
+		call := expr.GetCallExpr()
+		if call == nil || len(call.GetArgs()) != 2 {
+			return true
+		}
+		lhs, rhs := call.GetArgs()[0], call.GetArgs()[1]
+		fn := call.GetFunction()
+		// Normalize `0 < size(x)` to `size(x) > 0`, and likewise for the other operators.
+		if sizeOperand(lhs) == nil {
+			lhs, rhs = rhs, lhs
+			fn = reversedComparisons[fn]
+		}
+		operand := sizeOperand(lhs)
+		bound, isInt := intLiteral(rhs)
+		if operand == nil || !isInt {
+			return true
+		}
+		var empty bool
+		switch {
+		case fn == operators.Equals && bound == 0,
+			fn == operators.LessEquals && bound == 0,
+			fn == operators.Less && bound == 1:
+			empty = true
+		case fn == operators.NotEquals && bound == 0,
+			fn == operators.Greater && bound == 0,
+			fn == operators.GreaterEquals && bound == 1:
+			empty = false
+		default:
+			return true
+		}
+		if empty != r.empty {
+			return true
+		}
+		emptyValue, found := emptyLiteral(ast.typeMap[operand.GetId()])
+		if !found {
+			return true
+		}
+		op := "!="
+		if empty {
+			op = "=="
+		}
+		issues = append(issues, newValidationIssue(ast, expr.GetId(), SeverityWarning,
+			"prefer '%s %s %s' to comparing the size", unparseOrDefault(ast, operand), op, emptyValue))
+		return true
+	})
+	return issues
+}
+
+// PreferHasOverNotEquals returns a lint rule which reports comparisons of a message field to
+// null, such as `msg.field != null`, which are more clearly written as `has(msg.field)`.
+//
+// Only fields which support presence and cannot hold a null value are reported, and only when the
+// type of the message is known at check time.
+func PreferHasOverNotEquals() Validator {
+	return &hasOverNotEqualsRule{}
+}
+
+type hasOverNotEqualsRule struct{}
+
+// Validate implements the Validator interface method.
+func (*hasOverNotEqualsRule) Validate(e *Env, ast *Ast) []*ValidationIssue {
+	var issues []*ValidationIssue
+	walk.PreOrder(ast.Expr(), func(expr *exprpb.Expr) bool {
+		call := expr.GetCallExpr()
+		if call.GetFunction() != operators.NotEquals || len(call.GetArgs()) != 2 {
+			return true
+		}
+		field, other := call.GetArgs()[0], call.GetArgs()[1]
+		if isNullLiteral(field) {
+			field, other = other, field
+		}
+		sel := field.GetSelectExpr()
+		if sel == nil || sel.GetTestOnly() || !isNullLiteral(other) {
+			return true
+		}
+		msgType := ast.typeMap[sel.GetOperand().GetId()].GetMessageType()
+		if msgType == "" {
+			return true
+		}
+		ft, found := e.provider.FindFieldType(msgType, sel.GetField())
+		// Fields of type google.protobuf.Value, which are typed as `dyn`, may be set to null.
+		if !found || !ft.SupportsPresence || ft.Type.GetDyn() != nil {
+			return true
+		}
+		issues = append(issues, newValidationIssue(ast, expr.GetId(), SeverityWarning,
+			"prefer 'has(%s)' to comparing the field to null", unparseOrDefault(ast, field)))
+		return true
+	})
+	return issues
+}
+
+// reversedComparisons maps comparison operators to the operator which yields the same result
+// when the operands are swapped.
+var reversedComparisons = map[string]string{
+	operators.Equals:        operators.Equals,
+	operators.NotEquals:     operators.NotEquals,
+	operators.Less:          operators.Greater,
+	operators.LessEquals:    operators.GreaterEquals,
+	operators.Greater:       operators.Less,
+	operators.GreaterEquals: operators.LessEquals,
+}
+
+// sizeOperand returns the argument of a `size(x)` or `x.size()` call, or nil if the expression
+// is not a size call.
+func sizeOperand(e *exprpb.Expr) *exprpb.Expr {
+	call := e.GetCallExpr()
+	if call.GetFunction() != overloads.Size {
+		return nil
+	}
+	switch {
+	case call.GetTarget() == nil && len(call.GetArgs()) == 1:
+		return call.GetArgs()[0]
+	case call.GetTarget() != nil && len(call.GetArgs()) == 0:
+		return call.GetTarget()
+	}
+	return nil
+}
+
+// emptyLiteral returns the source text of the empty value of the type, if the type has one.
+func emptyLiteral(t *exprpb.Type) (string, bool) {
+	switch {
+	case t.GetListType() != nil:
+		return "[]", true
+	case t.GetMapType() != nil:
+		return "{}", true
+	case t.GetPrimitive() == exprpb.Type_STRING:
+		return `""`, true
+	case t.GetPrimitive() == exprpb.Type_BYTES:
+		return `b""`, true
+	}
+	return "", false
+}
+
+func intLiteral(e *exprpb.Expr) (int64, bool) {
+	c, ok := e.GetConstExpr().GetConstantKind().(*exprpb.Constant_Int64Value)
+	if !ok {
+		return 0, false
+	}
+	return c.Int64Value, true
+}
+
+func isNullLiteral(e *exprpb.Expr) bool {
+	_, ok := e.GetConstExpr().GetConstantKind().(*exprpb.Constant_NullValue)
+	return ok
+}
+
+// unparseOrDefault returns the source text of the expression, or a placeholder if the expression
+// cannot be unparsed.
+func unparseOrDefault(ast *Ast, e *exprpb.Expr) string {
+	text, err := parser.Unparse(e, ast.SourceInfo())
+	if err != nil {
+		return "x"
+	}
+	return text
+}
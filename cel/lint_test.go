@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+
+	proto3pb "github.com/google/cel-go/test/proto3pb"
+)
+
+func TestLintRules(t *testing.T) {
+	env, err := NewEnv(
+		Types(&proto3pb.TestAllTypes{}),
+		Declarations(
+			decls.NewVar("l", decls.NewListType(decls.Int)),
+			decls.NewVar("m", decls.NewMapType(decls.String, decls.Int)),
+			decls.NewVar("s", decls.String),
+			decls.NewVar("b", decls.Bytes),
+			decls.NewVar("d", decls.Dyn),
+			decls.NewVar("msg", decls.NewObjectType("google.expr.proto3.test.TestAllTypes"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		rule Validator
+		out  []string
+	}{
+		{expr: `size(s) == 0`, rule: PreferEmptyCheck(),
+			out: []string{`WARNING: 1:9: prefer 's == ""' to comparing the size`}},
+		{expr: `0 == b.size() || size(m) < 1`, rule: PreferEmptyCheck(),
+			out: []string{
+				`WARNING: 1:3: prefer 'b == b""' to comparing the size`,
+				`WARNING: 1:26: prefer 'm == {}' to comparing the size`,
+			}},
+		{expr: `size(l) > 0`, rule: PreferEmptyCheck()},
+		{expr: `size(d) == 0`, rule: PreferEmptyCheck()},
+		{expr: `size(l) > 0`, rule: PreferNonEmptyCheck(),
+			out: []string{`WARNING: 1:9: prefer 'l != []' to comparing the size`}},
+		{expr: `0 != size(s) && size(m) >= 1`, rule: PreferNonEmptyCheck(),
+			out: []string{
+				`WARNING: 1:3: prefer 's != ""' to comparing the size`,
+				`WARNING: 1:25: prefer 'm != {}' to comparing the size`,
+			}},
+		{expr: `size(l) > 1 || size(s) == 0`, rule: PreferNonEmptyCheck()},
+		{expr: `size(d) != 0 && size(d) > 0`, rule: PreferNonEmptyCheck()},
+		{expr: `msg.single_nested_message != null`, rule: PreferHasOverNotEquals(),
+			out: []string{
+				`WARNING: 1:27: prefer 'has(msg.single_nested_message)' to comparing the field to null`,
+			}},
+		{expr: `null != msg.single_any`, rule: PreferHasOverNotEquals(),
+			out: []string{
+				`WARNING: 1:6: prefer 'has(msg.single_any)' to comparing the field to null`,
+			}},
+		{expr: `msg.single_value != null && d.field != null`, rule: PreferHasOverNotEquals()},
+	}
+	for _, tc := range tests {
+		ast, iss := env.Compile(tc.expr)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		issues, err := env.Validate(ast, tc.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(issues) != len(tc.out) {
+			t.Errorf("%s: got issues %v, wanted %v", tc.expr, issues, tc.out)
+			continue
+		}
+		for i, issue := range issues {
+			if issue.String() != tc.out[i] {
+				t.Errorf("%s: got issue %q, wanted %q", tc.expr, issue, tc.out[i])
+			}
+		}
+	}
+}
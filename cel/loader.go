@@ -0,0 +1,189 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/common"
+)
+
+// FSLoader reads, parses, and type-checks CEL expressions stored as `.cel` files within a
+// file system, such as an `embed.FS` bundled into a binary and adapted with `http.FS`, or a
+// directory opened with `http.Dir`.
+type FSLoader struct {
+	fsys      http.FileSystem
+	env       *Env
+	container string
+}
+
+// NewFSLoader creates an FSLoader which compiles the expressions found within the file system
+// using the given environment and container.
+//
+// When the container is non-empty, the environment is extended with the container prior to
+// compilation.
+func NewFSLoader(fsys http.FileSystem, env *Env, container string) *FSLoader {
+	return &FSLoader{
+		fsys:      fsys,
+		env:       env,
+		container: container,
+	}
+}
+
+// LoadAll compiles all `.cel` files whose names match the glob pattern and returns a map from
+// file name to Program.
+//
+// File names are slash-separated paths relative to the root of the file system, such as
+// `policies/allow.cel`, and are matched against the pattern with path.Match.
+//
+// Files are parsed and checked in parallel by a pool of at most GOMAXPROCS workers. Failures for individual files do not prevent other
+// files from being loaded: the programs which compiled successfully are returned alongside a
+// LoadErrors value which records the failures by file name.
+func (l *FSLoader) LoadAll(pattern string) (map[string]Program, error) {
+	matches, err := l.glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	env := l.env
+	if l.container != "" {
+		env, err = env.Extend(Container(l.container))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var names []string
+	for _, name := range matches {
+		if strings.HasSuffix(name, ".cel") {
+			names = append(names, name)
+		}
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(names) {
+		workers = len(names)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	progs := make(map[string]Program)
+	errs := make(LoadErrors)
+	work := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range work {
+				prg, err := l.load(env, name)
+				mu.Lock()
+				if err != nil {
+					errs[name] = err
+				} else {
+					progs[name] = prg
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range names {
+		work <- name
+	}
+	close(work)
+	wg.Wait()
+	if len(errs) != 0 {
+		return progs, errs
+	}
+	return progs, nil
+}
+
+// glob returns the names of the files within the file system which match the pattern.
+func (l *FSLoader) glob(pattern string) ([]string, error) {
+	// Check the pattern up front, since it may not be matched against any name.
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var matches []string
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		f, err := l.fsys.Open("/" + dir)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		infos, err := f.Readdir(-1)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			name := path.Join(dir, info.Name())
+			if info.IsDir() {
+				if err := walk(name); err != nil {
+					return err
+				}
+				continue
+			}
+			if matched, _ := path.Match(pattern, name); matched {
+				matches = append(matches, name)
+			}
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// load reads and compiles a single file into a Program.
+func (l *FSLoader) load(env *Env, name string) (Program, error) {
+	f, err := l.fsys.Open("/" + name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	ast, iss := env.CompileSource(common.NewStringSource(string(src), name))
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	return env.Program(ast)
+}
+
+// LoadErrors records the errors encountered while loading expression files, keyed by file name.
+type LoadErrors map[string]error
+
+// Error implements the Go error interface, reporting the errors in file name order.
+func (le LoadErrors) Error() string {
+	names := make([]string, 0, len(le))
+	for name := range le {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, le[name])
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+)
+
+func TestFSLoader(t *testing.T) {
+	fsys, dir := testFileSystem(t, map[string]string{
+		"policies/allow.cel":  `x > 1`,
+		"policies/deny.cel":   `x < 1`,
+		"policies/broken.cel": `y > 1`,
+		"policies/notes.txt":  `not an expression`,
+	})
+	defer os.RemoveAll(dir)
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	loader := NewFSLoader(fsys, env, "")
+	progs, err := loader.LoadAll("policies/*")
+	if err == nil {
+		t.Fatal("got nil error, wanted load errors")
+	}
+	loadErrs, ok := err.(LoadErrors)
+	if !ok || len(loadErrs) != 1 || loadErrs["policies/broken.cel"] == nil {
+		t.Errorf("got errors %v, wanted a single error for policies/broken.cel", err)
+	}
+	if len(progs) != 2 {
+		t.Fatalf("got %d programs, wanted 2", len(progs))
+	}
+	out, _, err := progs["policies/allow.cel"].Eval(map[string]interface{}{"x": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+}
+
+func TestFSLoader_Container(t *testing.T) {
+	fsys, dir := testFileSystem(t, map[string]string{
+		"a.cel": `x == 'hello'`,
+	})
+	defer os.RemoveAll(dir)
+	env, err := NewEnv(Declarations(decls.NewVar("pkg.x", decls.String)))
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	progs, err := NewFSLoader(fsys, env, "pkg").LoadAll("*.cel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := progs["a.cel"].Eval(map[string]interface{}{"pkg.x": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+}
+
+func TestFSLoader_ManyFiles(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		files[fmt.Sprintf("expr%d.cel", i)] = fmt.Sprintf("x == %d", i)
+	}
+	fsys, dir := testFileSystem(t, files)
+	defer os.RemoveAll(dir)
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	progs, err := NewFSLoader(fsys, env, "").LoadAll("*.cel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progs) != len(files) {
+		t.Errorf("got %d programs, wanted %d", len(progs), len(files))
+	}
+}
+
+// testFileSystem writes the files to a temporary directory and returns the file system along with
+// the directory, which the caller is responsible for removing.
+func testFileSystem(t *testing.T, files map[string]string) (http.FileSystem, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return http.Dir(dir), dir
+}
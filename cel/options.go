@@ -16,7 +16,9 @@ package cel
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/google/cel-go/checker"
 	"github.com/google/cel-go/common/containers"
 	"github.com/google/cel-go/common/types/pb"
 	"github.com/google/cel-go/common/types/ref"
@@ -24,6 +26,7 @@ import (
 	"github.com/google/cel-go/interpreter/functions"
 	"github.com/google/cel-go/parser"
 
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -105,6 +108,15 @@ func Features(flags ...int) EnvOption {
 	}
 }
 
+// CheckerMiddleware option appends middleware which intercepts the type-checking of each
+// expression node, as described by checker.WithMiddleware.
+func CheckerMiddleware(m ...checker.Middleware) EnvOption {
+	return func(e *Env) (*Env, error) {
+		e.chkMiddleware = append(e.chkMiddleware, m...)
+		return e, nil
+	}
+}
+
 // HomogeneousAggregateLiterals option ensures that list and map literal entry types must agree
 // during type-checking.
 //
@@ -317,6 +329,138 @@ func CustomDecorator(dec interpreter.InterpretableDecorator) ProgramOption {
 	}
 }
 
+// ExpressionPanicRecovery converts panics raised during program evaluation into error values
+// which wrap an interpreter.EvalError with the code interpreter.ErrInternalPanic.
+//
+// The recovery is installed once at the root of the expression, outside of any other decorators.
+// Options such as interpreter.WithPanicLogger configure how the panics are reported.
+func ExpressionPanicRecovery(opts ...interpreter.PanicRecoveryOption) ProgramOption {
+	return func(p *prog) (*prog, error) {
+		p.panicRecovery = true
+		p.panicRecoveryOpts = opts
+		return p, nil
+	}
+}
+
+// ExpressionIsolation evaluates the program on a goroutine of its own, abandoning evaluations
+// which do not complete within the timeout, as described by interpreter.WithIsolation. A timeout
+// of zero waits for the evaluation to complete.
+//
+// The isolation is installed once at the root of the expression, after any other decorators.
+func ExpressionIsolation(timeout time.Duration) ProgramOption {
+	return func(p *prog) (*prog, error) {
+		p.isolate = true
+		p.isolationTimeout = timeout
+		return p, nil
+	}
+}
+
+// ExpressionTracer traces program evaluation with spans created by the tracer as children of the
+// span within the context of the evaluation, as described by interpreter.WithOTelTracing. The
+// context is supplied by evaluating the program with an activation created by
+// interpreter.NewContextActivation.
+func ExpressionTracer(tracer trace.Tracer, threshold time.Duration) ProgramOption {
+	return CustomDecorator(interpreter.WithOTelTracing(tracer, threshold))
+}
+
+// ExpressionContextFunctions binds functions to implementations which receive the context of the
+// evaluation, as described by interpreter.WithContextFunctions. The context is supplied by
+// evaluating the program with an activation created by interpreter.NewContextActivation.
+func ExpressionContextFunctions(fns map[string]functions.ContextFunctionOp) ProgramOption {
+	return CustomDecorator(interpreter.WithContextFunctions(fns))
+}
+
+// ExpressionAccessLogging records the variable accesses of evaluations for AccessLog, as described
+// by interpreter.WithAccessLogging.
+func ExpressionAccessLogging() ProgramOption {
+	return func(p *prog) (*prog, error) {
+		p.accessLogging = true
+		p.decorators = append(p.decorators, interpreter.WithAccessLogging())
+		return p, nil
+	}
+}
+
+// ExpressionMemoryAdaptation pauses large comprehensions for garbage collection when the heap is
+// under pressure, as described by interpreter.WithMemoryAdaptation.
+func ExpressionMemoryAdaptation(gcPressureThreshold float64) ProgramOption {
+	return CustomDecorator(interpreter.WithMemoryAdaptation(gcPressureThreshold))
+}
+
+// ExpressionInterpreterSampler evaluates the expression for only a fraction of the activations,
+// returning the passthrough value for the others, as described by interpreter.WithSampling.
+func ExpressionInterpreterSampler(rate float64,
+	passthrough ref.Val,
+	opts ...interpreter.SamplingOption) ProgramOption {
+	return func(p *prog) (*prog, error) {
+		if passthrough == nil {
+			return nil, fmt.Errorf("sampling requires a passthrough value")
+		}
+		p.sampler = interpreter.WithSampling(rate, passthrough, opts...)
+		return p, nil
+	}
+}
+
+// ExpressionSharding evaluates map and filter comprehensions over large lists in concurrent
+// partitions, as described by interpreter.WithSharding.
+func ExpressionSharding(shards int, opts ...interpreter.ShardingOption) ProgramOption {
+	return CustomDecorator(interpreter.WithSharding(shards, opts...))
+}
+
+// InterpreterStats collects counts of program evaluations, comprehension evaluations,
+// short-circuits, and function calls within the stats, as described by interpreter.Stats.
+//
+// Programs created without this option may still have their evaluations counted by WrapStats,
+// which does not count the evaluations of programs created with this option a second time.
+func InterpreterStats(stats *interpreter.Stats) ProgramOption {
+	return func(p *prog) (*prog, error) {
+		p.stats = stats
+		return p, nil
+	}
+}
+
+// InterpreterMetricsHook reports evaluations, comprehension iterations, and function calls to
+// the hook, as described by interpreter.MetricsHook. Evaluations are identified by the
+// HashExpression of the program's Ast. The interpreter/prometheus package provides a hook which
+// records them as Prometheus metrics.
+func InterpreterMetricsHook(hook interpreter.MetricsHook) ProgramOption {
+	return func(p *prog) (*prog, error) {
+		p.metrics = hook
+		return p, nil
+	}
+}
+
+// SubExprDeduplication evaluates sub-expressions which occur more than once within the expression
+// only once per evaluation, sharing the result between the occurrences.
+//
+// The option has no effect when the OptTrackState or OptExhaustiveEval flags are set, since the
+// state of every occurrence is expected to be recorded.
+func SubExprDeduplication() ProgramOption {
+	return func(p *prog) (*prog, error) {
+		p.dedup = true
+		return p, nil
+	}
+}
+
+// ReplayProtection rejects evaluations with the same variables as an evaluation already recorded
+// in the store. Rejected evaluations return an error whose Value is interpreter.ErrReplay.
+//
+// Nonces are keyed with the secret, which must not be empty and should be shared by all of the
+// processes using the store. See interpreter.WithReplayProtection for how nonces are computed and
+// when they are stored.
+func ReplayProtection(store interpreter.NonceStore, secret []byte) ProgramOption {
+	return func(p *prog) (*prog, error) {
+		if store == nil {
+			return nil, fmt.Errorf("replay protection requires a nonce store")
+		}
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("replay protection requires a non-empty secret")
+		}
+		p.replayStore = store
+		p.replaySecret = secret
+		return p, nil
+	}
+}
+
 // Functions adds function overloads that extend or override the set of CEL built-ins.
 func Functions(funcs ...*functions.Overload) ProgramOption {
 	return func(p *prog) (*prog, error) {
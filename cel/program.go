@@ -17,6 +17,7 @@ package cel
 import (
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
@@ -92,7 +93,10 @@ func (ed *EvalDetails) State() interpreter.EvalState {
 
 // prog is the internal implementation of the Program interface.
 type prog struct {
-	*Env
+	// watchers are the watchers of the Env the program was created within. Once a watcher is
+	// registered, the program does not keep the Env reachable, so that the watcher's Updates
+	// channel may be closed when the Env is collected while the program is in use.
+	watchers      *watcherSet
 	evalOpts      EvalOption
 	decorators    []interpreter.InterpretableDecorator
 	defaultVars   interpreter.Activation
@@ -100,6 +104,32 @@ type prog struct {
 	interpreter   interpreter.Interpreter
 	interpretable interpreter.Interpretable
 	attrFactory   interpreter.AttributeFactory
+	ast           *Ast
+	// deps holds the variables referenced by the Ast, computed once when the program is created.
+	deps []string
+	// opts are the options supplied to Env.Program, excluding those of the Env.
+	opts []ProgramOption
+	// stats, when non-nil, collects interpreter statistics for the program.
+	stats *interpreter.Stats
+	// metrics, when non-nil, receives interpreter metrics for the program.
+	metrics interpreter.MetricsHook
+	// dedup, when true, evaluates repeated sub-expressions once per evaluation.
+	dedup bool
+	// replayStore, when non-nil, records the nonces of evaluations to reject replays.
+	replayStore  interpreter.NonceStore
+	replaySecret []byte
+	// sampler, when non-nil, is the sampling decorator for the program.
+	sampler interpreter.InterpretableDecorator
+	// panicRecovery, when true, converts panics during evaluation into error values.
+	panicRecovery     bool
+	panicRecoveryOpts []interpreter.PanicRecoveryOption
+	// accessLogging, when true, records the variable accesses of evaluations for AccessLog.
+	accessLogging bool
+	// isolate, when true, evaluates the program on a goroutine of its own.
+	isolate          bool
+	isolationTimeout time.Duration
+	// priority orders the evaluations of the program which wait for a Throttle.
+	priority int
 }
 
 // progFactory is a helper alias for marking a program creation factory function.
@@ -108,22 +138,35 @@ type progFactory func(interpreter.EvalState) (Program, error)
 // progGen holds a reference to a progFactory instance and implements the Program interface.
 type progGen struct {
 	factory progFactory
+	// base is the configured program from which the factory creates its programs. It is not
+	// planned, but holds the Ast and the options of the programs.
+	base *prog
 }
 
 // newProgram creates a program instance with an environment, an ast, and an optional list of
 // ProgramOption values.
 //
 // If the program cannot be configured the prog will be nil, with a non-nil error response.
-func newProgram(e *Env, ast *Ast, opts []ProgramOption) (Program, error) {
+func newProgram(e *Env, ast *Ast, progOpts []ProgramOption) (Program, error) {
+	opts := e.progOpts
+	if len(progOpts) != 0 {
+		opts = []ProgramOption{}
+		opts = append(opts, e.progOpts...)
+		opts = append(opts, progOpts...)
+	}
+
 	// Build the dispatcher, interpreter, and default program value.
 	disp := interpreter.NewDispatcher()
 
 	// Ensure the default attribute factory is set after the adapter and provider are
 	// configured.
 	p := &prog{
-		Env:        e,
+		watchers:   e.watcherSet(),
 		decorators: []interpreter.InterpretableDecorator{},
 		dispatcher: disp,
+		ast:        ast,
+		deps:       dependencies(ast),
+		opts:       progOpts,
 	}
 
 	// Configure the program via the ProgramOption values.
@@ -156,49 +199,96 @@ func newProgram(e *Env, ast *Ast, opts []ProgramOption) (Program, error) {
 	if p.evalOpts&OptOptimize == OptOptimize {
 		decorators = append(decorators, interpreter.Optimize())
 	}
+	// Instrument the plan after the optimizations which inspect function calls.
+	if p.stats != nil {
+		decorators = append(decorators, p.stats.Decorator())
+	}
+	if p.metrics != nil {
+		decorators = append(decorators, interpreter.WithMetricsHook(p.metrics))
+	}
+	// Decorators which intercept the whole evaluation are created once, so that the programs
+	// created by a factory share them, and applied last so that they enclose other interceptors.
+	rootDecorators := p.rootDecorators()
 	// Enable exhaustive eval over state tracking since it offers a superset of features.
 	if p.evalOpts&OptExhaustiveEval == OptExhaustiveEval {
 		// State tracking requires that each Eval() call operate on an isolated EvalState
 		// object; hence, the presence of the factory.
 		factory := func(state interpreter.EvalState) (Program, error) {
 			decs := append(decorators, interpreter.ExhaustiveEval(state))
+			decs = append(decs, rootDecorators...)
 			clone := &prog{
 				evalOpts:    p.evalOpts,
 				defaultVars: p.defaultVars,
-				Env:         e,
+				watchers:    p.watchers,
 				dispatcher:  disp,
-				interpreter: interp}
+				interpreter: interp,
+				deps:        p.deps,
+				opts:        progOpts,
+				stats:       p.stats,
+				metrics:     p.metrics}
 			return initInterpretable(clone, ast, decs)
 		}
-		return initProgGen(factory)
+		return initProgGen(factory, p)
 	}
 	// Enable state tracking last since it too requires the factory approach but is less
 	// featured than the ExhaustiveEval decorator.
 	if p.evalOpts&OptTrackState == OptTrackState {
 		factory := func(state interpreter.EvalState) (Program, error) {
 			decs := append(decorators, interpreter.TrackState(state))
+			decs = append(decs, rootDecorators...)
 			clone := &prog{
 				evalOpts:    p.evalOpts,
 				defaultVars: p.defaultVars,
-				Env:         e,
+				watchers:    p.watchers,
 				dispatcher:  disp,
-				interpreter: interp}
+				interpreter: interp,
+				deps:        p.deps,
+				opts:        progOpts,
+				stats:       p.stats,
+				metrics:     p.metrics}
 			return initInterpretable(clone, ast, decs)
 		}
-		return initProgGen(factory)
+		return initProgGen(factory, p)
+	}
+	// Share repeated sub-expressions last, since the decorator wraps the planned nodes.
+	if p.dedup {
+		decorators = append(decorators, interpreter.WithSubExprDeduplication())
 	}
-	return initInterpretable(p, ast, decorators)
+	return initInterpretable(p, ast, append(decorators, rootDecorators...))
+}
+
+// rootDecorators returns the decorators which intercept the evaluation of the whole expression,
+// from the innermost to the outermost. Isolation is innermost so that rejected evaluations do not
+// start a goroutine, and sampling is outermost so that evaluations which are passed through do
+// not record a replay nonce.
+func (p *prog) rootDecorators() []interpreter.InterpretableDecorator {
+	var decorators []interpreter.InterpretableDecorator
+	if p.isolate {
+		decorators = append(decorators, interpreter.WithIsolation(p.isolationTimeout))
+	}
+	if p.replayStore != nil {
+		decorators = append(decorators,
+			interpreter.WithReplayProtection(p.replayStore, p.replaySecret))
+	}
+	if p.sampler != nil {
+		decorators = append(decorators, p.sampler)
+	}
+	if p.panicRecovery {
+		decorators = append(decorators, interpreter.WithPanicRecovery(p.panicRecoveryOpts...))
+	}
+	return decorators
 }
 
 // initProgGen tests the factory object by calling it once and returns a factory-based Program if
-// the test is successful.
-func initProgGen(factory progFactory) (Program, error) {
+// the test is successful. The configuration of the program is read from p, the program from which
+// the factory creates its programs.
+func initProgGen(factory progFactory, p *prog) (Program, error) {
 	// Test the factory to make sure that configuration errors are spotted at config
 	_, err := factory(interpreter.NewEvalState())
 	if err != nil {
 		return nil, err
 	}
-	return &progGen{factory: factory}, nil
+	return &progGen{factory: factory, base: p}, nil
 }
 
 // initIterpretable creates a checked or unchecked interpretable depending on whether the Ast
@@ -208,6 +298,7 @@ func initInterpretable(
 	ast *Ast,
 	decorators []interpreter.InterpretableDecorator) (Program, error) {
 	var err error
+	p.ast = ast
 	// Unchecked programs do not contain type and reference information and may be
 	// slower to execute than their checked counterparts.
 	if !ast.IsChecked() {
@@ -216,6 +307,10 @@ func initInterpretable(
 		if err != nil {
 			return nil, err
 		}
+		if p.metrics != nil {
+			p.interpretable = interpreter.NewMeteredProgram(
+				p.interpretable, p.metrics, HashExpression(ast))
+		}
 		return p, nil
 	}
 	// When the AST has been checked it contains metadata that can be used to speed up program
@@ -229,7 +324,10 @@ func initInterpretable(
 	if err != nil {
 		return nil, err
 	}
-
+	if p.metrics != nil {
+		p.interpretable = interpreter.NewMeteredProgram(
+			p.interpretable, p.metrics, HashExpression(ast))
+	}
 	return p, nil
 }
 
@@ -252,6 +350,9 @@ func (p *prog) Eval(input interface{}) (v ref.Val, det *EvalDetails, err error)
 		vars = interpreter.NewHierarchicalActivation(p.defaultVars, vars)
 	}
 	v = p.interpretable.Eval(vars)
+	if p.stats != nil {
+		p.stats.CountEval(v)
+	}
 	// The output of an internal Eval may have a value (`v`) that is a types.Err. This step
 	// translates the CEL value to a Go error response. This interface does not quite match the
 	// RPC signature which allows for multiple errors to be returned, but should be sufficient.
@@ -266,6 +367,11 @@ func (p *prog) Cost() (min, max int64) {
 	return estimateCost(p.interpretable)
 }
 
+// Dependencies implements the DependencyReporter interface method.
+func (p *prog) Dependencies() []string {
+	return append([]string{}, p.deps...)
+}
+
 // Eval implements the Program interface method.
 func (gen *progGen) Eval(input interface{}) (ref.Val, *EvalDetails, error) {
 	// The factory based Eval() differs from the standard evaluation model in that it generates a
@@ -300,6 +406,11 @@ func (gen *progGen) Cost() (min, max int64) {
 	return estimateCost(p)
 }
 
+// Dependencies implements the DependencyReporter interface method.
+func (gen *progGen) Dependencies() []string {
+	return gen.base.Dependencies()
+}
+
 var (
 	emptyEvalState = interpreter.NewEvalState()
 )
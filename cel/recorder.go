@@ -0,0 +1,141 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/cel-go/common/types/ref"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// ExpressionRecorder writes each distinct expression evaluated by its recorded programs to a sink,
+// so that the expressions seen in production can be collected into a test corpus.
+//
+// Each expression is written as a CheckedExpr proto, preceded by its length as a varint, the
+// first time a program for it is evaluated. Expressions are identified by HashExpression, so
+// programs for the same source are recorded once even when compiled separately. Parsed but
+// unchecked expressions are written as CheckedExpr values without type or reference maps.
+type ExpressionRecorder struct {
+	maxUnique int64
+	unique    int64
+	seen      sync.Map
+
+	mu   sync.Mutex
+	sink io.Writer
+	err  error
+}
+
+// NewExpressionRecorder creates an ExpressionRecorder which writes at most maxUnique distinct
+// expressions to the sink.
+func NewExpressionRecorder(sink io.Writer, maxUnique int) *ExpressionRecorder {
+	return &ExpressionRecorder{sink: sink, maxUnique: int64(maxUnique)}
+}
+
+// Wrap returns a RecordedProgram which records the expression of the program on its first
+// evaluation.
+//
+// The program must have been created by Env.Program.
+func (r *ExpressionRecorder) Wrap(prg Program) (*RecordedProgram, error) {
+	p, err := watchedProg(prg)
+	if err != nil {
+		return nil, err
+	}
+	checked := &exprpb.CheckedExpr{
+		Expr:         p.ast.Expr(),
+		SourceInfo:   p.ast.SourceInfo(),
+		ReferenceMap: p.ast.refMap,
+		TypeMap:      p.ast.typeMap,
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(checked)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordedProgram{
+		prg:      prg,
+		recorder: r,
+		hash:     HashExpression(p.ast),
+		data:     data,
+	}, nil
+}
+
+// Len returns the number of distinct expressions written to the sink.
+func (r *ExpressionRecorder) Len() int {
+	n := atomic.LoadInt64(&r.unique)
+	if n > r.maxUnique {
+		n = r.maxUnique
+	}
+	return int(n)
+}
+
+// Err returns the first error encountered while writing to the sink, if any. Once a write fails,
+// no further expressions are recorded.
+func (r *ExpressionRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *ExpressionRecorder) record(hash uint64, data []byte) {
+	if atomic.LoadInt64(&r.unique) >= r.maxUnique {
+		return
+	}
+	if _, loaded := r.seen.LoadOrStore(hash, struct{}{}); loaded {
+		return
+	}
+	if atomic.AddInt64(&r.unique, 1) > r.maxUnique {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(data))
+	n := binary.PutUvarint(buf, uint64(len(data)))
+	_, r.err = r.sink.Write(append(buf[:n], data...))
+}
+
+// RecordedProgram is a Program which reports its expression to an ExpressionRecorder on its first
+// evaluation.
+type RecordedProgram struct {
+	prg      Program
+	recorder *ExpressionRecorder
+	hash     uint64
+	data     []byte
+	recorded int32
+}
+
+// Eval implements the Program interface method, recording the program's expression if it has not
+// been recorded already and then evaluating the underlying program.
+//
+// After the first evaluation, recording costs a single atomic load.
+func (rp *RecordedProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	if atomic.LoadInt32(&rp.recorded) == 0 && atomic.CompareAndSwapInt32(&rp.recorded, 0, 1) {
+		rp.recorder.record(rp.hash, rp.data)
+	}
+	return rp.prg.Eval(vars)
+}
+
+// Program returns the underlying program.
+func (rp *RecordedProgram) Program() Program {
+	return rp.prg
+}
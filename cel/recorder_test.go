@@ -0,0 +1,146 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestExpressionRecorder(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	var sink bytes.Buffer
+	rec := NewExpressionRecorder(&sink, 2)
+	wrap := func(src string) *RecordedProgram {
+		t.Helper()
+		ast, iss := env.Compile(src)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("env.Program() failed: %v", err)
+		}
+		rp, err := rec.Wrap(prg)
+		if err != nil {
+			t.Fatalf("Wrap() failed: %v", err)
+		}
+		return rp
+	}
+	vars := map[string]interface{}{"x": 1}
+	programs := []*RecordedProgram{
+		wrap(`x + 1`), wrap(`x + 1`), wrap(`x > 0`), wrap(`x < 0`),
+	}
+	var wg sync.WaitGroup
+	for _, rp := range programs {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(rp *RecordedProgram) {
+				defer wg.Done()
+				if _, _, err := rp.Eval(vars); err != nil {
+					t.Errorf("Eval() failed: %v", err)
+				}
+			}(rp)
+		}
+	}
+	wg.Wait()
+	if rec.Len() != 2 {
+		t.Errorf("Len() got %d, wanted 2", rec.Len())
+	}
+	if err := rec.Err(); err != nil {
+		t.Errorf("Err() got %v, wanted nil", err)
+	}
+
+	r := bufio.NewReader(&sink)
+	var exprs []*exprpb.CheckedExpr
+	for {
+		n, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("binary.ReadUvarint() failed: %v", err)
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatalf("io.ReadFull() failed: %v", err)
+		}
+		checked := &exprpb.CheckedExpr{}
+		if err := proto.Unmarshal(data, checked); err != nil {
+			t.Fatalf("proto.Unmarshal() failed: %v", err)
+		}
+		exprs = append(exprs, checked)
+	}
+	if len(exprs) != 2 {
+		t.Fatalf("got %d recorded expressions, wanted 2", len(exprs))
+	}
+	if proto.Equal(exprs[0], exprs[1]) {
+		t.Error("recorded the same expression twice")
+	}
+	for _, checked := range exprs {
+		if len(checked.GetTypeMap()) == 0 {
+			t.Errorf("recorded expression has no type map: %v", checked)
+		}
+	}
+}
+
+func TestExpressionRecorderWriteError(t *testing.T) {
+	env, err := NewEnv()
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	rec := NewExpressionRecorder(failingWriter{}, 10)
+	ast, iss := env.Compile(`1 + 1`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("env.Program() failed: %v", err)
+	}
+	rp, err := rec.Wrap(prg)
+	if err != nil {
+		t.Fatalf("Wrap() failed: %v", err)
+	}
+	if _, _, err := rp.Eval(NoVars()); err != nil {
+		t.Errorf("Eval() failed: %v", err)
+	}
+	if rec.Err() == nil {
+		t.Error("Err() got nil, wanted write error")
+	}
+	if _, err := rec.Wrap(rp); err == nil {
+		t.Error("Wrap() of a program not created by an Env got nil error")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
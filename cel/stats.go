@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+// StatProgram is a Program whose evaluations and their outcomes are counted within an
+// interpreter.Stats value.
+type StatProgram struct {
+	prg   Program
+	stats *interpreter.Stats
+	// counted indicates that the program already counts its evaluations within the stats.
+	counted bool
+}
+
+// WrapStats returns a StatProgram which counts the evaluations of the program within the stats.
+//
+// Programs created with the InterpreterStats option already count their evaluations. When such a
+// program counts into the same stats, the StatProgram leaves the counting to the program so that
+// each evaluation is counted once.
+func WrapStats(stats *interpreter.Stats, prg Program) *StatProgram {
+	return &StatProgram{prg: prg, stats: stats, counted: programStats(prg) == stats}
+}
+
+// programStats returns the stats of a program created by Env.Program, looking through the
+// wrappers which return their underlying program.
+func programStats(prg Program) *interpreter.Stats {
+	for {
+		switch p := prg.(type) {
+		case *prog:
+			return p.stats
+		case *progGen:
+			return p.base.stats
+		case interface{ Program() Program }:
+			prg = p.Program()
+		default:
+			return nil
+		}
+	}
+}
+
+// Eval implements the Program interface method.
+func (sp *StatProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	val, det, err := sp.prg.Eval(vars)
+	if sp.counted {
+		return val, det, err
+	}
+	if val == nil && err != nil {
+		sp.stats.CountEval(types.WrapErr(err))
+	} else {
+		sp.stats.CountEval(val)
+	}
+	return val, det, err
+}
+
+// Program returns the underlying program.
+func (sp *StatProgram) Program() Program {
+	return sp.prg
+}
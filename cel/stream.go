@@ -0,0 +1,181 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/common"
+)
+
+const (
+	// streamDelimiter separates multi-line expressions within an ExpressionStream.
+	streamDelimiter = "---"
+
+	// streamBufferSize is the number of compiled expressions buffered ahead of the reader.
+	streamBufferSize = 8
+)
+
+// ExpressionStream parses, checks, and plans a sequence of expressions read from an io.Reader.
+//
+// By default each non-blank line of input is treated as a separate expression. When the first
+// non-blank line of input is the delimiter `---`, the stream is read as a series of documents
+// where the text between `---` lines forms a single, possibly multi-line, expression.
+//
+// Expressions are compiled in a background goroutine which buffers up to eight results ahead of
+// the consumer. Call Close to release the goroutine when the stream is abandoned before io.EOF.
+type ExpressionStream struct {
+	results chan streamResult
+	done    chan struct{}
+	once    sync.Once
+}
+
+// StreamError describes an invalid expression within an ExpressionStream.
+type StreamError struct {
+	// Index is the zero-based position of the expression within the stream.
+	Index int
+
+	// Line is the one-based line number at which the expression begins.
+	Line int
+
+	// Issues are the parse and check issues reported for the expression.
+	Issues *Issues
+}
+
+// Error implements the Go error interface.
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("expression %d at line %d: %s", e.Index, e.Line, e.Issues.String())
+}
+
+type streamResult struct {
+	prg Program
+	err error
+}
+
+// NewExpressionStream creates an ExpressionStream which compiles the expressions read from `r`
+// using the given environment and container.
+//
+// When the container is non-empty, the environment is extended with the container prior to
+// compilation.
+func NewExpressionStream(r io.Reader, env *Env, container string) *ExpressionStream {
+	s := &ExpressionStream{
+		results: make(chan streamResult, streamBufferSize),
+		done:    make(chan struct{}),
+	}
+	go s.run(r, env, container)
+	return s
+}
+
+// Next returns the next compiled expression within the stream.
+//
+// An invalid expression results in a *StreamError, but does not terminate the stream. Errors
+// reading from the underlying io.Reader are returned as-is and terminate the stream. Once the
+// stream has been exhausted, Next returns io.EOF.
+func (s *ExpressionStream) Next() (Program, error) {
+	res, ok := <-s.results
+	if !ok {
+		return nil, io.EOF
+	}
+	return res.prg, res.err
+}
+
+// Close stops the compilation of any further expressions from the stream.
+func (s *ExpressionStream) Close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// run reads and compiles expressions until the reader is exhausted or the stream is closed.
+func (s *ExpressionStream) run(r io.Reader, env *Env, container string) {
+	defer close(s.results)
+	var err error
+	if container != "" {
+		env, err = env.Extend(Container(container))
+		if err != nil {
+			s.send(streamResult{err: err})
+			return
+		}
+	}
+	index := 0
+	emit := func(txt string, line int) bool {
+		if strings.TrimSpace(txt) == "" {
+			return true
+		}
+		prg, err := compileStreamExpr(env, txt, index, line)
+		index++
+		return s.send(streamResult{prg: prg, err: err})
+	}
+
+	scanner := bufio.NewScanner(r)
+	var docMode, started bool
+	var doc []string
+	docLine, lineNum := 0, 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		isDelim := strings.TrimSpace(line) == streamDelimiter
+		if !started {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			started = true
+			docMode = isDelim
+		}
+		if !docMode {
+			if !emit(line, lineNum) {
+				return
+			}
+			continue
+		}
+		if isDelim {
+			if !emit(strings.Join(doc, "\n"), docLine) {
+				return
+			}
+			doc = doc[:0]
+			docLine = lineNum + 1
+			continue
+		}
+		doc = append(doc, line)
+	}
+	if docMode && !emit(strings.Join(doc, "\n"), docLine) {
+		return
+	}
+	if err := scanner.Err(); err != nil {
+		s.send(streamResult{err: err})
+	}
+}
+
+// send publishes a result to the consumer, returning false if the stream has been closed.
+func (s *ExpressionStream) send(res streamResult) bool {
+	select {
+	case s.results <- res:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func compileStreamExpr(env *Env, txt string, index, line int) (Program, error) {
+	ast, iss := env.CompileSource(common.NewTextSource(txt))
+	if iss.Err() != nil {
+		return nil, &StreamError{Index: index, Line: line, Issues: iss}
+	}
+	return env.Program(ast)
+}
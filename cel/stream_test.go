@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+func TestExpressionStream(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	in := "x > 1\n\ny > 1\nx < 1\n"
+	stream := NewExpressionStream(strings.NewReader(in), env, "")
+	defer stream.Close()
+
+	prg, err := stream.Next()
+	if err != nil {
+		t.Fatalf("Next() failed: %v", err)
+	}
+	out, _, err := prg.Eval(map[string]interface{}{"x": 2})
+	if err != nil || out != types.True {
+		t.Errorf("got %v, %v, wanted true", out, err)
+	}
+	_, err = stream.Next()
+	streamErr, ok := err.(*StreamError)
+	if !ok {
+		t.Fatalf("got %v, wanted *StreamError", err)
+	}
+	if streamErr.Index != 1 || streamErr.Line != 3 {
+		t.Errorf("got index %d, line %d, wanted index 1, line 3", streamErr.Index, streamErr.Line)
+	}
+	if _, err = stream.Next(); err != nil {
+		t.Fatalf("Next() failed: %v", err)
+	}
+	if _, err = stream.Next(); err != io.EOF {
+		t.Errorf("got %v, wanted io.EOF", err)
+	}
+}
+
+func TestExpressionStream_Delimited(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("pkg.x", decls.Int)))
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	in := `---
+x > 1
+  && x < 10
+---
+x == 1
+---
+`
+	stream := NewExpressionStream(strings.NewReader(in), env, "pkg")
+	defer stream.Close()
+
+	var results []ref.Val
+	for {
+		prg, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		out, _, err := prg.Eval(map[string]interface{}{"pkg.x": 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, out)
+	}
+	if len(results) != 2 || results[0] != types.True || results[1] != types.False {
+		t.Errorf("got %v, wanted [true, false]", results)
+	}
+}
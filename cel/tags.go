@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// TaggedProgram is a Program labelled with arbitrary key-value tags, such as `io: none`, which
+// may be used to route the program to a suitable evaluation backend.
+type TaggedProgram struct {
+	prg  Program
+	tags map[string]string
+}
+
+// NewTaggedProgram labels the program with a copy of the given tags.
+func NewTaggedProgram(prg Program, tags map[string]string) *TaggedProgram {
+	return &TaggedProgram{prg: prg, tags: copyTags(tags)}
+}
+
+// Eval implements the Program interface method by evaluating the underlying program.
+func (tp *TaggedProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	return tp.prg.Eval(vars)
+}
+
+// Program returns the underlying program.
+func (tp *TaggedProgram) Program() Program {
+	return tp.prg
+}
+
+// Tag returns the value of the tag with the given key, and whether the tag is set.
+func (tp *TaggedProgram) Tag(key string) (string, bool) {
+	val, found := tp.tags[key]
+	return val, found
+}
+
+// Tags returns a copy of the program's tags.
+func (tp *TaggedProgram) Tags() map[string]string {
+	return copyTags(tp.tags)
+}
+
+// MarshalJSON encodes the program's tags as a JSON object with sorted keys.
+//
+// The program itself is not serialized; use UnmarshalTags and NewTaggedProgram to restore the
+// tags onto a program compiled from the same source.
+func (tp *TaggedProgram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tp.tags)
+}
+
+// UnmarshalTags decodes the tags encoded by TaggedProgram.MarshalJSON.
+func UnmarshalTags(data []byte) (map[string]string, error) {
+	tags := map[string]string{}
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// TagIndex is a registry of tagged programs which may be searched by tag. It is safe for
+// concurrent use.
+type TagIndex struct {
+	mu       sync.RWMutex
+	programs map[string]*TaggedProgram
+}
+
+// NewTagIndex creates an empty TagIndex.
+func NewTagIndex() *TagIndex {
+	return &TagIndex{programs: map[string]*TaggedProgram{}}
+}
+
+// Register adds the tagged program to the index under the given id, replacing any program
+// previously registered with the same id.
+func (idx *TagIndex) Register(id string, tp *TaggedProgram) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.programs[id] = tp
+}
+
+// FindByTag returns the registered programs which have the tag key set to value, ordered by
+// their registration id.
+func (idx *TagIndex) FindByTag(key, value string) []*TaggedProgram {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var ids []string
+	for id, tp := range idx.programs {
+		if val, found := tp.tags[key]; found && val == value {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	found := make([]*TaggedProgram, len(ids))
+	for i, id := range ids {
+		found[i] = idx.programs[id]
+	}
+	return found
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	cp := make(map[string]string, len(tags))
+	for k, v := range tags {
+		cp[k] = v
+	}
+	return cp
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+)
+
+func TestTaggedProgram(t *testing.T) {
+	prg := compileProgram(t, `x + 1`)
+	tags := map[string]string{"io": "none", "backend": "gpu"}
+	tp := NewTaggedProgram(prg, tags)
+	tags["io"] = "network"
+	if val, found := tp.Tag("io"); !found || val != "none" {
+		t.Errorf("Tag(io) got %q, %v, wanted none", val, found)
+	}
+	out, _, err := tp.Eval(map[string]interface{}{"x": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != types.Int(3) {
+		t.Errorf("Eval() got %v, wanted 3", out)
+	}
+
+	data, err := json.Marshal(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"backend":"gpu","io":"none"}` {
+		t.Errorf("json.Marshal() got %s", data)
+	}
+	restored, err := UnmarshalTags(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, tp.Tags()) {
+		t.Errorf("UnmarshalTags() got %v, wanted %v", restored, tp.Tags())
+	}
+	if _, err := UnmarshalTags([]byte(`{"io": 1}`)); err == nil {
+		t.Error("UnmarshalTags() got no error for a non-string tag value")
+	}
+}
+
+func TestTagIndex(t *testing.T) {
+	prg := compileProgram(t, `x`)
+	a := NewTaggedProgram(prg, map[string]string{"io": "none", "backend": "gpu"})
+	b := NewTaggedProgram(prg, map[string]string{"io": "none"})
+	c := NewTaggedProgram(prg, map[string]string{"io": "network"})
+	idx := NewTagIndex()
+	idx.Register("c", c)
+	idx.Register("b", b)
+	idx.Register("a", a)
+
+	if got := idx.FindByTag("io", "none"); !reflect.DeepEqual(got, []*TaggedProgram{a, b}) {
+		t.Errorf("FindByTag(io, none) got %v, wanted [a b]", got)
+	}
+	if got := idx.FindByTag("backend", "gpu"); !reflect.DeepEqual(got, []*TaggedProgram{a}) {
+		t.Errorf("FindByTag(backend, gpu) got %v, wanted [a]", got)
+	}
+	if got := idx.FindByTag("backend", "cpu"); len(got) != 0 {
+		t.Errorf("FindByTag(backend, cpu) got %v, wanted none", got)
+	}
+
+	// Registering an id again replaces the program.
+	idx.Register("a", c)
+	if got := idx.FindByTag("io", "network"); !reflect.DeepEqual(got, []*TaggedProgram{c, c}) {
+		t.Errorf("FindByTag(io, network) got %v, wanted [c c]", got)
+	}
+}
+
+func compileProgram(t testing.TB, expr string, opts ...ProgramOption) Program {
+	t.Helper()
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prg
+}
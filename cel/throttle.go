@@ -0,0 +1,223 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/common/types/ref"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrThrottled is returned by a ThrottledProgram when no evaluation token could be acquired before
+// the context was done.
+var ErrThrottled = errors.New("evaluation throttled")
+
+// Throttle limits the rate of evaluations of the programs it wraps using a token bucket which
+// holds up to `burst` tokens and refills at `rate` tokens per second. Each evaluation takes one
+// token, so a single Throttle may be used to cap the evaluation capacity given to one tenant
+// across all of its programs.
+//
+// When the bucket is empty, evaluations wait for tokens in order of priority, and in order of
+// arrival among evaluations of equal priority.
+type Throttle struct {
+	limiter *rate.Limiter
+
+	mu      sync.Mutex
+	seq     int64
+	waiters []*throttleWaiter
+	timer   *time.Timer
+}
+
+type throttleWaiter struct {
+	priority int
+	seq      int64
+	// ready is closed once a token has been granted to the waiter.
+	ready chan struct{}
+}
+
+// NewThrottle creates a Throttle with a full bucket of `burst` tokens which refills at `limit`
+// tokens per second. A limit of zero or less admits only the initial burst, and a burst of less
+// than one is raised to one so that the bucket can hold a token.
+func NewThrottle(limit float64, burst int) *Throttle {
+	if limit < 0 {
+		limit = 0
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Throttle{limiter: rate.NewLimiter(rate.Limit(limit), burst)}
+}
+
+// WithPriority sets the priority of the program's evaluations when a Throttle which wraps the
+// program waits for tokens. Higher priorities are served first; the default priority is zero.
+func WithPriority(p int) ProgramOption {
+	return func(prg *prog) (*prog, error) {
+		prg.priority = p
+		return prg, nil
+	}
+}
+
+// Wrap returns a ThrottledProgram which takes a token from the throttle before each evaluation of
+// the program, at the priority set by the WithPriority option of the program.
+func (t *Throttle) Wrap(prg Program) *ThrottledProgram {
+	return &ThrottledProgram{prg: prg, throttle: t, priority: programPriority(prg)}
+}
+
+// programPriority returns the priority of a program created by Env.Program, looking through the
+// wrappers which return their underlying program.
+func programPriority(prg Program) int {
+	for {
+		switch p := prg.(type) {
+		case *prog:
+			return p.priority
+		case *progGen:
+			return p.base.priority
+		case interface{ Program() Program }:
+			prg = p.Program()
+		default:
+			return 0
+		}
+	}
+}
+
+// acquire takes a token from the bucket, waiting until one is granted or the context is done.
+func (t *Throttle) acquire(ctx context.Context, priority int) error {
+	t.mu.Lock()
+	t.seq++
+	w := &throttleWaiter{priority: priority, seq: t.seq, ready: make(chan struct{})}
+	t.enqueue(w)
+	t.dispatch()
+	granted := isClosed(w.ready)
+	if !granted && t.limiter.Limit() == 0 && ctx.Done() == nil {
+		// Without a refill rate or a deadline, the evaluation would wait forever.
+		t.remove(w)
+		t.mu.Unlock()
+		return ErrThrottled
+	}
+	t.mu.Unlock()
+	if granted {
+		return nil
+	}
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if isClosed(w.ready) {
+			// The token was granted as the context was done; use it rather than waste it.
+			return nil
+		}
+		t.remove(w)
+		return ErrThrottled
+	}
+}
+
+// enqueue inserts the waiter, keeping the waiters ordered by priority and then by arrival.
+func (t *Throttle) enqueue(w *throttleWaiter) {
+	i := len(t.waiters)
+	for i > 0 && t.waiters[i-1].priority < w.priority {
+		i--
+	}
+	t.waiters = append(t.waiters, nil)
+	copy(t.waiters[i+1:], t.waiters[i:])
+	t.waiters[i] = w
+}
+
+func (t *Throttle) remove(w *throttleWaiter) {
+	for i, other := range t.waiters {
+		if other == w {
+			t.waiters = append(t.waiters[:i], t.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatch grants the tokens available from the limiter to waiters in order. If waiters remain
+// and the limiter refills, a timer is scheduled to dispatch again once the next token is
+// available.
+//
+// The caller must hold the mutex.
+func (t *Throttle) dispatch() {
+	for len(t.waiters) > 0 {
+		now := time.Now()
+		r := t.limiter.ReserveN(now, 1)
+		if !r.OK() {
+			// The bucket is empty and never refills.
+			return
+		}
+		if wait := r.DelayFrom(now); wait > 0 {
+			// Return the token, since a waiter of higher priority may arrive before it is due.
+			r.CancelAt(now)
+			if t.timer == nil {
+				t.timer = time.AfterFunc(wait, func() {
+					t.mu.Lock()
+					defer t.mu.Unlock()
+					t.timer = nil
+					t.dispatch()
+				})
+			}
+			return
+		}
+		w := t.waiters[0]
+		t.waiters = t.waiters[1:]
+		close(w.ready)
+	}
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// ThrottledProgram is a Program whose evaluations are rate-limited by a Throttle.
+type ThrottledProgram struct {
+	prg      Program
+	throttle *Throttle
+	priority int
+}
+
+// Eval implements the Program interface method, waiting without a deadline for a token before
+// evaluating the program.
+//
+// When the throttle has no refill rate and its bucket is empty, ErrThrottled is returned rather
+// than waiting forever.
+func (tp *ThrottledProgram) Eval(vars interface{}) (ref.Val, *EvalDetails, error) {
+	return tp.ContextEval(context.Background(), vars)
+}
+
+// ContextEval waits for a token until the context is done before evaluating the program, and
+// returns ErrThrottled if no token was granted in time.
+func (tp *ThrottledProgram) ContextEval(ctx context.Context,
+	vars interface{}) (ref.Val, *EvalDetails, error) {
+	if err := tp.throttle.acquire(ctx, tp.priority); err != nil {
+		return nil, nil, err
+	}
+	return tp.prg.Eval(vars)
+}
+
+// Program returns the underlying program.
+func (tp *ThrottledProgram) Program() Program {
+	return tp.prg
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/common/types"
+)
+
+func TestThrottledProgram(t *testing.T) {
+	prg := compileProgram(t, `x + 1`)
+	vars := map[string]interface{}{"x": 1}
+
+	// Without a refill rate, only the burst is admitted.
+	tp := NewThrottle(0, 2).Wrap(prg)
+	for i := 0; i < 2; i++ {
+		out, _, err := tp.Eval(vars)
+		if err != nil {
+			t.Fatalf("Eval() #%d failed: %v", i, err)
+		}
+		if out != types.Int(2) {
+			t.Errorf("Eval() got %v, wanted 2", out)
+		}
+	}
+	if _, _, err := tp.Eval(vars); err != ErrThrottled {
+		t.Errorf("Eval() got error %v, wanted ErrThrottled", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := tp.ContextEval(ctx, vars); err != ErrThrottled {
+		t.Errorf("ContextEval() got error %v, wanted ErrThrottled", err)
+	}
+
+	// With a refill rate, evaluations wait for tokens.
+	tp = NewThrottle(100, 1).Wrap(prg)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, _, err := tp.Eval(vars); err != nil {
+			t.Fatalf("Eval() #%d failed: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("three evaluations took %v, wanted about 20ms", elapsed)
+	}
+
+	// A burst of less than one still admits evaluations at the refill rate.
+	tp = NewThrottle(100, 0).Wrap(prg)
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, _, err := tp.ContextEval(ctx, vars)
+		cancel()
+		if err != nil {
+			t.Fatalf("ContextEval() #%d with a zero burst failed: %v", i, err)
+		}
+	}
+}
+
+func TestThrottledProgram_Priority(t *testing.T) {
+	prg := compileProgram(t, `x + 1`)
+	vars := map[string]interface{}{"x": 1}
+	throttle := NewThrottle(20, 1)
+	low := throttle.Wrap(prg)
+	// The priority is found through wrappers of the program.
+	high := throttle.Wrap(NewTaggedProgram(
+		compileProgram(t, `x + 1`, WithPriority(1), EvalOptions(OptTrackState)), nil))
+	if _, _, err := low.Eval(vars); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queue a low-priority evaluation ahead of a high-priority one while the bucket is empty.
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	eval := func(name string, tp *ThrottledProgram) {
+		defer wg.Done()
+		if _, _, err := tp.Eval(vars); err != nil {
+			t.Errorf("%s Eval() failed: %v", name, err)
+		}
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+	}
+	wg.Add(2)
+	go eval("low", low)
+	time.Sleep(5 * time.Millisecond)
+	go eval("high", high)
+	wg.Wait()
+	if len(order) != 2 || order[0] != "high" {
+		t.Errorf("got evaluation order %v, wanted high first", order)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/walk"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Severity indicates how strongly a ValidationIssue should be acted upon.
+type Severity int
+
+const (
+	// SeverityWarning indicates an expression which is valid, but likely to be incorrect.
+	SeverityWarning Severity = iota + 1
+
+	// SeverityError indicates an expression which should be rejected.
+	SeverityError
+)
+
+// String returns the display name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "WARNING"
+	case SeverityError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ValidationIssue describes a problem reported by a Validator for an expression node.
+type ValidationIssue struct {
+	// ID of the expression node to which the issue applies.
+	ID int64
+
+	// Location of the expression node within the source, if known.
+	Location common.Location
+
+	// Severity of the issue.
+	Severity Severity
+
+	// Message describing the issue.
+	Message string
+}
+
+// String formats the issue as `<severity>: <line>:<column>: <message>`.
+func (v *ValidationIssue) String() string {
+	return fmt.Sprintf("%s: %d:%d: %s",
+		v.Severity, v.Location.Line(), v.Location.Column()+1, v.Message)
+}
+
+// Validator inspects a checked Ast for expressions which are well-typed, but likely to be
+// incorrect.
+type Validator interface {
+	// Validate returns the issues found within the checked Ast.
+	Validate(e *Env, ast *Ast) []*ValidationIssue
+}
+
+// Validate applies the validators to the checked Ast and returns the issues found, ordered by
+// source position.
+//
+// An error is returned if the Ast has not been type-checked.
+func (e *Env) Validate(ast *Ast, validators ...Validator) ([]*ValidationIssue, error) {
+	if !ast.IsChecked() {
+		return nil, errors.New("cannot validate unchecked ast")
+	}
+	var issues []*ValidationIssue
+	for _, v := range validators {
+		issues = append(issues, v.Validate(e, ast)...)
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		li, lj := issues[i].Location, issues[j].Location
+		if li.Line() != lj.Line() {
+			return li.Line() < lj.Line()
+		}
+		return li.Column() < lj.Column()
+	})
+	return issues, nil
+}
+
+// InvalidPresenceCheck returns a Validator which reports suspicious presence tests.
+//
+// A `has()` test on a field which does not support presence, such as a proto3 scalar field,
+// cannot distinguish an unset field from one set to the default value, and is reported as a
+// warning. A `has()` test on a map literal is reported as an error since the keys of the literal
+// are known without evaluating the test.
+func InvalidPresenceCheck() Validator {
+	return &presenceValidator{}
+}
+
+type presenceValidator struct{}
+
+// Validate implements the Validator interface method.
+func (*presenceValidator) Validate(e *Env, ast *Ast) []*ValidationIssue {
+	var issues []*ValidationIssue
+	walk.PreOrder(ast.Expr(), func(expr *exprpb.Expr) bool {
+		sel := expr.GetSelectExpr()
+		if sel == nil || !sel.GetTestOnly() {
+			return true
+		}
+		operand := sel.GetOperand()
+		if st := operand.GetStructExpr(); st != nil && st.GetMessageName() == "" {
+			issues = append(issues, newValidationIssue(ast, expr.GetId(), SeverityError,
+				"presence test on map literal key '%s' can be determined statically", sel.GetField()))
+			return true
+		}
+		msgType := ast.typeMap[operand.GetId()].GetMessageType()
+		if msgType == "" {
+			return true
+		}
+		ft, found := e.provider.FindFieldType(msgType, sel.GetField())
+		if !found || ft.SupportsPresence {
+			return true
+		}
+		// Presence tests on repeated and map fields test for a non-empty value.
+		if ft.Type.GetListType() != nil || ft.Type.GetMapType() != nil {
+			return true
+		}
+		issues = append(issues, newValidationIssue(ast, expr.GetId(), SeverityWarning,
+			"field '%s' of '%s' does not support presence, has() is true only for non-default values",
+			sel.GetField(), msgType))
+		return true
+	})
+	return issues
+}
+
+func newValidationIssue(ast *Ast, id int64, severity Severity,
+	format string, args ...interface{}) *ValidationIssue {
+	var loc common.Location = common.NoLocation
+	if offset, found := ast.SourceInfo().GetPositions()[id]; found {
+		if l, found := ast.Source().OffsetLocation(offset); found {
+			loc = l
+		}
+	}
+	return &ValidationIssue{
+		ID:       id,
+		Location: loc,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
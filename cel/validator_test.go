@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+
+	proto2pb "github.com/google/cel-go/test/proto2pb"
+	proto3pb "github.com/google/cel-go/test/proto3pb"
+)
+
+func TestInvalidPresenceCheck(t *testing.T) {
+	env, err := NewEnv(
+		Types(&proto2pb.TestAllTypes{}, &proto3pb.TestAllTypes{}),
+		Declarations(
+			decls.NewVar("p2", decls.NewObjectType("google.expr.proto2.test.TestAllTypes")),
+			decls.NewVar("p3", decls.NewObjectType("google.expr.proto3.test.TestAllTypes")),
+			decls.NewVar("m", decls.NewMapType(decls.String, decls.Int))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		out  []string
+	}{
+		{expr: `has(p2.single_int32)`},
+		{expr: `has(p3.single_nested_message)`},
+		{expr: `has(p3.single_int32_wrapper)`},
+		{expr: `has(p3.single_nested_enum)`},
+		{expr: `has(p3.standalone_enum) || has(p3.repeated_int32) || has(p3.map_string_string)`,
+			out: []string{
+				"WARNING: 1:4: field 'standalone_enum' of 'google.expr.proto3.test.TestAllTypes' " +
+					"does not support presence, has() is true only for non-default values",
+			}},
+		{expr: `has(m.key)`},
+		{expr: "has({'key': 1}.key) &&\nhas(p3.single_int32)",
+			out: []string{
+				"ERROR: 1:4: presence test on map literal key 'key' can be determined statically",
+				"WARNING: 2:4: field 'single_int32' of 'google.expr.proto3.test.TestAllTypes' " +
+					"does not support presence, has() is true only for non-default values",
+			}},
+	}
+	for _, tc := range tests {
+		ast, iss := env.Compile(tc.expr)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		issues, err := env.Validate(ast, InvalidPresenceCheck())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(issues) != len(tc.out) {
+			t.Errorf("%s: got issues %v, wanted %v", tc.expr, issues, tc.out)
+			continue
+		}
+		for i, issue := range issues {
+			if issue.String() != tc.out[i] {
+				t.Errorf("%s: got issue %q, wanted %q", tc.expr, issue, tc.out[i])
+			}
+		}
+	}
+}
+
+func TestValidate_Unchecked(t *testing.T) {
+	env, err := NewEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Parse(`has(a.b)`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	if _, err := env.Validate(ast, InvalidPresenceCheck()); err == nil {
+		t.Error("got no error validating an unchecked ast")
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// ProgramWatcher delivers a recompiled Program each time the Env of the watched program is
+// updated with Env.Update.
+//
+// Once a watcher is registered, neither the watcher nor the programs created by the Env keep the
+// Env reachable. Envs whose programs are never watched are not tracked at all. Once the Env and
+// every Env created from it by Update have been garbage collected, the Updates channel is closed.
+// Note, a delivered program which has not been received does refer to the Env it was compiled
+// within, so Updates should be drained for the Env to be collected.
+type ProgramWatcher struct {
+	set     *watcherSet
+	ast     *Ast
+	opts    []ProgramOption
+	updates chan Program
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// NewProgramWatcher creates a ProgramWatcher for a Program created by Env.Program.
+//
+// Checked programs are re-checked against the updated Env before being planned.
+func NewProgramWatcher(prg Program) (*ProgramWatcher, error) {
+	p, err := watchedProg(prg)
+	if err != nil {
+		return nil, err
+	}
+	w := &ProgramWatcher{
+		set:     p.watchers,
+		ast:     p.ast,
+		opts:    p.opts,
+		updates: make(chan Program, 1),
+	}
+	p.watchers.add(w)
+	return w, nil
+}
+
+// Updates returns the channel on which recompiled programs are delivered.
+//
+// Only the most recent program is buffered: if a program has not been received by the time the
+// Env is updated again, it is replaced by the newer one.
+func (w *ProgramWatcher) Updates() <-chan Program {
+	return w.updates
+}
+
+// Err returns the error from the most recent failed recompilation, or nil if the most recent
+// recompilation succeeded.
+func (w *ProgramWatcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close stops the watcher from receiving updates and closes the Updates channel.
+func (w *ProgramWatcher) Close() {
+	w.set.remove(w)
+	w.close()
+}
+
+// recompile plans the watched expression within the environment and delivers the result.
+func (w *ProgramWatcher) recompile(e *Env) {
+	prg, err := w.compile(e)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+	if err != nil || w.closed {
+		return
+	}
+	// Replace any program which has not yet been received.
+	select {
+	case <-w.updates:
+	default:
+	}
+	w.updates <- prg
+}
+
+func (w *ProgramWatcher) compile(e *Env) (Program, error) {
+	ast := w.ast
+	if ast.IsChecked() {
+		// Checking annotates the expression, so the expression of the watched program is copied.
+		parsed := &Ast{
+			source: ast.source,
+			expr:   proto.Clone(ast.expr).(*exprpb.Expr),
+			info:   ast.info,
+		}
+		checked, iss := e.Check(parsed)
+		if iss != nil && iss.Err() != nil {
+			return nil, iss.Err()
+		}
+		ast = checked
+	}
+	return e.Program(ast, w.opts...)
+}
+
+func (w *ProgramWatcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.updates)
+	}
+}
+
+// watchedProg returns the prog holding the Ast and options of a Program created by Env.Program.
+func watchedProg(prg Program) (*prog, error) {
+	switch p := prg.(type) {
+	case *prog:
+		return p, nil
+	case *progGen:
+		return p.base, nil
+	}
+	return nil, errors.New("program was not created by an Env")
+}
+
+// watcherSet tracks the watchers registered with an Env and the Env values created from it by
+// Update.
+//
+// Until a watcher is registered, the set refers to the Env it was created for and has no
+// finalizer, so that Envs which are never watched pay only for the set itself. The programs
+// created within the Env keep it reachable in the meantime.
+type watcherSet struct {
+	// envs counts the Env values sharing the set which have not been collected.
+	envs int32
+
+	mu sync.Mutex
+	// pending is the Env the set was created for, until the first watcher is registered.
+	pending  *Env
+	watchers map[*ProgramWatcher]struct{}
+}
+
+// retain counts the Env as sharing the set until it is collected, at which point the watchers are
+// closed if no other Env shares the set. The finalizer only refers to the set so that the
+// watchers do not keep the Env reachable.
+func (s *watcherSet) retain(e *Env) {
+	atomic.AddInt32(&s.envs, 1)
+	runtime.SetFinalizer(e, func(*Env) {
+		if atomic.AddInt32(&s.envs, -1) == 0 {
+			s.closeAll()
+		}
+	})
+}
+
+// watching reports whether a watcher has been registered with the set.
+func (s *watcherSet) watching() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.watchers != nil
+}
+
+// add registers the watcher. The first registration retains the Env the set was created for and
+// releases the reference to it.
+func (s *watcherSet) add(w *ProgramWatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watchers == nil {
+		s.watchers = map[*ProgramWatcher]struct{}{}
+		s.retain(s.pending)
+		s.pending = nil
+	}
+	s.watchers[w] = struct{}{}
+}
+
+func (s *watcherSet) remove(w *ProgramWatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.watchers, w)
+}
+
+func (s *watcherSet) notify(e *Env) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for w := range s.watchers {
+		w.recompile(e)
+	}
+}
+
+func (s *watcherSet) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for w := range s.watchers {
+		w.close()
+		delete(s.watchers, w)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cel
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+)
+
+func watchedProgram(t *testing.T, src string, opts ...EnvOption) (*Env, *ProgramWatcher) {
+	t.Helper()
+	env, err := NewEnv(opts...)
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	ast, iss := env.Compile(src)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("env.Program() failed: %v", err)
+	}
+	w, err := NewProgramWatcher(prg)
+	if err != nil {
+		t.Fatalf("NewProgramWatcher() failed: %v", err)
+	}
+	return env, w
+}
+
+func TestProgramWatcher(t *testing.T) {
+	env, w := watchedProgram(t, `x.size() > 1`,
+		Declarations(decls.NewVar("x", decls.String)))
+	defer w.Close()
+
+	next, err := env.Update(Declarations(decls.NewVar("y", decls.Int)))
+	if err != nil {
+		t.Fatalf("env.Update() failed: %v", err)
+	}
+	// The updated environment is a new Env, and the original is unchanged.
+	if _, iss := env.Compile(`y > 1`); iss.Err() == nil {
+		t.Error("env.Compile() succeeded with a declaration added by env.Update()")
+	}
+	if _, iss := next.Compile(`y > 1`); iss.Err() != nil {
+		t.Errorf("next.Compile() failed: %v", iss.Err())
+	}
+	var prg Program
+	select {
+	case prg = <-w.Updates():
+	default:
+		t.Fatal("no program delivered after env.Update()")
+	}
+	if w.Err() != nil {
+		t.Fatalf("recompilation failed: %v", w.Err())
+	}
+	out, _, err := prg.Eval(map[string]interface{}{"x": "ab"})
+	if err != nil || out != types.True {
+		t.Errorf("prg.Eval() got %v, %v, wanted true", out, err)
+	}
+
+	w.Close()
+	if _, ok := <-w.Updates(); ok {
+		t.Error("Updates() channel not closed after Close()")
+	}
+}
+
+func TestProgramWatcherRecompileError(t *testing.T) {
+	env, w := watchedProgram(t, `x + 1`, Declarations(decls.NewVar("x", decls.Int)))
+	defer w.Close()
+	if _, err := env.Update(Declarations(decls.NewVar("x", decls.String))); err != nil {
+		t.Fatalf("env.Update() failed: %v", err)
+	}
+	if w.Err() == nil {
+		t.Error("got nil error, wanted recompilation error")
+	}
+	select {
+	case prg := <-w.Updates():
+		t.Errorf("got program %v, wanted none", prg)
+	default:
+	}
+}
+
+func TestProgramWatcherEnvCollected(t *testing.T) {
+	env, err := NewEnv()
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	ast, iss := env.Compile(`1 + 1`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	// The program remains in use, but does not keep the Env reachable.
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("env.Program() failed: %v", err)
+	}
+	defer runtime.KeepAlive(prg)
+	w, err := NewProgramWatcher(prg)
+	if err != nil {
+		t.Fatalf("NewProgramWatcher() failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		runtime.GC()
+		select {
+		case _, ok := <-w.Updates():
+			if !ok {
+				return
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Error("Updates() channel not closed after the Env was collected")
+}
+
+func TestProgramWatcherLazyRegistration(t *testing.T) {
+	env, err := NewEnv(Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatalf("NewEnv() failed: %v", err)
+	}
+	ast, iss := env.Compile(`x + 1`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast, EvalOptions(OptTrackState))
+	if err != nil {
+		t.Fatalf("env.Program() failed: %v", err)
+	}
+	// Envs are not retained by the set until a watcher is registered.
+	unwatched, err := env.Update(Declarations(decls.NewVar("y", decls.Int)))
+	if err != nil {
+		t.Fatalf("env.Update() failed: %v", err)
+	}
+	if unwatched.watchers != nil || env.watchers.watching() || env.watchers.envs != 0 {
+		t.Fatal("watcher set in use before a watcher was registered")
+	}
+	w, err := NewProgramWatcher(prg)
+	if err != nil {
+		t.Fatalf("NewProgramWatcher() failed: %v", err)
+	}
+	defer w.Close()
+	if env.watchers.envs != 1 || env.watchers.pending != nil {
+		t.Errorf("got %d retained Envs, wanted the watched Env alone", env.watchers.envs)
+	}
+	if _, err := env.Update(Declarations(decls.NewVar("y", decls.Int))); err != nil {
+		t.Fatalf("env.Update() failed: %v", err)
+	}
+	select {
+	case <-w.Updates():
+	default:
+		t.Fatal("no program delivered after env.Update()")
+	}
+}
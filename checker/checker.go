@@ -38,6 +38,7 @@ type checker struct {
 	sourceInfo         *exprpb.SourceInfo
 	types              map[int64]*exprpb.Type
 	references         map[int64]*exprpb.Reference
+	checkFn            CheckFn
 }
 
 // Check performs type checking, giving a typed AST.
@@ -58,6 +59,7 @@ func Check(parsedExpr *exprpb.ParsedExpr,
 		types:              make(map[int64]*exprpb.Type),
 		references:         make(map[int64]*exprpb.Reference),
 	}
+	c.checkFn = chainMiddleware(env.middleware, c.checkNode)
 	c.check(parsedExpr.GetExpr())
 
 	// Walk over the final type map substituting any type parameters either by their bound value or
@@ -79,7 +81,11 @@ func (c *checker) check(e *exprpb.Expr) {
 	if e == nil {
 		return
 	}
+	c.checkFn(e)
+}
 
+// checkNode type-checks the expression without applying the Env middleware.
+func (c *checker) checkNode(e *exprpb.Expr) {
 	switch e.ExprKind.(type) {
 	case *exprpb.Expr_ConstExpr:
 		literal := e.GetConstExpr()
@@ -184,6 +190,17 @@ func (c *checker) checkSelect(e *exprpb.Expr) {
 			}
 			return
 		}
+		// The qualified name may refer to a value which is missing from an enum type.
+		enumType, vals := c.env.LookupEnumValues(qname[:len(qname)-len(sel.Field)-1])
+		if len(vals) != 0 {
+			names := make([]string, len(vals))
+			for i, v := range vals {
+				names[i] = v.Name
+			}
+			c.setType(e, decls.Error)
+			c.errors.undeclaredEnumValue(c.location(e), enumType, sel.Field, names)
+			return
+		}
 	}
 
 	// Interpret as field selection, first traversing down the operand.
@@ -205,6 +222,11 @@ func (c *checker) checkSelect(e *exprpb.Expr) {
 			messageType.GetMessageType(),
 			sel.Field); found {
 			resultType = fieldType.Type
+			// Providers which map field names report the declared name, which replaces the
+			// name used within the expression.
+			if fieldType.Name != "" {
+				sel.Field = fieldType.Name
+			}
 		}
 	case kindTypeParam:
 		// Set the operand type to DYN to prevent assignment to a potentionally incorrect type
@@ -321,6 +343,7 @@ func (c *checker) resolveOverload(
 
 	var resultType *exprpb.Type
 	var checkedRef *exprpb.Reference
+	var boundViolated bool
 	for _, overload := range fn.GetFunction().Overloads {
 		if (target == nil && overload.IsInstanceFunction) ||
 			(target != nil && !overload.IsInstanceFunction) {
@@ -329,9 +352,10 @@ func (c *checker) resolveOverload(
 		}
 
 		overloadType := decls.NewFunctionType(overload.ResultType, overload.Params...)
+		var substitutions *mapping
 		if len(overload.TypeParams) > 0 {
 			// Instantiate overload's type with fresh type variables.
-			substitutions := newMapping()
+			substitutions = newMapping()
 			for _, typePar := range overload.TypeParams {
 				substitutions.add(decls.NewTypeParamType(typePar), c.newTypeVar())
 			}
@@ -340,6 +364,10 @@ func (c *checker) resolveOverload(
 
 		candidateArgTypes := overloadType.GetFunction().ArgTypes
 		if c.isAssignableList(argTypes, candidateArgTypes) {
+			if !c.satisfiesBounds(loc, fn.GetName(), overload, substitutions) {
+				boundViolated = true
+				continue
+			}
 			if checkedRef == nil {
 				checkedRef = newFunctionReference(overload.OverloadId)
 			} else {
@@ -359,7 +387,10 @@ func (c *checker) resolveOverload(
 	}
 
 	if resultType == nil {
-		c.errors.noMatchingOverload(loc, fn.GetName(), argTypes, target != nil)
+		// Bound violations have already been reported.
+		if !boundViolated {
+			c.errors.noMatchingOverload(loc, fn.GetName(), argTypes, target != nil)
+		}
 		resultType = decls.Error
 		return nil
 	}
@@ -367,6 +398,28 @@ func (c *checker) resolveOverload(
 	return newResolution(checkedRef, resultType)
 }
 
+// satisfiesBounds reports whether the types inferred for the overload's type parameters satisfy
+// the bounds declared with decls.WithBound, reporting a boundViolation for each which does not.
+func (c *checker) satisfiesBounds(loc common.Location,
+	name string,
+	overload *exprpb.Decl_FunctionDecl_Overload,
+	substitutions *mapping) bool {
+	satisfied := true
+	for _, typePar := range overload.TypeParams {
+		bound, found := decls.LookupBound(overload, typePar)
+		if !found {
+			continue
+		}
+		typeVar, _ := substitutions.find(decls.NewTypeParamType(typePar))
+		inferred := substitute(c.mappings, typeVar, false)
+		if !bound.Satisfies(inferred) {
+			c.errors.boundViolation(loc, name, typePar, bound, inferred)
+			satisfied = false
+		}
+	}
+	return satisfied
+}
+
 func (c *checker) checkCreateList(e *exprpb.Expr) {
 	create := e.GetListExpr()
 	var elemType *exprpb.Type
@@ -454,6 +507,11 @@ func (c *checker) checkCreateMessage(e *exprpb.Expr) {
 			messageType.GetMessageType(),
 			field); found {
 			fieldType = t.Type
+			// As with selections, the declared name replaces the name used within the
+			// expression.
+			if t.Name != "" {
+				ent.KeyKind = &exprpb.Expr_CreateStruct_Entry_FieldKey{FieldKey: t.Name}
+			}
 		}
 		if !c.isAssignable(fieldType, c.getType(value)) {
 			c.errors.fieldTypeMismatch(
@@ -16,6 +16,7 @@ package checker
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/cel-go/checker/decls"
@@ -404,6 +405,14 @@ _!=_(_-_(_+_(1~double, _*_(2~double, 3~double)~double^multiply_double)
 	~bool^not_equals`,
 		Type: decls.Bool,
 	},
+	{
+		I:         `TestAllTypes.NestedEnum.BAZZ != 99`,
+		Container: "google.expr.proto3.test",
+		Error: `
+ERROR: <input>:1:24: undeclared reference to 'BAZZ' in enum 'google.expr.proto3.test.TestAllTypes.NestedEnum', did you mean one of: FOO, BAR, BAZ
+ | TestAllTypes.NestedEnum.BAZZ != 99
+ | .......................^`,
+	},
 	{
 		I:    `size([] + [1])`,
 		R:    `size(_+_([]~list(int), [1~int]~list(int))~list(int)^add_list)~int^size_list`,
@@ -1564,6 +1573,56 @@ _&&_(_==_(list~type(list(dyn))^list,
 		)~string^base64_encode_string`,
 		Type: decls.String,
 	},
+	{
+		I: `max([1, 2]) < 3 && max(['a']) == 'a'`,
+		Env: env{
+			functions: []*exprpb.Decl{
+				decls.NewFunction("max",
+					decls.NewParameterizedOverload("max_list_ordered",
+						[]*exprpb.Type{decls.NewListType(decls.NewTypeParamType("T"))},
+						decls.NewTypeParamType("T"),
+						[]string{"T"},
+						decls.WithBound("T", decls.Ordered))),
+			},
+		},
+		Type: decls.Bool,
+	},
+	{
+		I: `max([true])`,
+		Env: env{
+			functions: []*exprpb.Decl{
+				decls.NewFunction("max",
+					decls.NewParameterizedOverload("max_list_ordered",
+						[]*exprpb.Type{decls.NewListType(decls.NewTypeParamType("T"))},
+						decls.NewTypeParamType("T"),
+						[]string{"T"},
+						decls.WithBound("T", decls.Ordered))),
+			},
+		},
+		Error: `
+		ERROR: <input>:1:4: type 'bool' bound to parameter 'T' of 'max' does not satisfy bound 'ordered'
+		  | max([true])
+		  | ...^`,
+	},
+	{
+		I: `max([true])`,
+		Env: env{
+			functions: []*exprpb.Decl{
+				decls.NewFunction("max",
+					decls.NewParameterizedOverload("max_list_ordered",
+						[]*exprpb.Type{decls.NewListType(decls.NewTypeParamType("T"))},
+						decls.NewTypeParamType("T"),
+						[]string{"T"})),
+			},
+		},
+		R: `
+		max(
+			[
+				true~bool
+			]~list(bool)
+		)~bool^max_list_ordered`,
+		Type: decls.Bool,
+	},
 }
 
 var testEnvs = map[string]env{
@@ -1690,3 +1749,33 @@ func TestCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestCheck_JSONNameMapping(t *testing.T) {
+	src := common.NewTextSource(`has(x.singleNestedMessage) && x.singleNestedMessage.bb == x.single_int32 &&
+		x == google.expr.proto3.test.TestAllTypes{singleInt32: 1}`)
+	expression, errors := parser.Parse(src)
+	if len(errors.GetErrors()) > 0 {
+		t.Fatalf("Unexpected parse errors: %v", errors.ToDisplayString())
+	}
+	reg, err := types.NewRegistryWithOptions(
+		[]types.TypeProviderOption{types.WithJSONNameMapping()}, &proto3pb.TestAllTypes{})
+	if err != nil {
+		t.Fatalf("types.NewRegistryWithOptions() failed: %v", err)
+	}
+	env := NewStandardEnv(containers.DefaultContainer, reg)
+	env.Add(decls.NewVar("x", decls.NewObjectType("google.expr.proto3.test.TestAllTypes")))
+	checked, errors := Check(expression, src, env)
+	if len(errors.GetErrors()) > 0 {
+		t.Fatalf("Unexpected type-check errors: %v", errors.ToDisplayString())
+	}
+	out := Print(checked.GetExpr(), checked)
+	for _, want := range []string{
+		"x~google.expr.proto3.test.TestAllTypes^x.single_nested_message~test-only~~bool",
+		".single_nested_message~google.expr.proto3.test.TestAllTypes.NestedMessage.bb~int",
+		"single_int32:1~int",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("got %s, wanted it to contain %s", out, want)
+		}
+	}
+}
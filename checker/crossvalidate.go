@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checker
+
+import (
+	"sort"
+
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/containers"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// CrossValidationResult compares the results of type-checking an expression in two environments.
+type CrossValidationResult struct {
+	// TypeA and TypeB are the types of the expression in each environment, or nil if the
+	// expression failed to check in that environment.
+	TypeA, TypeB *exprpb.Type
+
+	// ErrorsA and ErrorsB are the errors reported when checking the expression in each
+	// environment.
+	ErrorsA, ErrorsB *common.Errors
+
+	checkedA, checkedB *exprpb.CheckedExpr
+}
+
+// Agree returns true if the expression checked without errors in both environments and every
+// node has the same type in both.
+func (r *CrossValidationResult) Agree() bool {
+	return r.TypeA != nil && r.TypeB != nil && len(r.DivergentNodeIds()) == 0
+}
+
+// DivergentNodeIds returns the sorted ids of the expression nodes whose types differ between the
+// two environments, including nodes which have a type in only one of them.
+func (r *CrossValidationResult) DivergentNodeIds() []int64 {
+	typesA := r.checkedA.GetTypeMap()
+	typesB := r.checkedB.GetTypeMap()
+	var ids []int64
+	for id, ta := range typesA {
+		if tb, found := typesB[id]; !found || !proto.Equal(ta, tb) {
+			ids = append(ids, id)
+		}
+	}
+	for id := range typesB {
+		if _, found := typesA[id]; !found {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// CrossValidate type-checks the parsed expression in both environments, such as environments
+// built from two versions of a proto schema, and returns the comparison of the results.
+//
+// When the container is non-empty it replaces the container name of both environments. The
+// parsed expression is not modified.
+func CrossValidate(parsed *exprpb.ParsedExpr, envA, envB *Env,
+	container string) *CrossValidationResult {
+	result := &CrossValidationResult{}
+	result.checkedA, result.TypeA, result.ErrorsA = crossCheck(parsed, envA, container)
+	result.checkedB, result.TypeB, result.ErrorsB = crossCheck(parsed, envB, container)
+	return result
+}
+
+func crossCheck(parsed *exprpb.ParsedExpr, env *Env,
+	container string) (*exprpb.CheckedExpr, *exprpb.Type, *common.Errors) {
+	// The checker qualifies names in place, so each environment checks its own copy.
+	parsed = proto.Clone(parsed).(*exprpb.ParsedExpr)
+	src := common.NewInfoSource(parsed.GetSourceInfo())
+	if container != "" {
+		cont, err := env.container.Extend(containers.Name(container))
+		if err != nil {
+			errs := common.NewErrors(src)
+			errs.ReportError(common.NoLocation, err.Error())
+			return nil, nil, errs
+		}
+		env = env.withContainer(cont)
+	}
+	checked, errs := Check(parsed, src, env)
+	if len(errs.GetErrors()) != 0 {
+		return checked, nil, errs
+	}
+	return checked, checked.GetTypeMap()[parsed.GetExpr().GetId()], errs
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/containers"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/parser"
+
+	"google.golang.org/protobuf/proto"
+
+	proto3pb "github.com/google/cel-go/test/proto3pb"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestCrossValidate(t *testing.T) {
+	envA := newCrossValidationEnv(t, decls.NewVar("x", decls.Int), decls.NewVar("y", decls.Int))
+	envB := newCrossValidationEnv(t, decls.NewVar("x", decls.String), decls.NewVar("y", decls.Int))
+
+	r := CrossValidate(parse(t, `[x, y]`), envA, envB, "")
+	if r.Agree() {
+		t.Error("Agree() got true for divergent types")
+	}
+	if !proto.Equal(r.TypeA, decls.NewListType(decls.Int)) ||
+		!proto.Equal(r.TypeB, decls.NewListType(decls.Dyn)) {
+		t.Errorf("got types %v and %v", r.TypeA, r.TypeB)
+	}
+	if got := r.DivergentNodeIds(); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("DivergentNodeIds() got %v, wanted [1 2]", got)
+	}
+
+	r = CrossValidate(parse(t, `y + 1`), envA, envB, "")
+	if !r.Agree() || len(r.DivergentNodeIds()) != 0 {
+		t.Errorf("got divergent nodes %v, wanted agreement", r.DivergentNodeIds())
+	}
+
+	r = CrossValidate(parse(t, `x + 1`), envA, envB, "")
+	if r.Agree() || r.TypeA == nil || r.TypeB != nil || len(r.ErrorsB.GetErrors()) == 0 {
+		t.Errorf("got result %+v, wanted a check failure in the second env", r)
+	}
+}
+
+func TestCrossValidate_Container(t *testing.T) {
+	envA := newCrossValidationEnv(t)
+	envB := newCrossValidationEnv(t)
+	parsed := parse(t, `TestAllTypes{}.single_int64`)
+	if r := CrossValidate(parsed, envA, envB, ""); r.Agree() {
+		t.Error("Agree() got true for an unresolvable type")
+	}
+	r := CrossValidate(parsed, envA, envB, "google.expr.proto3.test")
+	if !r.Agree() || !proto.Equal(r.TypeA, decls.Int) {
+		t.Errorf("got type %v and errors %v, wanted int", r.TypeA, r.ErrorsA.ToDisplayString())
+	}
+	r = CrossValidate(parsed, envA, envB, ".invalid")
+	if r.Agree() || !strings.Contains(r.ErrorsA.ToDisplayString(), "container name") {
+		t.Errorf("got result %+v, wanted container errors", r)
+	}
+}
+
+func newCrossValidationEnv(t *testing.T, idents ...*exprpb.Decl) *Env {
+	t.Helper()
+	reg, err := types.NewRegistry(&proto3pb.TestAllTypes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewStandardEnv(containers.DefaultContainer, reg)
+	if err := env.Add(idents...); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func parse(t *testing.T, expr string) *exprpb.ParsedExpr {
+	t.Helper()
+	parsed, errs := parser.Parse(common.NewTextSource(expr))
+	if len(errs.GetErrors()) != 0 {
+		t.Fatal(errs.ToDisplayString())
+	}
+	return parsed
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decls
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// TypeBound constrains the types which may be bound to a type parameter.
+//
+// Bounds are recorded within the overload declarations by name, and so the set of bounds is
+// limited to those declared in this package.
+type TypeBound interface {
+	// String returns the name of the bound.
+	String() string
+
+	// Satisfies returns whether the type satisfies the bound.
+	//
+	// Types which are not yet known, such as `dyn` and unbound type parameters, satisfy all bounds.
+	Satisfies(t *exprpb.Type) bool
+
+	isTypeBound()
+}
+
+// Type bounds for use with WithBound.
+var (
+	// AnyBound permits any type, and is the default bound of a type parameter.
+	//
+	// The name differs from the other bounds since Any is the google.protobuf.Any type.
+	AnyBound TypeBound = primitiveBound{name: "any"}
+
+	// Comparable permits int, double, string, and bool types.
+	Comparable TypeBound = primitiveBound{
+		name:  "comparable",
+		kinds: []exprpb.Type_PrimitiveType{exprpb.Type_INT64, exprpb.Type_DOUBLE, exprpb.Type_STRING, exprpb.Type_BOOL},
+	}
+
+	// Numeric permits int and double types.
+	Numeric TypeBound = primitiveBound{
+		name:  "numeric",
+		kinds: []exprpb.Type_PrimitiveType{exprpb.Type_INT64, exprpb.Type_DOUBLE},
+	}
+
+	// Ordered permits int, double, and string types.
+	Ordered TypeBound = primitiveBound{
+		name:  "ordered",
+		kinds: []exprpb.Type_PrimitiveType{exprpb.Type_INT64, exprpb.Type_DOUBLE, exprpb.Type_STRING},
+	}
+)
+
+type primitiveBound struct {
+	name  string
+	kinds []exprpb.Type_PrimitiveType
+}
+
+// String implements the TypeBound interface method.
+func (b primitiveBound) String() string {
+	return b.name
+}
+
+func (primitiveBound) isTypeBound() {}
+
+// Satisfies implements the TypeBound interface method.
+func (b primitiveBound) Satisfies(t *exprpb.Type) bool {
+	if b.kinds == nil {
+		return true
+	}
+	switch t.GetTypeKind().(type) {
+	case *exprpb.Type_Dyn, *exprpb.Type_TypeParam, *exprpb.Type_Error:
+		return true
+	case *exprpb.Type_Primitive:
+		for _, k := range b.kinds {
+			if t.GetPrimitive() == k {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParamBound associates a TypeBound with a named type parameter.
+type ParamBound struct {
+	Param string
+	Bound TypeBound
+}
+
+// WithBound constrains the type parameter of a parameterized overload to the given bound.
+func WithBound(paramName string, bound TypeBound) ParamBound {
+	return ParamBound{Param: paramName, Bound: bound}
+}
+
+// boundsField is the number of the field in which the bounds of an overload's type parameters are
+// recorded, since the overload declaration proto has no field for them. The bounds are recorded as
+// unknown fields of the overload so that they are retained when the declaration is copied or
+// serialized. Each occurrence of the field holds a message with the parameter name in field 1 and
+// the bound name in field 2.
+const boundsField protowire.Number = 1 << 20
+
+// boundsByName indexes the bounds declared in this package by name.
+var boundsByName = map[string]TypeBound{
+	AnyBound.String():   AnyBound,
+	Comparable.String(): Comparable,
+	Numeric.String():    Numeric,
+	Ordered.String():    Ordered,
+}
+
+// setBounds records the bounds within the unknown fields of the overload.
+func setBounds(overload *exprpb.Decl_FunctionDecl_Overload, bounds []ParamBound) {
+	var raw []byte
+	for _, b := range bounds {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, b.Param)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, b.Bound.String())
+		raw = protowire.AppendTag(raw, boundsField, protowire.BytesType)
+		raw = protowire.AppendBytes(raw, entry)
+	}
+	overload.ProtoReflect().SetUnknown(raw)
+}
+
+// LookupBound returns the bound declared for a type parameter of the overload, if any.
+func LookupBound(overload *exprpb.Decl_FunctionDecl_Overload, paramName string) (TypeBound, bool) {
+	raw := overload.ProtoReflect().GetUnknown()
+	for len(raw) > 0 {
+		num, typ, n := protowire.ConsumeTag(raw)
+		if n < 0 {
+			return nil, false
+		}
+		raw = raw[n:]
+		if num != boundsField || typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, raw)
+			if n < 0 {
+				return nil, false
+			}
+			raw = raw[n:]
+			continue
+		}
+		entry, n := protowire.ConsumeBytes(raw)
+		if n < 0 {
+			return nil, false
+		}
+		raw = raw[n:]
+		param, bound := parseBound(entry)
+		if param == paramName {
+			b, found := boundsByName[bound]
+			return b, found
+		}
+	}
+	return nil, false
+}
+
+// parseBound returns the parameter and bound names recorded within an entry of the bounds field.
+func parseBound(entry []byte) (param, bound string) {
+	for len(entry) > 0 {
+		num, typ, n := protowire.ConsumeTag(entry)
+		if n < 0 {
+			return "", ""
+		}
+		entry = entry[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, entry)
+		} else {
+			var v string
+			v, n = protowire.ConsumeString(entry)
+			switch num {
+			case 1:
+				param = v
+			case 2:
+				bound = v
+			}
+		}
+		if n < 0 {
+			return "", ""
+		}
+		entry = entry[n:]
+	}
+	return param, bound
+}
@@ -158,29 +158,39 @@ func NewOverload(id string, argTypes []*exprpb.Type,
 }
 
 // NewParameterizedInstanceOverload creates a parametric function instance overload type.
+//
+// Type parameters may be constrained with bounds created by WithBound.
 func NewParameterizedInstanceOverload(id string,
 	argTypes []*exprpb.Type,
 	resultType *exprpb.Type,
-	typeParams []string) *exprpb.Decl_FunctionDecl_Overload {
-	return &exprpb.Decl_FunctionDecl_Overload{
+	typeParams []string,
+	bounds ...ParamBound) *exprpb.Decl_FunctionDecl_Overload {
+	overload := &exprpb.Decl_FunctionDecl_Overload{
 		OverloadId:         id,
 		ResultType:         resultType,
 		Params:             argTypes,
 		TypeParams:         typeParams,
 		IsInstanceFunction: true}
+	setBounds(overload, bounds)
+	return overload
 }
 
 // NewParameterizedOverload creates a parametric function overload type.
+//
+// Type parameters may be constrained with bounds created by WithBound.
 func NewParameterizedOverload(id string,
 	argTypes []*exprpb.Type,
 	resultType *exprpb.Type,
-	typeParams []string) *exprpb.Decl_FunctionDecl_Overload {
-	return &exprpb.Decl_FunctionDecl_Overload{
+	typeParams []string,
+	bounds ...ParamBound) *exprpb.Decl_FunctionDecl_Overload {
+	overload := &exprpb.Decl_FunctionDecl_Overload{
 		OverloadId:         id,
 		ResultType:         resultType,
 		Params:             argTypes,
 		TypeParams:         typeParams,
 		IsInstanceFunction: false}
+	setBounds(overload, bounds)
+	return overload
 }
 
 // NewPrimitiveType creates a type for a primitive value. See the var declarations
@@ -44,23 +44,32 @@ type Env struct {
 	provider       ref.TypeProvider
 	declarations   *decls.Scopes
 	aggLitElemType aggregateLiteralElementType
+	middleware     []Middleware
 }
 
+// EnvOption configures an Env.
+type EnvOption func(e *Env) *Env
+
 // NewEnv returns a new *Env with the given parameters.
-func NewEnv(container *containers.Container, provider ref.TypeProvider) *Env {
+func NewEnv(container *containers.Container, provider ref.TypeProvider, opts ...EnvOption) *Env {
 	declarations := decls.NewScopes()
 	declarations.Push()
 
-	return &Env{
+	e := &Env{
 		container:    container,
 		provider:     provider,
 		declarations: declarations,
 	}
+	for _, opt := range opts {
+		e = opt(e)
+	}
+	return e
 }
 
 // NewStandardEnv returns a new *Env with the given params plus standard declarations.
-func NewStandardEnv(container *containers.Container, provider ref.TypeProvider) *Env {
-	e := NewEnv(container, provider)
+func NewStandardEnv(container *containers.Container, provider ref.TypeProvider,
+	opts ...EnvOption) *Env {
+	e := NewEnv(container, provider, opts...)
 	if err := e.Add(StandardDeclarations()...); err != nil {
 		// The standard declaration set should never have duplicate declarations.
 		panic(err)
@@ -127,6 +136,22 @@ func (e *Env) LookupIdent(name string) *exprpb.Decl {
 	return nil
 }
 
+// LookupEnumValues returns the fully-qualified name and values of the named enum type, resolved
+// against the container. An empty list is returned if the enum type is not found, or if the type
+// provider does not implement ref.EnumValueProvider.
+func (e *Env) LookupEnumValues(enumType string) (string, []ref.EnumValue) {
+	provider, ok := e.provider.(ref.EnumValueProvider)
+	if !ok {
+		return "", []ref.EnumValue{}
+	}
+	for _, candidate := range e.container.ResolveCandidateNames(enumType) {
+		if vals := provider.LookupEnumValues(candidate); len(vals) != 0 {
+			return candidate, vals
+		}
+	}
+	return "", []ref.EnumValue{}
+}
+
 // LookupFunction returns a Decl proto for typeName as a function in env.
 // Returns nil if no such function is found in env.
 func (e *Env) LookupFunction(name string) *exprpb.Decl {
@@ -290,6 +315,18 @@ func getObjectWellKnownType(t *exprpb.Type) *exprpb.Type {
 	return pb.CheckedWellKnowns[t.GetMessageType()]
 }
 
+// withContainer creates a new Env instance which shares the declarations of the Env, but resolves
+// names within the given container.
+func (e *Env) withContainer(container *containers.Container) *Env {
+	return &Env{
+		declarations:   e.declarations,
+		container:      container,
+		provider:       e.provider,
+		aggLitElemType: e.aggLitElemType,
+		middleware:     e.middleware,
+	}
+}
+
 // enterScope creates a new Env instance with a new innermost declaration scope.
 func (e *Env) enterScope() *Env {
 	childDecls := e.declarations.Push()
@@ -298,6 +335,7 @@ func (e *Env) enterScope() *Env {
 		container:      e.container,
 		provider:       e.provider,
 		aggLitElemType: e.aggLitElemType,
+		middleware:     e.middleware,
 	}
 }
 
@@ -309,6 +347,7 @@ func (e *Env) exitScope() *Env {
 		container:      e.container,
 		provider:       e.provider,
 		aggLitElemType: e.aggLitElemType,
+		middleware:     e.middleware,
 	}
 }
 
@@ -15,6 +15,9 @@
 package checker
 
 import (
+	"strings"
+
+	"github.com/google/cel-go/checker/decls"
 	"github.com/google/cel-go/common"
 
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
@@ -29,6 +32,12 @@ func (e *typeErrors) undeclaredReference(l common.Location, container string, na
 	e.ReportError(l, "undeclared reference to '%s' (in container '%s')", name, container)
 }
 
+func (e *typeErrors) undeclaredEnumValue(l common.Location, enumType string, name string,
+	suggestions []string) {
+	e.ReportError(l, "undeclared reference to '%s' in enum '%s', did you mean one of: %s",
+		name, enumType, strings.Join(suggestions, ", "))
+}
+
 func (e *typeErrors) expressionDoesNotSelectField(l common.Location) {
 	e.ReportError(l, "expression does not select a field")
 }
@@ -61,6 +70,12 @@ func (e *typeErrors) noMatchingOverload(l common.Location, name string, args []*
 	e.ReportError(l, "found no matching overload for '%s' applied to '%s'", name, signature)
 }
 
+func (e *typeErrors) boundViolation(l common.Location, name string, param string,
+	bound decls.TypeBound, t *exprpb.Type) {
+	e.ReportError(l, "type '%s' bound to parameter '%s' of '%s' does not satisfy bound '%s'",
+		FormatCheckedType(t), param, name, bound)
+}
+
 func (e *typeErrors) aggregateTypeMismatch(l common.Location, aggregate *exprpb.Type, member *exprpb.Type) {
 	e.ReportError(
 		l,
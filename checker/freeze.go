@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/common/walk"
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// FrozenExpr is an immutable view of a validated CheckedExpr.
+//
+// The FrozenExpr holds a private copy of the expression and its type and reference maps. None of
+// its methods permit mutation of the frozen state, and all values returned from it are copies.
+type FrozenExpr struct {
+	checked *exprpb.CheckedExpr
+}
+
+// Freeze validates the internal consistency of a CheckedExpr and returns an immutable copy.
+//
+// A CheckedExpr is consistent when every expression node has an entry in the TypeMap, and every
+// identifier and function call has an entry in the ReferenceMap.
+func Freeze(c *exprpb.CheckedExpr) (*FrozenExpr, error) {
+	if c.GetExpr() == nil {
+		return nil, fmt.Errorf("cannot freeze checked expression without an expr")
+	}
+	var missingTypes, missingRefs []int64
+	walk.PreOrder(c.GetExpr(), func(e *exprpb.Expr) bool {
+		if _, found := c.GetTypeMap()[e.GetId()]; !found {
+			missingTypes = append(missingTypes, e.GetId())
+		}
+		switch e.GetExprKind().(type) {
+		case *exprpb.Expr_IdentExpr, *exprpb.Expr_CallExpr:
+			if _, found := c.GetReferenceMap()[e.GetId()]; !found {
+				missingRefs = append(missingRefs, e.GetId())
+			}
+		}
+		return true
+	})
+	var msgs []string
+	if len(missingTypes) != 0 {
+		msgs = append(msgs, fmt.Sprintf("missing types for expr ids: %v", sortedIDs(missingTypes)))
+	}
+	if len(missingRefs) != 0 {
+		msgs = append(msgs, fmt.Sprintf("missing references for expr ids: %v", sortedIDs(missingRefs)))
+	}
+	if len(msgs) != 0 {
+		return nil, fmt.Errorf("invalid checked expression: %s", strings.Join(msgs, ", "))
+	}
+	return &FrozenExpr{checked: proto.Clone(c).(*exprpb.CheckedExpr)}, nil
+}
+
+// CheckedExpr returns a deep copy of the frozen expression for callers which need a mutable
+// CheckedExpr.
+func (f *FrozenExpr) CheckedExpr() *exprpb.CheckedExpr {
+	return proto.Clone(f.checked).(*exprpb.CheckedExpr)
+}
+
+// ResultType returns a copy of the type of the root expression node.
+func (f *FrozenExpr) ResultType() *exprpb.Type {
+	t, _ := f.Type(f.checked.GetExpr().GetId())
+	return t
+}
+
+// Type returns a copy of the type associated with the expression id, if present.
+func (f *FrozenExpr) Type(id int64) (*exprpb.Type, bool) {
+	t, found := f.checked.GetTypeMap()[id]
+	if !found {
+		return nil, false
+	}
+	return proto.Clone(t).(*exprpb.Type), true
+}
+
+// Reference returns a copy of the reference associated with the expression id, if present.
+func (f *FrozenExpr) Reference(id int64) (*exprpb.Reference, bool) {
+	r, found := f.checked.GetReferenceMap()[id]
+	if !found {
+		return nil, false
+	}
+	return proto.Clone(r).(*exprpb.Reference), true
+}
+
+func sortedIDs(ids []int64) []int64 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
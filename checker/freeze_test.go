@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/containers"
+	"github.com/google/cel-go/common/walk"
+	"github.com/google/cel-go/parser"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestFreeze(t *testing.T) {
+	checked := mustCheck(t, `[1, 2, 3].exists(i, i > x)`, decls.NewVar("x", decls.Int))
+	frozen, err := Freeze(checked)
+	if err != nil {
+		t.Fatalf("Freeze() failed: %v", err)
+	}
+	if !proto.Equal(frozen.ResultType(), decls.Bool) {
+		t.Errorf("got result type %v, wanted bool", frozen.ResultType())
+	}
+
+	// Mutations of the original expression must not be visible in the frozen expression.
+	rootID := checked.GetExpr().GetId()
+	checked.TypeMap[rootID] = decls.String
+	if !proto.Equal(frozen.ResultType(), decls.Bool) {
+		t.Errorf("got result type %v after mutating the source, wanted bool", frozen.ResultType())
+	}
+
+	// Mutations of the copy must not be visible in the frozen expression either.
+	cpy := frozen.CheckedExpr()
+	delete(cpy.TypeMap, rootID)
+	if _, found := frozen.Type(rootID); !found {
+		t.Error("got type not found after mutating the copy, wanted found")
+	}
+}
+
+func TestFreeze_Invalid(t *testing.T) {
+	checked := mustCheck(t, `x + 1 == 2`, decls.NewVar("x", decls.Int))
+	var identID, callID int64
+	walk.PreOrder(checked.GetExpr(), func(e *exprpb.Expr) bool {
+		switch e.GetExprKind().(type) {
+		case *exprpb.Expr_IdentExpr:
+			identID = e.GetId()
+		case *exprpb.Expr_CallExpr:
+			callID = e.GetId()
+		}
+		return true
+	})
+	delete(checked.ReferenceMap, identID)
+	delete(checked.TypeMap, callID)
+	_, err := Freeze(checked)
+	if err == nil {
+		t.Fatal("got nil, wanted error")
+	}
+	if !strings.Contains(err.Error(), "missing types") ||
+		!strings.Contains(err.Error(), "missing references") {
+		t.Errorf("got %v, wanted missing types and references", err)
+	}
+}
+
+func mustCheck(t *testing.T, expr string, declarations ...*exprpb.Decl) *exprpb.CheckedExpr {
+	t.Helper()
+	src := common.NewTextSource(expr)
+	parsed, errs := parser.Parse(src)
+	if len(errs.GetErrors()) != 0 {
+		t.Fatalf("parser.Parse(%q) failed: %s", expr, errs.ToDisplayString())
+	}
+	env := NewStandardEnv(containers.DefaultContainer, newTestRegistry(t))
+	if err := env.Add(declarations...); err != nil {
+		t.Fatalf("env.Add() failed: %v", err)
+	}
+	checked, errs := Check(parsed, src, env)
+	if len(errs.GetErrors()) != 0 {
+		t.Fatalf("Check(%q) failed: %s", expr, errs.ToDisplayString())
+	}
+	return checked
+}
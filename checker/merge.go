@@ -0,0 +1,154 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checker
+
+import (
+	"sort"
+
+	"github.com/google/cel-go/checker/decls"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// MergeStrategy determines which type Merge chooses for a node with different types in the two
+// checked expressions.
+type MergeStrategy int
+
+const (
+	// PreferFirst chooses the type from the first checked expression.
+	PreferFirst MergeStrategy = iota
+
+	// PreferSecond chooses the type from the second checked expression.
+	PreferSecond
+
+	// PreferMoreSpecific chooses the type which is not dyn, recursively within list and map
+	// types, so that list(dyn) and list(int) resolve to list(int). Types which cannot be
+	// reconciled, such as int and string, resolve to the type from the first checked expression.
+	PreferMoreSpecific
+)
+
+// Conflict describes a node whose type differs between two checked expressions.
+type Conflict struct {
+	// ID is the id of the expression node.
+	ID int64
+
+	// First and Second are the types of the node in each checked expression.
+	First, Second *exprpb.Type
+
+	// Resolved is the type of the node in the merged checked expression.
+	Resolved *exprpb.Type
+}
+
+// Merge combines two checked expressions produced by checking the same parsed expression, such as
+// against two versions of an environment, and returns the merged expression along with the
+// conflicts between their type maps, ordered by node id.
+//
+// Nodes typed in only one of the expressions keep that type. The expression and source info of
+// the merged result are copied from the second checked expression when the strategy is
+// PreferSecond, and from the first otherwise. The reference of each node is copied from the
+// checked expression whose type was chosen for the node, or from the one the expression was
+// copied from when the type was reconciled from both.
+func Merge(c1, c2 *exprpb.CheckedExpr, strategy MergeStrategy) (*exprpb.CheckedExpr, []Conflict) {
+	primary, secondary := c1, c2
+	if strategy == PreferSecond {
+		primary, secondary = c2, c1
+	}
+	merged := &exprpb.CheckedExpr{
+		Expr:         proto.Clone(primary.GetExpr()).(*exprpb.Expr),
+		SourceInfo:   proto.Clone(primary.GetSourceInfo()).(*exprpb.SourceInfo),
+		TypeMap:      map[int64]*exprpb.Type{},
+		ReferenceMap: map[int64]*exprpb.Reference{},
+	}
+	// chosen records the checked expression whose type was chosen for each node.
+	chosen := map[int64]*exprpb.CheckedExpr{}
+
+	var conflicts []Conflict
+	for id, t1 := range c1.GetTypeMap() {
+		t2, found := c2.GetTypeMap()[id]
+		if !found || proto.Equal(t1, t2) {
+			merged.TypeMap[id] = t1
+			if found {
+				chosen[id] = primary
+			} else {
+				chosen[id] = c1
+			}
+			continue
+		}
+		var resolved *exprpb.Type
+		switch strategy {
+		case PreferFirst:
+			resolved = t1
+		case PreferSecond:
+			resolved = t2
+		case PreferMoreSpecific:
+			resolved = moreSpecific(t1, t2)
+		}
+		merged.TypeMap[id] = resolved
+		chosen[id] = primary
+		if proto.Equal(resolved, t2) {
+			chosen[id] = c2
+		} else if proto.Equal(resolved, t1) {
+			chosen[id] = c1
+		}
+		conflicts = append(conflicts, Conflict{ID: id, First: t1, Second: t2, Resolved: resolved})
+	}
+	for id, t2 := range c2.GetTypeMap() {
+		if _, found := c1.GetTypeMap()[id]; !found {
+			merged.TypeMap[id] = t2
+			chosen[id] = c2
+		}
+	}
+
+	// Nodes without a type in either expression take the reference from the primary.
+	for _, c := range []*exprpb.CheckedExpr{secondary, primary} {
+		for id, ref := range c.GetReferenceMap() {
+			if _, found := chosen[id]; !found {
+				merged.ReferenceMap[id] = ref
+			}
+		}
+	}
+	for id, c := range chosen {
+		if ref, found := c.GetReferenceMap()[id]; found {
+			merged.ReferenceMap[id] = ref
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].ID < conflicts[j].ID })
+	return merged, conflicts
+}
+
+// moreSpecific returns whichever of the types is not dyn or error, reconciling the element types
+// of lists and maps, or t1 if the types cannot be reconciled.
+func moreSpecific(t1, t2 *exprpb.Type) *exprpb.Type {
+	switch {
+	case proto.Equal(t1, t2):
+		return t1
+	case isDynOrError(t1):
+		return t2
+	case isDynOrError(t2):
+		return t1
+	}
+	switch {
+	case kindOf(t1) == kindList && kindOf(t2) == kindList:
+		return decls.NewListType(
+			moreSpecific(t1.GetListType().GetElemType(), t2.GetListType().GetElemType()))
+	case kindOf(t1) == kindMap && kindOf(t2) == kindMap:
+		return decls.NewMapType(
+			moreSpecific(t1.GetMapType().GetKeyType(), t2.GetMapType().GetKeyType()),
+			moreSpecific(t1.GetMapType().GetValueType(), t2.GetMapType().GetValueType()))
+	}
+	return t1
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checker
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestMerge(t *testing.T) {
+	envA := newCrossValidationEnv(t,
+		decls.NewVar("x", decls.Int), decls.NewVar("y", decls.Dyn), decls.NewVar("z", decls.Int))
+	envB := newCrossValidationEnv(t,
+		decls.NewVar("x", decls.Dyn), decls.NewVar("y", decls.NewListType(decls.String)),
+		decls.NewVar("z", decls.String))
+	parsed := parse(t, `[x, y, z]`)
+	c1 := checkClone(t, parsed, envA)
+	c2 := checkClone(t, parsed, envB)
+
+	tests := []struct {
+		strategy MergeStrategy
+		resolved map[int64]*exprpb.Type
+	}{
+		{
+			strategy: PreferFirst,
+			resolved: map[int64]*exprpb.Type{2: decls.Int, 3: decls.Dyn, 4: decls.Int},
+		},
+		{
+			strategy: PreferSecond,
+			resolved: map[int64]*exprpb.Type{
+				2: decls.Dyn, 3: decls.NewListType(decls.String), 4: decls.String},
+		},
+		{
+			strategy: PreferMoreSpecific,
+			resolved: map[int64]*exprpb.Type{
+				2: decls.Int,
+				3: decls.NewListType(decls.String),
+				4: decls.Int,
+			},
+		},
+	}
+	for _, tc := range tests {
+		merged, conflicts := Merge(c1, c2, tc.strategy)
+		// The list literal has mixed element types, and so is list(dyn), in both envs.
+		if len(conflicts) != 3 {
+			t.Fatalf("strategy %d: got conflicts %v, wanted 3", tc.strategy, conflicts)
+		}
+		for i, c := range conflicts {
+			if c.ID != int64(i+2) {
+				t.Errorf("strategy %d: got conflict ids out of order: %v", tc.strategy, conflicts)
+			}
+			if !proto.Equal(c.First, c1.GetTypeMap()[c.ID]) ||
+				!proto.Equal(c.Second, c2.GetTypeMap()[c.ID]) ||
+				!proto.Equal(c.Resolved, merged.GetTypeMap()[c.ID]) {
+				t.Errorf("strategy %d: got conflict %v for types %v", tc.strategy, c, merged.GetTypeMap())
+			}
+			if want, found := tc.resolved[c.ID]; found && !proto.Equal(c.Resolved, want) {
+				t.Errorf("strategy %d: node %d resolved to %v, wanted %v",
+					tc.strategy, c.ID, FormatCheckedType(c.Resolved), FormatCheckedType(want))
+			}
+		}
+		if len(merged.GetReferenceMap()) != 3 {
+			t.Errorf("strategy %d: got references %v, wanted 3", tc.strategy, merged.GetReferenceMap())
+		}
+	}
+}
+
+func TestMerge_References(t *testing.T) {
+	fn := func(argType *exprpb.Type, overloadID string) *exprpb.Decl {
+		return decls.NewFunction("f", decls.NewOverload(overloadID, []*exprpb.Type{argType}, argType))
+	}
+	envA := newCrossValidationEnv(t, decls.NewVar("x", decls.Dyn), fn(decls.Dyn, "f_dyn"))
+	envB := newCrossValidationEnv(t, decls.NewVar("x", decls.Int), fn(decls.Int, "f_int"))
+	parsed := parse(t, `f(x)`)
+	c1 := checkClone(t, parsed, envA)
+	c2 := checkClone(t, parsed, envB)
+	callID := parsed.GetExpr().GetId()
+
+	tests := []struct {
+		strategy MergeStrategy
+		overload string
+	}{
+		{strategy: PreferFirst, overload: "f_dyn"},
+		{strategy: PreferSecond, overload: "f_int"},
+		{strategy: PreferMoreSpecific, overload: "f_int"},
+	}
+	for _, tc := range tests {
+		merged, _ := Merge(c1, c2, tc.strategy)
+		ids := merged.GetReferenceMap()[callID].GetOverloadId()
+		if len(ids) != 1 || ids[0] != tc.overload {
+			t.Errorf("strategy %d: got overloads %v for type %v, wanted [%s]", tc.strategy, ids,
+				FormatCheckedType(merged.GetTypeMap()[callID]), tc.overload)
+		}
+	}
+}
+
+func TestMerge_MissingNodes(t *testing.T) {
+	env := newCrossValidationEnv(t, decls.NewVar("x", decls.Int))
+	c1 := checkClone(t, parse(t, `x`), env)
+	c2 := &exprpb.CheckedExpr{
+		Expr:    c1.GetExpr(),
+		TypeMap: map[int64]*exprpb.Type{7: decls.String},
+	}
+	merged, conflicts := Merge(c1, c2, PreferSecond)
+	if len(conflicts) != 0 {
+		t.Errorf("got conflicts %v, wanted none", conflicts)
+	}
+	if len(merged.GetTypeMap()) != 2 || len(merged.GetReferenceMap()) != 1 {
+		t.Errorf("got merged %v, wanted the union of the type and reference maps", merged)
+	}
+}
+
+func TestMoreSpecific(t *testing.T) {
+	tests := []struct {
+		t1, t2, out *exprpb.Type
+	}{
+		{t1: decls.Dyn, t2: decls.Int, out: decls.Int},
+		{t1: decls.Error, t2: decls.Int, out: decls.Int},
+		{t1: decls.String, t2: decls.Int, out: decls.String},
+		{t1: decls.NewListType(decls.Dyn), t2: decls.NewListType(decls.Int),
+			out: decls.NewListType(decls.Int)},
+		{t1: decls.NewMapType(decls.String, decls.Dyn), t2: decls.NewMapType(decls.Dyn, decls.Bool),
+			out: decls.NewMapType(decls.String, decls.Bool)},
+	}
+	for _, tc := range tests {
+		if out := moreSpecific(tc.t1, tc.t2); !proto.Equal(out, tc.out) {
+			t.Errorf("moreSpecific(%s, %s) got %s, wanted %s", FormatCheckedType(tc.t1),
+				FormatCheckedType(tc.t2), FormatCheckedType(out), FormatCheckedType(tc.out))
+		}
+	}
+}
+
+func checkClone(t *testing.T, parsed *exprpb.ParsedExpr, env *Env) *exprpb.CheckedExpr {
+	t.Helper()
+	parsed = proto.Clone(parsed).(*exprpb.ParsedExpr)
+	checked, errs := Check(parsed, common.NewInfoSource(parsed.GetSourceInfo()), env)
+	if len(errs.GetErrors()) != 0 {
+		t.Fatal(errs.ToDisplayString())
+	}
+	return checked
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checker
+
+import (
+	"log"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// CheckFn type-checks a single expression node, including its children.
+type CheckFn func(e *exprpb.Expr)
+
+// Middleware intercepts the type-checking of each expression node.
+//
+// The CheckFn returned by WrapCheck may run logic before and after calling next, or may skip
+// calling next altogether, in which case the node and its children are not checked.
+type Middleware interface {
+	// WrapCheck returns a CheckFn which wraps the next CheckFn in the chain.
+	WrapCheck(next CheckFn) CheckFn
+}
+
+// MiddlewareFunc adapts a function to the Middleware interface.
+type MiddlewareFunc func(next CheckFn) CheckFn
+
+// WrapCheck implements the Middleware interface method.
+func (f MiddlewareFunc) WrapCheck(next CheckFn) CheckFn {
+	return f(next)
+}
+
+// WithMiddleware appends middleware to the Env.
+//
+// The first middleware is the outermost: it runs first before a node is checked and last after
+// the node is checked.
+func WithMiddleware(m ...Middleware) EnvOption {
+	return func(e *Env) *Env {
+		middleware := make([]Middleware, 0, len(e.middleware)+len(m))
+		middleware = append(middleware, e.middleware...)
+		e.middleware = append(middleware, m...)
+		return e
+	}
+}
+
+// chainMiddleware wraps the check function with the middleware such that middleware[0] is the
+// outermost wrapper.
+func chainMiddleware(middleware []Middleware, check CheckFn) CheckFn {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		check = middleware[i].WrapCheck(check)
+	}
+	return check
+}
+
+// NewLoggingMiddleware returns a Middleware which logs the id and kind of each expression node
+// before and after it is checked.
+func NewLoggingMiddleware(logger *log.Logger) Middleware {
+	return MiddlewareFunc(func(next CheckFn) CheckFn {
+		return func(e *exprpb.Expr) {
+			kind := exprKindName(e)
+			logger.Printf("checking expr %d: %s", e.GetId(), kind)
+			next(e)
+			logger.Printf("checked expr %d: %s", e.GetId(), kind)
+		}
+	})
+}
+
+func exprKindName(e *exprpb.Expr) string {
+	switch e.GetExprKind().(type) {
+	case *exprpb.Expr_ConstExpr:
+		return "const"
+	case *exprpb.Expr_IdentExpr:
+		return "ident " + e.GetIdentExpr().GetName()
+	case *exprpb.Expr_SelectExpr:
+		return "select " + e.GetSelectExpr().GetField()
+	case *exprpb.Expr_CallExpr:
+		return "call " + e.GetCallExpr().GetFunction()
+	case *exprpb.Expr_ListExpr:
+		return "list"
+	case *exprpb.Expr_StructExpr:
+		return "struct"
+	case *exprpb.Expr_ComprehensionExpr:
+		return "comprehension"
+	}
+	return "unknown"
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checker
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/containers"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/parser"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestMiddleware_Order(t *testing.T) {
+	var calls []string
+	tracing := func(name string) Middleware {
+		return MiddlewareFunc(func(next CheckFn) CheckFn {
+			return func(e *exprpb.Expr) {
+				calls = append(calls, fmt.Sprintf("%s>%d", name, e.GetId()))
+				next(e)
+				calls = append(calls, fmt.Sprintf("%s<%d", name, e.GetId()))
+			}
+		})
+	}
+	checked := checkWithMiddleware(t, `-x`,
+		WithMiddleware(tracing("a")), WithMiddleware(tracing("b"), tracing("c")))
+	want := []string{
+		"a>1", "b>1", "c>1",
+		"a>2", "b>2", "c>2", "c<2", "b<2", "a<2",
+		"c<1", "b<1", "a<1",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls %v, wanted %v", calls, want)
+	}
+	if len(checked.GetTypeMap()) != 2 {
+		t.Errorf("got type map %v, wanted two entries", checked.GetTypeMap())
+	}
+}
+
+func TestMiddleware_Skip(t *testing.T) {
+	// Middleware which does not call next prevents the node and its children from being checked.
+	skipCalls := MiddlewareFunc(func(next CheckFn) CheckFn {
+		return func(e *exprpb.Expr) {
+			if e.GetCallExpr() == nil {
+				next(e)
+			}
+		}
+	})
+	checked := checkWithMiddleware(t, `[-x]`, WithMiddleware(skipCalls))
+	if _, found := checked.GetTypeMap()[2]; found {
+		t.Errorf("got type for skipped call: %v", checked.GetTypeMap())
+	}
+	if _, found := checked.GetTypeMap()[1]; !found {
+		t.Errorf("got no type for list: %v", checked.GetTypeMap())
+	}
+}
+
+func TestNewLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	checkWithMiddleware(t, `x.y`, WithMiddleware(NewLoggingMiddleware(log.New(&buf, "", 0))))
+	want := []string{
+		"checking expr 2: select y",
+		"checking expr 1: ident x",
+		"checked expr 1: ident x",
+		"checked expr 2: select y",
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got log %q, wanted %q", got, want)
+	}
+}
+
+func checkWithMiddleware(t *testing.T, expr string, opts ...EnvOption) *exprpb.CheckedExpr {
+	t.Helper()
+	src := common.NewTextSource(expr)
+	parsed, errs := parser.Parse(src)
+	if len(errs.GetErrors()) != 0 {
+		t.Fatal(errs.ToDisplayString())
+	}
+	reg, err := types.NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewStandardEnv(containers.DefaultContainer, reg, opts...)
+	if err := env.Add(decls.NewVar("x", decls.Dyn)); err != nil {
+		t.Fatal(err)
+	}
+	checked, errs := Check(parsed, src, env)
+	if len(errs.GetErrors()) != 0 {
+		t.Fatal(errs.ToDisplayString())
+	}
+	return checked
+}
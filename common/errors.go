@@ -46,6 +46,11 @@ func (e *Errors) GetErrors() []Error {
 	return e.errors[:]
 }
 
+// GetSource returns the source in which the errors were observed.
+func (e *Errors) GetSource() Source {
+	return e.source
+}
+
 // Append takes an Errors object as input creates a new Errors object with the current and input
 // errors.
 func (e *Errors) Append(errs []Error) *Errors {
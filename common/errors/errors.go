@@ -0,0 +1,256 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package errors serializes parse and check errors into machine-readable formats.
+package errors
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/common"
+)
+
+// Error codes assigned to errors based on the message formats used by the parser and checker.
+const (
+	CodeSyntaxError          = "syntax_error"
+	CodeInvalidArgument      = "invalid_argument"
+	CodeUndeclaredReference  = "undeclared_reference"
+	CodeUndefinedField       = "undefined_field"
+	CodeUnsupportedField     = "unsupported_field"
+	CodeNoMatchingOverload   = "no_matching_overload"
+	CodeOverlappingOverload  = "overlapping_overload"
+	CodeTypeMismatch         = "type_mismatch"
+	CodeInvalidType          = "invalid_type"
+	CodeInvalidComprehension = "invalid_comprehension"
+	CodeInternal             = "internal"
+	CodeUnknown              = "unknown"
+)
+
+// SeverityError is the severity of every error within a common.Errors value.
+const SeverityError = "error"
+
+// codePrefixes maps the leading text of known error messages to their codes. Longer prefixes
+// which share a start with shorter ones must appear first.
+var codePrefixes = []struct {
+	prefix string
+	code   string
+}{
+	{"Syntax error", CodeSyntaxError},
+	{"Argument to the function 'has'", CodeInvalidArgument},
+	{"Argument must be a simple name", CodeInvalidArgument},
+	{"Expected a qualified name", CodeInvalidArgument},
+	{"invalid argument to has() macro", CodeInvalidArgument},
+	{"argument is not an identifier", CodeInvalidArgument},
+	{"undeclared reference", CodeUndeclaredReference},
+	{"undefined field", CodeUndefinedField},
+	{"expression does not select a field", CodeUnsupportedField},
+	{"field '", CodeUnsupportedField},
+	{"found no matching overload", CodeNoMatchingOverload},
+	{"overlapping overload", CodeOverlappingOverload},
+	{"overload for name", CodeOverlappingOverload},
+	{"expected type", CodeTypeMismatch},
+	{"expression of type", CodeInvalidComprehension},
+	{"[internal]", CodeInternal},
+}
+
+// codeSuffixes maps the trailing text of known error messages to their codes, for messages
+// which begin with the formatted type or name they describe.
+var codeSuffixes = []struct {
+	contains string
+	code     string
+}{
+	{"does not support field selection", CodeUnsupportedField},
+	{"does not satisfy bound", CodeTypeMismatch},
+	{"in aggregate", CodeTypeMismatch},
+	{"is not a type", CodeInvalidType},
+	{"is not a message type", CodeInvalidType},
+}
+
+// Code returns the code for the error, or CodeUnknown if the message is not one produced by the
+// parser or checker.
+func Code(err common.Error) string {
+	for _, p := range codePrefixes {
+		if strings.HasPrefix(err.Message, p.prefix) {
+			return p.code
+		}
+	}
+	for _, s := range codeSuffixes {
+		if strings.Contains(err.Message, s.contains) {
+			return s.code
+		}
+	}
+	return CodeUnknown
+}
+
+// jsonError is the JSON form of a single error. The line and column are omitted when the error
+// has no location.
+type jsonError struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+}
+
+// ToJSON serializes the errors to a JSON array of objects with `code`, `message`, `line`,
+// `column`, and `severity` fields, ordered by location.
+//
+// Lines and columns are 1-based, matching the output of ToDisplayString.
+func ToJSON(errs *common.Errors) []byte {
+	out := []jsonError{}
+	for _, err := range sortedErrors(errs) {
+		e := jsonError{
+			Code:     Code(err),
+			Message:  err.Message,
+			Severity: SeverityError,
+		}
+		e.Line, e.Column = position(err.Location)
+		out = append(out, e)
+	}
+	bytes, _ := json.Marshal(out)
+	return bytes
+}
+
+// SARIF 2.1.0 log format, limited to the properties produced by ToSARIF.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+// ToSARIF serializes the errors to a SARIF 2.1.0 log with a single run, for consumption by
+// editors and code scanning tools.
+//
+// Each error becomes a result whose rule id is the error code. Results for errors without a
+// location have no locations, and the artifact uri is the description of the errors' source.
+func ToSARIF(errs *common.Errors) []byte {
+	uri := ""
+	if src := errs.GetSource(); src != nil {
+		uri = src.Description()
+	}
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "cel-go",
+			InformationURI: "https://github.com/google/cel-go",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	rules := map[string]bool{}
+	for _, err := range sortedErrors(errs) {
+		code := Code(err)
+		if !rules[code] {
+			rules[code] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: code})
+		}
+		result := sarifResult{
+			RuleID:  code,
+			Level:   SeverityError,
+			Message: sarifMessage{Text: err.Message},
+		}
+		if line, col := position(err.Location); line != 0 {
+			result.Locations = []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: uri},
+					Region:           sarifRegion{StartLine: line, StartColumn: col},
+				},
+			}}
+		}
+		run.Results = append(run.Results, result)
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool {
+		return run.Tool.Driver.Rules[i].ID < run.Tool.Driver.Rules[j].ID
+	})
+	bytes, _ := json.Marshal(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	})
+	return bytes
+}
+
+// position returns the 1-based line and column of the location, or zeros if the location is
+// common.NoLocation or otherwise unknown.
+func position(l common.Location) (line, column int) {
+	if l == nil || l.Line() < 1 || l.Column() < 0 {
+		return 0, 0
+	}
+	return l.Line(), l.Column() + 1
+}
+
+// sortedErrors returns a copy of the errors ordered by location, as in ToDisplayString.
+func sortedErrors(errs *common.Errors) []common.Error {
+	sorted := append([]common.Error{}, errs.GetErrors()...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		li, ci := position(sorted[i].Location)
+		lj, cj := position(sorted[j].Location)
+		return li < lj || (li == lj && ci < cj)
+	})
+	return sorted
+}
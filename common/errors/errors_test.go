@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/containers"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/parser"
+)
+
+func TestToJSON(t *testing.T) {
+	errs := checkErrors(t, `a + 1 == 'b'`)
+	errs.ReportError(common.NoLocation, "no location")
+	var got []map[string]interface{}
+	if err := json.Unmarshal(ToJSON(errs), &got); err != nil {
+		t.Fatal(err)
+	}
+	// Errors are ordered by location, with errors that have no location first.
+	want := []map[string]interface{}{
+		{
+			"code":     CodeUnknown,
+			"message":  "no location",
+			"severity": SeverityError,
+		},
+		{
+			"code":     CodeUndeclaredReference,
+			"message":  "undeclared reference to 'a' (in container '')",
+			"line":     1.0,
+			"column":   1.0,
+			"severity": SeverityError,
+		},
+		{
+			"code":     CodeNoMatchingOverload,
+			"message":  "found no matching overload for '_==_' applied to '(int, string)'",
+			"line":     1.0,
+			"column":   7.0,
+			"severity": SeverityError,
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, wanted %v", got, want)
+	}
+	for i := range want {
+		if len(got[i]) != len(want[i]) {
+			t.Errorf("got error %v, wanted %v", got[i], want[i])
+			continue
+		}
+		for k, v := range want[i] {
+			if got[i][k] != v {
+				t.Errorf("got error %v, wanted %v", got[i], want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestToJSON_Empty(t *testing.T) {
+	if got := string(ToJSON(common.NewErrors(nil))); got != "[]" {
+		t.Errorf("got %s, wanted []", got)
+	}
+}
+
+func TestToSARIF(t *testing.T) {
+	src := common.NewTextSource(`a.b +`)
+	_, errs := parser.Parse(src)
+	errs.ReportError(common.NoLocation, "no location")
+	var got sarifLog
+	if err := json.Unmarshal(ToSARIF(errs), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "2.1.0" || len(got.Runs) != 1 {
+		t.Fatalf("got log %+v, wanted a single SARIF 2.1.0 run", got)
+	}
+	run := got.Runs[0]
+	if len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].ID != CodeSyntaxError ||
+		run.Tool.Driver.Rules[1].ID != CodeUnknown {
+		t.Errorf("got rules %v, wanted syntax_error and unknown", run.Tool.Driver.Rules)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("got results %+v, wanted two", run.Results)
+	}
+	if run.Results[0].RuleID != CodeUnknown || run.Results[0].Locations != nil {
+		t.Errorf("got result %+v, wanted one without locations", run.Results[0])
+	}
+	res := run.Results[1]
+	if res.RuleID != CodeSyntaxError || res.Level != "error" || len(res.Locations) != 1 {
+		t.Fatalf("got result %+v, wanted a located syntax error", res)
+	}
+	loc := res.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "<input>" || loc.Region.StartLine != 1 ||
+		loc.Region.StartColumn != 6 {
+		t.Errorf("got location %+v, wanted <input>:1:6", loc)
+	}
+}
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		expr string
+		code string
+	}{
+		{expr: `1.foo`, code: CodeUnsupportedField},
+		{expr: `has(a)`, code: CodeInvalidArgument},
+		{expr: `x in 1`, code: CodeUndeclaredReference},
+	}
+	for _, tst := range tests {
+		errs := checkErrors(t, tst.expr)
+		if len(errs.GetErrors()) == 0 {
+			t.Fatalf("%s: got no errors", tst.expr)
+		}
+		if got := Code(errs.GetErrors()[0]); got != tst.code {
+			t.Errorf("%s: got code %s for %q, wanted %s",
+				tst.expr, got, errs.GetErrors()[0].Message, tst.code)
+		}
+	}
+}
+
+func TestCode_Messages(t *testing.T) {
+	tests := []struct {
+		msg  string
+		code string
+	}{
+		{msg: "expected type 'bool' but found 'int'", code: CodeTypeMismatch},
+		{msg: "type 'string' does not match previous type 'int' in aggregate. Use 'dyn(x)' " +
+			"to make the aggregate dynamic.", code: CodeTypeMismatch},
+		{msg: "'int' is not a message type", code: CodeInvalidType},
+		{msg: "field 'a' does not support presence check", code: CodeUnsupportedField},
+		{msg: "[internal] unexpected failed resolution of 'a'", code: CodeInternal},
+		{msg: "custom error", code: CodeUnknown},
+	}
+	for _, tst := range tests {
+		if got := Code(common.Error{Message: tst.msg}); got != tst.code {
+			t.Errorf("got code %s for %q, wanted %s", got, tst.msg, tst.code)
+		}
+	}
+}
+
+func checkErrors(t *testing.T, expr string) *common.Errors {
+	t.Helper()
+	src := common.NewTextSource(expr)
+	parsed, errs := parser.Parse(src)
+	if len(errs.GetErrors()) != 0 {
+		return errs
+	}
+	reg, err := types.NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errs = checker.Check(parsed, src, checker.NewStandardEnv(containers.DefaultContainer, reg))
+	return errs
+}
@@ -37,6 +37,13 @@ func NewErr(format string, args ...interface{}) ref.Val {
 	return &Err{fmt.Errorf(format, args...)}
 }
 
+// WrapErr creates a new Err instance from an existing Go error value.
+//
+// The wrapped error is accessible via the Value method of the returned Err.
+func WrapErr(err error) ref.Val {
+	return &Err{err}
+}
+
 // NoSuchOverloadErr returns a new types.Err instance with a no such overload message.
 func NoSuchOverloadErr() ref.Val {
 	return NewErr("no such overload")
@@ -17,6 +17,7 @@ package types
 import (
 	"fmt"
 	"reflect"
+	"sort"
 
 	"github.com/google/cel-go/common/types/pb"
 	"github.com/google/cel-go/common/types/ref"
@@ -85,6 +86,39 @@ func NewStringStringMap(adapter ref.TypeAdapter, value map[string]string) traits
 	}
 }
 
+// MapEntry is a key-value pair within a map with String keys.
+type MapEntry struct {
+	Key   String
+	Value ref.Val
+}
+
+// NewSortedStringMap returns a specialized traits.Mapper with String keys whose lookups perform a
+// binary search over a slice of entries sorted by key, which is faster than hashing for small,
+// constant maps. Iteration visits the keys in sorted order.
+//
+// The entries are sorted in place. When a key is repeated, the last entry for the key is retained.
+// As with NewRefValMap, the Value of the map is a map[ref.Val]ref.Val.
+func NewSortedStringMap(adapter ref.TypeAdapter, entries []MapEntry) traits.Mapper {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	deduped := entries[:0]
+	for i, e := range entries {
+		if i+1 < len(entries) && entries[i+1].Key == e.Key {
+			continue
+		}
+		deduped = append(deduped, e)
+	}
+	value := make(map[ref.Val]ref.Val, len(deduped))
+	for _, e := range deduped {
+		value[e.Key] = e.Value
+	}
+	return &baseMap{
+		TypeAdapter: adapter,
+		mapAccessor: &sortedStringMapAccessor{entries: deduped},
+		value:       value,
+		size:        len(deduped),
+	}
+}
+
 // NewProtoMap returns a specialized traits.Mapper for handling protobuf map values.
 func NewProtoMap(adapter ref.TypeAdapter, value *pb.Map) traits.Mapper {
 	return &protoMap{
@@ -466,6 +500,39 @@ func (a *stringMapAccessor) Iterator() traits.Iterator {
 	}
 }
 
+type sortedStringMapAccessor struct {
+	entries []MapEntry
+}
+
+// Find performs a binary search over the sorted entries, returning (value, true) if present.
+//
+// If the key is not found the function returns (nil, false).
+// If the input key is not a String, or is an Err or Unknown, the function returns
+// (Unknown|Err, false).
+func (a *sortedStringMapAccessor) Find(key ref.Val) (ref.Val, bool) {
+	strKey, ok := key.(String)
+	if !ok {
+		return MaybeNoSuchOverloadErr(key), false
+	}
+	idx := sort.Search(len(a.entries), func(i int) bool { return a.entries[i].Key >= strKey })
+	if idx == len(a.entries) || a.entries[idx].Key != strKey {
+		return nil, false
+	}
+	return a.entries[idx].Value, true
+}
+
+// Iterator creates a new traits.Iterator over the keys of the map in sorted order.
+func (a *sortedStringMapAccessor) Iterator() traits.Iterator {
+	mapKeys := make([]string, len(a.entries))
+	for i, e := range a.entries {
+		mapKeys[i] = string(e.Key)
+	}
+	return &stringKeyIterator{
+		mapKeys: mapKeys,
+		len:     len(mapKeys),
+	}
+}
+
 func newStringIfaceMapAccessor(adapter ref.TypeAdapter, mapVal map[string]interface{}) mapAccessor {
 	return &stringIfaceMapAccessor{
 		TypeAdapter: adapter,
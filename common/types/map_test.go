@@ -495,6 +495,47 @@ func TestStringMapSize(t *testing.T) {
 	}
 }
 
+func TestSortedStringMap(t *testing.T) {
+	reg := newTestRegistry(t)
+	mapValue := NewSortedStringMap(reg, []MapEntry{
+		{Key: "second", Value: String("world")},
+		{Key: "first", Value: String("goodbye")},
+		{Key: "first", Value: String("hello")},
+	})
+	if mapValue.Size() != Int(2) {
+		t.Errorf("Got '%v', expected 2", mapValue.Size())
+	}
+	if val := mapValue.Get(String("first")); val.Equal(String("hello")) != True {
+		t.Errorf("Got '%v', wanted 'hello'", val)
+	}
+	if !IsError(mapValue.Get(Int(1))) {
+		t.Error("Got real value, wanted error")
+	}
+	if !IsError(mapValue.Get(String("third"))) {
+		t.Error("Got real value, wanted error")
+	}
+	other := NewStringStringMap(reg, map[string]string{
+		"first":  "hello",
+		"second": "world"})
+	if mapValue.Equal(other) != True {
+		t.Errorf("Got %v, wanted map equal to %v", mapValue, other)
+	}
+	it := mapValue.Iterator()
+	if key := it.Next(); key != String("first") {
+		t.Errorf("Got first key '%v', wanted 'first'", key)
+	}
+	if _, isMap := mapValue.Value().(map[ref.Val]ref.Val); !isMap {
+		t.Errorf("Got value of type %T, wanted map[ref.Val]ref.Val", mapValue.Value())
+	}
+	native, err := mapValue.ConvertToNative(reflect.TypeOf(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(native, map[string]string{"first": "hello", "second": "world"}) {
+		t.Errorf("Got %v, wanted map[first:hello second:world]", native)
+	}
+}
+
 func TestProtoMap(t *testing.T) {
 	strMap := map[string]string{
 		"hello":   "world",
@@ -38,6 +38,11 @@ func (ed *EnumValueDescription) Name() string {
 	return ed.enumValueName
 }
 
+// SimpleName returns the unqualified identifier name for the enum value.
+func (ed *EnumValueDescription) SimpleName() string {
+	return string(ed.desc.Name())
+}
+
 // Value returns the (numeric) value of the enum.
 func (ed *EnumValueDescription) Value() int32 {
 	return int32(ed.desc.Number())
@@ -16,6 +16,7 @@ package pb
 
 import (
 	"fmt"
+	"sort"
 
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
@@ -62,6 +63,25 @@ func (fd *FileDescription) GetEnumNames() []string {
 	return enumNames
 }
 
+// GetEnumValues returns the descriptions of the values of a qualified enum type name declared
+// within the .proto file, ordered by number and then by name.
+func (fd *FileDescription) GetEnumValues(enumType string) []*EnumValueDescription {
+	enumType = sanitizeProtoName(enumType)
+	var values []*EnumValueDescription
+	for _, e := range fd.enums {
+		if string(e.desc.Parent().FullName()) == enumType {
+			values = append(values, e)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Value() != values[j].Value() {
+			return values[i].Value() < values[j].Value()
+		}
+		return values[i].Name() < values[j].Name()
+	})
+	return values
+}
+
 // GetTypeDescription returns a TypeDescription for a qualified protobuf message type name
 // declared within the .proto file.
 func (fd *FileDescription) GetTypeDescription(typeName string) (*TypeDescription, bool) {
@@ -146,6 +146,17 @@ func (pbdb *Db) DescribeEnum(enumName string) (*EnumValueDescription, bool) {
 	return nil, false
 }
 
+// DescribeEnumValues takes a qualified enum type name and returns the descriptions of its values,
+// ordered by number, if the enum type exists in the `pb.Db`.
+func (pbdb *Db) DescribeEnumValues(enumType string) ([]*EnumValueDescription, bool) {
+	for _, fd := range pbdb.files {
+		if values := fd.GetEnumValues(enumType); len(values) != 0 {
+			return values, true
+		}
+	}
+	return nil, false
+}
+
 // DescribeType returns a `TypeDescription` for the `typeName` if it exists in the `pb.Db`.
 func (pbdb *Db) DescribeType(typeName string) (*TypeDescription, bool) {
 	typeName = sanitizeProtoName(typeName)
@@ -283,6 +283,13 @@ func (fd *FieldDescription) IsList() bool {
 	return fd.desc.IsList()
 }
 
+// SupportsPresence returns true if the field distinguishes between an unset value and a value set
+// to the default, as is the case for proto2 singular fields and proto3 message, oneof, and
+// optional fields.
+func (fd *FieldDescription) SupportsPresence() bool {
+	return fd.desc.HasPresence()
+}
+
 // MaybeUnwrapDynamic takes the reflected protoreflect.Message and determines whether the
 // value can be unwrapped to a more primitive CEL type.
 //
@@ -101,6 +101,9 @@ func TestFieldDescription(t *testing.T) {
 	if fd.IsList() {
 		t.Error("Field 'payload' is marked as repeated.")
 	}
+	if !fd.SupportsPresence() {
+		t.Error("Field 'payload' does not support presence.")
+	}
 	// Access the field by its Go struct name and check to see that it's index
 	// matches the one determined by the TypeDescription utils.
 	got := fd.CheckedType()
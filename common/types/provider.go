@@ -17,7 +17,9 @@ package types
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/google/cel-go/common/types/pb"
 	"github.com/google/cel-go/common/types/ref"
@@ -36,6 +38,43 @@ import (
 type protoTypeRegistry struct {
 	revTypeMap map[string]ref.Type
 	pbdb       *pb.Db
+	// jsonNames indicates whether field lookups fall back to JSON-style field names.
+	jsonNames bool
+}
+
+// TypeProviderOption configures a type registry created by NewRegistryWithOptions.
+type TypeProviderOption func(*protoTypeRegistry) (*protoTypeRegistry, error)
+
+// WithJSONNameMapping causes field lookups which do not match a field name exactly to match the
+// field with the same JSON name, such as `singleInt64` for the field `single_int64`, or the field
+// named by the lowerCamelCase or snake_case form of the name. Names which match more than one
+// field in this way are not found.
+//
+// Exact matches take precedence, so expressions which use the declared field names are
+// unaffected. The FieldType found reports the declared field name, which the type-checker
+// substitutes for the name used within the expression.
+func WithJSONNameMapping() TypeProviderOption {
+	return func(p *protoTypeRegistry) (*protoTypeRegistry, error) {
+		p.jsonNames = true
+		return p, nil
+	}
+}
+
+// NewRegistryWithOptions creates a type registry like NewRegistry, configured by the options.
+func NewRegistryWithOptions(opts []TypeProviderOption,
+	types ...proto.Message) (ref.TypeRegistry, error) {
+	reg, err := NewRegistry(types...)
+	if err != nil {
+		return nil, err
+	}
+	p := reg.(*protoTypeRegistry)
+	for _, opt := range opts {
+		p, err = opt(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
 }
 
 // NewRegistry accepts a list of proto message instances and returns a type
@@ -92,6 +131,7 @@ func (p *protoTypeRegistry) Copy() ref.TypeRegistry {
 	copy := &protoTypeRegistry{
 		revTypeMap: make(map[string]ref.Type),
 		pbdb:       p.pbdb.Copy(),
+		jsonNames:  p.jsonNames,
 	}
 	for k, v := range p.revTypeMap {
 		copy.revTypeMap[k] = v
@@ -107,6 +147,19 @@ func (p *protoTypeRegistry) EnumValue(enumName string) ref.Val {
 	return Int(enumVal.Value())
 }
 
+// LookupEnumValues implements the ref.EnumValueProvider interface method.
+func (p *protoTypeRegistry) LookupEnumValues(enumType string) []ref.EnumValue {
+	vals, found := p.pbdb.DescribeEnumValues(enumType)
+	if !found {
+		return []ref.EnumValue{}
+	}
+	enumVals := make([]ref.EnumValue, len(vals))
+	for i, v := range vals {
+		enumVals[i] = ref.EnumValue{Name: v.SimpleName(), Number: int64(v.Value())}
+	}
+	return enumVals
+}
+
 func (p *protoTypeRegistry) FindFieldType(messageType string,
 	fieldName string) (*ref.FieldType, bool) {
 	msgType, found := p.pbdb.DescribeType(messageType)
@@ -114,16 +167,80 @@ func (p *protoTypeRegistry) FindFieldType(messageType string,
 		return nil, false
 	}
 	field, found := msgType.FieldByName(fieldName)
+	if !found && p.jsonNames {
+		field, found = findFieldByJSONName(msgType, fieldName)
+	}
 	if !found {
 		return nil, false
 	}
 	return &ref.FieldType{
-			Type:    field.CheckedType(),
-			IsSet:   field.IsSet,
-			GetFrom: field.GetFrom},
+			Name:             field.Name(),
+			Type:             field.CheckedType(),
+			SupportsPresence: field.SupportsPresence(),
+			IsSet:            field.IsSet,
+			GetFrom:          field.GetFrom},
 		true
 }
 
+// findFieldByJSONName returns the field whose JSON name is the given name, or which is named by
+// the lowerCamelCase or snake_case form of the name. The name is not found when it matches more
+// than one field.
+func findFieldByJSONName(msgType *pb.TypeDescription, name string) (*pb.FieldDescription, bool) {
+	var match *pb.FieldDescription
+	add := func(field *pb.FieldDescription) bool {
+		if match != nil && match != field {
+			return false
+		}
+		match = field
+		return true
+	}
+	for _, field := range msgType.FieldMap() {
+		if field.Descriptor().JSONName() == name && !add(field) {
+			return nil, false
+		}
+	}
+	for _, alt := range []string{lowerCamelCase(name), snakeCase(name)} {
+		if field, found := msgType.FieldByName(alt); found && !add(field) {
+			return nil, false
+		}
+	}
+	return match, match != nil
+}
+
+// lowerCamelCase removes the underscores from the name, capitalizing the letters which follow
+// them.
+func lowerCamelCase(name string) string {
+	var sb strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = sb.Len() != 0
+		case upper:
+			sb.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// snakeCase lowercases the capital letters of the name, preceding each with an underscore.
+func snakeCase(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i != 0 {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
 func (p *protoTypeRegistry) FindIdent(identName string) (ref.Val, bool) {
 	if t, found := p.revTypeMap[identName]; found {
 		return t.(ref.Val), true
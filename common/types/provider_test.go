@@ -25,10 +25,12 @@ import (
 	"github.com/google/cel-go/common/types/traits"
 
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
 
 	proto3pb "github.com/google/cel-go/test/proto3pb"
 
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	descpb "google.golang.org/protobuf/types/descriptorpb"
 	anypb "google.golang.org/protobuf/types/known/anypb"
 	dpb "google.golang.org/protobuf/types/known/durationpb"
 	structpb "google.golang.org/protobuf/types/known/structpb"
@@ -557,3 +559,75 @@ func newTestRegistry(t *testing.T, types ...proto.Message) ref.TypeRegistry {
 	}
 	return reg
 }
+
+func TestTypeRegistryFindFieldType_JSONNameMapping(t *testing.T) {
+	reg, err := NewRegistryWithOptions(
+		[]TypeProviderOption{WithJSONNameMapping()}, &proto3pb.TestAllTypes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgType := "google.expr.proto3.test.TestAllTypes"
+	for _, name := range []string{"single_int64", "singleInt64", "SingleInt64"} {
+		ft, found := reg.FindFieldType(msgType, name)
+		if !found {
+			t.Errorf("FindFieldType(%q) not found", name)
+			continue
+		}
+		if ft.Name != "single_int64" {
+			t.Errorf("FindFieldType(%q) got name %q, wanted single_int64", name, ft.Name)
+		}
+	}
+	if _, found := reg.Copy().FindFieldType(msgType, "singleInt64"); !found {
+		t.Error("FindFieldType() on a copy did not map the JSON name")
+	}
+	if _, found := reg.FindFieldType(msgType, "single_int"); found {
+		t.Error("FindFieldType(single_int) found an undeclared field")
+	}
+	if _, found := newTestRegistry(t).FindFieldType(msgType, "singleInt64"); found {
+		t.Error("FindFieldType() mapped a JSON name without WithJSONNameMapping")
+	}
+}
+
+func TestTypeRegistryFindFieldType_JSONNameMappingAmbiguous(t *testing.T) {
+	// FooBar is the JSON name of Foo_bar and the lowerCamelCase form of foo_bar.
+	file, err := protodesc.NewFile(&descpb.FileDescriptorProto{
+		Name:    proto.String("ambiguous.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto2"),
+		MessageType: []*descpb.DescriptorProto{{
+			Name: proto.String("Ambiguous"),
+			Field: []*descpb.FieldDescriptorProto{
+				{
+					Name:   proto.String("foo_bar"),
+					Number: proto.Int32(1),
+					Label:  descpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:   descpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+				},
+				{
+					Name:   proto.String("Foo_bar"),
+					Number: proto.Int32(2),
+					Label:  descpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:   descpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+				},
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := NewRegistryWithOptions([]TypeProviderOption{WithJSONNameMapping()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterDescriptor(file); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if ft, found := reg.FindFieldType("test.Ambiguous", "FooBar"); found {
+			t.Fatalf("FindFieldType(FooBar) got %q, wanted an ambiguous name not to be found", ft.Name)
+		}
+	}
+	if ft, found := reg.FindFieldType("test.Ambiguous", "fooBar"); !found || ft.Name != "foo_bar" {
+		t.Errorf("FindFieldType(fooBar) got %v, %v, wanted foo_bar", ft, found)
+	}
+}
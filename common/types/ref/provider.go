@@ -83,12 +83,38 @@ type TypeRegistry interface {
 	Copy() TypeRegistry
 }
 
+// EnumValue describes a named value of an enum type.
+type EnumValue struct {
+	// Name of the value, unqualified by the enum type name.
+	Name string
+
+	// Number is the numeric value.
+	Number int64
+}
+
+// EnumValueProvider is an optional interface which a TypeProvider may implement to enumerate the
+// values of enum types, for example to offer completions or suggestions to the user.
+type EnumValueProvider interface {
+	// LookupEnumValues returns the values of the named enum type ordered by number, or an empty
+	// list if the enum type is not found.
+	LookupEnumValues(enumType string) []EnumValue
+}
+
 // FieldType represents a field's type value and whether that field supports
 // presence detection.
 type FieldType struct {
+	// Name of the field as declared by its type. Providers which map field names, such as those
+	// created with types.WithJSONNameMapping, may find the field under a different name. The name
+	// is empty when the provider does not report it.
+	Name string
+
 	// Type of the field.
 	Type *exprpb.Type
 
+	// SupportsPresence indicates whether the field distinguishes between an unset value and a
+	// value set to the field type's default.
+	SupportsPresence bool
+
 	// IsSet indicates whether the field is set on an input object.
 	IsSet FieldTester
 
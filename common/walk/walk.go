@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package walk provides traversals of the nodes of parsed and checked expressions.
+package walk
+
+import (
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Children returns the direct sub-expressions of the expression in evaluation order:
+//
+//   - the operand of a select.
+//   - the target, if any, and the arguments of a call.
+//   - the elements of a list.
+//   - the key, for map entries, and the value of each entry of a struct or map.
+//   - the range, accumulator initializer, loop condition, loop step, and result of a
+//     comprehension.
+//
+// Constants and identifiers have no sub-expressions.
+func Children(e *exprpb.Expr) []*exprpb.Expr {
+	var children []*exprpb.Expr
+	add := func(c *exprpb.Expr) {
+		if c != nil {
+			children = append(children, c)
+		}
+	}
+	switch e.GetExprKind().(type) {
+	case *exprpb.Expr_SelectExpr:
+		add(e.GetSelectExpr().GetOperand())
+	case *exprpb.Expr_CallExpr:
+		call := e.GetCallExpr()
+		add(call.GetTarget())
+		for _, arg := range call.GetArgs() {
+			add(arg)
+		}
+	case *exprpb.Expr_ListExpr:
+		for _, elem := range e.GetListExpr().GetElements() {
+			add(elem)
+		}
+	case *exprpb.Expr_StructExpr:
+		for _, entry := range e.GetStructExpr().GetEntries() {
+			add(entry.GetMapKey())
+			add(entry.GetValue())
+		}
+	case *exprpb.Expr_ComprehensionExpr:
+		comp := e.GetComprehensionExpr()
+		add(comp.GetIterRange())
+		add(comp.GetAccuInit())
+		add(comp.GetLoopCondition())
+		add(comp.GetLoopStep())
+		add(comp.GetResult())
+	}
+	return children
+}
+
+// PreOrder visits the expression and its sub-expressions in pre-order. When visit returns false,
+// the sub-expressions of the node are skipped.
+//
+// The sub-expressions of a node are determined after it has been visited, so visit may rewrite
+// the node in place.
+func PreOrder(e *exprpb.Expr, visit func(*exprpb.Expr) bool) {
+	if e == nil || !visit(e) {
+		return
+	}
+	for _, c := range Children(e) {
+		PreOrder(c, visit)
+	}
+}
+
+// Scope counts the bindings of the comprehension variables in scope at a node. Names may be bound
+// more than once by nested comprehensions.
+type Scope map[string]int
+
+// Bound reports whether the name refers to a comprehension variable in scope.
+func (s Scope) Bound(name string) bool {
+	return s[name] > 0
+}
+
+// Scoped visits the expression and its sub-expressions in pre-order like PreOrder, along with the
+// comprehension variables in scope at each node.
+//
+// The iteration variable of a comprehension is in scope within its loop condition and loop step,
+// and the accumulator variable within those and its result. The range and accumulator initializer
+// are evaluated in the scope of the comprehension itself. The Scope is updated as the traversal
+// proceeds, so visit must not retain it.
+func Scoped(e *exprpb.Expr, visit func(e *exprpb.Expr, scope Scope) bool) {
+	scoped(e, Scope{}, visit)
+}
+
+func scoped(e *exprpb.Expr, scope Scope, visit func(*exprpb.Expr, Scope) bool) {
+	if e == nil || !visit(e, scope) {
+		return
+	}
+	comp := e.GetComprehensionExpr()
+	if comp == nil {
+		for _, c := range Children(e) {
+			scoped(c, scope, visit)
+		}
+		return
+	}
+	scoped(comp.GetIterRange(), scope, visit)
+	scoped(comp.GetAccuInit(), scope, visit)
+	scope[comp.GetIterVar()]++
+	scope[comp.GetAccuVar()]++
+	scoped(comp.GetLoopCondition(), scope, visit)
+	scoped(comp.GetLoopStep(), scope, visit)
+	scope[comp.GetIterVar()]--
+	scoped(comp.GetResult(), scope, visit)
+	scope[comp.GetAccuVar()]--
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package walk_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/walk"
+	"github.com/google/cel-go/parser"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func parse(t *testing.T, expr string) *exprpb.Expr {
+	t.Helper()
+	parsed, errs := parser.Parse(common.NewTextSource(expr))
+	if len(errs.GetErrors()) != 0 {
+		t.Fatal(errs.ToDisplayString())
+	}
+	return parsed.GetExpr()
+}
+
+func TestPreOrder(t *testing.T) {
+	e := parse(t, `a.f(b, [c, {d: e}]).g && Msg{field: h}.field`)
+	var names []string
+	walk.PreOrder(e, func(e *exprpb.Expr) bool {
+		if id := e.GetIdentExpr(); id != nil {
+			names = append(names, id.GetName())
+		}
+		return true
+	})
+	want := []string{"a", "b", "c", "d", "e", "h"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, wanted %v", names, want)
+	}
+
+	// Returning false skips the sub-expressions of a call.
+	names = nil
+	walk.PreOrder(e, func(e *exprpb.Expr) bool {
+		if id := e.GetIdentExpr(); id != nil {
+			names = append(names, id.GetName())
+		}
+		return e.GetCallExpr().GetFunction() != "f"
+	})
+	want = []string{"h"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, wanted %v", names, want)
+	}
+}
+
+func TestScoped(t *testing.T) {
+	e := parse(t, `x.exists(i, i > y && [1].all(j, i < j)) || i == z`)
+	var free, bound []string
+	walk.Scoped(e, func(e *exprpb.Expr, scope walk.Scope) bool {
+		id := e.GetIdentExpr()
+		switch {
+		case id == nil:
+		case scope.Bound(id.GetName()):
+			bound = append(bound, id.GetName())
+		default:
+			free = append(free, id.GetName())
+		}
+		return true
+	})
+	// The accumulator variable of each macro is bound as well.
+	for i, name := range bound {
+		if strings.HasPrefix(name, "__") {
+			bound[i] = "accu"
+		}
+	}
+	wantFree := []string{"x", "y", "i", "z"}
+	if !reflect.DeepEqual(free, wantFree) {
+		t.Errorf("got free variables %v, wanted %v", free, wantFree)
+	}
+	wantBound := []string{"accu", "accu", "i", "accu", "accu", "i", "j", "accu", "accu"}
+	if !reflect.DeepEqual(bound, wantBound) {
+		t.Errorf("got bound variables %v, wanted %v", bound, wantBound)
+	}
+}
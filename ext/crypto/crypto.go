@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crypto contains a CEL extension library for computing hashes and message
+// authentication codes, as used by security policies such as webhook signature checks.
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter/functions"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// ExtLib returns a cel.Library which declares hash and HMAC functions. Use it with
+// cel.Lib(crypto.ExtLib()).
+//
+// All of the functions are deterministic and free of side effects, and their overloads are
+// marked Pure so that their results may be cached, as by interpreter.WithResultCache. Strings are
+// hashed as their UTF-8 encoding.
+//
+// Crypto.Sha256
+//
+// Returns the SHA-256 digest of the input.
+//
+//     crypto.sha256(<bytes>) -> <bytes>
+//     crypto.sha256(<string>) -> <bytes>
+//
+// Example:
+//
+//     crypto.sha256('abc') == crypto.sha256(b'abc') // returns true
+//
+// Crypto.HmacSHA256
+//
+// Returns the HMAC-SHA-256 of the message with the key.
+//
+//     crypto.hmacSHA256(<bytes>, <bytes>) -> <bytes>
+//
+// Example:
+//
+//     crypto.hmacSHA256(request.body, secret) == request.signature
+//
+// Crypto.Md5
+//
+// Deprecated: MD5 is not collision resistant and must not be used for security checks. It is
+// provided only for comparison with digests computed by legacy systems.
+//
+// Returns the MD5 digest of the input.
+//
+//     crypto.md5(<bytes>) -> <bytes>
+func ExtLib() cel.Library {
+	return cryptoLib{}
+}
+
+type cryptoLib struct{}
+
+func (cryptoLib) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Declarations(
+			decls.NewFunction("crypto.sha256",
+				decls.NewOverload("crypto_sha256_bytes",
+					[]*exprpb.Type{decls.Bytes}, decls.Bytes),
+				decls.NewOverload("crypto_sha256_string",
+					[]*exprpb.Type{decls.String}, decls.Bytes)),
+			decls.NewFunction("crypto.hmacSHA256",
+				decls.NewOverload("crypto_hmac_sha256_bytes_bytes",
+					[]*exprpb.Type{decls.Bytes, decls.Bytes}, decls.Bytes)),
+			decls.NewFunction("crypto.md5",
+				decls.NewOverload("crypto_md5_bytes",
+					[]*exprpb.Type{decls.Bytes}, decls.Bytes)),
+		),
+	}
+}
+
+func (cryptoLib) ProgramOptions() []cel.ProgramOption {
+	return []cel.ProgramOption{
+		cel.Functions(
+			&functions.Overload{
+				Operator: "crypto.sha256",
+				Unary:    sha256Digest,
+				Pure:     true,
+			},
+			&functions.Overload{
+				Operator: "crypto_sha256_bytes",
+				Unary:    sha256Digest,
+				Pure:     true,
+			},
+			&functions.Overload{
+				Operator: "crypto_sha256_string",
+				Unary:    sha256Digest,
+				Pure:     true,
+			},
+			&functions.Overload{
+				Operator: "crypto.hmacSHA256",
+				Binary:   hmacSHA256,
+				Pure:     true,
+			},
+			&functions.Overload{
+				Operator: "crypto_hmac_sha256_bytes_bytes",
+				Binary:   hmacSHA256,
+				Pure:     true,
+			},
+			&functions.Overload{
+				Operator: "crypto.md5",
+				Unary:    md5Digest,
+				Pure:     true,
+			},
+			&functions.Overload{
+				Operator: "crypto_md5_bytes",
+				Unary:    md5Digest,
+				Pure:     true,
+			},
+		),
+	}
+}
+
+func sha256Digest(val ref.Val) ref.Val {
+	var sum [sha256.Size]byte
+	switch v := val.(type) {
+	case types.Bytes:
+		sum = sha256.Sum256(v)
+	case types.String:
+		sum = sha256.Sum256([]byte(v))
+	default:
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	return types.Bytes(sum[:])
+}
+
+func hmacSHA256(msgVal, keyVal ref.Val) ref.Val {
+	msg, ok := msgVal.(types.Bytes)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(msgVal)
+	}
+	key, ok := keyVal.(types.Bytes)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(keyVal)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg)
+	return types.Bytes(mac.Sum(nil))
+}
+
+func md5Digest(val ref.Val) ref.Val {
+	b, ok := val.(types.Bytes)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	sum := md5.Sum(b)
+	return types.Bytes(sum[:])
+}
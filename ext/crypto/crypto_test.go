@@ -0,0 +1,101 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+)
+
+func TestExtLib(t *testing.T) {
+	var tests = []struct {
+		expr string
+		want string
+	}{
+		{
+			expr: `crypto.sha256('abc')`,
+			want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+		{
+			expr: `crypto.sha256(b'abc')`,
+			want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+		{
+			expr: `crypto.sha256(b'')`,
+			want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			expr: `crypto.hmacSHA256(b'The quick brown fox jumps over the lazy dog', b'key')`,
+			want: "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		},
+		{
+			expr: `crypto.hmacSHA256(body, secret)`,
+			want: "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		},
+		{
+			expr: `crypto.md5(b'abc')`,
+			want: "900150983cd24fb0d6963f7d28e17f72",
+		},
+	}
+
+	env, err := cel.NewEnv(
+		cel.Lib(ExtLib()),
+		cel.Declarations(
+			decls.NewVar("body", decls.Bytes),
+			decls.NewVar("secret", decls.Bytes)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]interface{}{
+		"body":   []byte("The quick brown fox jumps over the lazy dog"),
+		"secret": []byte("key"),
+	}
+	for i, tst := range tests {
+		tc := tst
+		t.Run(fmt.Sprintf("[%d]", i), func(tt *testing.T) {
+			ast, iss := env.Compile(tc.expr)
+			if iss.Err() != nil {
+				tt.Fatal(iss.Err())
+			}
+			prg, err := env.Program(ast)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			out, _, err := prg.Eval(vars)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			if got := hex.EncodeToString(out.Value().([]byte)); got != tc.want {
+				tt.Errorf("got %s, wanted %s for expr: %s", got, tc.want, tc.expr)
+			}
+		})
+	}
+}
+
+func TestExtLibTypeCheck(t *testing.T) {
+	env, err := cel.NewEnv(cel.Lib(ExtLib()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expr := range []string{`crypto.md5('abc')`, `crypto.hmacSHA256('msg', b'key')`} {
+		if _, iss := env.Compile(expr); iss.Err() == nil {
+			t.Errorf("got nil error, wanted no matching overload for expr: %s", expr)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/interpreter/functions"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// DefaultMaxStringDistanceLength is the default limit on the number of code points in each
+// argument to the string distance functions.
+const DefaultMaxStringDistanceLength = 1000
+
+// StringDistanceOption configures the StringDistance library.
+type StringDistanceOption func(*distanceLib)
+
+// StringDistanceMaxLength sets the limit on the number of code points in each argument to the
+// string distance functions. Since the functions take time proportional to the product of the
+// argument lengths, the limit bounds the cost of a single call.
+func StringDistanceMaxLength(limit int) StringDistanceOption {
+	return func(lib *distanceLib) {
+		lib.maxLength = limit
+	}
+}
+
+// StringDistance returns a cel.EnvOption to configure functions which measure the similarity of
+// two strings, for use in fuzzy matching.
+//
+// Lengths are measured in unicode code points, and arguments longer than the configured limit,
+// DefaultMaxStringDistanceLength unless set with StringDistanceMaxLength, produce an error.
+//
+// Strings.Levenshtein
+//
+// Returns the Levenshtein edit distance between two strings: the minimum number of single
+// character insertions, deletions, and substitutions which turn one string into the other.
+//
+//     strings.levenshtein(<string>, <string>) -> <int>
+//
+// Examples:
+//
+//     strings.levenshtein('kitten', 'sitting') // returns 3
+//     strings.levenshtein('', 'abc')           // returns 3
+//
+// Strings.JaroWinkler
+//
+// Returns the Jaro-Winkler similarity between two strings, from 0.0 for strings with no
+// characters in common to 1.0 for identical strings. Strings with a common prefix of up to four
+// characters score higher than the Jaro similarity alone.
+//
+//     strings.jaroWinkler(<string>, <string>) -> <double>
+//
+// Examples:
+//
+//     strings.jaroWinkler('martha', 'marhta') // returns 0.9611111111111111
+//     strings.jaroWinkler('abc', 'xyz')       // returns 0.0
+func StringDistance(opts ...StringDistanceOption) cel.EnvOption {
+	lib := &distanceLib{maxLength: DefaultMaxStringDistanceLength}
+	for _, opt := range opts {
+		opt(lib)
+	}
+	return cel.Lib(lib)
+}
+
+type distanceLib struct {
+	maxLength int
+}
+
+func (*distanceLib) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Declarations(
+			decls.NewFunction("strings.levenshtein",
+				decls.NewOverload("strings_levenshtein_string_string",
+					[]*exprpb.Type{decls.String, decls.String},
+					decls.Int)),
+			decls.NewFunction("strings.jaroWinkler",
+				decls.NewOverload("strings_jaro_winkler_string_string",
+					[]*exprpb.Type{decls.String, decls.String},
+					decls.Double)),
+		),
+	}
+}
+
+func (lib *distanceLib) ProgramOptions() []cel.ProgramOption {
+	levenshtein := callInStrStrOutInt(lib.levenshtein)
+	jaroWinkler := callInStrStrOutDouble(lib.jaroWinkler)
+	return []cel.ProgramOption{
+		cel.Functions(
+			&functions.Overload{
+				Operator: "strings.levenshtein",
+				Binary:   levenshtein,
+			},
+			&functions.Overload{
+				Operator: "strings_levenshtein_string_string",
+				Binary:   levenshtein,
+			},
+			&functions.Overload{
+				Operator: "strings.jaroWinkler",
+				Binary:   jaroWinkler,
+			},
+			&functions.Overload{
+				Operator: "strings_jaro_winkler_string_string",
+				Binary:   jaroWinkler,
+			},
+		),
+	}
+}
+
+// runes returns the code points of the strings, or an error if either exceeds the length limit.
+func (lib *distanceLib) runes(s1, s2 string) ([]rune, []rune, error) {
+	r1, r2 := []rune(s1), []rune(s2)
+	if len(r1) > lib.maxLength || len(r2) > lib.maxLength {
+		return nil, nil, fmt.Errorf("string length exceeds limit: %d", lib.maxLength)
+	}
+	return r1, r2, nil
+}
+
+func (lib *distanceLib) levenshtein(s1, s2 string) (int64, error) {
+	r1, r2, err := lib.runes(s1, s2)
+	if err != nil {
+		return 0, err
+	}
+	// Only the previous row of the edit distance table is needed to compute the next one.
+	prev := make([]int, len(r2)+1)
+	curr := make([]int, len(r2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(r1); i++ {
+		curr[0] = i
+		for j := 1; j <= len(r2); j++ {
+			cost := 1
+			if r1[i-1] == r2[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+		prev, curr = curr, prev
+	}
+	return int64(prev[len(r2)]), nil
+}
+
+func (lib *distanceLib) jaroWinkler(s1, s2 string) (float64, error) {
+	r1, r2, err := lib.runes(s1, s2)
+	if err != nil {
+		return 0, err
+	}
+	sim := jaro(r1, r2)
+	prefix := 0
+	for prefix < len(r1) && prefix < len(r2) && prefix < 4 && r1[prefix] == r2[prefix] {
+		prefix++
+	}
+	return sim + float64(prefix)*0.1*(1-sim), nil
+}
+
+// jaro returns the Jaro similarity of two strings, where characters match if they are equal and
+// no further apart than half the length of the longer string, less one.
+func jaro(r1, r2 []rune) float64 {
+	if len(r1) == 0 && len(r2) == 0 {
+		return 1
+	}
+	if len(r1) == 0 || len(r2) == 0 {
+		return 0
+	}
+	window := maxInt(len(r1), len(r2))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matched1 := make([]bool, len(r1))
+	matched2 := make([]bool, len(r2))
+	matches := 0
+	for i := range r1 {
+		lo := maxInt(0, i-window)
+		hi := minInt(len(r2), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matched2[j] && r1[i] == r2[j] {
+				matched1[i], matched2[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+	// Count the matched characters which appear in a different order in each string.
+	transpositions := 0
+	j := 0
+	for i := range r1 {
+		if !matched1[i] {
+			continue
+		}
+		for !matched2[j] {
+			j++
+		}
+		if r1[i] != r2[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	return (m/float64(len(r1)) + m/float64(len(r2)) + (m-float64(transpositions)/2)/m) / 3
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
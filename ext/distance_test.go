@@ -0,0 +1,110 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+)
+
+func TestStringDistance(t *testing.T) {
+	var tests = []struct {
+		expr string
+		err  string
+	}{
+		// Levenshtein tests.
+		{expr: `strings.levenshtein('kitten', 'sitting') == 3`},
+		{expr: `strings.levenshtein('', 'abc') == 3`},
+		{expr: `strings.levenshtein('abc', '') == 3`},
+		{expr: `strings.levenshtein('', '') == 0`},
+		{expr: `strings.levenshtein('flaw', 'lawn') == 2`},
+		{expr: `strings.levenshtein('héllo', 'hello') == 1`},
+		{expr: `strings.levenshtein('abc', 'abc') == 0`},
+		// JaroWinkler tests.
+		{expr: `strings.jaroWinkler('martha', 'marhta') > 0.961`},
+		{expr: `strings.jaroWinkler('martha', 'marhta') < 0.962`},
+		{expr: `strings.jaroWinkler('dixon', 'dicksonx') > 0.813`},
+		{expr: `strings.jaroWinkler('dixon', 'dicksonx') < 0.814`},
+		{expr: `strings.jaroWinkler('abc', 'xyz') == 0.0`},
+		{expr: `strings.jaroWinkler('abc', 'abc') == 1.0`},
+		{expr: `strings.jaroWinkler('', '') == 1.0`},
+		{expr: `strings.jaroWinkler('', 'a') == 0.0`},
+		// Length limit tests.
+		{expr: `strings.levenshtein('` + strings.Repeat("a", 1000) + `', 'a') == 999`},
+		{
+			expr: `strings.levenshtein('` + strings.Repeat("a", 1001) + `', 'a') == 1000`,
+			err:  "string length exceeds limit: 1000",
+		},
+		{
+			expr: `strings.jaroWinkler('a', '` + strings.Repeat("a", 1001) + `') == 0.0`,
+			err:  "string length exceeds limit: 1000",
+		},
+	}
+
+	env, err := cel.NewEnv(StringDistance())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tst := range tests {
+		tc := tst
+		t.Run(fmt.Sprintf("[%d]", i), func(tt *testing.T) {
+			ast, iss := env.Compile(tc.expr)
+			if iss.Err() != nil {
+				tt.Fatal(iss.Err())
+			}
+			prg, err := env.Program(ast)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			out, _, err := prg.Eval(cel.NoVars())
+			if tc.err != "" {
+				if err == nil {
+					tt.Fatalf("got %v, wanted error %s for expr: %s",
+						out.Value(), tc.err, tc.expr)
+				}
+				if tc.err != err.Error() {
+					tt.Errorf("got error %v, wanted error %s for expr: %s",
+						err, tc.err, tc.expr)
+				}
+			} else if err != nil {
+				tt.Fatal(err)
+			} else if out.Value() != true {
+				tt.Errorf("got %v, wanted true for expr: %s", out.Value(), tc.expr)
+			}
+		})
+	}
+}
+
+func TestStringDistanceMaxLength(t *testing.T) {
+	env, err := cel.NewEnv(StringDistance(StringDistanceMaxLength(3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`strings.levenshtein('abc', 'abcd')`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = prg.Eval(cel.NoVars())
+	if err == nil || err.Error() != "string length exceeds limit: 3" {
+		t.Errorf("got error %v, wanted string length exceeds limit: 3", err)
+	}
+}
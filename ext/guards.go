@@ -100,6 +100,24 @@ func callInStrStrOutInt(fn func(string, string) (int64, error)) functions.Binary
 	}
 }
 
+func callInStrStrOutDouble(fn func(string, string) (float64, error)) functions.BinaryOp {
+	return func(val, arg ref.Val) ref.Val {
+		vVal, ok := val.(types.String)
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(val)
+		}
+		argVal, ok := arg.(types.String)
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(arg)
+		}
+		out, err := fn(string(vVal), string(argVal))
+		if err != nil {
+			return types.NewErr(err.Error())
+		}
+		return types.Double(out)
+	}
+}
+
 func callInStrStrOutListStr(fn func(string, string) ([]string, error)) functions.BinaryOp {
 	return func(val, arg ref.Val) ref.Val {
 		vVal, ok := val.(types.String)
@@ -0,0 +1,213 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jwt contains a CEL extension library for verifying JSON Web Tokens and inspecting their
+// claims, as used by authorization policies.
+package jwt
+
+import (
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter/functions"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// now returns the current time, and may be replaced within tests.
+var now = time.Now
+
+// ExtLib returns a cel.Library which declares the opaque type jwt.JWT along with functions for
+// verifying tokens and reading their claims. Use it with cel.Lib(jwt.ExtLib()).
+//
+// Jwt.Parse
+//
+// Decodes a compact serialized token and verifies its signature with a PEM encoded public key,
+// certificate, or PKCS #1 RSA public key. The "alg" header of the token selects the algorithm,
+// which must be one of RS256, RS384, RS512, ES256, ES384, or ES512 and must match the key type.
+// Malformed tokens, unsupported algorithms, and invalid signatures produce an error.
+//
+//     jwt.parse(<string>, <string>) -> <jwt.JWT>
+//
+// Example:
+//
+//     jwt.parse(request.token, '-----BEGIN PUBLIC KEY-----\n...')
+//
+// Jwt.Claims, Jwt.Claim
+//
+// Return the claims set of the token, or the value of one claim. Numeric claims are doubles, as
+// in JSON. Claims which are absent produce an error.
+//
+//     jwt.claims(<jwt.JWT>) -> <map(string, dyn)>
+//     jwt.claim(<jwt.JWT>, <string>) -> <dyn>
+//
+// Examples:
+//
+//     'admin' in jwt.claims(token)['roles']
+//     jwt.claim(token, 'iss') == 'https://issuer.example.com'
+//
+// Jwt.IsExpired
+//
+// Returns whether the "exp" claim of the token is at or before the current time. Tokens without
+// an "exp" claim never expire.
+//
+//     jwt.isExpired(<jwt.JWT>) -> <bool>
+//
+// Jwt.Subject
+//
+// Returns the "sub" claim of the token, or the empty string if it is absent.
+//
+//     jwt.subject(<jwt.JWT>) -> <string>
+func ExtLib() cel.Library {
+	return jwtLib{}
+}
+
+type jwtLib struct{}
+
+func (jwtLib) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Declarations(
+			decls.NewFunction("jwt.parse",
+				decls.NewOverload("jwt_parse_string_string",
+					[]*exprpb.Type{decls.String, decls.String}, JWTDecl)),
+			decls.NewFunction("jwt.claims",
+				decls.NewOverload("jwt_claims_jwt",
+					[]*exprpb.Type{JWTDecl}, decls.NewMapType(decls.String, decls.Dyn))),
+			decls.NewFunction("jwt.claim",
+				decls.NewOverload("jwt_claim_jwt_string",
+					[]*exprpb.Type{JWTDecl, decls.String}, decls.Dyn)),
+			decls.NewFunction("jwt.isExpired",
+				decls.NewOverload("jwt_is_expired_jwt",
+					[]*exprpb.Type{JWTDecl}, decls.Bool)),
+			decls.NewFunction("jwt.subject",
+				decls.NewOverload("jwt_subject_jwt",
+					[]*exprpb.Type{JWTDecl}, decls.String)),
+		),
+	}
+}
+
+func (jwtLib) ProgramOptions() []cel.ProgramOption {
+	return []cel.ProgramOption{
+		cel.Functions(
+			&functions.Overload{
+				Operator: "jwt.parse",
+				Binary:   parse,
+			},
+			&functions.Overload{
+				Operator: "jwt_parse_string_string",
+				Binary:   parse,
+			},
+			&functions.Overload{
+				Operator: "jwt.claims",
+				Unary:    claims,
+			},
+			&functions.Overload{
+				Operator: "jwt_claims_jwt",
+				Unary:    claims,
+			},
+			&functions.Overload{
+				Operator: "jwt.claim",
+				Binary:   claim,
+			},
+			&functions.Overload{
+				Operator: "jwt_claim_jwt_string",
+				Binary:   claim,
+			},
+			&functions.Overload{
+				Operator: "jwt.isExpired",
+				Unary:    isExpired,
+			},
+			&functions.Overload{
+				Operator: "jwt_is_expired_jwt",
+				Unary:    isExpired,
+			},
+			&functions.Overload{
+				Operator: "jwt.subject",
+				Unary:    subject,
+			},
+			&functions.Overload{
+				Operator: "jwt_subject_jwt",
+				Unary:    subject,
+			},
+		),
+	}
+}
+
+func parse(tokenVal, keyVal ref.Val) ref.Val {
+	token, ok := tokenVal.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(tokenVal)
+	}
+	key, ok := keyVal.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(keyVal)
+	}
+	t, err := verify(string(token), string(key))
+	if err != nil {
+		return types.NewErr(err.Error())
+	}
+	return t
+}
+
+func claims(val ref.Val) ref.Val {
+	t, ok := val.(JWT)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	return types.DefaultTypeAdapter.NativeToValue(t.Claims)
+}
+
+func claim(val, nameVal ref.Val) ref.Val {
+	t, ok := val.(JWT)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	name, ok := nameVal.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(nameVal)
+	}
+	c, found := t.Claims[string(name)]
+	if !found {
+		return types.NewErr("no such claim: %q", string(name))
+	}
+	return types.DefaultTypeAdapter.NativeToValue(c)
+}
+
+func isExpired(val ref.Val) ref.Val {
+	t, ok := val.(JWT)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	exp, found := t.Claims["exp"]
+	if !found {
+		return types.False
+	}
+	secs, ok := exp.(float64)
+	if !ok {
+		return types.NewErr("invalid exp claim: %v", exp)
+	}
+	return types.Bool(float64(now().Unix()) >= secs)
+}
+
+func subject(val ref.Val) ref.Val {
+	t, ok := val.(JWT)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	sub, _ := t.Claims["sub"].(string)
+	return types.String(sub)
+}
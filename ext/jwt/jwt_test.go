@@ -0,0 +1,198 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+)
+
+func TestExtLib(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{
+		"sub":   "alice",
+		"exp":   1600000000,
+		"roles": []string{"admin", "dev"},
+	}
+	vars := map[string]interface{}{
+		"rsaToken":   sign(t, "RS256", rsaKey, claims),
+		"ecToken":    sign(t, "ES256", ecKey, claims),
+		"noExpToken": sign(t, "RS512", rsaKey, map[string]interface{}{"iss": "issuer"}),
+		"rsaKey":     publicKeyPEM(t, &rsaKey.PublicKey),
+		"ecKey":      publicKeyPEM(t, &ecKey.PublicKey),
+	}
+	vars["tamperedToken"] = vars["rsaToken"].(string) + "A"
+	vars["noneToken"] = segment(t, map[string]string{"alg": "none"}) + "." +
+		segment(t, claims) + "."
+
+	var tests = []struct {
+		expr string
+		err  string
+	}{
+		{expr: `jwt.subject(jwt.parse(rsaToken, rsaKey)) == 'alice'`},
+		{expr: `jwt.subject(jwt.parse(ecToken, ecKey)) == 'alice'`},
+		{expr: `jwt.subject(jwt.parse(noExpToken, rsaKey)) == ''`},
+		{expr: `'admin' in jwt.claims(jwt.parse(rsaToken, rsaKey))['roles']`},
+		{expr: `jwt.claim(jwt.parse(ecToken, ecKey), 'exp') == 1600000000.0`},
+		{expr: `jwt.claim(jwt.parse(noExpToken, rsaKey), 'iss') == 'issuer'`},
+		{expr: `jwt.isExpired(jwt.parse(rsaToken, rsaKey))`},
+		{expr: `!jwt.isExpired(jwt.parse(noExpToken, rsaKey))`},
+		{
+			expr: `jwt.claim(jwt.parse(rsaToken, rsaKey), 'aud') == ''`,
+			err:  `no such claim: "aud"`,
+		},
+		{
+			expr: `jwt.isExpired(jwt.parse(tamperedToken, rsaKey))`,
+			err:  "invalid token signature",
+		},
+		{
+			expr: `jwt.isExpired(jwt.parse(rsaToken, ecKey))`,
+			err:  "algorithm RS256 requires an RSA key",
+		},
+		{
+			expr: `jwt.isExpired(jwt.parse(noneToken, rsaKey))`,
+			err:  `unsupported signature algorithm: "none"`,
+		},
+		{
+			expr: `jwt.isExpired(jwt.parse('a.b', rsaKey))`,
+			err:  "malformed token",
+		},
+		{
+			expr: `jwt.isExpired(jwt.parse(rsaToken, 'not a key'))`,
+			err:  "malformed public key: no PEM block found",
+		},
+	}
+
+	env, err := cel.NewEnv(
+		cel.Lib(ExtLib()),
+		cel.Declarations(
+			decls.NewVar("rsaToken", decls.String),
+			decls.NewVar("ecToken", decls.String),
+			decls.NewVar("noExpToken", decls.String),
+			decls.NewVar("tamperedToken", decls.String),
+			decls.NewVar("noneToken", decls.String),
+			decls.NewVar("rsaKey", decls.String),
+			decls.NewVar("ecKey", decls.String)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tst := range tests {
+		tc := tst
+		t.Run(fmt.Sprintf("[%d]", i), func(tt *testing.T) {
+			ast, iss := env.Compile(tc.expr)
+			if iss.Err() != nil {
+				tt.Fatal(iss.Err())
+			}
+			prg, err := env.Program(ast)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			out, _, err := prg.Eval(vars)
+			if tc.err != "" {
+				if err == nil {
+					tt.Fatalf("got %v, wanted error %s for expr: %s",
+						out.Value(), tc.err, tc.expr)
+				}
+				if tc.err != err.Error() {
+					tt.Errorf("got error %v, wanted error %s for expr: %s",
+						err, tc.err, tc.expr)
+				}
+			} else if err != nil {
+				tt.Fatal(err)
+			} else if out.Value() != true {
+				tt.Errorf("got %v, wanted true for expr: %s", out.Value(), tc.expr)
+			}
+		})
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	defer func(orig func() time.Time) { now = orig }(now)
+	tok := JWT{Claims: map[string]interface{}{"exp": float64(100)}}
+	now = func() time.Time { return time.Unix(99, 0) }
+	if isExpired(tok) != types.False {
+		t.Error("isExpired() got true before the exp claim")
+	}
+	now = func() time.Time { return time.Unix(100, 0) }
+	if isExpired(tok) != types.True {
+		t.Error("isExpired() got false at the exp claim")
+	}
+}
+
+func segment(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func sign(t *testing.T, alg string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	signed := segment(t, map[string]string{"alg": alg, "typ": "JWT"}) + "." + segment(t, claims)
+	h := algorithms[alg].hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, algorithms[alg].hash, digest); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[size-len(rb):size], rb)
+		copy(sig[2*size-len(sb):], sb)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func publicKeyPEM(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
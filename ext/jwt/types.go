@@ -0,0 +1,84 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+var (
+	// JWTType is the runtime type of verified token values.
+	JWTType = types.NewTypeValue("jwt.JWT")
+
+	// JWTDecl is the type-check declaration of verified token values.
+	JWTDecl = decls.NewAbstractType("jwt.JWT")
+
+	claimsValueType = reflect.TypeOf(map[string]interface{}{})
+)
+
+// JWT is an opaque CEL value holding the header and claims of a token whose signature has been
+// verified.
+type JWT struct {
+	// Header is the decoded JOSE header of the token.
+	Header map[string]interface{}
+
+	// Claims is the decoded claims set of the token.
+	Claims map[string]interface{}
+
+	raw string
+}
+
+// ConvertToNative implements ref.Val.ConvertToNative.
+func (t JWT) ConvertToNative(typeDesc reflect.Type) (interface{}, error) {
+	if typeDesc == claimsValueType {
+		return t.Claims, nil
+	}
+	return nil, fmt.Errorf("type conversion error from '%s' to '%v'", JWTType, typeDesc)
+}
+
+// ConvertToType implements ref.Val.ConvertToType.
+func (t JWT) ConvertToType(typeVal ref.Type) ref.Val {
+	switch typeVal {
+	case JWTType:
+		return t
+	case types.TypeType:
+		return JWTType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", JWTType, typeVal)
+}
+
+// Equal implements ref.Val.Equal.
+func (t JWT) Equal(other ref.Val) ref.Val {
+	otherJWT, ok := other.(JWT)
+	if !ok {
+		return types.ValOrErr(other, "no such overload")
+	}
+	return types.Bool(t.raw == otherJWT.raw)
+}
+
+// Type implements ref.Val.Type.
+func (t JWT) Type() ref.Type {
+	return JWTType
+}
+
+// Value implements ref.Val.Value.
+func (t JWT) Value() interface{} {
+	return t.Claims
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	// Register the hash functions used by the supported algorithms.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// algorithm describes a supported JWS signature algorithm.
+type algorithm struct {
+	hash crypto.Hash
+	ec   bool
+}
+
+var algorithms = map[string]algorithm{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"ES256": {hash: crypto.SHA256, ec: true},
+	"ES384": {hash: crypto.SHA384, ec: true},
+	"ES512": {hash: crypto.SHA512, ec: true},
+}
+
+// verify decodes a compact serialized token and verifies its signature with the PEM encoded
+// public key, using the algorithm named by the token's "alg" header.
+func verify(token, publicKey string) (JWT, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return JWT{}, errors.New("malformed token")
+	}
+	var header, claims map[string]interface{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return JWT{}, fmt.Errorf("malformed token header: %v", err)
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return JWT{}, fmt.Errorf("malformed token claims: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return JWT{}, fmt.Errorf("malformed token signature: %v", err)
+	}
+	algName, _ := header["alg"].(string)
+	alg, found := algorithms[algName]
+	if !found {
+		return JWT{}, fmt.Errorf("unsupported signature algorithm: %q", algName)
+	}
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return JWT{}, err
+	}
+	h := alg.hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	digest := h.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg.ec {
+			return JWT{}, fmt.Errorf("algorithm %s requires an ECDSA key", algName)
+		}
+		if rsa.VerifyPKCS1v15(k, alg.hash, digest, sig) != nil {
+			return JWT{}, errors.New("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		if !alg.ec {
+			return JWT{}, fmt.Errorf("algorithm %s requires an RSA key", algName)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return JWT{}, errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return JWT{}, errors.New("invalid token signature")
+		}
+	default:
+		return JWT{}, fmt.Errorf("unsupported public key type: %T", key)
+	}
+	return JWT{Header: header, Claims: claims, raw: token}, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// parsePublicKey parses a PEM encoded PKIX or PKCS #1 public key, or the public key of a PEM
+// encoded certificate.
+func parsePublicKey(publicKey string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, errors.New("malformed public key: no PEM block found")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("malformed public key: %v", err)
+		}
+		return key, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("malformed public key: %v", err)
+		}
+		return key, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("malformed certificate: %v", err)
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block type: %q", block.Type)
+}
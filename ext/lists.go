@@ -0,0 +1,172 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/interpreter/functions"
+	"github.com/google/cel-go/parser"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// maxFlattenDepth limits the depth of lists.flattenDeep to prevent stack overflows.
+const maxFlattenDepth = 10
+
+// Lists returns a cel.EnvOption to configure extended functions and macros for nested lists.
+//
+// Lists.Flatten
+//
+// Flattens one level of nesting from a list. Elements which are not lists, including null
+// elements, are retained as-is.
+//
+//     lists.flatten(<list(dyn)>) -> <list(dyn)>
+//
+// Examples:
+//
+//     lists.flatten([[1], [2, 3]])  // returns [1, 2, 3]
+//     lists.flatten([1, [2, [3]]])  // returns [1, 2, [3]]
+//     lists.flatten([])             // returns []
+//
+// Lists.FlattenDeep
+//
+// Recursively flattens up to the given number of levels of nesting from a list. The depth is
+// capped at 10 levels, and a negative depth produces an error.
+//
+//     lists.flattenDeep(<list(dyn)>, <int>) -> <list(dyn)>
+//
+// Examples:
+//
+//     lists.flattenDeep([1, [2, [3, [4]]]], 2)  // returns [1, 2, 3, [4]]
+//     lists.flattenDeep([1, [2]], 0)            // returns [1, [2]]
+//     lists.flattenDeep([1], -1)                // error
+//
+// Lists.FlatMap
+//
+// A macro which maps each element of a list to a list and concatenates the results. Calls to
+// `flatMap` with any other target are left as function calls.
+//
+//     lists.flatMap(<list(T)>, <ident>, <expr(list(U))>) -> <list(U)>
+//
+// Examples:
+//
+//     lists.flatMap([1, 2], x, [x, x * 10])  // returns [1, 10, 2, 20]
+//     lists.flatMap([], x, [x])              // returns []
+func Lists() cel.EnvOption {
+	return cel.Lib(listsLib{})
+}
+
+type listsLib struct{}
+
+func (listsLib) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Macros(parser.NewReceiverMacro("flatMap", 3, makeFlatMap)),
+		cel.Declarations(
+			decls.NewFunction("lists.flatten",
+				decls.NewOverload("lists_flatten_list",
+					[]*exprpb.Type{decls.NewListType(decls.Dyn)},
+					decls.NewListType(decls.Dyn))),
+			decls.NewFunction("lists.flattenDeep",
+				decls.NewOverload("lists_flatten_deep_list_int",
+					[]*exprpb.Type{decls.NewListType(decls.Dyn), decls.Int},
+					decls.NewListType(decls.Dyn))),
+		),
+	}
+}
+
+func (listsLib) ProgramOptions() []cel.ProgramOption {
+	return []cel.ProgramOption{
+		cel.Functions(
+			&functions.Overload{
+				Operator: "lists.flatten",
+				Unary:    flatten,
+			},
+			&functions.Overload{
+				Operator: "lists_flatten_list",
+				Unary:    flatten,
+			},
+			&functions.Overload{
+				Operator: "lists.flattenDeep",
+				Binary:   flattenDeep,
+			},
+			&functions.Overload{
+				Operator: "lists_flatten_deep_list_int",
+				Binary:   flattenDeep,
+			},
+		),
+	}
+}
+
+// makeFlatMap expands lists.flatMap(range, x, expr) into a comprehension which concatenates the
+// lists produced by expr for each element x of the range. Calls with any other target are not
+// expanded.
+func makeFlatMap(eh parser.ExprHelper,
+	target *exprpb.Expr, args []*exprpb.Expr) (*exprpb.Expr, *common.Error) {
+	if target.GetIdentExpr().GetName() != "lists" {
+		return nil, nil
+	}
+	v := args[1].GetIdentExpr().GetName()
+	if v == "" {
+		return nil, &common.Error{Message: "argument is not an identifier"}
+	}
+	accuExpr := eh.Ident(parser.AccumulatorName)
+	step := eh.GlobalCall(operators.Add, accuExpr, args[2])
+	return eh.Fold(v, args[0], parser.AccumulatorName,
+		eh.NewList(), eh.LiteralBool(true), step, accuExpr), nil
+}
+
+func flatten(val ref.Val) ref.Val {
+	return flattenDeep(val, types.Int(1))
+}
+
+func flattenDeep(val, depth ref.Val) ref.Val {
+	l, ok := val.(traits.Lister)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	d, ok := depth.(types.Int)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(depth)
+	}
+	if d < 0 {
+		return types.NewErr("invalid flatten depth: %d", d)
+	}
+	if d > maxFlattenDepth {
+		d = maxFlattenDepth
+	}
+	elems := appendFlattened([]ref.Val{}, l, int(d))
+	return types.NewRefValList(types.DefaultTypeAdapter, elems)
+}
+
+// appendFlattened appends the elements of the list to elems, flattening nested lists up to the
+// given depth.
+func appendFlattened(elems []ref.Val, l traits.Lister, depth int) []ref.Val {
+	it := l.Iterator()
+	for it.HasNext() == types.True {
+		elem := it.Next()
+		if nested, ok := elem.(traits.Lister); ok && depth > 0 {
+			elems = appendFlattened(elems, nested, depth-1)
+			continue
+		}
+		elems = append(elems, elem)
+	}
+	return elems
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+)
+
+func TestLists(t *testing.T) {
+	var tests = []struct {
+		expr      string
+		err       string
+		parseOnly bool
+	}{
+		// Flatten tests.
+		{expr: `lists.flatten([[1], [2, 3]]) == [1, 2, 3]`},
+		{expr: `lists.flatten([]) == []`},
+		{expr: `lists.flatten([[], []]) == []`},
+		{expr: `lists.flatten([1, [2, [3]]]) == [1, 2, [3]]`},
+		{expr: `lists.flatten([null, [null]]) == [null, null]`},
+		{
+			expr:      `lists.flatten(1) == []`,
+			err:       "no such overload",
+			parseOnly: true,
+		},
+		// FlattenDeep tests.
+		{expr: `lists.flattenDeep([1, [2, [3, [4]]]], 2) == [1, 2, 3, [4]]`},
+		{expr: `lists.flattenDeep([1, [2]], 0) == [1, [2]]`},
+		{expr: `lists.flattenDeep([], 3) == []`},
+		{expr: `lists.flattenDeep([[null], null], 1) == [null, null]`},
+		{
+			expr: `lists.flattenDeep([[[[[[[[[[[[1]]]]]]]]]]]], 20)
+				== [[1]]`,
+		},
+		{
+			expr: `lists.flattenDeep([1], -1) == [1]`,
+			err:  "invalid flatten depth: -1",
+		},
+		// FlatMap tests.
+		{expr: `lists.flatMap([1, 2], x, [x, x * 10]) == [1, 10, 2, 20]`},
+		{expr: `lists.flatMap([], x, [x]) == []`},
+		{expr: `lists.flatMap([[1, 2], [3]], x, x) == [1, 2, 3]`},
+		{expr: `lists.flatMap(['a', 'b'], s, s == 'a' ? [] : [s]) == ['b']`},
+	}
+
+	env, err := cel.NewEnv(Lists())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tst := range tests {
+		tc := tst
+		t.Run(fmt.Sprintf("[%d]", i), func(tt *testing.T) {
+			var asts []*cel.Ast
+			pAst, iss := env.Parse(tc.expr)
+			if iss.Err() != nil {
+				tt.Fatal(iss.Err())
+			}
+			asts = append(asts, pAst)
+			if !tc.parseOnly {
+				cAst, iss := env.Check(pAst)
+				if iss.Err() != nil {
+					tt.Fatal(iss.Err())
+				}
+				asts = append(asts, cAst)
+			}
+			for _, ast := range asts {
+				prg, err := env.Program(ast)
+				if err != nil {
+					tt.Fatal(err)
+				}
+				out, _, err := prg.Eval(cel.NoVars())
+				if tc.err != "" {
+					if err == nil {
+						tt.Fatalf("got %v, wanted error %s for expr: %s",
+							out.Value(), tc.err, tc.expr)
+					}
+					if tc.err != err.Error() {
+						tt.Errorf("got error %v, wanted error %s for expr: %s",
+							err, tc.err, tc.expr)
+					}
+				} else if err != nil {
+					tt.Fatal(err)
+				} else if out.Value() != true {
+					tt.Errorf("got %v, wanted true for expr: %s", out.Value(), tc.expr)
+				}
+			}
+		})
+	}
+}
+
+func TestListsFlatMapOtherTarget(t *testing.T) {
+	env, err := cel.NewEnv(Lists())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Parse(`[1].flatMap([1], x, [x])`)
+	if iss.Err() != nil {
+		t.Fatalf("env.Parse() failed: %v", iss.Err())
+	}
+	if ast.Expr().GetCallExpr().GetFunction() != "flatMap" {
+		t.Errorf("got %v, wanted an unexpanded flatMap call", ast.Expr())
+	}
+}
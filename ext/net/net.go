@@ -0,0 +1,233 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package net contains a CEL extension library for parsing IP addresses and CIDR ranges and
+// matching addresses against ranges, as used by network policies.
+package net
+
+import (
+	gonet "net"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter/functions"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// ExtLib returns a cel.Library which declares the opaque types net.IPAddr and net.CIDR along with
+// functions for working with them. Use it with cel.Lib(net.ExtLib()).
+//
+// Net.ParseIP
+//
+// Parses an IPv4 or IPv6 address. Malformed addresses produce an error.
+//
+//     net.parseIP(<string>) -> <net.IPAddr>
+//
+// Examples:
+//
+//     net.parseIP('192.168.0.1')
+//     net.parseIP('2001:db8::1')
+//     net.parseIP('192.168.0')   // error
+//
+// Net.ParseCIDR
+//
+// Parses an IPv4 or IPv6 range in CIDR notation. Malformed ranges produce an error.
+//
+//     net.parseCIDR(<string>) -> <net.CIDR>
+//
+// Examples:
+//
+//     net.parseCIDR('10.0.0.0/8')
+//     net.parseCIDR('10.0.0.0') // error
+//
+// Net.Contains
+//
+// Returns whether the range contains the address.
+//
+//     net.contains(<net.CIDR>, <net.IPAddr>) -> <bool>
+//
+// Example:
+//
+//     net.contains(net.parseCIDR('10.0.0.0/8'), net.parseIP('10.1.2.3')) // returns true
+//
+// Net.IsIPv4, Net.IsIPv6
+//
+// Returns whether the address is an IPv4 or an IPv6 address. IPv4-mapped IPv6 addresses, such as
+// ::ffff:10.0.0.1, are IPv4 addresses.
+//
+//     net.isIPv4(<net.IPAddr>) -> <bool>
+//     net.isIPv6(<net.IPAddr>) -> <bool>
+//
+// Examples:
+//
+//     net.isIPv4(net.parseIP('10.0.0.1'))    // returns true
+//     net.isIPv6(net.parseIP('2001:db8::1')) // returns true
+//
+// Net.IPToString
+//
+// Returns the canonical string form of the address.
+//
+//     net.ipToString(<net.IPAddr>) -> <string>
+//
+// Example:
+//
+//     net.ipToString(net.parseIP('2001:0db8::0001')) // returns '2001:db8::1'
+func ExtLib() cel.Library {
+	return netLib{}
+}
+
+type netLib struct{}
+
+func (netLib) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Declarations(
+			decls.NewFunction("net.parseIP",
+				decls.NewOverload("net_parse_ip_string",
+					[]*exprpb.Type{decls.String}, IPAddrDecl)),
+			decls.NewFunction("net.parseCIDR",
+				decls.NewOverload("net_parse_cidr_string",
+					[]*exprpb.Type{decls.String}, CIDRDecl)),
+			decls.NewFunction("net.contains",
+				decls.NewOverload("net_contains_cidr_ipaddr",
+					[]*exprpb.Type{CIDRDecl, IPAddrDecl}, decls.Bool)),
+			decls.NewFunction("net.isIPv4",
+				decls.NewOverload("net_is_ipv4_ipaddr",
+					[]*exprpb.Type{IPAddrDecl}, decls.Bool)),
+			decls.NewFunction("net.isIPv6",
+				decls.NewOverload("net_is_ipv6_ipaddr",
+					[]*exprpb.Type{IPAddrDecl}, decls.Bool)),
+			decls.NewFunction("net.ipToString",
+				decls.NewOverload("net_ip_to_string_ipaddr",
+					[]*exprpb.Type{IPAddrDecl}, decls.String)),
+		),
+	}
+}
+
+func (netLib) ProgramOptions() []cel.ProgramOption {
+	return []cel.ProgramOption{
+		cel.Functions(
+			&functions.Overload{
+				Operator: "net.parseIP",
+				Unary:    parseIP,
+			},
+			&functions.Overload{
+				Operator: "net_parse_ip_string",
+				Unary:    parseIP,
+			},
+			&functions.Overload{
+				Operator: "net.parseCIDR",
+				Unary:    parseCIDR,
+			},
+			&functions.Overload{
+				Operator: "net_parse_cidr_string",
+				Unary:    parseCIDR,
+			},
+			&functions.Overload{
+				Operator: "net.contains",
+				Binary:   contains,
+			},
+			&functions.Overload{
+				Operator: "net_contains_cidr_ipaddr",
+				Binary:   contains,
+			},
+			&functions.Overload{
+				Operator: "net.isIPv4",
+				Unary:    isIPv4,
+			},
+			&functions.Overload{
+				Operator: "net_is_ipv4_ipaddr",
+				Unary:    isIPv4,
+			},
+			&functions.Overload{
+				Operator: "net.isIPv6",
+				Unary:    isIPv6,
+			},
+			&functions.Overload{
+				Operator: "net_is_ipv6_ipaddr",
+				Unary:    isIPv6,
+			},
+			&functions.Overload{
+				Operator: "net.ipToString",
+				Unary:    ipToString,
+			},
+			&functions.Overload{
+				Operator: "net_ip_to_string_ipaddr",
+				Unary:    ipToString,
+			},
+		),
+	}
+}
+
+func parseIP(val ref.Val) ref.Val {
+	s, ok := val.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	ip := gonet.ParseIP(string(s))
+	if ip == nil {
+		return types.NewErr("invalid IP address: %q", string(s))
+	}
+	return IPAddr{IP: ip}
+}
+
+func parseCIDR(val ref.Val) ref.Val {
+	s, ok := val.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	_, ipNet, err := gonet.ParseCIDR(string(s))
+	if err != nil {
+		return types.NewErr("invalid CIDR range: %q", string(s))
+	}
+	return CIDR{IPNet: ipNet}
+}
+
+func contains(val, arg ref.Val) ref.Val {
+	c, ok := val.(CIDR)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	ip, ok := arg.(IPAddr)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(arg)
+	}
+	return types.Bool(c.Contains(ip.IP))
+}
+
+func isIPv4(val ref.Val) ref.Val {
+	ip, ok := val.(IPAddr)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	return types.Bool(ip.To4() != nil)
+}
+
+func isIPv6(val ref.Val) ref.Val {
+	ip, ok := val.(IPAddr)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	return types.Bool(ip.To4() == nil)
+}
+
+func ipToString(val ref.Val) ref.Val {
+	ip, ok := val.(IPAddr)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	return types.String(ip.String())
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package net
+
+import (
+	"fmt"
+	gonet "net"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+)
+
+func TestExtLib(t *testing.T) {
+	var tests = []struct {
+		expr string
+		err  string
+	}{
+		{expr: `net.contains(net.parseCIDR('10.0.0.0/8'), net.parseIP('10.1.2.3'))`},
+		{expr: `!net.contains(net.parseCIDR('10.0.0.0/8'), net.parseIP('11.0.0.1'))`},
+		{expr: `net.contains(net.parseCIDR('2001:db8::/32'), net.parseIP('2001:db8::1'))`},
+		{expr: `!net.contains(net.parseCIDR('2001:db8::/32'), net.parseIP('10.0.0.1'))`},
+		{expr: `net.contains(net.parseCIDR('10.0.0.0/8'), net.parseIP('::ffff:10.0.0.1'))`},
+		{expr: `net.isIPv4(net.parseIP('192.168.0.1'))`},
+		{expr: `!net.isIPv6(net.parseIP('192.168.0.1'))`},
+		{expr: `net.isIPv6(net.parseIP('2001:db8::1'))`},
+		{expr: `net.isIPv4(net.parseIP('::ffff:10.0.0.1'))`},
+		{expr: `net.ipToString(net.parseIP('2001:0db8::0001')) == '2001:db8::1'`},
+		{expr: `net.ipToString(net.parseIP('10.0.0.1')) == '10.0.0.1'`},
+		{expr: `net.parseIP('10.0.0.1') == net.parseIP('::ffff:10.0.0.1')`},
+		{expr: `net.parseCIDR('10.1.0.0/8') == net.parseCIDR('10.0.0.0/8')`},
+		{expr: `net.parseCIDR('10.0.0.0/8') != net.parseCIDR('10.0.0.0/16')`},
+		{expr: `net.contains(net.parseCIDR(cidr), ip)`},
+		{
+			expr: `net.isIPv4(net.parseIP('192.168.0'))`,
+			err:  `invalid IP address: "192.168.0"`,
+		},
+		{
+			expr: `net.contains(net.parseCIDR('10.0.0.0'), net.parseIP('10.0.0.1'))`,
+			err:  `invalid CIDR range: "10.0.0.0"`,
+		},
+	}
+
+	env, err := cel.NewEnv(
+		cel.Lib(ExtLib()),
+		cel.Declarations(
+			decls.NewVar("cidr", decls.String),
+			decls.NewVar("ip", IPAddrDecl)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]interface{}{
+		"cidr": "192.168.0.0/16",
+		"ip":   IPAddr{IP: gonet.ParseIP("192.168.10.20")},
+	}
+	for i, tst := range tests {
+		tc := tst
+		t.Run(fmt.Sprintf("[%d]", i), func(tt *testing.T) {
+			ast, iss := env.Compile(tc.expr)
+			if iss.Err() != nil {
+				tt.Fatal(iss.Err())
+			}
+			prg, err := env.Program(ast)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			out, _, err := prg.Eval(vars)
+			if tc.err != "" {
+				if err == nil {
+					tt.Fatalf("got %v, wanted error %s for expr: %s",
+						out.Value(), tc.err, tc.expr)
+				}
+				if tc.err != err.Error() {
+					tt.Errorf("got error %v, wanted error %s for expr: %s",
+						err, tc.err, tc.expr)
+				}
+			} else if err != nil {
+				tt.Fatal(err)
+			} else if out.Value() != true {
+				tt.Errorf("got %v, wanted true for expr: %s", out.Value(), tc.expr)
+			}
+		})
+	}
+}
+
+func TestExtLibTypeCheck(t *testing.T) {
+	env, err := cel.NewEnv(cel.Lib(ExtLib()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, iss := env.Compile(`net.contains(net.parseIP('10.0.0.1'), net.parseCIDR('10.0.0.0/8'))`)
+	if iss.Err() == nil {
+		t.Error("got nil error, wanted error for swapped net.contains arguments")
+	}
+	ast, iss := env.Compile(`net.parseIP('10.0.0.1')`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	if got := ast.ResultType().GetAbstractType().GetName(); got != "net.IPAddr" {
+		t.Errorf("got result type %v, wanted net.IPAddr", ast.ResultType())
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package net
+
+import (
+	"fmt"
+	gonet "net"
+	"reflect"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+var (
+	// IPAddrType is the runtime type of IP address values.
+	IPAddrType = types.NewTypeValue("net.IPAddr")
+
+	// CIDRType is the runtime type of CIDR range values.
+	CIDRType = types.NewTypeValue("net.CIDR")
+
+	// IPAddrDecl is the type-check declaration of IP address values.
+	IPAddrDecl = decls.NewAbstractType("net.IPAddr")
+
+	// CIDRDecl is the type-check declaration of CIDR range values.
+	CIDRDecl = decls.NewAbstractType("net.CIDR")
+
+	ipValueType    = reflect.TypeOf(gonet.IP{})
+	ipNetValueType = reflect.TypeOf(&gonet.IPNet{})
+)
+
+// IPAddr is an opaque CEL value backed by a net.IP.
+type IPAddr struct {
+	gonet.IP
+}
+
+// ConvertToNative implements ref.Val.ConvertToNative.
+func (ip IPAddr) ConvertToNative(typeDesc reflect.Type) (interface{}, error) {
+	if typeDesc == ipValueType {
+		return ip.IP, nil
+	}
+	return nil, fmt.Errorf("type conversion error from '%s' to '%v'", IPAddrType, typeDesc)
+}
+
+// ConvertToType implements ref.Val.ConvertToType.
+func (ip IPAddr) ConvertToType(typeVal ref.Type) ref.Val {
+	switch typeVal {
+	case types.StringType:
+		return types.String(ip.String())
+	case IPAddrType:
+		return ip
+	case types.TypeType:
+		return IPAddrType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", IPAddrType, typeVal)
+}
+
+// Equal implements ref.Val.Equal.
+func (ip IPAddr) Equal(other ref.Val) ref.Val {
+	otherIP, ok := other.(IPAddr)
+	if !ok {
+		return types.ValOrErr(other, "no such overload")
+	}
+	return types.Bool(ip.IP.Equal(otherIP.IP))
+}
+
+// Type implements ref.Val.Type.
+func (ip IPAddr) Type() ref.Type {
+	return IPAddrType
+}
+
+// Value implements ref.Val.Value.
+func (ip IPAddr) Value() interface{} {
+	return ip.IP
+}
+
+// CIDR is an opaque CEL value backed by a *net.IPNet.
+type CIDR struct {
+	*gonet.IPNet
+}
+
+// ConvertToNative implements ref.Val.ConvertToNative.
+func (c CIDR) ConvertToNative(typeDesc reflect.Type) (interface{}, error) {
+	if typeDesc == ipNetValueType {
+		return c.IPNet, nil
+	}
+	return nil, fmt.Errorf("type conversion error from '%s' to '%v'", CIDRType, typeDesc)
+}
+
+// ConvertToType implements ref.Val.ConvertToType.
+func (c CIDR) ConvertToType(typeVal ref.Type) ref.Val {
+	switch typeVal {
+	case types.StringType:
+		return types.String(c.String())
+	case CIDRType:
+		return c
+	case types.TypeType:
+		return CIDRType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", CIDRType, typeVal)
+}
+
+// Equal implements ref.Val.Equal.
+func (c CIDR) Equal(other ref.Val) ref.Val {
+	otherCIDR, ok := other.(CIDR)
+	if !ok {
+		return types.ValOrErr(other, "no such overload")
+	}
+	return types.Bool(c.IP.Equal(otherCIDR.IP) && c.Mask.String() == otherCIDR.Mask.String())
+}
+
+// Type implements ref.Val.Type.
+func (c CIDR) Type() ref.Type {
+	return CIDRType
+}
+
+// Value implements ref.Val.Value.
+func (c CIDR) Value() interface{} {
+	return c.IPNet
+}
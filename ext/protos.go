@@ -0,0 +1,282 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter/functions"
+	"github.com/google/cel-go/parser"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// FieldDefaults returns a cel.EnvOption to configure macros which read and populate proto message
+// fields with default values, distinguishing absent fields from fields set to the zero value.
+//
+// The field path is a string literal of dot-separated field names. Since the macros expand into
+// presence tests and selections of the path, the type-checker validates the path against the
+// message type and reports unknown fields.
+//
+// Proto.GetOrDefault
+//
+// Returns the value of the field when every field along the path is present, and the default
+// value otherwise. The default value must have the same type as the field.
+//
+//     proto.getOrDefault(<message>, <string>, <T>) -> <T>
+//
+// Examples:
+//
+//     proto.getOrDefault(msg, 'single_int64', 10)        // returns 10 if single_int64 is unset
+//     proto.getOrDefault(msg, 'single_nested_message.bb', 1)
+//
+// Proto.SetDefault
+//
+// Returns the message when every field along the path is present, and otherwise a copy of the
+// message in which the field, along with any absent messages along the path, is set to the
+// default value. Repeated and map fields cannot be set.
+//
+//     proto.setDefault(<message>, <string>, <dyn>) -> <message>
+//
+// Examples:
+//
+//     proto.setDefault(msg, 'single_string', 'unknown').single_string
+//     proto.setDefault(msg, 'single_nested_message.bb', 1)
+func FieldDefaults() cel.EnvOption {
+	return cel.Lib(fieldDefaultsLib{})
+}
+
+type fieldDefaultsLib struct{}
+
+func (fieldDefaultsLib) CompileOptions() []cel.EnvOption {
+	typeParamT := decls.NewTypeParamType("T")
+	return []cel.EnvOption{
+		cel.Macros(
+			parser.NewReceiverMacro("getOrDefault", 3, makeGetOrDefault),
+			parser.NewReceiverMacro("setDefault", 3, makeSetDefault),
+		),
+		cel.Declarations(
+			decls.NewFunction("proto.setDefault",
+				decls.NewParameterizedOverload("proto_set_default_message_string_dyn",
+					[]*exprpb.Type{typeParamT, decls.String, decls.Dyn},
+					typeParamT,
+					[]string{"T"})),
+		),
+	}
+}
+
+func (fieldDefaultsLib) ProgramOptions() []cel.ProgramOption {
+	return []cel.ProgramOption{
+		cel.Functions(
+			&functions.Overload{
+				Operator: "proto.setDefault",
+				Function: setDefault,
+			},
+			&functions.Overload{
+				Operator: "proto_set_default_message_string_dyn",
+				Function: setDefault,
+			},
+		),
+	}
+}
+
+// fieldDefaultsVar is the name of the variable to which the message argument of the field default
+// macros is bound, so that the message is evaluated once. The name cannot be written in an
+// expression, and so cannot collide with user variables.
+const fieldDefaultsVar = "@msg"
+
+// makeGetOrDefault expands proto.getOrDefault(msg, 'a.b', d) into
+// has(@msg.a) && has(@msg.a.b) ? @msg.a.b : d, with msg bound to @msg.
+func makeGetOrDefault(eh parser.ExprHelper,
+	target *exprpb.Expr, args []*exprpb.Expr) (*exprpb.Expr, *common.Error) {
+	if !isProtoTarget(target) {
+		return nil, nil
+	}
+	present, field, err := fieldPresence(eh, args)
+	if err != nil {
+		return nil, err
+	}
+	return bindMessage(eh, args[0],
+		eh.GlobalCall(operators.Conditional, present, field, args[2])), nil
+}
+
+// makeSetDefault expands proto.setDefault(msg, 'a.b', d) into
+// has(@msg.a) && has(@msg.a.b) ? @msg : proto.setDefault(@msg, 'a.b', d), with msg bound to @msg.
+func makeSetDefault(eh parser.ExprHelper,
+	target *exprpb.Expr, args []*exprpb.Expr) (*exprpb.Expr, *common.Error) {
+	if !isProtoTarget(target) {
+		return nil, nil
+	}
+	present, _, err := fieldPresence(eh, args)
+	if err != nil {
+		return nil, err
+	}
+	set := eh.GlobalCall("proto.setDefault", eh.Ident(fieldDefaultsVar), args[1], args[2])
+	return bindMessage(eh, args[0],
+		eh.GlobalCall(operators.Conditional, present, eh.Ident(fieldDefaultsVar), set)), nil
+}
+
+// isProtoTarget reports whether the target of a field default macro is the `proto` namespace.
+// Calls with other targets are not expanded.
+func isProtoTarget(target *exprpb.Expr) bool {
+	return target.GetIdentExpr().GetName() == "proto"
+}
+
+// bindMessage evaluates the result with the message bound to fieldDefaultsVar, using a
+// comprehension over an empty list whose accumulator is initialized to the message.
+func bindMessage(eh parser.ExprHelper, msg, result *exprpb.Expr) *exprpb.Expr {
+	return eh.Fold("#unused", eh.NewList(), fieldDefaultsVar, msg,
+		eh.LiteralBool(false), eh.Ident(fieldDefaultsVar), result)
+}
+
+// fieldPresence validates the field path argument of a field default macro and returns a test for
+// the presence of every field along the path of the bound message, along with the selection of
+// the field.
+func fieldPresence(eh parser.ExprHelper,
+	args []*exprpb.Expr) (*exprpb.Expr, *exprpb.Expr, *common.Error) {
+	path, isString := args[1].GetConstExpr().GetConstantKind().(*exprpb.Constant_StringValue)
+	if !isString {
+		return nil, nil, &common.Error{
+			Message:  "field path must be a string literal",
+			Location: eh.OffsetLocation(args[1].GetId()),
+		}
+	}
+	fields := strings.Split(path.StringValue, ".")
+	var present *exprpb.Expr
+	for i, field := range fields {
+		if field == "" {
+			return nil, nil, &common.Error{
+				Message:  fmt.Sprintf("invalid field path: %q", path.StringValue),
+				Location: eh.OffsetLocation(args[1].GetId()),
+			}
+		}
+		test := eh.PresenceTest(selectPath(eh, fields[:i]), field)
+		if present == nil {
+			present = test
+		} else {
+			present = eh.GlobalCall(operators.LogicalAnd, present, test)
+		}
+	}
+	return present, selectPath(eh, fields), nil
+}
+
+// selectPath returns the selection of the fields from the bound message.
+func selectPath(eh parser.ExprHelper, fields []string) *exprpb.Expr {
+	operand := eh.Ident(fieldDefaultsVar)
+	for _, field := range fields {
+		operand = eh.Select(operand, field)
+	}
+	return operand
+}
+
+// setDefault returns a copy of the message with the field at the path set to the value.
+func setDefault(args ...ref.Val) ref.Val {
+	if len(args) != 3 {
+		return types.NoSuchOverloadErr()
+	}
+	msgVal, pathVal, defVal := args[0], args[1], args[2]
+	msg, isMsg := msgVal.Value().(proto.Message)
+	adapter, isAdapter := msgVal.(ref.TypeAdapter)
+	if !isMsg || !isAdapter {
+		return types.MaybeNoSuchOverloadErr(msgVal)
+	}
+	path, ok := pathVal.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(pathVal)
+	}
+	out := proto.Clone(msg)
+	m := out.ProtoReflect()
+	fields := strings.Split(string(path), ".")
+	for i, name := range fields {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return types.NewErr("no such field: %s", name)
+		}
+		if fd.IsList() || fd.IsMap() {
+			return types.NewErr("cannot set default of repeated field: %s", name)
+		}
+		if i < len(fields)-1 {
+			if fd.Message() == nil {
+				return types.NewErr("field is not a message: %s", name)
+			}
+			m = m.Mutable(fd).Message()
+			continue
+		}
+		if m.Has(fd) {
+			return msgVal
+		}
+		v, err := protoFieldValue(m, fd, defVal)
+		if err != nil {
+			return types.NewErr("cannot set field %s: %v", name, err)
+		}
+		m.Set(fd, v)
+	}
+	return adapter.NativeToValue(out)
+}
+
+// protoFieldValue converts a CEL value to the protobuf value of the message field.
+func protoFieldValue(m protoreflect.Message, fd protoreflect.FieldDescriptor,
+	val ref.Val) (protoreflect.Value, error) {
+	var native interface{}
+	var err error
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		native, err = val.ConvertToNative(reflect.TypeOf(false))
+	case protoreflect.EnumKind:
+		var n interface{}
+		n, err = val.ConvertToNative(reflect.TypeOf(int32(0)))
+		if err == nil {
+			native = protoreflect.EnumNumber(n.(int32))
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		native, err = val.ConvertToNative(reflect.TypeOf(int32(0)))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		native, err = val.ConvertToNative(reflect.TypeOf(int64(0)))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		native, err = val.ConvertToNative(reflect.TypeOf(uint32(0)))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		native, err = val.ConvertToNative(reflect.TypeOf(uint64(0)))
+	case protoreflect.FloatKind:
+		native, err = val.ConvertToNative(reflect.TypeOf(float32(0)))
+	case protoreflect.DoubleKind:
+		native, err = val.ConvertToNative(reflect.TypeOf(float64(0)))
+	case protoreflect.StringKind:
+		native, err = val.ConvertToNative(reflect.TypeOf(""))
+	case protoreflect.BytesKind:
+		native, err = val.ConvertToNative(reflect.TypeOf([]byte{}))
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		msgType := reflect.TypeOf(m.NewField(fd).Message().Interface())
+		var pbVal interface{}
+		pbVal, err = val.ConvertToNative(msgType)
+		if err == nil {
+			native = pbVal.(proto.Message).ProtoReflect()
+		}
+	}
+	if err != nil {
+		return protoreflect.Value{}, err
+	}
+	return protoreflect.ValueOf(native), nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/walk"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+
+	proto3pb "github.com/google/cel-go/test/proto3pb"
+)
+
+func TestFieldDefaults(t *testing.T) {
+	var tests = []struct {
+		expr string
+		msg  *proto3pb.TestAllTypes
+		err  string
+	}{
+		// GetOrDefault tests.
+		{
+			expr: `proto.getOrDefault(msg, 'single_int64', 10) == 10`,
+			msg:  &proto3pb.TestAllTypes{},
+		},
+		{
+			expr: `proto.getOrDefault(msg, 'single_int64', 10) == 3`,
+			msg:  &proto3pb.TestAllTypes{SingleInt64: 3},
+		},
+		{
+			expr: `proto.getOrDefault(msg, 'single_nested_message.bb', 7) == 7`,
+			msg:  &proto3pb.TestAllTypes{},
+		},
+		{
+			expr: `proto.getOrDefault(msg, 'single_nested_message.bb', 7) == 2`,
+			msg: &proto3pb.TestAllTypes{
+				NestedType: &proto3pb.TestAllTypes_SingleNestedMessage{
+					SingleNestedMessage: &proto3pb.TestAllTypes_NestedMessage{Bb: 2},
+				},
+			},
+		},
+		// SetDefault tests.
+		{
+			expr: `proto.setDefault(msg, 'single_string', 'unknown').single_string == 'unknown'`,
+			msg:  &proto3pb.TestAllTypes{},
+		},
+		{
+			expr: `proto.setDefault(msg, 'single_string', 'unknown').single_string == 'known'`,
+			msg:  &proto3pb.TestAllTypes{SingleString: "known"},
+		},
+		{
+			expr: `proto.setDefault(msg, 'single_nested_message.bb', 5).single_nested_message.bb == 5`,
+			msg:  &proto3pb.TestAllTypes{},
+		},
+		{
+			expr: `proto.setDefault(msg, 'single_int64_wrapper', 5).single_int64_wrapper == 5`,
+			msg:  &proto3pb.TestAllTypes{},
+		},
+		{
+			expr: `!has(msg.single_string)
+				&& has(proto.setDefault(msg, 'single_string', 'x').single_string)`,
+			msg: &proto3pb.TestAllTypes{},
+		},
+		{
+			expr: `proto.setDefault(msg, 'single_int32', 'one') == msg`,
+			msg:  &proto3pb.TestAllTypes{},
+			err:  "cannot set field single_int32",
+		},
+	}
+
+	env, err := cel.NewEnv(
+		FieldDefaults(),
+		cel.Types(&proto3pb.TestAllTypes{}),
+		cel.Declarations(
+			decls.NewVar("msg", decls.NewObjectType("google.expr.proto3.test.TestAllTypes")),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tst := range tests {
+		tc := tst
+		t.Run(fmt.Sprintf("[%d]", i), func(tt *testing.T) {
+			ast, iss := env.Compile(tc.expr)
+			if iss.Err() != nil {
+				tt.Fatal(iss.Err())
+			}
+			prg, err := env.Program(ast)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			out, _, err := prg.Eval(map[string]interface{}{"msg": tc.msg})
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					tt.Fatalf("got %v, %v, wanted error %s for expr: %s", out, err, tc.err, tc.expr)
+				}
+			} else if err != nil {
+				tt.Fatal(err)
+			} else if out.Value() != true {
+				tt.Errorf("got %v, wanted true for expr: %s", out.Value(), tc.expr)
+			}
+		})
+	}
+}
+
+func TestFieldDefaultsInvalidPath(t *testing.T) {
+	env, err := cel.NewEnv(
+		FieldDefaults(),
+		cel.Types(&proto3pb.TestAllTypes{}),
+		cel.Declarations(
+			decls.NewVar("msg", decls.NewObjectType("google.expr.proto3.test.TestAllTypes")),
+			decls.NewVar("path", decls.String),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		expr string
+		err  string
+	}{
+		{
+			expr: `proto.getOrDefault(msg, 'single_int65', 1)`,
+			err:  "undefined field 'single_int65'",
+		},
+		{
+			expr: `proto.setDefault(msg, 'single_nested_message.cc', 1)`,
+			err:  "undefined field 'cc'",
+		},
+		{
+			expr: `proto.getOrDefault(msg, path, 1)`,
+			err:  "field path must be a string literal",
+		},
+		{
+			expr: `proto.getOrDefault(msg, 'single_int64.', 1)`,
+			err:  "invalid field path",
+		},
+		{
+			expr: `msg.getOrDefault(msg, 'single_int64', 1)`,
+			err:  "undeclared reference to 'getOrDefault'",
+		},
+	}
+	for _, tc := range tests {
+		_, iss := env.Compile(tc.expr)
+		if iss.Err() == nil || !strings.Contains(iss.Err().Error(), tc.err) {
+			t.Errorf("env.Compile(%q) got %v, wanted error %s", tc.expr, iss.Err(), tc.err)
+		}
+	}
+}
+
+func TestFieldDefaultsEvaluatesMessageOnce(t *testing.T) {
+	env, err := cel.NewEnv(FieldDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expr := range []string{
+		`proto.getOrDefault(msg, 'single_nested_message.bb', 7)`,
+		`proto.setDefault(msg, 'single_nested_message.bb', 7)`,
+	} {
+		ast, iss := env.Parse(expr)
+		if iss.Err() != nil {
+			t.Fatalf("env.Parse(%q) failed: %v", expr, iss.Err())
+		}
+		var refs int
+		walk.PreOrder(ast.Expr(), func(e *exprpb.Expr) bool {
+			if e.GetIdentExpr().GetName() == "msg" {
+				refs++
+			}
+			return true
+		})
+		if refs != 1 {
+			t.Errorf("%s: got %d references to msg, wanted 1", expr, refs)
+		}
+	}
+}
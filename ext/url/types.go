@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package url
+
+import (
+	"fmt"
+	gourl "net/url"
+	"reflect"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+var (
+	// URLType is the runtime type of URL values.
+	URLType = types.NewTypeValue("url.URL")
+
+	// URLDecl is the type-check declaration of URL values.
+	URLDecl = decls.NewAbstractType("url.URL")
+
+	urlValueType = reflect.TypeOf(&gourl.URL{})
+)
+
+// URL is an opaque CEL value backed by a *url.URL.
+type URL struct {
+	*gourl.URL
+}
+
+// ConvertToNative implements ref.Val.ConvertToNative.
+func (u URL) ConvertToNative(typeDesc reflect.Type) (interface{}, error) {
+	if typeDesc == urlValueType {
+		return u.URL, nil
+	}
+	return nil, fmt.Errorf("type conversion error from '%s' to '%v'", URLType, typeDesc)
+}
+
+// ConvertToType implements ref.Val.ConvertToType.
+func (u URL) ConvertToType(typeVal ref.Type) ref.Val {
+	switch typeVal {
+	case types.StringType:
+		return types.String(u.String())
+	case URLType:
+		return u
+	case types.TypeType:
+		return URLType
+	}
+	return types.NewErr("type conversion error from '%s' to '%s'", URLType, typeVal)
+}
+
+// Equal implements ref.Val.Equal.
+func (u URL) Equal(other ref.Val) ref.Val {
+	otherURL, ok := other.(URL)
+	if !ok {
+		return types.ValOrErr(other, "no such overload")
+	}
+	return types.Bool(u.String() == otherURL.String())
+}
+
+// Type implements ref.Val.Type.
+func (u URL) Type() ref.Type {
+	return URLType
+}
+
+// Value implements ref.Val.Value.
+func (u URL) Value() interface{} {
+	return u.URL
+}
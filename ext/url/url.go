@@ -0,0 +1,288 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package url contains a CEL extension library for parsing URLs and matching their components,
+// as used by API gateway policies.
+package url
+
+import (
+	gourl "net/url"
+	"path"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter/functions"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// ExtLib returns a cel.Library which declares the opaque type url.URL along with functions for
+// working with it. Use it with cel.Lib(url.ExtLib()).
+//
+// Url.Parse
+//
+// Parses an absolute URL or a relative reference. Malformed URLs produce an error.
+//
+//     url.parse(<string>) -> <url.URL>
+//
+// Examples:
+//
+//     url.parse('https://example.com/v1/users?id=1')
+//     url.parse('https://[::1') // error
+//
+// Accessors
+//
+// Return the components of a URL. Since the URL type is opaque, the components are accessed with
+// member functions rather than field selection. The path is decoded, while the query is the raw,
+// encoded query string without the leading '?'. Absent components are empty strings.
+//
+//     <url.URL>.scheme() -> <string>
+//     <url.URL>.host() -> <string>
+//     <url.URL>.path() -> <string>
+//     <url.URL>.query() -> <string>
+//     <url.URL>.fragment() -> <string>
+//
+// Examples:
+//
+//     url.parse('https://example.com:8080/a%20b?x=1#top').host()     // returns 'example.com:8080'
+//     url.parse('https://example.com:8080/a%20b?x=1#top').path()     // returns '/a b'
+//     url.parse('https://example.com:8080/a%20b?x=1#top').fragment() // returns 'top'
+//
+// Url.Matches
+//
+// Returns whether the path of the URL matches a glob pattern, where '*' matches any sequence of
+// characters other than '/', '?' matches any single character other than '/', and '[...]' matches
+// a character class, as in path.Match. Malformed patterns produce an error.
+//
+//     url.matches(<url.URL>, <string>) -> <bool>
+//
+// Examples:
+//
+//     url.matches(url.parse('https://example.com/v1/users'), '/v1/*')  // returns true
+//     url.matches(url.parse('https://example.com/v1/users/1'), '/v1/*') // returns false
+//
+// Url.HasQueryParam, Url.QueryParam
+//
+// Return whether the query contains the parameter, and the first value of the parameter or the
+// empty string if it is absent.
+//
+//     url.hasQueryParam(<url.URL>, <string>) -> <bool>
+//     url.queryParam(<url.URL>, <string>) -> <string>
+//
+// Examples:
+//
+//     url.hasQueryParam(url.parse('https://example.com/?a=1&a=2'), 'a') // returns true
+//     url.queryParam(url.parse('https://example.com/?a=1&a=2'), 'a')    // returns '1'
+//     url.queryParam(url.parse('https://example.com/'), 'a')            // returns ''
+func ExtLib() cel.Library {
+	return urlLib{}
+}
+
+type urlLib struct{}
+
+func (urlLib) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Declarations(
+			decls.NewFunction("url.parse",
+				decls.NewOverload("url_parse_string",
+					[]*exprpb.Type{decls.String}, URLDecl)),
+			decls.NewFunction("scheme",
+				decls.NewInstanceOverload("url_scheme",
+					[]*exprpb.Type{URLDecl}, decls.String)),
+			decls.NewFunction("host",
+				decls.NewInstanceOverload("url_host",
+					[]*exprpb.Type{URLDecl}, decls.String)),
+			decls.NewFunction("path",
+				decls.NewInstanceOverload("url_path",
+					[]*exprpb.Type{URLDecl}, decls.String)),
+			decls.NewFunction("query",
+				decls.NewInstanceOverload("url_query",
+					[]*exprpb.Type{URLDecl}, decls.String)),
+			decls.NewFunction("fragment",
+				decls.NewInstanceOverload("url_fragment",
+					[]*exprpb.Type{URLDecl}, decls.String)),
+			decls.NewFunction("url.matches",
+				decls.NewOverload("url_matches_url_string",
+					[]*exprpb.Type{URLDecl, decls.String}, decls.Bool)),
+			decls.NewFunction("url.hasQueryParam",
+				decls.NewOverload("url_has_query_param_url_string",
+					[]*exprpb.Type{URLDecl, decls.String}, decls.Bool)),
+			decls.NewFunction("url.queryParam",
+				decls.NewOverload("url_query_param_url_string",
+					[]*exprpb.Type{URLDecl, decls.String}, decls.String)),
+		),
+	}
+}
+
+func (urlLib) ProgramOptions() []cel.ProgramOption {
+	return []cel.ProgramOption{
+		cel.Functions(
+			&functions.Overload{
+				Operator: "url.parse",
+				Unary:    parse,
+			},
+			&functions.Overload{
+				Operator: "url_parse_string",
+				Unary:    parse,
+			},
+			&functions.Overload{
+				Operator: "scheme",
+				Unary:    scheme,
+			},
+			&functions.Overload{
+				Operator: "url_scheme",
+				Unary:    scheme,
+			},
+			&functions.Overload{
+				Operator: "host",
+				Unary:    host,
+			},
+			&functions.Overload{
+				Operator: "url_host",
+				Unary:    host,
+			},
+			&functions.Overload{
+				Operator: "path",
+				Unary:    urlPath,
+			},
+			&functions.Overload{
+				Operator: "url_path",
+				Unary:    urlPath,
+			},
+			&functions.Overload{
+				Operator: "query",
+				Unary:    query,
+			},
+			&functions.Overload{
+				Operator: "url_query",
+				Unary:    query,
+			},
+			&functions.Overload{
+				Operator: "fragment",
+				Unary:    fragment,
+			},
+			&functions.Overload{
+				Operator: "url_fragment",
+				Unary:    fragment,
+			},
+			&functions.Overload{
+				Operator: "url.matches",
+				Binary:   matches,
+			},
+			&functions.Overload{
+				Operator: "url_matches_url_string",
+				Binary:   matches,
+			},
+			&functions.Overload{
+				Operator: "url.hasQueryParam",
+				Binary:   hasQueryParam,
+			},
+			&functions.Overload{
+				Operator: "url_has_query_param_url_string",
+				Binary:   hasQueryParam,
+			},
+			&functions.Overload{
+				Operator: "url.queryParam",
+				Binary:   queryParam,
+			},
+			&functions.Overload{
+				Operator: "url_query_param_url_string",
+				Binary:   queryParam,
+			},
+		),
+	}
+}
+
+func parse(val ref.Val) ref.Val {
+	s, ok := val.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	u, err := gourl.Parse(string(s))
+	if err != nil {
+		return types.NewErr("invalid URL: %q", string(s))
+	}
+	return URL{URL: u}
+}
+
+func scheme(val ref.Val) ref.Val {
+	return callInURLOutStr(val, func(u URL) string { return u.Scheme })
+}
+
+func host(val ref.Val) ref.Val {
+	return callInURLOutStr(val, func(u URL) string { return u.Host })
+}
+
+func urlPath(val ref.Val) ref.Val {
+	return callInURLOutStr(val, func(u URL) string { return u.Path })
+}
+
+func query(val ref.Val) ref.Val {
+	return callInURLOutStr(val, func(u URL) string { return u.RawQuery })
+}
+
+func fragment(val ref.Val) ref.Val {
+	return callInURLOutStr(val, func(u URL) string { return u.Fragment })
+}
+
+func matches(val, arg ref.Val) ref.Val {
+	u, ok := val.(URL)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	pattern, ok := arg.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(arg)
+	}
+	matched, err := path.Match(string(pattern), u.Path)
+	if err != nil {
+		return types.NewErr("invalid path pattern: %q", string(pattern))
+	}
+	return types.Bool(matched)
+}
+
+func hasQueryParam(val, arg ref.Val) ref.Val {
+	u, ok := val.(URL)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	key, ok := arg.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(arg)
+	}
+	_, found := u.Query()[string(key)]
+	return types.Bool(found)
+}
+
+func queryParam(val, arg ref.Val) ref.Val {
+	u, ok := val.(URL)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	key, ok := arg.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(arg)
+	}
+	return types.String(u.Query().Get(string(key)))
+}
+
+func callInURLOutStr(val ref.Val, fn func(URL) string) ref.Val {
+	u, ok := val.(URL)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(val)
+	}
+	return types.String(fn(u))
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package url
+
+import (
+	"fmt"
+	gourl "net/url"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+)
+
+func TestExtLib(t *testing.T) {
+	var tests = []struct {
+		expr string
+		err  string
+	}{
+		{expr: `url.parse('https://example.com:8080/a%20b?x=1#top').scheme() == 'https'`},
+		{expr: `url.parse('https://example.com:8080/a%20b?x=1#top').host() == 'example.com:8080'`},
+		{expr: `url.parse('https://example.com:8080/a%20b?x=1#top').path() == '/a b'`},
+		{expr: `url.parse('https://example.com:8080/a%20b?x=1#top').query() == 'x=1'`},
+		{expr: `url.parse('https://example.com:8080/a%20b?x=1#top').fragment() == 'top'`},
+		{expr: `url.parse('/relative').host() == ''`},
+		{expr: `url.matches(url.parse('https://example.com/v1/users'), '/v1/*')`},
+		{expr: `!url.matches(url.parse('https://example.com/v1/users/1'), '/v1/*')`},
+		{expr: `url.matches(url.parse('https://example.com/v1/users/1'), '/v?/users/[0-9]')`},
+		{expr: `url.hasQueryParam(url.parse('https://example.com/?a=1&a=2&b'), 'b')`},
+		{expr: `!url.hasQueryParam(url.parse('https://example.com/?a=1'), 'c')`},
+		{expr: `url.queryParam(url.parse('https://example.com/?a=1&a=2'), 'a') == '1'`},
+		{expr: `url.queryParam(url.parse('https://example.com/?q=a%20b'), 'q') == 'a b'`},
+		{expr: `url.queryParam(url.parse('https://example.com/'), 'a') == ''`},
+		{expr: `url.parse('https://example.com/a') == url.parse('https://example.com/a')`},
+		{expr: `url.hasQueryParam(request, 'token')`},
+		{
+			expr: `url.parse('https://[::1').host() == ''`,
+			err:  `invalid URL: "https://[::1"`,
+		},
+		{
+			expr: `url.matches(url.parse('https://example.com/a'), '[')`,
+			err:  `invalid path pattern: "["`,
+		},
+	}
+
+	env, err := cel.NewEnv(
+		cel.Lib(ExtLib()),
+		cel.Declarations(decls.NewVar("request", URLDecl)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := gourl.Parse("https://example.com/?token=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]interface{}{"request": URL{URL: request}}
+	for i, tst := range tests {
+		tc := tst
+		t.Run(fmt.Sprintf("[%d]", i), func(tt *testing.T) {
+			ast, iss := env.Compile(tc.expr)
+			if iss.Err() != nil {
+				tt.Fatal(iss.Err())
+			}
+			prg, err := env.Program(ast)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			out, _, err := prg.Eval(vars)
+			if tc.err != "" {
+				if err == nil {
+					tt.Fatalf("got %v, wanted error %s for expr: %s",
+						out.Value(), tc.err, tc.expr)
+				}
+				if tc.err != err.Error() {
+					tt.Errorf("got error %v, wanted error %s for expr: %s",
+						err, tc.err, tc.expr)
+				}
+			} else if err != nil {
+				tt.Fatal(err)
+			} else if out.Value() != true {
+				tt.Errorf("got %v, wanted true for expr: %s", out.Value(), tc.expr)
+			}
+		})
+	}
+}
@@ -4,11 +4,18 @@ go 1.12
 
 require (
 	github.com/antlr/antlr4 v0.0.0-20200503195918-621b933c7a7f
+	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
 	github.com/golang/protobuf v1.4.3
 	github.com/google/cel-spec v0.5.0
+	github.com/prometheus/client_golang v0.9.2
+	github.com/prometheus/client_model v0.2.0 // indirect
+	github.com/prometheus/common v0.0.0-20181126121408-4724e9255275
 	github.com/stoewer/go-strcase v1.2.0
+	go.opentelemetry.io/otel v0.19.0
+	go.opentelemetry.io/otel/trace v0.19.0
 	golang.org/x/text v0.3.2
+	golang.org/x/time v0.0.0-20211116232009-f0f3c7e86c11
 	google.golang.org/genproto v0.0.0-20201102152239-715cce707fb0
 	google.golang.org/grpc v1.33.2
 	google.golang.org/protobuf v1.25.0
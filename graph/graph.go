@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graph orders the evaluation of CEL programs whose results are assigned to variables
+// referenced by other programs.
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+)
+
+// DependencyGraph records which assigned variables each program depends upon.
+type DependencyGraph struct {
+	// deps maps each variable to the sorted set of assigned variables its program references.
+	deps map[string][]string
+}
+
+// BuildDependencyGraph creates a DependencyGraph from a map of variable name to the program
+// whose result is assigned to the variable.
+//
+// A program depends on another when it references the variable the other program is assigned to.
+// References to variables which are not assigned by any program are ignored, as these are
+// expected to be supplied as inputs.
+//
+// The references of each program are found with cel.ProgramDependencies, and an error is returned
+// for programs which do not report them.
+func BuildDependencyGraph(exprs map[string]cel.Program) (*DependencyGraph, error) {
+	g := &DependencyGraph{deps: make(map[string][]string, len(exprs))}
+	for name, prg := range exprs {
+		if prg == nil {
+			return nil, fmt.Errorf("no program assigned to '%s'", name)
+		}
+		refs, found := cel.ProgramDependencies(prg)
+		if !found {
+			return nil, fmt.Errorf("program assigned to '%s' does not report its dependencies", name)
+		}
+		var deps []string
+		for _, dep := range refs {
+			if _, found := exprs[dep]; found {
+				deps = append(deps, dep)
+			}
+		}
+		sort.Strings(deps)
+		g.deps[name] = deps
+	}
+	return g, nil
+}
+
+// Dependencies returns the sorted names of the assigned variables the named program depends on.
+func (g *DependencyGraph) Dependencies(name string) []string {
+	return g.deps[name]
+}
+
+// TopologicalOrder returns the variable names in an order where each program is evaluated after
+// the programs it depends on. Ties are broken by name so that the order is deterministic.
+//
+// An error is returned if the dependencies contain a cycle.
+func (g *DependencyGraph) TopologicalOrder() ([]string, error) {
+	remaining := make(map[string]int, len(g.deps))
+	dependents := make(map[string][]string, len(g.deps))
+	for name, deps := range g.deps {
+		remaining[name] = len(deps)
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+	var ready []string
+	for name, count := range remaining {
+		if count == 0 {
+			ready = append(ready, name)
+		}
+	}
+	order := make([]string, 0, len(g.deps))
+	for len(ready) != 0 {
+		sort.Strings(ready)
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, name)
+		for _, dependent := range dependents[name] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(order) != len(g.deps) {
+		var cyclic []string
+		for name, count := range remaining {
+			if count != 0 {
+				cyclic = append(cyclic, name)
+			}
+		}
+		sort.Strings(cyclic)
+		return nil, fmt.Errorf("dependency cycle among: %s", strings.Join(cyclic, ", "))
+	}
+	return order, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+)
+
+func compileAll(t *testing.T, srcs map[string]string) map[string]cel.Program {
+	t.Helper()
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("input", decls.Int),
+		decls.NewVar("a", decls.Int),
+		decls.NewVar("b", decls.Int),
+		decls.NewVar("c", decls.Int),
+		decls.NewVar("items", decls.NewListType(decls.Int))))
+	if err != nil {
+		t.Fatalf("cel.NewEnv() failed: %v", err)
+	}
+	prgs := make(map[string]cel.Program, len(srcs))
+	for name, src := range srcs {
+		ast, iss := env.Compile(src)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prgs[name] = prg
+	}
+	return prgs
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	g, err := BuildDependencyGraph(compileAll(t, map[string]string{
+		"c": `a + b`,
+		"b": `a * 2 + items.filter(a, a > input).size()`,
+		"a": `input + 1`,
+	}))
+	if err != nil {
+		t.Fatalf("BuildDependencyGraph() failed: %v", err)
+	}
+	if deps := g.Dependencies("b"); !reflect.DeepEqual(deps, []string{"a"}) {
+		t.Errorf("got dependencies %v for b, wanted [a]", deps)
+	}
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		t.Fatalf("TopologicalOrder() failed: %v", err)
+	}
+	want := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("got order %v, wanted %v", order, want)
+	}
+}
+
+func TestTopologicalOrder_Cycle(t *testing.T) {
+	g, err := BuildDependencyGraph(compileAll(t, map[string]string{
+		"a":     `c + 1`,
+		"b":     `a + 1`,
+		"c":     `b + 1`,
+		"input": `1`,
+	}))
+	if err != nil {
+		t.Fatalf("BuildDependencyGraph() failed: %v", err)
+	}
+	if _, err := g.TopologicalOrder(); err == nil ||
+		err.Error() != "dependency cycle among: a, b, c" {
+		t.Errorf("got error %v, wanted a cycle among a, b, c", err)
+	}
+}
+
+func TestBuildDependencyGraph_Unreported(t *testing.T) {
+	prgs := compileAll(t, map[string]string{
+		"a": `input + 1`,
+		"b": `a * 2`,
+	})
+	// Wrappers which return their underlying program still report its dependencies.
+	prgs["b"] = cel.NewTaggedProgram(prgs["b"], nil)
+	g, err := BuildDependencyGraph(prgs)
+	if err != nil {
+		t.Fatalf("BuildDependencyGraph() failed: %v", err)
+	}
+	if deps := g.Dependencies("b"); !reflect.DeepEqual(deps, []string{"a"}) {
+		t.Errorf("got dependencies %v for b, wanted [a]", deps)
+	}
+	prgs["b"] = struct{ cel.Program }{prgs["a"]}
+	if _, err := BuildDependencyGraph(prgs); err == nil {
+		t.Error("got no error for a program which does not report its dependencies")
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health periodically re-checks stored CEL expressions against an environment, so that
+// expressions broken by schema or declaration changes are detected before they are evaluated.
+package health
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+)
+
+// ExprStore provides the stored expressions to check.
+type ExprStore interface {
+	// LoadAll returns the source of every stored expression keyed by expression id.
+	LoadAll(ctx context.Context) (map[string]string, error)
+}
+
+// HealthReport records the outcome of checking each stored expression.
+type HealthReport struct {
+	// Valid holds the sorted ids of the expressions which compiled without issues.
+	Valid []string
+
+	// Invalid maps the ids of the expressions which failed to compile, or for which a validator
+	// reported an error, to the error.
+	Invalid map[string]error
+
+	// Degraded maps the ids of the expressions which compiled, but for which a validator reported
+	// warnings, to the warnings. Degraded expressions are not included in Valid.
+	Degraded map[string][]*cel.ValidationIssue
+
+	// Err is non-nil if the store could not be loaded, or if the check was cancelled before all
+	// expressions were checked.
+	Err error
+
+	// Time at which the check started.
+	Time time.Time
+}
+
+// HealthChecker re-checks the expressions within an ExprStore against an environment.
+type HealthChecker struct {
+	store     ExprStore
+	env       *cel.Env
+	container string
+
+	mu         sync.Mutex
+	validators []cel.Validator
+	last       *HealthReport
+	runs       int64
+}
+
+// NewHealthChecker creates a HealthChecker for the expressions within the store.
+//
+// When the container is non-empty, the environment is extended with the container prior to
+// compilation. The checker applies the cel.InvalidPresenceCheck validator unless others are set
+// with SetValidators.
+func NewHealthChecker(store ExprStore, env *cel.Env, container string) *HealthChecker {
+	return &HealthChecker{
+		store:      store,
+		env:        env,
+		container:  container,
+		validators: []cel.Validator{cel.InvalidPresenceCheck()},
+	}
+}
+
+// SetValidators replaces the validators applied to each expression which compiles.
+func (h *HealthChecker) SetValidators(validators ...cel.Validator) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.validators = validators
+}
+
+// RunOnce loads and checks all stored expressions, and returns the report.
+func (h *HealthChecker) RunOnce(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		Valid:    []string{},
+		Invalid:  map[string]error{},
+		Degraded: map[string][]*cel.ValidationIssue{},
+		Time:     time.Now(),
+	}
+	defer h.record(report)
+
+	h.mu.Lock()
+	validators := h.validators
+	h.mu.Unlock()
+
+	env := h.env
+	var err error
+	if h.container != "" {
+		env, err = env.Extend(cel.Container(h.container))
+		if err != nil {
+			report.Err = err
+			return report
+		}
+	}
+	exprs, err := h.store.LoadAll(ctx)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	ids := make([]string, 0, len(exprs))
+	for id := range exprs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			report.Err = err
+			return report
+		}
+		ast, iss := env.Compile(exprs[id])
+		if iss.Err() != nil {
+			report.Invalid[id] = iss.Err()
+			continue
+		}
+		issues, err := env.Validate(ast, validators...)
+		if err != nil {
+			report.Invalid[id] = err
+			continue
+		}
+		var warnings []*cel.ValidationIssue
+		for _, issue := range issues {
+			if issue.Severity == cel.SeverityError {
+				report.Invalid[id] = errors.New(issue.String())
+				break
+			}
+			warnings = append(warnings, issue)
+		}
+		switch {
+		case report.Invalid[id] != nil:
+		case len(warnings) != 0:
+			report.Degraded[id] = warnings
+		default:
+			report.Valid = append(report.Valid, id)
+		}
+	}
+	return report
+}
+
+// StartBackground runs RunOnce immediately, and then once per interval, until the context is
+// done. The most recent report is available from LastReport and Metrics.
+func (h *HealthChecker) StartBackground(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			h.RunOnce(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// LastReport returns the report of the most recent check, or nil if no check has run.
+func (h *HealthChecker) LastReport() *HealthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last
+}
+
+// Metrics summarizes the checks performed by a HealthChecker.
+type Metrics struct {
+	// Runs is the number of checks performed.
+	Runs int64 `json:"runs"`
+
+	// Valid, Invalid, and Degraded are the expression counts from the most recent check.
+	Valid    int `json:"valid"`
+	Invalid  int `json:"invalid"`
+	Degraded int `json:"degraded"`
+
+	// LastRun is the time at which the most recent check started.
+	LastRun time.Time `json:"last_run"`
+
+	// LastError is the message of the most recent check's error, if any.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Metrics returns a summary of the checks performed so far.
+func (h *HealthChecker) Metrics() Metrics {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := Metrics{Runs: h.runs}
+	if h.last != nil {
+		m.Valid = len(h.last.Valid)
+		m.Invalid = len(h.last.Invalid)
+		m.Degraded = len(h.last.Degraded)
+		m.LastRun = h.last.Time
+		if h.last.Err != nil {
+			m.LastError = h.last.Err.Error()
+		}
+	}
+	return m
+}
+
+// Var exports the checker's Metrics as an expvar.Var, which may be published with
+// expvar.Publish to make the metrics available on the `/debug/vars` endpoint.
+func (h *HealthChecker) Var() expvar.Var {
+	return expvar.Func(func() interface{} { return h.Metrics() })
+}
+
+func (h *HealthChecker) record(report *HealthReport) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = report
+	h.runs++
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+
+	proto3pb "github.com/google/cel-go/test/proto3pb"
+)
+
+type mapStore struct {
+	exprs map[string]string
+	err   error
+}
+
+func (s *mapStore) LoadAll(ctx context.Context) (map[string]string, error) {
+	return s.exprs, s.err
+}
+
+func newEnv(t *testing.T) *cel.Env {
+	t.Helper()
+	env, err := cel.NewEnv(
+		cel.Types(&proto3pb.TestAllTypes{}),
+		cel.Declarations(decls.NewVar("msg", decls.NewObjectType("google.expr.proto3.test.TestAllTypes"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestRunOnce(t *testing.T) {
+	store := &mapStore{exprs: map[string]string{
+		"ok":       `msg.single_int64 > 1`,
+		"also_ok":  `has(TestAllTypes{}.single_nested_message)`,
+		"missing":  `msg.removed_field == 1`,
+		"degraded": `has(msg.single_int32)`,
+		"literal":  `has({'a': 1}.a)`,
+	}}
+	h := NewHealthChecker(store, newEnv(t), "google.expr.proto3.test")
+	report := h.RunOnce(context.Background())
+	if report.Err != nil {
+		t.Fatal(report.Err)
+	}
+	if !reflect.DeepEqual(report.Valid, []string{"also_ok", "ok"}) {
+		t.Errorf("got valid %v, wanted [also_ok ok]", report.Valid)
+	}
+	if len(report.Invalid) != 2 || report.Invalid["missing"] == nil || report.Invalid["literal"] == nil {
+		t.Errorf("got invalid %v, wanted missing and literal", report.Invalid)
+	}
+	if len(report.Degraded) != 1 || len(report.Degraded["degraded"]) != 1 {
+		t.Errorf("got degraded %v, wanted degraded", report.Degraded)
+	}
+
+	h.SetValidators()
+	report = h.RunOnce(context.Background())
+	if len(report.Valid) != 4 || len(report.Invalid) != 1 {
+		t.Errorf("got valid %v and invalid %v without validators", report.Valid, report.Invalid)
+	}
+	if h.LastReport() != report {
+		t.Error("LastReport() did not return the most recent report")
+	}
+	m := h.Metrics()
+	if m.Runs != 2 || m.Valid != 4 || m.Invalid != 1 || m.Degraded != 0 {
+		t.Errorf("got metrics %+v", m)
+	}
+	var exported Metrics
+	if err := json.Unmarshal([]byte(h.Var().String()), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.Runs != 2 {
+		t.Errorf("got exported metrics %+v", exported)
+	}
+}
+
+func TestRunOnce_Errors(t *testing.T) {
+	h := NewHealthChecker(&mapStore{err: errors.New("unavailable")}, newEnv(t), "")
+	if report := h.RunOnce(context.Background()); report.Err == nil {
+		t.Error("got no error for a failing store")
+	}
+	if m := h.Metrics(); m.LastError != "unavailable" {
+		t.Errorf("got metrics %+v, wanted last error", m)
+	}
+
+	h = NewHealthChecker(&mapStore{exprs: map[string]string{"a": `1`}}, newEnv(t), "")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report := h.RunOnce(ctx)
+	if report.Err != context.Canceled || len(report.Valid) != 0 {
+		t.Errorf("got report %+v, wanted cancellation", report)
+	}
+}
+
+func TestStartBackground(t *testing.T) {
+	store := &mapStore{exprs: map[string]string{"a": `msg.single_int64 > 1`}}
+	h := NewHealthChecker(store, newEnv(t), "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.StartBackground(ctx, time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for h.Metrics().Runs < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d runs, wanted at least 3", h.Metrics().Runs)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := h.LastReport().Valid; !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("got valid %v, wanted [a]", got)
+	}
+}
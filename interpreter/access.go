@@ -0,0 +1,216 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// FieldAccess describes the resolution of a variable, or of a field or element within it, during
+// an evaluation.
+type FieldAccess struct {
+	// VariableName is the name of the variable, qualified by the container it was resolved in.
+	VariableName string
+
+	// FieldPath is the path selected within the variable, such as `address.city` or
+	// `items[0].price`, or empty when the variable itself was accessed. Indexes computed during
+	// evaluation are shown as `[?]`.
+	FieldPath string
+
+	// ValueType is the CEL type name of the value, such as `string` or `google.protobuf.Duration`.
+	ValueType string
+
+	// AccessedAt is the time at which the access completed.
+	AccessedAt time.Time
+}
+
+// AccessRecorder collects the FieldAccess values of the evaluations whose activations are created
+// by its Activation method, for programs planned with WithAccessLogging.
+type AccessRecorder struct {
+	mu       sync.Mutex
+	accesses []FieldAccess
+}
+
+// NewAccessRecorder creates an empty AccessRecorder.
+func NewAccessRecorder() *AccessRecorder {
+	return &AccessRecorder{}
+}
+
+// Activation returns an Activation which resolves names with vars and records accesses within
+// the recorder. The Activation is a PartialActivation when vars is one.
+func (r *AccessRecorder) Activation(vars Activation) Activation {
+	if partial, isPartial := vars.(PartialActivation); isPartial {
+		return &accessPartialActivation{PartialActivation: partial, recorder: r}
+	}
+	return &accessActivation{Activation: vars, recorder: r}
+}
+
+// Accesses returns the recorded accesses in the order in which they completed.
+func (r *AccessRecorder) Accesses() []FieldAccess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]FieldAccess{}, r.accesses...)
+}
+
+func (r *AccessRecorder) record(access FieldAccess) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accesses = append(r.accesses, access)
+}
+
+// accessActivation marks the evaluations which record their accesses.
+type accessActivation struct {
+	Activation
+	recorder *AccessRecorder
+}
+
+// Parent implements the Activation interface method, returning the marked activation.
+func (a *accessActivation) Parent() Activation {
+	return a.Activation
+}
+
+// accessPartialActivation marks the evaluations with partial activations which record their
+// accesses.
+type accessPartialActivation struct {
+	PartialActivation
+	recorder *AccessRecorder
+}
+
+// Parent implements the Activation interface method, returning the marked activation.
+func (a *accessPartialActivation) Parent() Activation {
+	return a.PartialActivation
+}
+
+// accessRecorder returns the recorder of the evaluation which the activation belongs to. Unlike
+// other markers, the recorder is supplied with the input, which may become the child of a
+// hierarchical activation holding default variables, so both sides of those are searched.
+func accessRecorder(vars Activation) (*AccessRecorder, bool) {
+	for a := vars; a != nil; a = a.Parent() {
+		switch act := a.(type) {
+		case *accessActivation:
+			return act.recorder, true
+		case *accessPartialActivation:
+			return act.recorder, true
+		case *hierarchicalActivation:
+			if r, found := accessRecorder(act.child); found {
+				return r, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// loggedAttribute records the resolutions of the attribute of a conditional branch.
+type loggedAttribute struct {
+	Attribute
+}
+
+// Resolve implements the Attribute interface method.
+func (a *loggedAttribute) Resolve(vars Activation) (interface{}, error) {
+	obj, err := a.Attribute.Resolve(vars)
+	if err == nil {
+		recordAccess(a.Attribute, vars, obj)
+	}
+	return obj, err
+}
+
+// logConditionalBranches wraps the variable attributes selected by conditional attributes, whose
+// resolutions are not otherwise visible as nodes.
+func logConditionalBranches(attr Attribute) {
+	cond, isCond := attr.(*conditionalAttribute)
+	if !isCond {
+		return
+	}
+	cond.truthy = logBranch(cond.truthy)
+	cond.falsy = logBranch(cond.falsy)
+}
+
+func logBranch(attr Attribute) Attribute {
+	switch a := attr.(type) {
+	case *loggedAttribute:
+		return attr
+	case *conditionalAttribute:
+		logConditionalBranches(a)
+		return attr
+	case NamespacedAttribute, *maybeAttribute:
+		return &loggedAttribute{Attribute: attr}
+	}
+	return attr
+}
+
+// recordAccess records the resolution of a variable attribute to the value, when the evaluation
+// records accesses.
+func recordAccess(attr Attribute, vars Activation, val interface{}) {
+	recorder, found := accessRecorder(vars)
+	if !found {
+		return
+	}
+	name, quals, found := accessedVariable(attr, vars)
+	if !found {
+		return
+	}
+	valType := fmt.Sprintf("%T", val)
+	if v, isVal := val.(ref.Val); isVal {
+		valType = v.Type().TypeName()
+	}
+	recorder.record(FieldAccess{
+		VariableName: name,
+		FieldPath:    fieldPath(quals),
+		ValueType:    valType,
+		AccessedAt:   time.Now(),
+	})
+}
+
+// accessedVariable returns the name of the variable the attribute resolved, and the qualifiers
+// applied to it.
+func accessedVariable(attr Attribute, vars Activation) (string, []Qualifier, bool) {
+	var candidates []NamespacedAttribute
+	switch a := attr.(type) {
+	case *maybeAttribute:
+		candidates = a.attrs
+	case NamespacedAttribute:
+		candidates = []NamespacedAttribute{a}
+	}
+	for _, ns := range candidates {
+		for _, name := range ns.CandidateVariableNames() {
+			if _, found := vars.ResolveName(name); found {
+				return name, ns.Qualifiers(), true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+func fieldPath(quals []Qualifier) string {
+	var path strings.Builder
+	for _, q := range quals {
+		switch qual := q.(type) {
+		case *fieldQualifier:
+			path.WriteString("." + qual.Name)
+		case *stringQualifier:
+			path.WriteString("." + qual.value)
+		case ConstantQualifier:
+			path.WriteString(fmt.Sprintf("[%v]", qual.Value()))
+		default:
+			path.WriteString("[?]")
+		}
+	}
+	return strings.TrimPrefix(path.String(), ".")
+}
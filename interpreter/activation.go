@@ -15,10 +15,13 @@
 package interpreter
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
 )
 
@@ -159,11 +162,119 @@ type partActivation struct {
 	unknowns []*AttributePattern
 }
 
+// Parent implements the Activation interface method, returning the bindings so that the markers
+// they carry remain visible when walking the parents of the activation.
+func (a *partActivation) Parent() Activation {
+	return a.Activation
+}
+
 // UnknownAttributePatterns implements the PartialActivation interface method.
 func (a *partActivation) UnknownAttributePatterns() []*AttributePattern {
 	return a.unknowns
 }
 
+// NewContextActivation returns an activation which resolves names from the vars and carries the
+// context of an evaluation. The context is passed to the implementations bound by
+// WithContextFunctions, and is observed by decorators which limit the evaluation, such as
+// WithMaxCallDepth.
+//
+// Create one activation per evaluation, just before the evaluation begins, since the creation
+// time marks the start of the evaluation for WithElasticDeadline. Partial activations remain
+// partial. Evaluations whose activation carries no context use context.Background().
+func NewContextActivation(ctx context.Context, vars Activation) Activation {
+	eval := evaluation{ctx: ctx, start: time.Now()}
+	if partial, isPartial := vars.(PartialActivation); isPartial {
+		return &contextPartialActivation{PartialActivation: partial, eval: eval}
+	}
+	return &contextActivation{Activation: vars, eval: eval}
+}
+
+// evaluation describes an evaluation begun with a context.
+type evaluation struct {
+	ctx   context.Context
+	start time.Time
+}
+
+// contextActivation carries the context of an evaluation.
+type contextActivation struct {
+	Activation
+	eval evaluation
+}
+
+// Parent implements the Activation interface method, returning the marked activation.
+func (a *contextActivation) Parent() Activation {
+	return a.Activation
+}
+
+// contextPartialActivation carries the context of an evaluation with a partial activation.
+type contextPartialActivation struct {
+	PartialActivation
+	eval evaluation
+}
+
+// Parent implements the Activation interface method, returning the marked activation.
+func (a *contextPartialActivation) Parent() Activation {
+	return a.PartialActivation
+}
+
+// withEvaluationContext returns an activation which carries the context in place of that of the
+// evaluation, keeping the start time of the evaluation when the activation carries one.
+func withEvaluationContext(vars Activation, ctx context.Context) Activation {
+	eval, found := findEvaluation(vars)
+	if !found {
+		eval.start = time.Now()
+	}
+	eval.ctx = ctx
+	if partial, isPartial := vars.(PartialActivation); isPartial {
+		return &contextPartialActivation{PartialActivation: partial, eval: eval}
+	}
+	return &contextActivation{Activation: vars, eval: eval}
+}
+
+// evaluationContext returns the context carried by the activation, or by the nearest of its
+// parents which carries one, and otherwise context.Background().
+func evaluationContext(vars Activation) context.Context {
+	if eval, found := findEvaluation(vars); found {
+		return eval.ctx
+	}
+	return context.Background()
+}
+
+// findEvaluation searches the activation and its parents for the evaluation carried by a context
+// activation. Markers such as this one return the activation they mark as their parent, so that
+// markers added by decorators during the evaluation do not hide it.
+func findEvaluation(vars Activation) (evaluation, bool) {
+	for a := vars; a != nil; a = a.Parent() {
+		switch act := a.(type) {
+		case *contextActivation:
+			return act.eval, true
+		case *contextPartialActivation:
+			return act.eval, true
+		case *hierarchicalActivation:
+			// The child of a hierarchical activation is not one of its parents.
+			if eval, found := findEvaluation(act.child); found {
+				return eval, true
+			}
+		}
+	}
+	return evaluation{}, false
+}
+
+// prefetch resolves the identifiers from the activation, returning the first error value resolved
+// for an identifier, or nil.
+func prefetch(vars Activation, idents []string) ref.Val {
+	for _, ident := range idents {
+		obj, found := vars.ResolveName(ident)
+		if !found {
+			continue
+		}
+		if val, isVal := obj.(ref.Val); isVal && types.IsError(val) {
+			return val
+		}
+	}
+	return nil
+}
+
 // varActivation represents a single mutable variable binding.
 //
 // This activation type should only be used within folds as the fold loop controls the object
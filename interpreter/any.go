@@ -0,0 +1,219 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"sync"
+
+	"github.com/google/cel-go/common/types/ref"
+	"google.golang.org/protobuf/proto"
+
+	anypb "google.golang.org/protobuf/types/known/anypb"
+)
+
+// AnyTypeResolver resolves the message type packed within a `google.protobuf.Any` value.
+type AnyTypeResolver interface {
+	// Resolve returns a message instance of the type identified by the type url.
+	//
+	// The returned message is used only as a prototype: the packed value is decoded into a new
+	// instance of the same type.
+	Resolve(typeURL string) (proto.Message, error)
+}
+
+// decAnyTypeResolver wraps attributes so that field selection on `google.protobuf.Any` values
+// decodes the value with the resolver before applying the qualifier, and intercepts the evaluation
+// of the expression so that each evaluation decodes the values into a cache of its own.
+func decAnyTypeResolver(resolver AnyTypeResolver) InterpretableDecorator {
+	cache := &anyCache{resolver: resolver}
+	return func(i Interpretable) (Interpretable, error) {
+		switch inst := i.(type) {
+		case *evalRoot:
+			inst.intercept(cache.evalScoped)
+		case *evalAttr:
+			switch inst.attr.(type) {
+			// Conditional attributes delegate qualification to the attributes of their branches.
+			case *anyResolvingAttribute, *conditionalAttribute:
+			default:
+				inst.attr = &anyResolvingAttribute{Attribute: inst.attr, cache: cache}
+			}
+		}
+		return i, nil
+	}
+}
+
+// anyResolvingAttribute wraps the qualifiers added to an attribute with an anyQualifier.
+type anyResolvingAttribute struct {
+	Attribute
+	cache *anyCache
+}
+
+// AddQualifier implements the Attribute interface method.
+func (a *anyResolvingAttribute) AddQualifier(qual Qualifier) (Attribute, error) {
+	switch q := qual.(type) {
+	case Attribute:
+		// Attribute qualifiers are evaluated as attributes, and so are left unwrapped.
+	case ConstantQualifier:
+		qual = &anyConstQualifier{ConstantQualifier: q, cache: a.cache}
+	default:
+		qual = &anyQualifier{Qualifier: q, cache: a.cache}
+	}
+	attr, err := a.Attribute.AddQualifier(qual)
+	if err != nil {
+		return nil, err
+	}
+	a.Attribute = attr
+	return a, nil
+}
+
+// Cost implements the Coster interface method.
+func (a *anyResolvingAttribute) Cost() (min, max int64) {
+	return estimateCost(a.Attribute)
+}
+
+type anyQualifier struct {
+	Qualifier
+	cache *anyCache
+}
+
+// Qualify implements the Qualifier interface method.
+func (q *anyQualifier) Qualify(vars Activation, obj interface{}) (interface{}, error) {
+	obj, err := q.cache.unpack(vars, obj)
+	if err != nil {
+		return nil, err
+	}
+	return q.Qualifier.Qualify(vars, obj)
+}
+
+// Cost implements the Coster interface method.
+func (q *anyQualifier) Cost() (min, max int64) {
+	return estimateCost(q.Qualifier)
+}
+
+type anyConstQualifier struct {
+	ConstantQualifier
+	cache *anyCache
+}
+
+// Qualify implements the Qualifier interface method.
+func (q *anyConstQualifier) Qualify(vars Activation, obj interface{}) (interface{}, error) {
+	obj, err := q.cache.unpack(vars, obj)
+	if err != nil {
+		return nil, err
+	}
+	return q.ConstantQualifier.Qualify(vars, obj)
+}
+
+// Cost implements the Coster interface method.
+func (q *anyConstQualifier) Cost() (min, max int64) {
+	return estimateCost(q.ConstantQualifier)
+}
+
+// anyCache decodes Any values with the resolver.
+//
+// The decoded messages are cached within the activation of a single evaluation, which is set up
+// around the evaluation of the expression, so that evaluations neither share messages nor retain them.
+type anyCache struct {
+	resolver AnyTypeResolver
+}
+
+// anyMessages holds the messages decoded during a single evaluation. The messages are guarded by
+// a mutex since partitions of a comprehension may be evaluated concurrently.
+type anyMessages struct {
+	cache    *anyCache
+	mu       sync.Mutex
+	messages map[*anypb.Any]proto.Message
+}
+
+// unpack decodes the object if it is an Any value, and otherwise returns the object as-is.
+func (c *anyCache) unpack(vars Activation, obj interface{}) (interface{}, error) {
+	anyVal, ok := obj.(*anypb.Any)
+	if !ok {
+		return obj, nil
+	}
+	scope, cacheable := anyMessagesOf(vars, c)
+	if cacheable {
+		scope.mu.Lock()
+		msg, found := scope.messages[anyVal]
+		scope.mu.Unlock()
+		if found {
+			return msg, nil
+		}
+	}
+	prototype, err := c.resolver.Resolve(anyVal.GetTypeUrl())
+	if err != nil {
+		return nil, err
+	}
+	msg := prototype.ProtoReflect().New().Interface()
+	if err := anyVal.UnmarshalTo(msg); err != nil {
+		return nil, err
+	}
+	if cacheable {
+		scope.mu.Lock()
+		scope.messages[anyVal] = msg
+		scope.mu.Unlock()
+	}
+	return msg, nil
+}
+
+// evalScoped evaluates the expression with a new set of decoded messages.
+func (c *anyCache) evalScoped(vars Activation, eval func(Activation) ref.Val) ref.Val {
+	scope := &anyMessages{cache: c, messages: make(map[*anypb.Any]proto.Message)}
+	if partial, isPartial := vars.(PartialActivation); isPartial {
+		return eval(&anyPartialActivation{PartialActivation: partial, scope: scope})
+	}
+	return eval(&anyActivation{Activation: vars, scope: scope})
+}
+
+// anyActivation carries the messages decoded during an evaluation.
+type anyActivation struct {
+	Activation
+	scope *anyMessages
+}
+
+// Parent implements the Activation interface method, returning the marked activation.
+func (a *anyActivation) Parent() Activation {
+	return a.Activation
+}
+
+// anyPartialActivation carries the messages decoded during an evaluation of a partial activation.
+type anyPartialActivation struct {
+	PartialActivation
+	scope *anyMessages
+}
+
+// Parent implements the Activation interface method, returning the marked activation.
+func (a *anyPartialActivation) Parent() Activation {
+	return a.PartialActivation
+}
+
+// anyMessagesOf returns the messages decoded by the cache during the evaluation of the activation,
+// if the activation or one of its parents carries them.
+func anyMessagesOf(vars Activation, cache *anyCache) (*anyMessages, bool) {
+	for a := vars; a != nil; a = a.Parent() {
+		var scope *anyMessages
+		switch act := a.(type) {
+		case *anyActivation:
+			scope = act.scope
+		case *anyPartialActivation:
+			scope = act.scope
+		default:
+			continue
+		}
+		if scope.cache == cache {
+			return scope, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+)
+
+// ArithmeticBackend implements the arithmetic operators for int and double values.
+//
+// Each method is invoked with two types.Int or two types.Double operands and returns the result
+// of the operation or an error value.
+type ArithmeticBackend interface {
+	// Add returns the sum of the operands.
+	Add(lhs, rhs ref.Val) ref.Val
+
+	// Sub returns the difference of the operands.
+	Sub(lhs, rhs ref.Val) ref.Val
+
+	// Mul returns the product of the operands.
+	Mul(lhs, rhs ref.Val) ref.Val
+
+	// Div returns the quotient of the operands.
+	Div(lhs, rhs ref.Val) ref.Val
+}
+
+// IEEE754Backend returns the default ArithmeticBackend, which uses native int64 arithmetic for
+// ints and IEEE 754 binary64 arithmetic for doubles.
+func IEEE754Backend() ArithmeticBackend {
+	return ieee754Backend{}
+}
+
+type ieee754Backend struct{}
+
+// Add implements ArithmeticBackend.Add.
+func (ieee754Backend) Add(lhs, rhs ref.Val) ref.Val {
+	return lhs.(traits.Adder).Add(rhs)
+}
+
+// Sub implements ArithmeticBackend.Sub.
+func (ieee754Backend) Sub(lhs, rhs ref.Val) ref.Val {
+	return lhs.(traits.Subtractor).Subtract(rhs)
+}
+
+// Mul implements ArithmeticBackend.Mul.
+func (ieee754Backend) Mul(lhs, rhs ref.Val) ref.Val {
+	return lhs.(traits.Multiplier).Multiply(rhs)
+}
+
+// Div implements ArithmeticBackend.Div.
+func (ieee754Backend) Div(lhs, rhs ref.Val) ref.Val {
+	return lhs.(traits.Divider).Divide(rhs)
+}
+
+// BigDecimalBackend returns an ArithmeticBackend which computes each operation using math/big.
+//
+// Double operations are computed with a big.Float of the given precision in bits. When the
+// operands of an arithmetic operator are themselves arithmetic operators, as in `a * b + c`, the
+// unrounded results are carried between the operators, and only the result of the outermost
+// operator is rounded to the nearest double. Values passed to other functions, stored in
+// variables, or returned from comprehensions are doubles, and so are rounded. Int operations are computed exactly and produce an error rather
+// than wrapping when the result overflows an int64. Operations on non-finite doubles and
+// division of doubles by zero follow IEEE 754.
+func BigDecimalBackend(prec uint) ArithmeticBackend {
+	return &bigDecimalBackend{prec: prec}
+}
+
+type bigDecimalBackend struct {
+	prec uint
+}
+
+// Add implements ArithmeticBackend.Add.
+func (b *bigDecimalBackend) Add(lhs, rhs ref.Val) ref.Val {
+	return b.apply(lhs, rhs, (*big.Int).Add, (*big.Float).Add, IEEE754Backend().Add)
+}
+
+// Sub implements ArithmeticBackend.Sub.
+func (b *bigDecimalBackend) Sub(lhs, rhs ref.Val) ref.Val {
+	return b.apply(lhs, rhs, (*big.Int).Sub, (*big.Float).Sub, IEEE754Backend().Sub)
+}
+
+// Mul implements ArithmeticBackend.Mul.
+func (b *bigDecimalBackend) Mul(lhs, rhs ref.Val) ref.Val {
+	return b.apply(lhs, rhs, (*big.Int).Mul, (*big.Float).Mul, IEEE754Backend().Mul)
+}
+
+// Div implements ArithmeticBackend.Div.
+func (b *bigDecimalBackend) Div(lhs, rhs ref.Val) ref.Val {
+	switch r := rhs.(type) {
+	case types.Int:
+		if r == 0 {
+			return types.NewErr("divide by zero")
+		}
+	case types.Double:
+		if r == 0 {
+			return IEEE754Backend().Div(lhs, rhs)
+		}
+	}
+	return b.apply(lhs, rhs, (*big.Int).Quo, (*big.Float).Quo, IEEE754Backend().Div)
+}
+
+func (b *bigDecimalBackend) apply(lhs, rhs ref.Val,
+	intOp func(z, x, y *big.Int) *big.Int,
+	floatOp func(z, x, y *big.Float) *big.Float,
+	fallback func(lhs, rhs ref.Val) ref.Val) ref.Val {
+	switch l := lhs.(type) {
+	case types.Int:
+		r, ok := rhs.(types.Int)
+		if !ok {
+			return types.ValOrErr(rhs, "no such overload")
+		}
+		z := intOp(new(big.Int), big.NewInt(int64(l)), big.NewInt(int64(r)))
+		if !z.IsInt64() {
+			return types.NewErr("integer overflow")
+		}
+		return types.Int(z.Int64())
+	case types.Double:
+		r, ok := rhs.(types.Double)
+		if !ok {
+			return types.ValOrErr(rhs, "no such overload")
+		}
+		if !isFinite(float64(l)) || !isFinite(float64(r)) {
+			return fallback(lhs, rhs)
+		}
+		x := new(big.Float).SetPrec(b.prec).SetFloat64(float64(l))
+		y := new(big.Float).SetPrec(b.prec).SetFloat64(float64(r))
+		z, _ := floatOp(new(big.Float).SetPrec(b.prec), x, y).Float64()
+		return types.Double(z)
+	}
+	return types.ValOrErr(lhs, "no such overload")
+}
+
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// decimalOperand evaluates an operand of an operator evaluated with the BigDecimalBackend,
+// returning the operand as a big.Float when it is a finite double, and as a value otherwise.
+func decimalOperand(i Interpretable, prec uint, ctx Activation) (*big.Float, ref.Val) {
+	var val ref.Val
+	if dec, isDec := i.(*evalDecimal); isDec {
+		var f *big.Float
+		f, val = dec.evalFloat(ctx)
+		if f != nil {
+			return f, nil
+		}
+	} else {
+		val = i.Eval(ctx)
+	}
+	if d, isDouble := val.(types.Double); isDouble && isFinite(float64(d)) {
+		return new(big.Float).SetPrec(prec).SetFloat64(float64(d)), nil
+	}
+	return nil, val
+}
+
+// roundFloat rounds the big.Float to the nearest double.
+func roundFloat(f *big.Float) ref.Val {
+	d, _ := f.Float64()
+	return types.Double(d)
+}
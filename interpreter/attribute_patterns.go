@@ -15,8 +15,6 @@
 package interpreter
 
 import (
-	"fmt"
-
 	"github.com/google/cel-go/common/containers"
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
@@ -338,7 +336,7 @@ func (m *attributeMatcher) Resolve(vars Activation) (interface{}, error) {
 		return nil, err
 	}
 	if !found {
-		return nil, fmt.Errorf("no such attribute: %v", m.NamespacedAttribute)
+		return nil, newCodedError(ErrUndeclaredIdent, "no such attribute: %v", m.NamespacedAttribute)
 	}
 	return obj, nil
 }
@@ -283,7 +283,7 @@ func (a *absoluteAttribute) Resolve(vars Activation) (interface{}, error) {
 	if found {
 		return obj, nil
 	}
-	return nil, fmt.Errorf("no such attribute: %v", a)
+	return nil, newCodedError(ErrUndeclaredIdent, "no such attribute: %v", a)
 }
 
 // String implements the Stringer interface method.
@@ -317,7 +317,7 @@ func (a *absoluteAttribute) TryResolve(vars Activation) (interface{}, bool, erro
 			if len(a.qualifiers) == 0 {
 				return typ, true, nil
 			}
-			return nil, true, fmt.Errorf("no such attribute: %v", typ)
+			return nil, true, newCodedError(ErrUndeclaredIdent, "no such attribute: %v", typ)
 		}
 	}
 	return nil, false, nil
@@ -525,7 +525,7 @@ func (a *maybeAttribute) Resolve(vars Activation) (interface{}, error) {
 		}
 	}
 	// Else, produce a no such attribute error.
-	return nil, fmt.Errorf("no such attribute: %v", a)
+	return nil, newCodedError(ErrUndeclaredIdent, "no such attribute: %v", a)
 }
 
 // String is an implementation of the Stringer interface method.
@@ -720,7 +720,7 @@ func (q *stringQualifier) Qualify(vars Activation, obj interface{}) (interface{}
 		return elem, nil
 	}
 	if isMap && !isKey {
-		return nil, fmt.Errorf("no such key: %v", s)
+		return nil, newCodedError(ErrNoSuchKey, "no such key: %v", s)
 	}
 	return obj, nil
 }
@@ -835,7 +835,7 @@ func (q *intQualifier) Qualify(vars Activation, obj interface{}) (interface{}, e
 		return elem, nil
 	}
 	if isMap && !isKey {
-		return nil, fmt.Errorf("no such key: %v", i)
+		return nil, newCodedError(ErrNoSuchKey, "no such key: %v", i)
 	}
 	if !isMap && !isIndex {
 		return nil, fmt.Errorf("index out of bounds: %v", i)
@@ -897,7 +897,7 @@ func (q *uintQualifier) Qualify(vars Activation, obj interface{}) (interface{},
 		return elem, nil
 	}
 	if isMap && !isKey {
-		return nil, fmt.Errorf("no such key: %v", u)
+		return nil, newCodedError(ErrNoSuchKey, "no such key: %v", u)
 	}
 	return obj, nil
 }
@@ -948,7 +948,7 @@ func (q *boolQualifier) Qualify(vars Activation, obj interface{}) (interface{},
 		return elem, nil
 	}
 	if !isKey {
-		return nil, fmt.Errorf("no such key: %v", b)
+		return nil, newCodedError(ErrNoSuchKey, "no such key: %v", b)
 	}
 	return obj, nil
 }
@@ -996,6 +996,20 @@ func (q *fieldQualifier) Cost() (min, max int64) {
 	return 0, 0
 }
 
+// isUndefinedField returns whether the object is a message whose type does not define the field.
+func isUndefinedField(adapter ref.TypeAdapter, obj ref.Val, field ref.Val) bool {
+	if _, isObj := obj.(traits.FieldTester); !isObj {
+		return false
+	}
+	provider, isProvider := adapter.(ref.TypeProvider)
+	name, isName := field.(types.String)
+	if !isProvider || !isName {
+		return false
+	}
+	_, found := provider.FindFieldType(obj.Type().TypeName(), string(name))
+	return !found
+}
+
 // refResolve attempts to convert the value to a CEL value and then uses reflection methods
 // to try and resolve the qualifier.
 func refResolve(adapter ref.TypeAdapter, idx ref.Val, obj interface{}) (ref.Val, error) {
@@ -1004,7 +1018,7 @@ func refResolve(adapter ref.TypeAdapter, idx ref.Val, obj interface{}) (ref.Val,
 	if isMapper {
 		elem, found := mapper.Find(idx)
 		if !found {
-			return nil, fmt.Errorf("no such key: %v", idx)
+			return nil, newCodedError(ErrNoSuchKey, "no such key: %v", idx)
 		}
 		if types.IsError(elem) {
 			return nil, elem.(*types.Err)
@@ -1015,6 +1029,9 @@ func refResolve(adapter ref.TypeAdapter, idx ref.Val, obj interface{}) (ref.Val,
 	if isIndexer {
 		elem := indexer.Get(idx)
 		if types.IsError(elem) {
+			if isUndefinedField(adapter, celVal, idx) {
+				return nil, newCodedError(ErrNoSuchField, "%v", elem)
+			}
 			return nil, elem.(*types.Err)
 		}
 		return elem, nil
@@ -0,0 +1,276 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ActivationHash identifies an expression together with the values of the variables it refers to.
+type ActivationHash [sha256.Size]byte
+
+// ResultCache stores the results of expressions evaluated with WithResultCache.
+//
+// Implementations must be safe for concurrent use.
+type ResultCache interface {
+	// Get returns the result stored for the key, if any.
+	Get(key ActivationHash) (ref.Val, bool)
+
+	// Set stores the result for the key.
+	Set(key ActivationHash, val ref.Val)
+}
+
+// LRUResultCache is a ResultCache which holds a bounded number of results, evicting the least
+// recently used result when full.
+type LRUResultCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[ActivationHash]*list.Element
+}
+
+type lruEntry struct {
+	key ActivationHash
+	val ref.Val
+}
+
+// NewLRUResultCache creates an empty LRUResultCache which holds up to `capacity` results. A
+// capacity less than one holds a single result.
+func NewLRUResultCache(capacity int) *LRUResultCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LRUResultCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[ActivationHash]*list.Element, capacity),
+	}
+}
+
+// Get implements the ResultCache interface method.
+func (c *LRUResultCache) Get(key ActivationHash) (ref.Val, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry).val, true
+}
+
+// Set implements the ResultCache interface method.
+func (c *LRUResultCache) Set(key ActivationHash, val ref.Val) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.entries[key]; found {
+		elem.Value.(*lruEntry).val = val
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, val: val})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Len returns the number of results held by the cache.
+func (c *LRUResultCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// resultCacheScopes numbers the scopes so that programs sharing a cache use distinct keys.
+var resultCacheScopes uint64
+
+// resultCacheScope records what a decorator has learned about the expression it planned.
+type resultCacheScope struct {
+	id       uint64
+	cache    ResultCache
+	volatile map[string]bool
+
+	mu sync.RWMutex
+	// names holds the sorted candidate names of the variables referenced by the expression.
+	names []string
+	// cacheable is false once an impure call or a volatile variable has been planned.
+	cacheable bool
+}
+
+func newResultCacheScope(cache ResultCache, volatile []string) *resultCacheScope {
+	s := &resultCacheScope{
+		id:        atomic.AddUint64(&resultCacheScopes, 1),
+		cache:     cache,
+		volatile:  make(map[string]bool, len(volatile)),
+		cacheable: true,
+	}
+	for _, name := range volatile {
+		s.volatile[name] = true
+	}
+	return s
+}
+
+// addNames records variable names referenced by the expression.
+func (s *resultCacheScope) addNames(names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range names {
+		if s.volatile[name] {
+			s.cacheable = false
+		}
+		i := sort.SearchStrings(s.names, name)
+		if i < len(s.names) && s.names[i] == name {
+			continue
+		}
+		s.names = append(s.names, "")
+		copy(s.names[i+1:], s.names[i:])
+		s.names[i] = name
+	}
+}
+
+func (s *resultCacheScope) markImpure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheable = false
+}
+
+// key computes the cache key for an evaluation of the node with the activation, returning false
+// when the expression is not cacheable or a variable value cannot be hashed.
+func (s *resultCacheScope) key(id int64, vars Activation) (ActivationHash, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var key ActivationHash
+	if !s.cacheable {
+		return key, false
+	}
+	h := sha256.New()
+	writeUint(h, s.id)
+	writeUint(h, uint64(id))
+	for _, name := range s.names {
+		writeString(h, name)
+		val, found := vars.ResolveName(name)
+		if !found {
+			writeUint(h, 0)
+			continue
+		}
+		writeUint(h, 1)
+		if !hashValue(h, val) {
+			return key, false
+		}
+	}
+	copy(key[:], h.Sum(nil))
+	return key, true
+}
+
+// attributeNames returns the candidate variable names of the attribute and of the attributes it
+// is composed of.
+func attributeNames(attr Attribute) []string {
+	switch a := attr.(type) {
+	case NamespacedAttribute:
+		return a.CandidateVariableNames()
+	case *maybeAttribute:
+		var names []string
+		for _, ns := range a.attrs {
+			names = append(names, ns.CandidateVariableNames()...)
+		}
+		return names
+	case *conditionalAttribute:
+		return append(attributeNames(a.truthy), attributeNames(a.falsy)...)
+	}
+	return nil
+}
+
+// hashValue writes a representation of the value to the hash which is equal for equal values,
+// returning false for values which cannot be represented, such as errors and unknowns.
+func hashValue(h hash.Hash, v interface{}) bool {
+	val, isVal := v.(ref.Val)
+	if !isVal {
+		val = types.DefaultTypeAdapter.NativeToValue(v)
+	}
+	if types.IsUnknownOrError(val) {
+		return false
+	}
+	writeString(h, val.Type().TypeName())
+	switch val.Type() {
+	case types.NullType, types.BoolType, types.IntType, types.UintType, types.DoubleType,
+		types.StringType, types.BytesType, types.DurationType, types.TimestampType:
+		writeString(h, fmt.Sprintf("%v", val.Value()))
+		return true
+	case types.TypeType:
+		writeString(h, val.(ref.Type).TypeName())
+		return true
+	}
+	switch coll := val.(type) {
+	case traits.Lister:
+		writeUint(h, uint64(coll.Size().(types.Int)))
+		for it := coll.Iterator(); it.HasNext() == types.True; {
+			if !hashValue(h, it.Next()) {
+				return false
+			}
+		}
+		return true
+	case traits.Mapper:
+		// Entries are combined independently of their order.
+		var combined [sha256.Size]byte
+		for it := coll.Iterator(); it.HasNext() == types.True; {
+			k := it.Next()
+			entry := sha256.New()
+			if !hashValue(entry, k) || !hashValue(entry, coll.Get(k)) {
+				return false
+			}
+			for i, b := range entry.Sum(nil) {
+				combined[i] ^= b
+			}
+		}
+		writeUint(h, uint64(coll.Size().(types.Int)))
+		h.Write(combined[:])
+		return true
+	}
+	if msg, isMsg := val.Value().(proto.Message); isMsg {
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return false
+		}
+		writeString(h, string(data))
+		return true
+	}
+	return false
+}
+
+func writeUint(h hash.Hash, v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	h.Write(buf[:])
+}
+
+func writeString(h hash.Hash, s string) {
+	writeUint(h, uint64(len(s)))
+	h.Write([]byte(s))
+}
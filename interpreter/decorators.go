@@ -15,16 +15,41 @@
 package interpreter
 
 import (
+	"context"
+	"math/big"
+	"runtime"
+	"time"
+
+	"github.com/google/cel-go/common/operators"
 	"github.com/google/cel-go/common/overloads"
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/interpreter/functions"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // InterpretableDecorator is a functional interface for decorating or replacing
 // Interpretable expression nodes at construction time.
+//
+// Each decorator is also invoked once before the expression is planned, with an Interpretable
+// standing for the root of the whole expression, through which the decorators of this package
+// intercept the evaluation of the expression. The value returned for it is ignored, so decorators
+// should return Interpretables of types they do not recognize unchanged.
 type InterpretableDecorator func(Interpretable) (Interpretable, error)
 
+// decRoot registers the interceptor built for the root of the expression, leaving the nodes of
+// the expression unchanged.
+func decRoot(build func(root *evalRoot) rootInterceptor) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		if root, isRoot := i.(*evalRoot); isRoot {
+			root.intercept(build(root))
+		}
+		return i, nil
+	}
+}
+
 // evalObserver is a functional interface that accepts an expression id and an observed value.
 type evalObserver func(int64, ref.Val)
 
@@ -80,6 +105,7 @@ func decDisableShortcircuits() InterpretableDecorator {
 				cond:      expr.cond,
 				step:      expr.step,
 				result:    expr.result,
+				observer:  expr.observer,
 			}, nil
 		case InterpretableAttribute:
 			cond, isCond := expr.Attr().(*conditionalAttribute)
@@ -95,6 +121,656 @@ func decDisableShortcircuits() InterpretableDecorator {
 	}
 }
 
+// decAggregateErrors replaces logical operators with versions which evaluate both operands and
+// combine their errors.
+func decAggregateErrors() InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		switch expr := i.(type) {
+		case *evalOr:
+			return &evalAggregateOr{
+				id:  expr.id,
+				lhs: expr.lhs,
+				rhs: expr.rhs,
+			}, nil
+		case *evalAnd:
+			return &evalAggregateAnd{
+				id:  expr.id,
+				lhs: expr.lhs,
+				rhs: expr.rhs,
+			}, nil
+		}
+		return i, nil
+	}
+}
+
+// decInlineSmallMaps builds constant maps with String keys and no more than maxSize entries as
+// sorted key-value slices.
+func decInlineSmallMaps(maxSize int) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		mp, ok := i.(*evalMap)
+		if !ok || len(mp.keys) > maxSize {
+			return i, nil
+		}
+		entries := make([]types.MapEntry, len(mp.keys))
+		for idx, key := range mp.keys {
+			k, isConst := key.(InterpretableConst)
+			if !isConst {
+				return i, nil
+			}
+			strKey, isStr := k.Value().(types.String)
+			if !isStr {
+				return i, nil
+			}
+			v, isConst := mp.vals[idx].(InterpretableConst)
+			if !isConst {
+				return i, nil
+			}
+			entries[idx] = types.MapEntry{Key: strKey, Value: v.Value()}
+		}
+		return NewConstValue(mp.ID(), types.NewSortedStringMap(mp.adapter, entries)), nil
+	}
+}
+
+// functionFallback is the fallback for calls to functions which have no implementation.
+type functionFallback struct {
+	fallback   func(string, []ref.Val) ref.Val
+	onFallback func(string, []string)
+}
+
+// decFunctionFallback binds function calls which have no implementation to the fallback.
+func decFunctionFallback(f *functionFallback) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		switch call := i.(type) {
+		case *evalUnary:
+			if call.impl == nil {
+				call.impl = func(arg ref.Val) ref.Val {
+					return f.invoke(call.function, call.overload, arg)
+				}
+			}
+		case *evalBinary:
+			if call.impl == nil {
+				call.impl = func(lhs, rhs ref.Val) ref.Val {
+					return f.invoke(call.function, call.overload, lhs, rhs)
+				}
+			}
+		case *evalVarArgs:
+			if call.impl == nil {
+				call.impl = func(args ...ref.Val) ref.Val {
+					return f.invoke(call.function, call.overload, args...)
+				}
+			}
+		}
+		return i, nil
+	}
+}
+
+// invoke preserves receiver-style dispatch for unbound functions, and invokes the fallback when
+// the receiver does not support the function.
+func (f *functionFallback) invoke(function, overload string, args ...ref.Val) ref.Val {
+	if args[0].Type().HasTrait(traits.ReceiverType) {
+		res := args[0].(traits.Receiver).Receive(function, overload, args[1:])
+		if !types.IsError(res) || res.(*types.Err).String() != "no such overload" {
+			return res
+		}
+	}
+	if f.onFallback != nil {
+		argTypes := make([]string, len(args))
+		for i, arg := range args {
+			argTypes[i] = arg.Type().TypeName()
+		}
+		f.onFallback(function, argTypes)
+	}
+	return f.fallback(function, args)
+}
+
+// decAccessLogging records the resolutions of variable attributes.
+func decAccessLogging() InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		attr, isAttr := i.(InterpretableAttribute)
+		if !isAttr {
+			return i, nil
+		}
+		if _, logged := i.(*evalAccessLogged); logged {
+			return i, nil
+		}
+		switch a := attr.Attr().(type) {
+		case *conditionalAttribute:
+			logConditionalBranches(a)
+		case NamespacedAttribute, *maybeAttribute:
+			return &evalAccessLogged{InterpretableAttribute: attr}, nil
+		}
+		return i, nil
+	}
+}
+
+// decReplayProtection records the variables referenced by the expression and checks for replays
+// around the evaluation of the whole expression.
+func decReplayProtection(guard *replayGuard) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		switch inst := i.(type) {
+		case *evalRoot:
+			guard.setExpr(inst.expr)
+			inst.intercept(guard.evalProtected)
+		case InterpretableAttribute:
+			guard.addNames(attributeNames(inst.Attr()))
+		}
+		return i, nil
+	}
+}
+
+// decSampling samples the evaluations of the expression.
+func decSampling(s *sampler) InterpretableDecorator {
+	return decRoot(func(*evalRoot) rootInterceptor {
+		return s.evalSampled
+	})
+}
+
+// decMemoryAdaptation attaches the memory monitor to comprehensions.
+func decMemoryAdaptation(monitor *memoryMonitor) InterpretableDecorator {
+	return decObserveFolds(monitor)
+}
+
+// decSharding partitions the evaluation of map and filter comprehensions over large lists.
+func decSharding(sharding *foldSharding) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		if fold, isFold := i.(*evalFold); isFold && isShardableFold(fold) {
+			return &evalShardedFold{evalFold: fold, sharding: sharding}, nil
+		}
+		return i, nil
+	}
+}
+
+// decObserveFolds attaches the observer to comprehensions.
+func decObserveFolds(observer foldObserver) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		if fold, isFold := i.(observableFold); isFold {
+			fold.observe(observer)
+		}
+		return i, nil
+	}
+}
+
+// decContextFunctions binds calls to the functions to implementations which receive the context
+// of the evaluation.
+func decContextFunctions(fns map[string]functions.ContextFunctionOp) InterpretableDecorator {
+	find := func(function, overload string) functions.ContextFunctionOp {
+		if fn, found := fns[overload]; found && overload != "" {
+			return fn
+		}
+		return fns[function]
+	}
+	return func(i Interpretable) (Interpretable, error) {
+		switch call := i.(type) {
+		case *evalZeroArity:
+			call.ctxImpl = find(call.function, call.overload)
+		case *evalUnary:
+			if fn := find(call.function, call.overload); fn != nil {
+				call.ctxImpl = fn
+				call.trait = 0
+			}
+		case *evalBinary:
+			if fn := find(call.function, call.overload); fn != nil {
+				call.ctxImpl = fn
+				call.trait = 0
+			}
+		case *evalVarArgs:
+			if fn := find(call.function, call.overload); fn != nil {
+				call.ctxImpl = fn
+				call.trait = 0
+			}
+		}
+		return i, nil
+	}
+}
+
+// decFunctionPlugin dispatches calls to the function to the plugin when it supports the argument
+// types.
+func decFunctionPlugin(function string, plugin FunctionPlugin) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		switch call := i.(type) {
+		case *evalZeroArity:
+			if call.function == function {
+				call.impl = pluginImpl(plugin, call.function, call.overload, 0, call.impl)
+			}
+		case *evalUnary:
+			if call.function == function {
+				var impl functions.FunctionOp
+				if unary := call.impl; unary != nil {
+					impl = func(args ...ref.Val) ref.Val { return unary(args[0]) }
+				}
+				op := pluginImpl(plugin, call.function, call.overload, call.trait, impl)
+				call.impl = func(arg ref.Val) ref.Val { return op(arg) }
+				call.trait = 0
+			}
+		case *evalBinary:
+			if call.function == function {
+				var impl functions.FunctionOp
+				if binary := call.impl; binary != nil {
+					impl = func(args ...ref.Val) ref.Val { return binary(args[0], args[1]) }
+				}
+				op := pluginImpl(plugin, call.function, call.overload, call.trait, impl)
+				call.impl = func(lhs, rhs ref.Val) ref.Val { return op(lhs, rhs) }
+				call.trait = 0
+			}
+		case *evalVarArgs:
+			if call.function == function {
+				call.impl = pluginImpl(plugin, call.function, call.overload, call.trait, call.impl)
+				call.trait = 0
+			}
+		}
+		return i, nil
+	}
+}
+
+// decMaxCallDepth tracks the depth of the function implementations executing within the context
+// of the evaluation, and produces an error instead of calling an implementation which would
+// exceed the maximum.
+func decMaxCallDepth(maxDepth int) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		switch call := i.(type) {
+		case *evalZeroArity:
+			call.interceptors = append(call.interceptors, callDepthLimit(call.id, maxDepth))
+		case *evalUnary:
+			call.interceptors = append(call.interceptors, callDepthLimit(call.id, maxDepth))
+		case *evalBinary:
+			call.interceptors = append(call.interceptors, callDepthLimit(call.id, maxDepth))
+		case *evalVarArgs:
+			call.interceptors = append(call.interceptors, callDepthLimit(call.id, maxDepth))
+		}
+		return i, nil
+	}
+}
+
+// decRetry retries the implementations of transient function overloads.
+func decRetry(r *retrier) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		switch call := i.(type) {
+		case *evalZeroArity:
+			if call.transient {
+				call.interceptors = append(call.interceptors, r.call)
+			}
+		case *evalUnary:
+			if call.transient {
+				call.interceptors = append(call.interceptors, r.call)
+			}
+		case *evalBinary:
+			if call.transient {
+				call.interceptors = append(call.interceptors, r.call)
+			}
+		case *evalVarArgs:
+			if call.transient {
+				call.interceptors = append(call.interceptors, r.call)
+			}
+		}
+		return i, nil
+	}
+}
+
+// callDepthKey is the context key of the depth of the function implementations executing within
+// an evaluation.
+type callDepthKey struct{}
+
+// callDepthLimit invokes function implementations with a context which records their depth,
+// unless doing so would exceed the maximum depth, in which case an error value for the expression
+// node id is returned.
+func callDepthLimit(id int64, maxDepth int) callInterceptor {
+	return func(ctx context.Context, invoke func(context.Context) ref.Val) ref.Val {
+		depth, _ := ctx.Value(callDepthKey{}).(int)
+		if depth >= maxDepth {
+			return types.WrapErr(EvalError{
+				ID:   id,
+				Code: ErrCallDepthExceeded,
+				Err:  types.NewErr("call depth exceeded: %d", maxDepth).(*types.Err),
+			})
+		}
+		return invoke(context.WithValue(ctx, callDepthKey{}, depth+1))
+	}
+}
+
+// decTimeoutBudget interrupts comprehensions once the context of the evaluation is done, checking
+// the context every iterationsPerCheck iterations.
+func decTimeoutBudget(iterationsPerCheck int) InterpretableDecorator {
+	return decBudget(&timeoutBudget{perCheck: uint64(iterationsPerCheck)})
+}
+
+// decElasticDeadline interrupts comprehensions once the context of the evaluation is done, except
+// that an evaluation whose deadline has passed is given a grace period of elasticPct percent of
+// the time between the start of the evaluation and its deadline.
+func decElasticDeadline(elasticPct float64, iterationsPerCheck int) InterpretableDecorator {
+	return decBudget(&timeoutBudget{elasticPct: elasticPct, perCheck: uint64(iterationsPerCheck)})
+}
+
+// decPrefetch resolves the identifiers before the expression is evaluated.
+func decPrefetch(idents []string) InterpretableDecorator {
+	return decRoot(func(root *evalRoot) rootInterceptor {
+		return func(vars Activation, eval func(Activation) ref.Val) ref.Val {
+			if root.isConst() {
+				return eval(vars)
+			}
+			if err := prefetch(vars, idents); err != nil {
+				return err
+			}
+			return eval(vars)
+		}
+	})
+}
+
+// decIsolation evaluates the expression on a goroutine of its own.
+func decIsolation(timeout time.Duration) InterpretableDecorator {
+	return decRoot(func(root *evalRoot) rootInterceptor {
+		return func(vars Activation, eval func(Activation) ref.Val) ref.Val {
+			if root.isConst() {
+				return eval(vars)
+			}
+			return evalOnIsolatedGoroutine(root.ID(), timeout, vars, eval)
+		}
+	})
+}
+
+// evalOnIsolatedGoroutine evaluates the expression on a new goroutine, with a context
+// which is cancelled when the evaluation completes or is abandoned.
+func evalOnIsolatedGoroutine(id int64, timeout time.Duration, vars Activation,
+	eval func(Activation) ref.Val) ref.Val {
+	ctx, cancel := context.WithCancel(evaluationContext(vars))
+	defer cancel()
+	isolated := withEvaluationContext(vars, ctx)
+	// The channel is buffered so that an abandoned goroutine does not block on sending.
+	result := make(chan ref.Val, 1)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer func() {
+			if r := recover(); r != nil {
+				result <- recoverEvalPanic(id, r)
+			}
+		}()
+		result <- eval(isolated)
+	}()
+	if timeout <= 0 {
+		return <-result
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case val := <-result:
+		return val
+	case <-timer.C:
+		return types.WrapErr(EvalError{
+			ID:   id,
+			Code: ErrIsolationTimeout,
+			Err:  types.NewErr("evaluation timed out after %v", timeout).(*types.Err),
+		})
+	}
+}
+
+// decResultCache records the variables and purity of the expression within the scope, and
+// intercepts the evaluation of the expression so that each evaluation consults the cache.
+func decResultCache(scope *resultCacheScope) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		switch inst := i.(type) {
+		case *evalRoot:
+			inst.intercept(func(vars Activation, eval func(Activation) ref.Val) ref.Val {
+				if inst.isConst() {
+					return eval(vars)
+				}
+				return evalWithResultCache(inst.ID(), scope, vars, eval)
+			})
+		case *evalZeroArity:
+			if inst.impl != nil && !inst.pure {
+				scope.markImpure()
+			}
+		case *evalUnary:
+			if inst.impl != nil && !inst.pure {
+				scope.markImpure()
+			}
+		case *evalBinary:
+			if inst.impl != nil && !inst.pure {
+				scope.markImpure()
+			}
+		case *evalVarArgs:
+			if inst.impl != nil && !inst.pure {
+				scope.markImpure()
+			}
+		case InterpretableAttribute:
+			scope.addNames(attributeNames(inst.Attr()))
+		}
+		return i, nil
+	}
+}
+
+// evalWithResultCache returns the cached result of the evaluation of the expression when there is
+// one, and otherwise evaluates the expression and caches its result.
+func evalWithResultCache(id int64, scope *resultCacheScope, vars Activation,
+	eval func(Activation) ref.Val) ref.Val {
+	if _, isPartial := vars.(PartialActivation); isPartial {
+		return eval(vars)
+	}
+	key, cacheable := scope.key(id, vars)
+	if cacheable {
+		if val, found := scope.cache.Get(key); found {
+			return val
+		}
+	}
+	val := eval(vars)
+	if cacheable && !types.IsUnknownOrError(val) {
+		scope.cache.Set(key, val)
+	}
+	return val
+}
+
+// decSubExprDeduplication wraps the occurrences of the sub-expressions shared within the expression
+// being planned, and intercepts the evaluation of the expression to start a new set of shared
+// results.
+func decSubExprDeduplication() InterpretableDecorator {
+	var classes map[int64]string
+	return func(i Interpretable) (Interpretable, error) {
+		if root, isRoot := i.(*evalRoot); isRoot {
+			classes = subExprClasses(root.expr)
+			root.intercept(evalDedupScope)
+			return i, nil
+		}
+		class, shared := classes[i.ID()]
+		if !shared {
+			return i, nil
+		}
+		switch inst := i.(type) {
+		case InterpretableConst, *evalDedup, *evalDedupAttr, *evalDedupCall:
+			return i, nil
+		case InterpretableAttribute:
+			return &evalDedupAttr{InterpretableAttribute: inst, class: class}, nil
+		case InterpretableCall:
+			return &evalDedupCall{InterpretableCall: inst, class: class}, nil
+		}
+		return &evalDedup{Interpretable: i, class: class}, nil
+	}
+}
+
+// decBudget attaches the budget to comprehensions.
+func decBudget(budget *timeoutBudget) InterpretableDecorator {
+	return decObserveFolds(budget)
+}
+
+// timeoutBudget amortizes the cost of checking whether the context of an evaluation is done
+// across a number of comprehension iterations.
+//
+// The iterations are counted by each evaluation of a comprehension, so concurrent evaluations of
+// the program do not share a count. A short comprehension nested within a long one is covered by
+// the checks of the enclosing comprehension.
+type timeoutBudget struct {
+	perCheck uint64
+	// elasticPct, when positive, is the percentage of the time between the start of an
+	// evaluation and its deadline for which the evaluation may continue past the deadline.
+	elasticPct float64
+}
+
+// begin implements the foldObserver interface method, returning the check of the budget for an
+// evaluation of a comprehension with the activation.
+func (b *timeoutBudget) begin(vars Activation, id int64) foldObservation {
+	eval, found := findEvaluation(vars)
+	if !found {
+		return &budgetCheck{}
+	}
+	c := &budgetCheck{budget: b, ctx: eval.ctx, done: eval.ctx.Done()}
+	if deadline, hasDeadline := eval.ctx.Deadline(); hasDeadline && b.elasticPct > 0 {
+		// The grace period depends only on the evaluation, so every comprehension within it
+		// shares the one grace period.
+		extension := time.Duration(float64(deadline.Sub(eval.start)) * b.elasticPct / 100)
+		if extension > 0 {
+			c.graceUntil = deadline.Add(extension)
+		}
+	}
+	return c
+}
+
+// budgetCheck counts the iterations of an evaluation of a comprehension against a budget.
+type budgetCheck struct {
+	budget *timeoutBudget
+	ctx    context.Context
+	// done is nil when there is no budget, or its context can never be done.
+	done  <-chan struct{}
+	iters uint64
+	// graceUntil, when non-zero, is the time until which evaluation may continue after the
+	// context's deadline has been exceeded.
+	graceUntil time.Time
+}
+
+// partitioned implements the foldObserver interface method. Each partition of a sharded
+// evaluation checks the budget separately.
+func (b *timeoutBudget) partitioned() foldObserver {
+	return b
+}
+
+// next implements the foldObservation interface method, counting an iteration and returning an
+// error value when the iteration is a multiple of the check interval and the context is done, and
+// nil otherwise.
+func (c *budgetCheck) next() ref.Val {
+	if c.done == nil {
+		return nil
+	}
+	c.iters++
+	if c.iters%c.budget.perCheck != 0 {
+		return nil
+	}
+	select {
+	case <-c.done:
+		if !c.graceUntil.IsZero() && c.ctx.Err() == context.DeadlineExceeded &&
+			time.Now().Before(c.graceUntil) {
+			return nil
+		}
+		return types.NewErr("operation interrupted: %v", c.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// end implements the foldObservation interface method.
+func (c *budgetCheck) end(iterations int64, shortCircuit bool) {}
+
+// decOTelTracing attaches a span tracer to comprehensions and times function calls.
+func decOTelTracing(tracer trace.Tracer, threshold time.Duration) InterpretableDecorator {
+	ft := &foldTracer{tracer: tracer}
+	return func(i Interpretable) (Interpretable, error) {
+		switch inst := i.(type) {
+		case observableFold:
+			inst.observe(ft)
+		case InterpretableCall:
+			return &evalTimedCall{InterpretableCall: inst, threshold: threshold}, nil
+		}
+		return i, nil
+	}
+}
+
+// decStats instruments comprehensions, logical operators, and function calls to update the stats.
+func decStats(stats *Stats) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		switch inst := i.(type) {
+		case observableFold:
+			inst.observe(foldStats{stats: stats})
+		case *evalAnd:
+			inst.stats = stats
+		case *evalOr:
+			inst.stats = stats
+		case InterpretableCall:
+			return &evalCountedCall{
+				InterpretableCall: inst,
+				count:             stats.functionCounter(inst.Function()),
+			}, nil
+		}
+		return i, nil
+	}
+}
+
+// decMetrics instruments comprehensions and function calls to report to the hook.
+func decMetrics(hook MetricsHook) InterpretableDecorator {
+	return func(i Interpretable) (Interpretable, error) {
+		switch inst := i.(type) {
+		case observableFold:
+			inst.observe(foldMetrics{hook: hook})
+		case InterpretableCall:
+			if counter, isCounter := hook.(CallCounter); isCounter {
+				return &evalHookCountedCall{
+					InterpretableCall: inst,
+					count:             counter.CallCounter(inst.Function()),
+				}, nil
+			}
+			return &evalMeteredCall{InterpretableCall: inst, hook: hook}, nil
+		}
+		return i, nil
+	}
+}
+
+// decArithmeticBackend dispatches the arithmetic operators to the backend when both operands are
+// ints or both are doubles.
+func decArithmeticBackend(backend ArithmeticBackend) InterpretableDecorator {
+	ops := map[string]func(lhs, rhs ref.Val) ref.Val{
+		operators.Add:      backend.Add,
+		operators.Subtract: backend.Sub,
+		operators.Multiply: backend.Mul,
+		operators.Divide:   backend.Div,
+	}
+	return func(i Interpretable) (Interpretable, error) {
+		call, ok := i.(*evalBinary)
+		if !ok || call.impl == nil {
+			return i, nil
+		}
+		op, found := ops[call.function]
+		if !found {
+			return i, nil
+		}
+		impl := call.impl
+		call.impl = func(lhs, rhs ref.Val) ref.Val {
+			switch lhs.(type) {
+			case types.Int:
+				if _, ok := rhs.(types.Int); ok {
+					return op(lhs, rhs)
+				}
+			case types.Double:
+				if _, ok := rhs.(types.Double); ok {
+					return op(lhs, rhs)
+				}
+			}
+			return impl(lhs, rhs)
+		}
+		if dec, isDec := backend.(*bigDecimalBackend); isDec {
+			return &evalDecimal{evalBinary: call, prec: dec.prec, floatOp: decimalOps[call.function]}, nil
+		}
+		return i, nil
+	}
+}
+
+// decimalOps maps the arithmetic operators to their big.Float implementations.
+var decimalOps = map[string]func(z, x, y *big.Float) *big.Float{
+	operators.Add:      (*big.Float).Add,
+	operators.Subtract: (*big.Float).Sub,
+	operators.Multiply: (*big.Float).Mul,
+	operators.Divide:   (*big.Float).Quo,
+}
+
+// decPanicRecovery converts panics during the evaluation of the expression into errors.
+func decPanicRecovery(r *panicRecovery) InterpretableDecorator {
+	return decRoot(r.intercept)
+}
+
 // decOptimize optimizes the program plan by looking for common evaluation patterns and
 // conditionally precomputating the result.
 // - build list and map values with constant elements.
@@ -0,0 +1,134 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"sync"
+
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/walk"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// subExprClasses returns the ids of the sub-expressions which occur more than once within the
+// expression, mapped to a key shared by the structurally identical occurrences.
+//
+// Constants and identifiers are cheap to evaluate and are excluded, as are sub-expressions which
+// refer to variables bound by an enclosing comprehension, since their values differ between
+// iterations and between comprehensions.
+func subExprClasses(expr *exprpb.Expr) map[int64]string {
+	occurrences := map[string][]int64{}
+	walk.Scoped(expr, func(e *exprpb.Expr, scope walk.Scope) bool {
+		switch e.GetExprKind().(type) {
+		case *exprpb.Expr_ConstExpr, *exprpb.Expr_IdentExpr:
+		default:
+			if !refersToBound(e, scope) {
+				key := structuralKey(e)
+				occurrences[key] = append(occurrences[key], e.GetId())
+			}
+		}
+		return true
+	})
+	classes := map[int64]string{}
+	for key, ids := range occurrences {
+		if len(ids) < 2 {
+			continue
+		}
+		for _, id := range ids {
+			classes[id] = key
+		}
+	}
+	return classes
+}
+
+// refersToBound reports whether the expression refers to any of the bound variables, excluding
+// variables bound by comprehensions within the expression itself.
+func refersToBound(e *exprpb.Expr, bound walk.Scope) bool {
+	found := false
+	walk.Scoped(e, func(n *exprpb.Expr, inner walk.Scope) bool {
+		if ident := n.GetIdentExpr(); ident != nil {
+			found = found || !inner.Bound(ident.GetName()) && bound.Bound(ident.GetName())
+		}
+		return !found
+	})
+	return found
+}
+
+// structuralKey returns an encoding of the expression which is equal for expressions of the same
+// structure, regardless of their node ids.
+func structuralKey(e *exprpb.Expr) string {
+	clone := proto.Clone(e).(*exprpb.Expr)
+	clearIDs(clone)
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(clone)
+	if err != nil {
+		// Expressions which cannot be encoded are never shared.
+		return ""
+	}
+	return string(data)
+}
+
+func clearIDs(e *exprpb.Expr) {
+	walk.PreOrder(e, func(n *exprpb.Expr) bool {
+		n.Id = 0
+		for _, entry := range n.GetStructExpr().GetEntries() {
+			entry.Id = 0
+		}
+		return true
+	})
+}
+
+// dedupActivation carries the results of shared sub-expressions for a single evaluation.
+type dedupActivation struct {
+	Activation
+	results *sync.Map
+}
+
+// Parent implements the Activation interface method, returning the marked activation.
+func (a *dedupActivation) Parent() Activation {
+	return a.Activation
+}
+
+// dedupResults returns the shared results of the evaluation which the activation belongs to.
+func dedupResults(vars Activation) (*sync.Map, bool) {
+	for a := vars; a != nil; a = a.Parent() {
+		if d, found := a.(*dedupActivation); found {
+			return d.results, true
+		}
+	}
+	return nil, false
+}
+
+// evalDedupScope evaluates the expression with a new set of shared results.
+func evalDedupScope(vars Activation, eval func(Activation) ref.Val) ref.Val {
+	return eval(&dedupActivation{Activation: vars, results: &sync.Map{}})
+}
+
+// evalDedupNode evaluates an occurrence of a shared sub-expression, which is evaluated only once
+// within each evaluation of the expression.
+func evalDedupNode(class string, vars Activation, eval func(Activation) ref.Val) ref.Val {
+	results, found := dedupResults(vars)
+	if !found {
+		return eval(vars)
+	}
+	if val, found := results.Load(class); found {
+		return val.(ref.Val)
+	}
+	val := eval(vars)
+	results.Store(class, val)
+	return val
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// ErrorCode classifies the cause of an EvalError.
+type ErrorCode int
+
+const (
+	// ErrUnspecified is the code of errors produced by the normal evaluation of an expression.
+	ErrUnspecified ErrorCode = iota
+
+	// ErrInternalPanic is the code of errors recovered from a panic during evaluation.
+	ErrInternalPanic
+
+	// ErrCallDepthExceeded is the code of errors produced when function implementations which
+	// evaluate expressions nest more deeply than the limit set by WithMaxCallDepth.
+	ErrCallDepthExceeded
+
+	// ErrNoSuchKey is the code of errors produced by accessing a key absent from a map.
+	ErrNoSuchKey
+
+	// ErrNoSuchField is the code of errors produced by accessing a field undefined on a message.
+	ErrNoSuchField
+
+	// ErrUndeclaredIdent is the code of errors produced by resolving an identifier which is absent
+	// from the activation.
+	ErrUndeclaredIdent
+
+	// ErrIsolationTimeout is the code of errors produced when an evaluation isolated by
+	// WithIsolation does not complete within its timeout.
+	ErrIsolationTimeout
+)
+
+// ErrorCodeOf returns the code of an error produced during evaluation.
+//
+// The code is attached to the error where it is created. Errors without a code, such as those
+// produced by function implementations, are reported as ErrUnspecified.
+func ErrorCodeOf(err error) ErrorCode {
+	switch e := err.(type) {
+	case *types.Err:
+		if inner, isErr := e.Value().(error); isErr {
+			return ErrorCodeOf(inner)
+		}
+	case EvalError:
+		return e.Code
+	case *codedError:
+		return e.code
+	}
+	return ErrUnspecified
+}
+
+// codedError is an error whose code is known at the point where it is created.
+type codedError struct {
+	code ErrorCode
+	msg  string
+}
+
+// newCodedError creates an error with the given code described by the format string and args.
+func newCodedError(code ErrorCode, format string, args ...interface{}) error {
+	return &codedError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// Error implements the Go error interface.
+func (e *codedError) Error() string {
+	return e.msg
+}
+
+// errorVal converts an error produced while resolving an attribute into an error value,
+// preserving the code attached to the error, if any.
+func errorVal(err error) ref.Val {
+	switch e := err.(type) {
+	case *types.Err:
+		return e
+	case *codedError:
+		return types.WrapErr(e)
+	}
+	return types.NewErr(err.Error())
+}
+
+// EvalError records an error value produced by an expression node during evaluation.
+type EvalError struct {
+	// ID of the expression node whose evaluation produced the error.
+	ID int64
+
+	// Code classifies the cause of the error.
+	Code ErrorCode
+
+	// Err is the error value produced by the expression node.
+	Err *types.Err
+}
+
+// Error implements the Go error interface.
+func (e EvalError) Error() string {
+	return e.Err.String()
+}
+
+// AggregatedError collects the errors produced by independent sub-expressions when the
+// WithErrorAggregation decorator is in use.
+//
+// The AggregatedError is returned to the caller wrapped within a types.Err value, and may be
+// accessed via the types.Err Value() method.
+type AggregatedError struct {
+	errs []EvalError
+}
+
+// Errors returns a copy of the list of errors observed during evaluation in the order they were
+// produced.
+func (a *AggregatedError) Errors() []EvalError {
+	errs := make([]EvalError, len(a.errs))
+	copy(errs, a.errs)
+	return errs
+}
+
+// Error implements the Go error interface.
+func (a *AggregatedError) Error() string {
+	msgs := make([]string, len(a.errs))
+	for i, err := range a.errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(a.errs), strings.Join(msgs, "; "))
+}
+
+// aggregateErrors combines the error values of two independent sub-expressions into a single
+// error value.
+//
+// Non-boolean, non-error values are treated as overload errors. When only one side has errored,
+// its value is returned unchanged; otherwise, the result wraps an AggregatedError whose entries
+// are flattened from any nested aggregations.
+func aggregateErrors(lhs Interpretable, lVal ref.Val, rhs Interpretable, rVal ref.Val) ref.Val {
+	var errs []EvalError
+	for _, v := range []struct {
+		id  int64
+		val ref.Val
+	}{{lhs.ID(), lVal}, {rhs.ID(), rVal}} {
+		if _, isBool := v.val.(types.Bool); isBool {
+			continue
+		}
+		errs = appendEvalErrors(errs, v.id, types.ValOrErr(v.val, "no such overload"))
+	}
+	if len(errs) == 1 {
+		return errs[0].Err
+	}
+	return types.WrapErr(&AggregatedError{errs: errs})
+}
+
+// appendEvalErrors appends the errors contained within the input value to the list of errors.
+func appendEvalErrors(errs []EvalError, id int64, val ref.Val) []EvalError {
+	err, isErr := val.(*types.Err)
+	if !isErr {
+		return errs
+	}
+	if agg, isAgg := err.Value().(*AggregatedError); isAgg {
+		return append(errs, agg.errs...)
+	}
+	return append(errs, EvalError{ID: id, Code: ErrorCodeOf(err), Err: err})
+}
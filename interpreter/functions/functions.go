@@ -16,7 +16,11 @@
 // interpreter and as declared within the checker#StandardDeclarations.
 package functions
 
-import "github.com/google/cel-go/common/types/ref"
+import (
+	"context"
+
+	"github.com/google/cel-go/common/types/ref"
+)
 
 // Overload defines a named overload of a function, indicating an operand trait
 // which must be present on the first argument to the overload as well as one
@@ -45,6 +49,16 @@ type Overload struct {
 	// Function defines the overload with a FunctionOp implementation. May be
 	// nil.
 	Function FunctionOp
+
+	// Transient indicates that errors produced by the implementation may not
+	// recur when the call is repeated, such as the failure of a call to an
+	// external service. Such errors are retried by interpreter.WithRetry.
+	Transient bool
+
+	// Pure indicates that the implementation has no side effects and that its
+	// result depends only on its arguments, so that results of expressions
+	// which call it may be cached by interpreter.WithResultCache.
+	Pure bool
 }
 
 // UnaryOp is a function that takes a single value and produces an output.
@@ -56,3 +70,7 @@ type BinaryOp func(lhs ref.Val, rhs ref.Val) ref.Val
 // FunctionOp is a function with accepts zero or more arguments and produces
 // an value (as interface{}) or error as a result.
 type FunctionOp func(values ...ref.Val) ref.Val
+
+// ContextFunctionOp is a FunctionOp which also receives the context of the
+// evaluation, such as for deadlines, cancellation, and request-scoped values.
+type ContextFunctionOp func(ctx context.Context, values ...ref.Val) ref.Val
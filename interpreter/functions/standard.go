@@ -24,7 +24,7 @@ import (
 
 // StandardOverloads returns the definitions of the built-in overloads.
 func StandardOverloads() []*Overload {
-	return []*Overload{
+	standard := []*Overload{
 		// Logical not (!a)
 		{
 			Operator:     operators.LogicalNot,
@@ -254,7 +254,11 @@ func StandardOverloads() []*Overload {
 				return value.(traits.Iterator).Next()
 			}},
 	}
-
+	// The built-in overloads depend only on their arguments.
+	for _, o := range standard {
+		o.Pure = true
+	}
+	return standard
 }
 
 func notStrictlyFalse(value ref.Val) ref.Val {
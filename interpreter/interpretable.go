@@ -15,7 +15,9 @@
 package interpreter
 
 import (
+	"context"
 	"math"
+	"math/big"
 
 	"github.com/google/cel-go/common/operators"
 	"github.com/google/cel-go/common/overloads"
@@ -23,6 +25,8 @@ import (
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/google/cel-go/common/types/traits"
 	"github.com/google/cel-go/interpreter/functions"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
 )
 
 // Interpretable can accept a given Activation and produce a value along with
@@ -110,7 +114,7 @@ func (test *evalTestOnly) Eval(ctx Activation) ref.Val {
 		if ok {
 			opVal, err := opAttr.Resolve(ctx)
 			if err != nil {
-				return types.NewErr(err.Error())
+				return errorVal(err)
 			}
 			refVal, ok := opVal.(ref.Val)
 			if ok {
@@ -181,6 +185,8 @@ type evalOr struct {
 	id  int64
 	lhs Interpretable
 	rhs Interpretable
+	// stats, when non-nil, counts evaluations which skip the right operand.
+	stats *Stats
 }
 
 // ID implements the Interpretable interface method.
@@ -194,6 +200,9 @@ func (or *evalOr) Eval(ctx Activation) ref.Val {
 	lVal := or.lhs.Eval(ctx)
 	lBool, lok := lVal.(types.Bool)
 	if lok && lBool == types.True {
+		if or.stats != nil {
+			or.stats.shortCircuit()
+		}
 		return types.True
 	}
 	// short-circuit on rhs.
@@ -231,6 +240,8 @@ type evalAnd struct {
 	id  int64
 	lhs Interpretable
 	rhs Interpretable
+	// stats, when non-nil, counts evaluations which skip the right operand.
+	stats *Stats
 }
 
 // ID implements the Interpretable interface method.
@@ -244,6 +255,9 @@ func (and *evalAnd) Eval(ctx Activation) ref.Val {
 	lVal := and.lhs.Eval(ctx)
 	lBool, lok := lVal.(types.Bool)
 	if lok && lBool == types.False {
+		if and.stats != nil {
+			and.stats.shortCircuit()
+		}
 		return types.False
 	}
 	// short-circuit on rhs.
@@ -364,11 +378,43 @@ func (ne *evalNe) Args() []Interpretable {
 	return []Interpretable{ne.lhs, ne.rhs}
 }
 
+// contextCall holds the implementation of a function call and the interceptors of its
+// invocations which receive the context of the evaluation.
+type contextCall struct {
+	// ctxImpl, when non-nil, takes precedence over the implementation of the call.
+	ctxImpl functions.ContextFunctionOp
+	// interceptors run around each invocation of the implementation, the last being outermost.
+	interceptors []callInterceptor
+}
+
+// callInterceptor runs around an invocation of a function implementation, which it performs by
+// calling invoke with the context of the evaluation or a context derived from it.
+type callInterceptor func(ctx context.Context, invoke func(context.Context) ref.Val) ref.Val
+
+// callContext invokes the context implementation on the arguments when one is set, and impl
+// otherwise, within the interceptors and with the context of the evaluation.
+func (c *contextCall) callContext(vars Activation, impl func() ref.Val, args ...ref.Val) ref.Val {
+	invoke := func(ctx context.Context) ref.Val {
+		if c.ctxImpl != nil {
+			return c.ctxImpl(ctx, args...)
+		}
+		return impl()
+	}
+	for _, ic := range c.interceptors {
+		next, intercept := invoke, ic
+		invoke = func(ctx context.Context) ref.Val { return intercept(ctx, next) }
+	}
+	return invoke(evaluationContext(vars))
+}
+
 type evalZeroArity struct {
-	id       int64
-	function string
-	overload string
-	impl     functions.FunctionOp
+	id        int64
+	function  string
+	overload  string
+	impl      functions.FunctionOp
+	transient bool
+	pure      bool
+	contextCall
 }
 
 // ID implements the Interpretable interface method.
@@ -378,6 +424,9 @@ func (zero *evalZeroArity) ID() int64 {
 
 // Eval implements the Interpretable interface method.
 func (zero *evalZeroArity) Eval(ctx Activation) ref.Val {
+	if zero.ctxImpl != nil || len(zero.interceptors) != 0 {
+		return zero.callContext(ctx, func() ref.Val { return zero.impl() })
+	}
 	return zero.impl()
 }
 
@@ -402,12 +451,15 @@ func (zero *evalZeroArity) Args() []Interpretable {
 }
 
 type evalUnary struct {
-	id       int64
-	function string
-	overload string
-	arg      Interpretable
-	trait    int
-	impl     functions.UnaryOp
+	id        int64
+	function  string
+	overload  string
+	arg       Interpretable
+	trait     int
+	impl      functions.UnaryOp
+	transient bool
+	pure      bool
+	contextCall
 }
 
 // ID implements the Interpretable interface method.
@@ -422,9 +474,15 @@ func (un *evalUnary) Eval(ctx Activation) ref.Val {
 	if types.IsUnknownOrError(argVal) {
 		return argVal
 	}
+	if un.ctxImpl != nil {
+		return un.callContext(ctx, nil, argVal)
+	}
 	// If the implementation is bound and the argument value has the right traits required to
 	// invoke it, then call the implementation.
 	if un.impl != nil && (un.trait == 0 || argVal.Type().HasTrait(un.trait)) {
+		if len(un.interceptors) != 0 {
+			return un.callContext(ctx, func() ref.Val { return un.impl(argVal) })
+		}
 		return un.impl(argVal)
 	}
 	// Otherwise, if the argument is a ReceiverType attempt to invoke the receiver method on the
@@ -459,13 +517,16 @@ func (un *evalUnary) Args() []Interpretable {
 }
 
 type evalBinary struct {
-	id       int64
-	function string
-	overload string
-	lhs      Interpretable
-	rhs      Interpretable
-	trait    int
-	impl     functions.BinaryOp
+	id        int64
+	function  string
+	overload  string
+	lhs       Interpretable
+	rhs       Interpretable
+	trait     int
+	impl      functions.BinaryOp
+	transient bool
+	pure      bool
+	contextCall
 }
 
 // ID implements the Interpretable interface method.
@@ -475,8 +536,11 @@ func (bin *evalBinary) ID() int64 {
 
 // Eval implements the Interpretable interface method.
 func (bin *evalBinary) Eval(ctx Activation) ref.Val {
-	lVal := bin.lhs.Eval(ctx)
-	rVal := bin.rhs.Eval(ctx)
+	return bin.apply(ctx, bin.lhs.Eval(ctx), bin.rhs.Eval(ctx))
+}
+
+// apply invokes the function on the evaluated operands.
+func (bin *evalBinary) apply(ctx Activation, lVal, rVal ref.Val) ref.Val {
 	// Early return if any argument to the function is unknown or error.
 	if types.IsUnknownOrError(lVal) {
 		return lVal
@@ -484,9 +548,15 @@ func (bin *evalBinary) Eval(ctx Activation) ref.Val {
 	if types.IsUnknownOrError(rVal) {
 		return rVal
 	}
+	if bin.ctxImpl != nil {
+		return bin.callContext(ctx, nil, lVal, rVal)
+	}
 	// If the implementation is bound and the argument value has the right traits required to
 	// invoke it, then call the implementation.
 	if bin.impl != nil && (bin.trait == 0 || lVal.Type().HasTrait(bin.trait)) {
+		if len(bin.interceptors) != 0 {
+			return bin.callContext(ctx, func() ref.Val { return bin.impl(lVal, rVal) })
+		}
 		return bin.impl(lVal, rVal)
 	}
 	// Otherwise, if the argument is a ReceiverType attempt to invoke the receiver method on the
@@ -518,12 +588,15 @@ func (bin *evalBinary) Args() []Interpretable {
 }
 
 type evalVarArgs struct {
-	id       int64
-	function string
-	overload string
-	args     []Interpretable
-	trait    int
-	impl     functions.FunctionOp
+	id        int64
+	function  string
+	overload  string
+	args      []Interpretable
+	trait     int
+	impl      functions.FunctionOp
+	transient bool
+	pure      bool
+	contextCall
 }
 
 // ID implements the Interpretable interface method.
@@ -543,8 +616,14 @@ func (fn *evalVarArgs) Eval(ctx Activation) ref.Val {
 	}
 	// If the implementation is bound and the argument value has the right traits required to
 	// invoke it, then call the implementation.
+	if fn.ctxImpl != nil {
+		return fn.callContext(ctx, nil, argVals...)
+	}
 	arg0 := argVals[0]
 	if fn.impl != nil && (fn.trait == 0 || arg0.Type().HasTrait(fn.trait)) {
+		if len(fn.interceptors) != 0 {
+			return fn.callContext(ctx, func() ref.Val { return fn.impl(argVals...) })
+		}
 		return fn.impl(argVals...)
 	}
 	// Otherwise, if the argument is a ReceiverType attempt to invoke the receiver method on the
@@ -696,6 +775,8 @@ type evalFold struct {
 	cond      Interpretable
 	step      Interpretable
 	result    Interpretable
+	// observer, when non-nil, observes each evaluation of the fold.
+	observer foldObserver
 }
 
 // ID implements the Interpretable interface method.
@@ -709,6 +790,11 @@ func (fold *evalFold) Eval(ctx Activation) ref.Val {
 	if !foldRange.Type().HasTrait(traits.IterableType) {
 		return types.ValOrErr(foldRange, "got '%T', expected iterable type", foldRange)
 	}
+	return fold.evalRange(ctx, foldRange)
+}
+
+// evalRange evaluates the fold over the iterable range.
+func (fold *evalFold) evalRange(ctx Activation, foldRange ref.Val) ref.Val {
 	// Configure the fold activation with the accumulator initial value.
 	accuCtx := varActivationPool.Get().(*varActivation)
 	accuCtx.parent = ctx
@@ -717,8 +803,22 @@ func (fold *evalFold) Eval(ctx Activation) ref.Val {
 	iterCtx := varActivationPool.Get().(*varActivation)
 	iterCtx.parent = accuCtx
 	iterCtx.name = fold.iterVar
+	var obs foldObservation
+	if fold.observer != nil {
+		obs = fold.observer.begin(ctx, fold.id)
+	}
+	var iterations int64
+	shortCircuit := false
 	it := foldRange.(traits.Iterable).Iterator()
 	for it.HasNext() == types.True {
+		if obs != nil {
+			if err := obs.next(); err != nil {
+				varActivationPool.Put(iterCtx)
+				varActivationPool.Put(accuCtx)
+				obs.end(iterations, shortCircuit)
+				return err
+			}
+		}
 		// Modify the iter var in the fold activation.
 		iterCtx.val = it.Next()
 
@@ -726,8 +826,10 @@ func (fold *evalFold) Eval(ctx Activation) ref.Val {
 		cond := fold.cond.Eval(iterCtx)
 		condBool, ok := cond.(types.Bool)
 		if !types.IsUnknown(cond) && ok && condBool != types.True {
+			shortCircuit = true
 			break
 		}
+		iterations++
 
 		// Evalute the evaluation step into accu var.
 		accuCtx.val = fold.step.Eval(iterCtx)
@@ -736,9 +838,17 @@ func (fold *evalFold) Eval(ctx Activation) ref.Val {
 	res := fold.result.Eval(accuCtx)
 	varActivationPool.Put(iterCtx)
 	varActivationPool.Put(accuCtx)
+	if obs != nil {
+		obs.end(iterations, shortCircuit)
+	}
 	return res
 }
 
+// observe implements the observableFold interface method.
+func (fold *evalFold) observe(observer foldObserver) {
+	fold.observer = addFoldObserver(fold.observer, observer)
+}
+
 // Cost implements the Coster interface method.
 func (fold *evalFold) Cost() (min, max int64) {
 	// Compute the cost for evaluating iterRange.
@@ -868,7 +978,7 @@ func (e *evalWatchConstQual) Qualify(vars Activation, obj interface{}) (interfac
 	out, err := e.ConstantQualifier.Qualify(vars, obj)
 	var val ref.Val
 	if err != nil {
-		val = types.NewErr(err.Error())
+		val = errorVal(err)
 	} else {
 		val = e.adapter.NativeToValue(out)
 	}
@@ -899,7 +1009,7 @@ func (e *evalWatchQual) Qualify(vars Activation, obj interface{}) (interface{},
 	out, err := e.Qualifier.Qualify(vars, obj)
 	var val ref.Val
 	if err != nil {
-		val = types.NewErr(err.Error())
+		val = errorVal(err)
 	} else {
 		val = e.adapter.NativeToValue(out)
 	}
@@ -1029,6 +1139,90 @@ func (and *evalExhaustiveAnd) Cost() (min, max int64) {
 	return calExhaustiveBinaryOpsCost(and.lhs, and.rhs)
 }
 
+// evalAggregateOr is like evalExhaustiveOr, but combines the errors from both operands when
+// neither operand is true.
+type evalAggregateOr struct {
+	id  int64
+	lhs Interpretable
+	rhs Interpretable
+}
+
+// ID implements the Interpretable interface method.
+func (or *evalAggregateOr) ID() int64 {
+	return or.id
+}
+
+// Eval implements the Interpretable interface method.
+func (or *evalAggregateOr) Eval(ctx Activation) ref.Val {
+	lVal := or.lhs.Eval(ctx)
+	rVal := or.rhs.Eval(ctx)
+	lBool, lok := lVal.(types.Bool)
+	if lok && lBool == types.True {
+		return types.True
+	}
+	rBool, rok := rVal.(types.Bool)
+	if rok && rBool == types.True {
+		return types.True
+	}
+	if lok && rok {
+		return types.False
+	}
+	if types.IsUnknown(lVal) {
+		return lVal
+	}
+	if types.IsUnknown(rVal) {
+		return rVal
+	}
+	return aggregateErrors(or.lhs, lVal, or.rhs, rVal)
+}
+
+// Cost implements the Coster interface method.
+func (or *evalAggregateOr) Cost() (min, max int64) {
+	return calExhaustiveBinaryOpsCost(or.lhs, or.rhs)
+}
+
+// evalAggregateAnd is like evalExhaustiveAnd, but combines the errors from both operands when
+// neither operand is false.
+type evalAggregateAnd struct {
+	id  int64
+	lhs Interpretable
+	rhs Interpretable
+}
+
+// ID implements the Interpretable interface method.
+func (and *evalAggregateAnd) ID() int64 {
+	return and.id
+}
+
+// Eval implements the Interpretable interface method.
+func (and *evalAggregateAnd) Eval(ctx Activation) ref.Val {
+	lVal := and.lhs.Eval(ctx)
+	rVal := and.rhs.Eval(ctx)
+	lBool, lok := lVal.(types.Bool)
+	if lok && lBool == types.False {
+		return types.False
+	}
+	rBool, rok := rVal.(types.Bool)
+	if rok && rBool == types.False {
+		return types.False
+	}
+	if lok && rok {
+		return types.True
+	}
+	if types.IsUnknown(lVal) {
+		return lVal
+	}
+	if types.IsUnknown(rVal) {
+		return rVal
+	}
+	return aggregateErrors(and.lhs, lVal, and.rhs, rVal)
+}
+
+// Cost implements the Coster interface method.
+func (and *evalAggregateAnd) Cost() (min, max int64) {
+	return calExhaustiveBinaryOpsCost(and.lhs, and.rhs)
+}
+
 func calExhaustiveBinaryOpsCost(lhs, rhs Interpretable) (min, max int64) {
 	lMin, lMax := estimateCost(lhs)
 	rMin, rMax := estimateCost(rhs)
@@ -1053,11 +1247,11 @@ func (cond *evalExhaustiveConditional) Eval(ctx Activation) ref.Val {
 	cVal := cond.attr.expr.Eval(ctx)
 	tVal, err := cond.attr.truthy.Resolve(ctx)
 	if err != nil {
-		return types.NewErr(err.Error())
+		return errorVal(err)
 	}
 	fVal, err := cond.attr.falsy.Resolve(ctx)
 	if err != nil {
-		return types.NewErr(err.Error())
+		return errorVal(err)
 	}
 	cBool, ok := cVal.(types.Bool)
 	if !ok {
@@ -1084,6 +1278,7 @@ type evalExhaustiveFold struct {
 	cond      Interpretable
 	step      Interpretable
 	result    Interpretable
+	observer  foldObserver
 }
 
 // ID implements the Interpretable interface method.
@@ -1105,10 +1300,24 @@ func (fold *evalExhaustiveFold) Eval(ctx Activation) ref.Val {
 	iterCtx := varActivationPool.Get().(*varActivation)
 	iterCtx.parent = accuCtx
 	iterCtx.name = fold.iterVar
+	var obs foldObservation
+	if fold.observer != nil {
+		obs = fold.observer.begin(ctx, fold.id)
+	}
+	var iterations int64
 	it := foldRange.(traits.Iterable).Iterator()
 	for it.HasNext() == types.True {
+		if obs != nil {
+			if err := obs.next(); err != nil {
+				varActivationPool.Put(iterCtx)
+				varActivationPool.Put(accuCtx)
+				obs.end(iterations, false)
+				return err
+			}
+		}
 		// Modify the iter var in the fold activation.
 		iterCtx.val = it.Next()
+		iterations++
 
 		// Evaluate the condition, but don't terminate the loop as this is exhaustive eval!
 		fold.cond.Eval(iterCtx)
@@ -1120,9 +1329,17 @@ func (fold *evalExhaustiveFold) Eval(ctx Activation) ref.Val {
 	res := fold.result.Eval(accuCtx)
 	varActivationPool.Put(iterCtx)
 	varActivationPool.Put(accuCtx)
+	if obs != nil {
+		obs.end(iterations, false)
+	}
 	return res
 }
 
+// observe implements the observableFold interface method.
+func (fold *evalExhaustiveFold) observe(observer foldObserver) {
+	fold.observer = addFoldObserver(fold.observer, observer)
+}
+
 // Cost implements the Coster interface method.
 func (fold *evalExhaustiveFold) Cost() (min, max int64) {
 	// Compute the cost for evaluating iterRange.
@@ -1188,7 +1405,7 @@ func (a *evalAttr) Cost() (min, max int64) {
 func (a *evalAttr) Eval(ctx Activation) ref.Val {
 	v, err := a.attr.Resolve(ctx)
 	if err != nil {
-		return types.NewErr(err.Error())
+		return errorVal(err)
 	}
 	return a.adapter.NativeToValue(v)
 }
@@ -1202,3 +1419,172 @@ func (a *evalAttr) Qualify(ctx Activation, obj interface{}) (interface{}, error)
 func (a *evalAttr) Resolve(ctx Activation) (interface{}, error) {
 	return a.attr.Resolve(ctx)
 }
+
+// rootInterceptor evaluates the root of the expression on behalf of a root decorator, calling eval
+// with the activation the expression is to be evaluated with, or returning a value of its own
+// without calling it.
+type rootInterceptor func(vars Activation, eval func(Activation) ref.Val) ref.Val
+
+// evalRoot evaluates the planned expression through the interceptors registered by root
+// decorators. The decorators are invoked with the evalRoot before the expression is planned, see
+// planner.PlanRoot, so the interceptors apply to the whole expression whatever the kind of its
+// root node.
+type evalRoot struct {
+	id   int64
+	expr *exprpb.Expr
+	// plan is nil until the expression has been planned.
+	plan         Interpretable
+	interceptors []rootInterceptor
+	eval         func(Activation) ref.Val
+}
+
+// intercept registers an interceptor. Interceptors registered earlier are nested within those
+// registered later.
+func (e *evalRoot) intercept(interceptor rootInterceptor) {
+	e.interceptors = append(e.interceptors, interceptor)
+}
+
+// setPlan composes the interceptors around the evaluation of the planned expression.
+func (e *evalRoot) setPlan(plan Interpretable) {
+	e.plan = plan
+	e.eval = plan.Eval
+	for _, interceptor := range e.interceptors {
+		interceptor, next := interceptor, e.eval
+		e.eval = func(vars Activation) ref.Val {
+			return interceptor(vars, next)
+		}
+	}
+}
+
+// isConst returns whether the planned expression is a constant.
+func (e *evalRoot) isConst() bool {
+	_, isConst := e.plan.(InterpretableConst)
+	return isConst
+}
+
+// ID implements the Interpretable interface method.
+func (e *evalRoot) ID() int64 {
+	return e.id
+}
+
+// Eval implements the Interpretable interface method.
+func (e *evalRoot) Eval(ctx Activation) ref.Val {
+	return e.eval(ctx)
+}
+
+// Cost implements the Coster interface method.
+func (e *evalRoot) Cost() (min, max int64) {
+	return estimateCost(e.plan)
+}
+
+// evalDedup shares the result of an Interpretable between the occurrences of a sub-expression.
+type evalDedup struct {
+	Interpretable
+	class string
+}
+
+// Eval implements the Interpretable interface method.
+func (e *evalDedup) Eval(ctx Activation) ref.Val {
+	return evalDedupNode(e.class, ctx, e.Interpretable.Eval)
+}
+
+// Cost implements the Coster interface method.
+func (e *evalDedup) Cost() (min, max int64) {
+	return estimateCost(e.Interpretable)
+}
+
+// evalDedupAttr shares the result of an InterpretableAttribute between the occurrences of a
+// sub-expression.
+type evalDedupAttr struct {
+	InterpretableAttribute
+	class string
+}
+
+// Eval implements the Interpretable interface method.
+func (e *evalDedupAttr) Eval(ctx Activation) ref.Val {
+	return evalDedupNode(e.class, ctx, e.InterpretableAttribute.Eval)
+}
+
+// Cost implements the Coster interface method.
+func (e *evalDedupAttr) Cost() (min, max int64) {
+	return estimateCost(e.InterpretableAttribute)
+}
+
+// evalDedupCall shares the result of an InterpretableCall between the occurrences of a
+// sub-expression.
+type evalDedupCall struct {
+	InterpretableCall
+	class string
+}
+
+// Eval implements the Interpretable interface method.
+func (e *evalDedupCall) Eval(ctx Activation) ref.Val {
+	return evalDedupNode(e.class, ctx, e.InterpretableCall.Eval)
+}
+
+// Cost implements the Coster interface method.
+func (e *evalDedupCall) Cost() (min, max int64) {
+	return estimateCost(e.InterpretableCall)
+}
+
+// evalAccessLogged records the variable accesses of an InterpretableAttribute.
+type evalAccessLogged struct {
+	InterpretableAttribute
+}
+
+// AddQualifier implements the InterpretableAttribute interface method, returning the logged
+// Interpretable so that the access is recorded with all of its qualifiers.
+func (e *evalAccessLogged) AddQualifier(q Qualifier) (Attribute, error) {
+	_, err := e.InterpretableAttribute.AddQualifier(q)
+	return e, err
+}
+
+// Eval implements the Interpretable interface method.
+func (e *evalAccessLogged) Eval(ctx Activation) ref.Val {
+	val := e.InterpretableAttribute.Eval(ctx)
+	if !types.IsUnknownOrError(val) {
+		recordAccess(e.Attr(), ctx, val)
+	}
+	return val
+}
+
+// Cost implements the Coster interface method.
+func (e *evalAccessLogged) Cost() (min, max int64) {
+	return estimateCost(e.InterpretableAttribute)
+}
+
+// evalDecimal evaluates an arithmetic operator with the BigDecimalBackend, carrying the unrounded
+// result of an operation on doubles into the enclosing arithmetic operator so that the result is
+// rounded to a double only once.
+type evalDecimal struct {
+	*evalBinary
+	prec    uint
+	floatOp func(z, x, y *big.Float) *big.Float
+}
+
+// Eval implements the Interpretable interface method.
+func (e *evalDecimal) Eval(ctx Activation) ref.Val {
+	f, val := e.evalFloat(ctx)
+	if f != nil {
+		return roundFloat(f)
+	}
+	return val
+}
+
+// evalFloat returns the unrounded result of the operator when it is applied to two finite doubles,
+// and otherwise returns the result value.
+func (e *evalDecimal) evalFloat(ctx Activation) (*big.Float, ref.Val) {
+	x, lVal := decimalOperand(e.lhs, e.prec, ctx)
+	y, rVal := decimalOperand(e.rhs, e.prec, ctx)
+	if x != nil && y != nil && (e.function != operators.Divide || y.Sign() != 0) {
+		return e.floatOp(new(big.Float).SetPrec(e.prec), x, y), nil
+	}
+	// Division by zero and operations on other values are applied to the rounded operands.
+	if x != nil {
+		lVal = roundFloat(x)
+	}
+	if y != nil {
+		rVal = roundFloat(y)
+	}
+	return nil, e.apply(ctx, lVal, rVal)
+}
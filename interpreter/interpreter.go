@@ -18,10 +18,15 @@
 package interpreter
 
 import (
+	"errors"
+	"time"
+
 	"github.com/google/cel-go/common/containers"
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/google/cel-go/interpreter/functions"
 
+	"go.opentelemetry.io/otel/trace"
+
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
 )
 
@@ -67,6 +72,375 @@ func ExhaustiveEval(state EvalState) InterpretableDecorator {
 	}
 }
 
+// WithErrorAggregation replaces the logical operators `&&` and `||` with versions which evaluate
+// both operands, even when the operator could short-circuit, and which combine the errors from
+// both operands when the operation fails.
+//
+// When more than one independent sub-expression errors, the result of the evaluation is a
+// types.Err whose Value() is an *AggregatedError listing every EvalError observed.
+func WithErrorAggregation() InterpretableDecorator {
+	return decAggregateErrors()
+}
+
+// WithFunctionFallback invokes the fallback for calls to functions which have no implementation
+// bound to the interpreter, such as functions declared in a newer environment than the one used
+// to plan the expression.
+//
+// The fallback receives the function name and the evaluated arguments, and may return
+// types.Unknown to propagate unknownness. Zero-arity functions must always be bound.
+func WithFunctionFallback(fallback func(name string, args []ref.Val) ref.Val,
+	opts ...FunctionFallbackOption) InterpretableDecorator {
+	f := &functionFallback{fallback: fallback}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return decFunctionFallback(f)
+}
+
+// FunctionFallbackOption configures WithFunctionFallback.
+type FunctionFallbackOption func(*functionFallback)
+
+// OnFunctionFallback sets a hook which is called before each invocation of the fallback with the
+// function name and the type names of the arguments, so that the caller may log or count the
+// invocation.
+func OnFunctionFallback(hook func(name string, argTypes []string)) FunctionFallbackOption {
+	return func(f *functionFallback) {
+		f.onFallback = hook
+	}
+}
+
+// WithAccessLogging records the variables, and the fields and elements within them, which are
+// resolved by evaluations whose activation is created by AccessRecorder.Activation. Evaluations
+// with other activations record nothing.
+//
+// An access is recorded for each resolution of a variable attribute, with the qualifiers of the
+// attribute, once the resolution succeeds; expressions which select from a computed value, such as
+// `f(x).y`, record the access to `x` only. The attributes selected by conditional expressions are
+// recorded when their branch is taken. Since attribute nodes are wrapped, this decorator should
+// follow any decorators which inspect the concrete type of Interpretables.
+func WithAccessLogging() InterpretableDecorator {
+	return decAccessLogging()
+}
+
+// WithReplayProtection rejects evaluations of the expression with the same variables as an
+// evaluation already recorded in the store, returning an error value wrapping ErrReplay.
+//
+// Each evaluation is identified by a nonce computed as HMAC-SHA256(exprHash || activationHash)
+// keyed with the secret, where exprHash is the SHA-256 hash of the expression ignoring its ids and
+// activationHash is the SHA-256 hash of the values of the variables the expression references.
+// The nonce is checked and stored once the expression evaluates to a value, so evaluations which
+// return an error or an unknown may be retried, and a replay is only rejected after it has been
+// evaluated. Evaluations whose variables cannot be hashed, such as error values, and evaluations
+// for which the store returns an error are rejected with an error value. The secret must not be
+// empty, otherwise planning fails.
+//
+// The store is supplied by the caller, since the period over which replays are detected and the
+// sharing of nonces between processes depend on the application. Each program should be planned
+// with a decorator of its own.
+func WithReplayProtection(store NonceStore, secret []byte) InterpretableDecorator {
+	if len(secret) == 0 {
+		return func(Interpretable) (Interpretable, error) {
+			return nil, errors.New("replay protection requires a non-empty secret")
+		}
+	}
+	return decReplayProtection(newReplayGuard(store, secret))
+}
+
+// WithSampling evaluates the expression for only a fraction of the activations, such as to
+// reduce the cost of policy evaluation in high-traffic systems. Each evaluation is performed with
+// probability `rate`, and otherwise returns the passthrough value without evaluating the
+// expression.
+//
+// By default the decision is made at random, using a source seeded from crypto/rand when the
+// decorator is created; WithDeterministicSampling bases it on the value of a variable instead.
+// Rates of one or more evaluate every activation, and rates of zero or less none.
+func WithSampling(rate float64,
+	passthrough ref.Val,
+	opts ...SamplingOption) InterpretableDecorator {
+	return decSampling(newSampler(rate, passthrough, opts...))
+}
+
+// WithMemoryAdaptation relieves memory pressure during large comprehensions. After every 1000
+// iterations, a comprehension compares the ratio of the heap in use to the heap obtained from the
+// system, runtime.MemStats.HeapInuse / HeapSys, with `gcPressureThreshold`. When the ratio exceeds
+// the threshold, the comprehension pauses for a garbage collection and then resumes.
+//
+// The pause lasts at most 10ms: a collection which takes longer continues concurrently with the
+// resumed evaluation. Comprehensions which observe pressure while a collection is running wait for
+// it rather than starting another. Each measurement calls runtime.ReadMemStats, which briefly stops
+// the world, so the check adds a small cost to comprehensions of more than 1000 iterations and
+// none to smaller ones.
+func WithMemoryAdaptation(gcPressureThreshold float64) InterpretableDecorator {
+	return decMemoryAdaptation(newMemoryMonitor(gcPressureThreshold))
+}
+
+// WithSharding evaluates map and filter comprehensions over lists of more than ShardThreshold
+// elements, DefaultShardThreshold by default, by splitting the list into `shards` partitions which
+// are evaluated concurrently. The partition results are concatenated in order, so the result is
+// the same as that of sequential evaluation. Other comprehensions, such as all, exists, and
+// hand-written folds, are always evaluated sequentially.
+//
+// At most `shards` goroutines are used at once across all evaluations of the program; when none
+// is available, partitions are evaluated on the calling goroutine. Functions called within the
+// comprehension must be safe for concurrent use.
+//
+// Comprehensions are recognized by the shape of their planned steps, so this decorator should
+// precede any decorators which wrap function calls or attributes, and is ineffective when
+// combined with TrackState or ExhaustiveEval. A value of `shards` less than two has no effect.
+func WithSharding(shards int, opts ...ShardingOption) InterpretableDecorator {
+	if shards < 2 {
+		return func(i Interpretable) (Interpretable, error) { return i, nil }
+	}
+	return decSharding(newFoldSharding(shards, opts...))
+}
+
+// WithContextFunctions binds calls to the functions in the map, keyed by function name or
+// overload id, to implementations which receive the context of the evaluation. The
+// implementations take precedence over any implementations supplied by the Dispatcher. Functions
+// with one or more arguments which have no implementation in the Dispatcher may be bound this way
+// as well, while zero-arity functions must always be bound by the Dispatcher.
+//
+// The context is the one carried by the activation of each evaluation, see NewContextActivation,
+// such as the context of the request being served, and is context.Background() otherwise. As with
+// other function implementations, calls with unknown or error arguments produce the unknown or
+// error without invoking the implementation. The logical operators and the `==` and `!=`
+// operators are evaluated directly by the interpreter and cannot be bound.
+func WithContextFunctions(fns map[string]functions.ContextFunctionOp) InterpretableDecorator {
+	return decContextFunctions(fns)
+}
+
+// WithFunctionPlugin evaluates calls to the named function with the plugin whenever the plugin
+// supports the runtime types of the call's arguments. Calls with unsupported argument types use
+// the standard implementation of the function.
+//
+// The plugin is invoked synchronously during evaluation. Calls with unknown or error arguments
+// produce the unknown or error without invoking the plugin. The logical operators and the `==`
+// and `!=` operators are evaluated directly by the interpreter and cannot be replaced by plugins.
+func WithFunctionPlugin(function string, plugin FunctionPlugin) InterpretableDecorator {
+	return decFunctionPlugin(function, plugin)
+}
+
+// WithAnyTypeResolver decodes `google.protobuf.Any` values with the resolver when a field is
+// selected from them, and then selects the field from the decoded message.
+//
+// Decoded messages are cached for the duration of a single evaluation.
+func WithAnyTypeResolver(resolver AnyTypeResolver) InterpretableDecorator {
+	return decAnyTypeResolver(resolver)
+}
+
+// InlineSmallMaps replaces map literals with at most `maxSize` constant entries and String keys
+// with constant maps whose entries are stored as a sorted slice and searched with a binary search.
+//
+// For small maps this avoids the cost of building and hashing into a Go map.
+func InlineSmallMaps(maxSize int) InterpretableDecorator {
+	return decInlineSmallMaps(maxSize)
+}
+
+// DefaultIterationsPerCheck is the number of comprehension iterations between checks of the
+// context when WithTimeoutBudget is given a non-positive interval.
+const DefaultIterationsPerCheck = 1000
+
+// WithTimeoutBudget interrupts comprehensions once the context of the evaluation, see
+// NewContextActivation, is cancelled or its deadline is exceeded, causing the evaluation to
+// produce an error.
+//
+// Rather than receiving from ctx.Done() on every iteration, the context is checked once every
+// `iterationsPerCheck` iterations of each comprehension to amortize the cost of the check. A value
+// less than one uses DefaultIterationsPerCheck. Contexts which can never be done, including that
+// of evaluations whose activation carries no context, are ignored.
+func WithTimeoutBudget(iterationsPerCheck int) InterpretableDecorator {
+	if iterationsPerCheck < 1 {
+		iterationsPerCheck = DefaultIterationsPerCheck
+	}
+	return decTimeoutBudget(iterationsPerCheck)
+}
+
+// WithElasticDeadline interrupts comprehensions once the context of the evaluation is done, like
+// WithTimeoutBudget with DefaultIterationsPerCheck, except that an evaluation which is still
+// running when the context's deadline passes is allowed to continue for a grace period rather
+// than discarding its partial work.
+//
+// The grace period is `elasticPct` percent of the evaluation's original budget, which is the time
+// between the creation of its activation by NewContextActivation and the context's deadline. It
+// is computed once per evaluation, and so granted at most once per evaluation. Cancelled
+// contexts, contexts without a deadline, and non-positive percentages get no grace period.
+//
+// This is a best-effort mode: evaluations may finish after the context's deadline, by up to the
+// grace period plus the time taken by the iterations between checks. Callers must be prepared
+// for results which arrive after the original deadline. The decorator replaces, rather than
+// combines with, WithTimeoutBudget.
+func WithElasticDeadline(elasticPct float64) InterpretableDecorator {
+	return decElasticDeadline(elasticPct, DefaultIterationsPerCheck)
+}
+
+// DefaultMaxCallDepth is the call depth limit used when WithMaxCallDepth is given a non-positive
+// limit.
+const DefaultMaxCallDepth = 32
+
+// WithMaxCallDepth limits the nesting of function implementations which evaluate expressions,
+// such as a custom function which traverses a recursive data structure by evaluating a program
+// on each of its children.
+//
+// The depth is the number of function implementations executing at once within an evaluation,
+// and is carried by the context of the evaluation, see NewContextActivation. Implementations
+// bound by WithContextFunctions receive a context which records their depth, and pass it on by
+// evaluating nested programs with an activation carrying that context. Calling an implementation
+// which would exceed the limit produces an error wrapping an EvalError with the code
+// ErrCallDepthExceeded. A limit less than one uses DefaultMaxCallDepth.
+//
+// Implementations which do not evaluate expressions return before any other call begins, so only
+// re-entrant implementations increase the depth beyond one.
+func WithMaxCallDepth(maxDepth int) InterpretableDecorator {
+	if maxDepth < 1 {
+		maxDepth = DefaultMaxCallDepth
+	}
+	return decMaxCallDepth(maxDepth)
+}
+
+// WithPrefetch resolves the named identifiers from the activation before evaluating the
+// expression, so that activations backed by lazy loaders perform their loads up front rather
+// than interleaved with evaluation.
+//
+// The identifiers are resolved in order on the goroutine calling Eval, so any deadline the
+// loaders observe applies as it would during evaluation. Identifiers absent from the activation
+// are skipped. When an identifier resolves to an error value, the error is returned without
+// evaluating the expression.
+//
+// The identifiers are resolved once per evaluation, before the root of the expression is
+// evaluated. Constant expressions are evaluated without prefetching.
+func WithPrefetch(idents ...string) InterpretableDecorator {
+	return decPrefetch(idents)
+}
+
+// WithIsolation evaluates each expression on a new goroutine, locked to an OS thread of its own,
+// so that a misbehaving function implementation cannot stall or crash the caller.
+//
+// The caller waits for the result until the timeout elapses, and otherwise returns an error
+// wrapping an EvalError with the code ErrIsolationTimeout. A timeout less than or equal to zero
+// waits indefinitely. Panics on the evaluation goroutine are converted into errors as they are by
+// WithPanicRecovery, rather than terminating the process.
+//
+// Goroutines cannot be stopped from the outside, so an abandoned evaluation is cancelled
+// cooperatively: the isolated evaluation carries a context derived from that of the evaluation,
+// see NewContextActivation, which is cancelled when the evaluation is abandoned. Comprehensions
+// limited by WithTimeoutBudget and functions bound by WithContextFunctions observe the
+// cancellation, but other work continues until it completes, and a function implementation
+// which never returns holds its goroutine and thread indefinitely. The evaluation shares memory
+// with the rest of the process, so this is not a security boundary; custom functions must still
+// be safe for concurrent use, and state tracking decorators such as TrackState should not be
+// combined with isolation, since an abandoned evaluation may still update the state.
+func WithIsolation(timeout time.Duration) InterpretableDecorator {
+	return decIsolation(timeout)
+}
+
+// DefaultMaxAttempts is the number of attempts used when WithRetry is given a non-positive number
+// of attempts.
+const DefaultMaxAttempts = 3
+
+// WithRetry repeats calls to function overloads marked as Transient when they produce an error,
+// making up to `maxAttempts` attempts in total and waiting between attempts for the delay given
+// by the backoff policy. A nil policy retries without waiting, and a value less than one uses
+// DefaultMaxAttempts.
+//
+// Errors from other overloads are returned immediately. Retries stop once the context of the
+// evaluation is done, see NewContextActivation, and a retry is not attempted when its delay would
+// extend past the context's deadline, so the time spent retrying does not exceed the deadline. In
+// either case the last error is returned.
+func WithRetry(maxAttempts int, backoff BackoffPolicy) InterpretableDecorator {
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	return decRetry(&retrier{maxAttempts: maxAttempts, backoff: backoff})
+}
+
+// WithResultCache stores the results of evaluations within the cache, and returns the stored
+// result when the expression is evaluated again with the same variable values.
+//
+// The cache key is computed from the values of every variable the expression refers to, whether
+// or not a given evaluation reads it. Results are only cached for pure expressions: those whose
+// function calls all resolve to overloads marked as Pure, as the standard overloads are, and
+// which refer to none of the `volatile` variables, such as a variable holding the current time.
+// Evaluations with partial activations, variables whose values cannot be hashed, or results which
+// are errors or unknowns are not cached.
+//
+// Each call to WithResultCache creates a distinct scope of keys, so a cache may be shared by
+// several programs, provided that each program is planned with its own decorator.
+func WithResultCache(cache ResultCache, volatile ...string) InterpretableDecorator {
+	return decResultCache(newResultCacheScope(cache, volatile))
+}
+
+// WithMetricsHook instruments comprehensions and function calls to report their iterations and
+// durations to the hook. A nil hook is a NopMetricsHook.
+//
+// Evaluations of the program are reported by wrapping the planned Interpretable with
+// NewMeteredProgram. Function calls are wrapped to time them, or to count them when the hook
+// implements CallCounter, so this decorator should follow any decorators which inspect the
+// concrete type of call Interpretables.
+func WithMetricsHook(hook MetricsHook) InterpretableDecorator {
+	if hook == nil {
+		hook = NopMetricsHook{}
+	}
+	return decMetrics(hook)
+}
+
+// WithSubExprDeduplication evaluates sub-expressions which occur more than once within the
+// expression, such as `request.resource.labels["env"]` appearing in several branches, only once
+// per evaluation and shares the result between the occurrences.
+//
+// Occurrences are identified when the expression is planned by comparing the structure of the
+// sub-expressions, ignoring their ids. Sub-expressions which refer to comprehension variables are
+// not shared, since their values vary between iterations; all other sub-expressions see the same
+// variables wherever they appear, so the first result is reused. Each program should be planned
+// with a decorator of its own.
+//
+// Shared occurrences after the first are not evaluated, so their values are not recorded by
+// state tracking decorators such as TrackState and ExhaustiveEval. Since nodes are wrapped, this
+// decorator should follow any decorators which inspect the concrete type of Interpretables.
+func WithSubExprDeduplication() InterpretableDecorator {
+	return decSubExprDeduplication()
+}
+
+// WithArithmeticBackend evaluates the `+`, `-`, `*`, and `/` operators on pairs of ints and
+// pairs of doubles using the backend, such as BigDecimalBackend for financial calculations.
+//
+// Type-checking is unaffected. Operations on other types, such as strings and lists, use their
+// standard implementations.
+func WithArithmeticBackend(backend ArithmeticBackend) InterpretableDecorator {
+	return decArithmeticBackend(backend)
+}
+
+// WithPanicRecovery converts panics raised while evaluating the expression, such as those from
+// function implementations or unexpected value types, into error values.
+//
+// A single recover is installed around the evaluation of the whole expression. The error value
+// wraps an EvalError with the code ErrInternalPanic and the id of the root of the expression. The
+// panic message and stack trace, which identify where the panic was raised, are passed to the
+// logger given by WithPanicLogger, if any.
+func WithPanicRecovery(opts ...PanicRecoveryOption) InterpretableDecorator {
+	return decPanicRecovery(newPanicRecovery(opts...))
+}
+
+// WithOTelTracing traces the evaluation of comprehensions, the most expensive construct in CEL, by
+// creating a span for each comprehension evaluation as a child of the span within the context of
+// the evaluation, see NewContextActivation. Evaluations whose activation carries no context create
+// spans within context.Background().
+// Each span is annotated with the AttrExpressionID, AttrComprehensionIterations, and
+// AttrComprehensionShortCircuit attributes.
+//
+// Function calls which take longer than the threshold to evaluate are recorded as events named
+// SlowExpressionEvent on the span within the context of the evaluation, annotated with the
+// AttrExpressionID and AttrExpressionEvalTime attributes. A threshold less than or equal to zero
+// uses DefaultTracingThreshold.
+//
+// Since function calls are wrapped to time them, this decorator should follow any decorators
+// which inspect the concrete type of call Interpretables.
+func WithOTelTracing(tracer trace.Tracer, threshold time.Duration) InterpretableDecorator {
+	if threshold <= 0 {
+		threshold = DefaultTracingThreshold
+	}
+	return decOTelTracing(tracer, threshold)
+}
+
 // Optimize will pre-compute operations such as list and map construction and optimize
 // call arguments to set membership tests. The set of optimizations will increase over time.
 func Optimize() InterpretableDecorator {
@@ -119,7 +493,7 @@ func (i *exprInterpreter) NewInterpretable(
 		i.container,
 		checked,
 		decorators...)
-	return p.Plan(checked.GetExpr())
+	return p.PlanRoot(checked.GetExpr())
 }
 
 // NewUncheckedIntepretable implements the Interpreter interface method.
@@ -133,5 +507,5 @@ func (i *exprInterpreter) NewUncheckedInterpretable(
 		i.attrFactory,
 		i.container,
 		decorators...)
-	return p.Plan(expr)
+	return p.PlanRoot(expr)
 }
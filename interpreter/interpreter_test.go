@@ -15,10 +15,17 @@
 package interpreter
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -26,18 +33,22 @@ import (
 	"github.com/google/cel-go/checker/decls"
 	"github.com/google/cel-go/common"
 	"github.com/google/cel-go/common/containers"
+	"github.com/google/cel-go/common/operators"
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/google/cel-go/common/types/traits"
 	"github.com/google/cel-go/interpreter/functions"
 	"github.com/google/cel-go/parser"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/proto"
 
 	proto2pb "github.com/google/cel-go/test/proto2pb"
 	proto3pb "github.com/google/cel-go/test/proto3pb"
 
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	anypb "google.golang.org/protobuf/types/known/anypb"
 	structpb "google.golang.org/protobuf/types/known/structpb"
 	tpb "google.golang.org/protobuf/types/known/timestamppb"
 	wrapperspb "google.golang.org/protobuf/types/known/wrapperspb"
@@ -1108,6 +1119,34 @@ func BenchmarkInterpreter_Parallel(b *testing.B) {
 	}
 }
 
+// BenchmarkInterpreter_Stats compares the evaluation of the benchmark suite with and without the
+// collection of interpreter statistics.
+func BenchmarkInterpreter_Stats(b *testing.B) {
+	stats := NewStats()
+	for _, tst := range testData {
+		prg, vars, err := program(b, &tst, Optimize())
+		if err != nil {
+			b.Fatal(err)
+		}
+		statPrg, _, err := program(b, &tst, Optimize(), stats.Decorator())
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(tst.name+"/NoStats", func(bb *testing.B) {
+			bb.ReportAllocs()
+			for i := 0; i < bb.N; i++ {
+				prg.Eval(vars)
+			}
+		})
+		b.Run(tst.name+"/Stats", func(bb *testing.B) {
+			bb.ReportAllocs()
+			for i := 0; i < bb.N; i++ {
+				stats.CountEval(statPrg.Eval(vars))
+			}
+		})
+	}
+}
+
 func TestInterpreter(t *testing.T) {
 	for _, tst := range testData {
 		tc := tst
@@ -1496,6 +1535,1535 @@ func TestInterpreter_TypeConversionOpt(t *testing.T) {
 	}
 }
 
+func TestInterpreter_ErrorAggregation(t *testing.T) {
+	tests := []struct {
+		expr string
+		out  ref.Val
+		errs []string
+	}{
+		{expr: `false && 1/0 != 0`, out: types.False},
+		{expr: `1/0 != 0 || true`, out: types.True},
+		{expr: `1/0 != 0 && true`, errs: []string{"divide by zero"}},
+		{expr: `1/0 != 0 || 2 % 0 != 0`, errs: []string{"divide by zero", "modulus by zero"}},
+		{
+			expr: `(1/0 != 0 && 2 % 0 != 0) || {}['missing']`,
+			errs: []string{"divide by zero", "modulus by zero", "no such key: missing"},
+		},
+	}
+	for _, tst := range tests {
+		tc := tst
+		prg, vars, err := program(t, &testCase{expr: tc.expr}, WithErrorAggregation())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		out := prg.Eval(vars)
+		if tc.out != nil {
+			if out.Equal(tc.out) != types.True {
+				t.Errorf("%s: got %v, wanted %v", tc.expr, out, tc.out)
+			}
+			continue
+		}
+		errVal, isErr := out.(*types.Err)
+		if !isErr {
+			t.Fatalf("%s: got %v, wanted error", tc.expr, out)
+		}
+		if len(tc.errs) == 1 {
+			if errVal.String() != tc.errs[0] {
+				t.Errorf("%s: got %v, wanted %s", tc.expr, errVal, tc.errs[0])
+			}
+			continue
+		}
+		agg, isAgg := errVal.Value().(*AggregatedError)
+		if !isAgg {
+			t.Fatalf("%s: got %v, wanted aggregated error", tc.expr, errVal)
+		}
+		var msgs []string
+		for _, e := range agg.Errors() {
+			msgs = append(msgs, e.Error())
+		}
+		if !reflect.DeepEqual(msgs, tc.errs) {
+			t.Errorf("%s: got errors %v, wanted %v", tc.expr, msgs, tc.errs)
+		}
+		agg.Errors()[0] = EvalError{}
+		if agg.Errors()[0].Error() != tc.errs[0] {
+			t.Errorf("%s: Errors() returned the aggregated error's own list", tc.expr)
+		}
+	}
+}
+
+func TestInterpreter_ErrorCodes(t *testing.T) {
+	tests := []struct {
+		expr string
+		code ErrorCode
+	}{
+		{expr: `{}['missing']`, code: ErrNoSuchKey},
+		{expr: `missing`, code: ErrUndeclaredIdent},
+		{expr: `msg.missing`, code: ErrNoSuchField},
+		{expr: `msg.single_int32 / 0`, code: ErrUnspecified},
+	}
+	for _, tst := range tests {
+		tc := tst
+		prg, vars, err := program(t, &testCase{
+			expr:      tc.expr,
+			unchecked: true,
+			types:     []proto.Message{&proto3pb.TestAllTypes{}},
+			in:        map[string]interface{}{"msg": &proto3pb.TestAllTypes{}},
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		out := prg.Eval(vars)
+		if !types.IsError(out) {
+			t.Fatalf("%s: got %v, wanted error", tc.expr, out)
+		}
+		if code := ErrorCodeOf(out.(*types.Err)); code != tc.code {
+			t.Errorf("%s: got code %v, wanted %v", tc.expr, code, tc.code)
+		}
+	}
+}
+
+func TestInterpreter_FunctionFallback(t *testing.T) {
+	var calls []string
+	fallback := func(name string, args []ref.Val) ref.Val {
+		calls = append(calls, name)
+		if name == "pending" {
+			return types.Unknown{args[0].(types.Int).Value().(int64)}
+		}
+		return types.String(fmt.Sprintf("%s/%d", name, len(args)))
+	}
+	var reports []string
+	onFallback := func(name string, argTypes []string) {
+		reports = append(reports, fmt.Sprintf("%s(%s)", name, strings.Join(argTypes, ", ")))
+	}
+	tests := []struct {
+		expr string
+		out  ref.Val
+	}{
+		{expr: `unary(1)`, out: types.String("unary/1")},
+		{expr: `'a'.binary('b')`, out: types.String("binary/2")},
+		{expr: `varargs(1, 2, 3)`, out: types.String("varargs/3")},
+		{expr: `pending(7) || false`, out: types.Unknown{7}},
+		{expr: `size('abc')`, out: types.Int(3)},
+	}
+	for _, tst := range tests {
+		tc := tst
+		prg, vars, err := program(t, &testCase{expr: tc.expr, unchecked: true},
+			WithFunctionFallback(fallback, OnFunctionFallback(onFallback)))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		out := prg.Eval(vars)
+		if !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("%s: got %v, wanted %v", tc.expr, out, tc.out)
+		}
+	}
+	want := []string{"unary", "binary", "varargs", "pending"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got fallback calls %v, wanted %v", calls, want)
+	}
+	wantReports := []string{"unary(int)", "binary(string, string)", "varargs(int, int, int)",
+		"pending(int)"}
+	if !reflect.DeepEqual(reports, wantReports) {
+		t.Errorf("got fallback reports %v, wanted %v", reports, wantReports)
+	}
+}
+
+// testPlugin evaluates calls on int arguments by returning the number of arguments.
+type testPlugin struct {
+	calls int
+}
+
+func (p *testPlugin) Supports(argTypes []*exprpb.Type) bool {
+	for _, t := range argTypes {
+		if !proto.Equal(t, decls.Int) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *testPlugin) Eval(args []ref.Val) (ref.Val, error) {
+	p.calls++
+	if len(args) == 0 {
+		return nil, errors.New("no arguments")
+	}
+	return types.Int(len(args) * 100), nil
+}
+
+func TestInterpreter_FunctionPlugin(t *testing.T) {
+	tests := []struct {
+		expr     string
+		function string
+		out      ref.Val
+		calls    int
+	}{
+		{expr: `1 + 2`, function: operators.Add, out: types.Int(200), calls: 1},
+		{expr: `'a' + 'b'`, function: operators.Add, out: types.String("ab")},
+		{expr: `-(1)`, function: operators.Negate, out: types.Int(100), calls: 1},
+		{expr: `-(1.5)`, function: operators.Negate, out: types.Double(-1.5)},
+		{expr: `[1, 2].size() + size('ab')`, function: "size", out: types.Int(4)},
+		{expr: `[1 < 2, 'a' < 'b']`, function: operators.Less,
+			out:   types.NewDynamicList(types.DefaultTypeAdapter, []ref.Val{types.Int(200), types.True}),
+			calls: 1},
+	}
+	for _, tst := range tests {
+		tc := tst
+		plugin := &testPlugin{}
+		prg, vars, err := program(t, &testCase{expr: tc.expr},
+			WithFunctionPlugin(tc.function, plugin))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		out := prg.Eval(vars)
+		if out.Equal(tc.out) != types.True {
+			t.Errorf("%s: got %v, wanted %v", tc.expr, out, tc.out)
+		}
+		if plugin.calls != tc.calls {
+			t.Errorf("%s: got %d plugin calls, wanted %d", tc.expr, plugin.calls, tc.calls)
+		}
+	}
+}
+
+func TestInterpreter_FunctionPluginError(t *testing.T) {
+	tc := &testCase{
+		expr:      `zero()`,
+		unchecked: true,
+		funcs: []*functions.Overload{
+			{
+				Operator: "zero",
+				Function: func(args ...ref.Val) ref.Val { return types.Int(0) },
+			},
+		},
+	}
+	prg, vars, err := program(t, tc, WithFunctionPlugin("zero", &testPlugin{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := prg.Eval(vars)
+	if !types.IsError(out) || out.(*types.Err).String() != "no arguments" {
+		t.Errorf("got %v, wanted error 'no arguments'", out)
+	}
+}
+
+type testAnyResolver struct {
+	calls int
+}
+
+func (r *testAnyResolver) Resolve(typeURL string) (proto.Message, error) {
+	r.calls++
+	if typeURL != "type.googleapis.com/google.expr.proto3.test.TestAllTypes" {
+		return nil, fmt.Errorf("unknown type url: %s", typeURL)
+	}
+	return &proto3pb.TestAllTypes{}, nil
+}
+
+func TestInterpreter_AnyTypeResolver(t *testing.T) {
+	msg, err := anypb.New(&proto3pb.TestAllTypes{SingleInt64: 40, SingleInt32: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr := `a.single_int64 + a.single_int32 == 42`
+	resolver := &testAnyResolver{}
+	prg, vars, err := program(t, &testCase{
+		expr:  expr,
+		types: []proto.Message{&proto3pb.TestAllTypes{}},
+		env:   []*exprpb.Decl{decls.NewVar("a", decls.Any)},
+		in:    map[string]interface{}{"a": msg},
+	}, WithAnyTypeResolver(resolver))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := prg.Eval(vars)
+	if out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+	if resolver.calls != 1 {
+		t.Errorf("got %d resolver calls, wanted 1", resolver.calls)
+	}
+
+	// A new evaluation decodes the Any value again, even with the same activation.
+	prg.Eval(vars)
+	if resolver.calls != 2 {
+		t.Errorf("got %d resolver calls, wanted 2", resolver.calls)
+	}
+
+	// Resolution errors are reported as evaluation errors.
+	unknown := &anypb.Any{TypeUrl: "type.googleapis.com/unknown.Type"}
+	vars, _ = NewActivation(map[string]interface{}{"a": unknown})
+	if out := prg.Eval(vars); !types.IsError(out) {
+		t.Errorf("got %v, wanted error", out)
+	}
+}
+
+func TestInterpreter_InlineSmallMaps(t *testing.T) {
+	tests := []struct {
+		expr    string
+		out     ref.Val
+		inlined bool
+	}{
+		{expr: `{'b': 2, 'a': 1}['a']`, out: types.Int(1), inlined: true},
+		{expr: `'c' in {'b': 2, 'c': 3}`, out: types.True, inlined: true},
+		{expr: `{'a': 1, 'b': 2, 'c': 3}.size()`, out: types.Int(3), inlined: false},
+		{expr: `{1: 'a'}[1]`, out: types.String("a"), inlined: false},
+	}
+	for _, tst := range tests {
+		tc := tst
+		var inlined bool
+		observer := func(i Interpretable) (Interpretable, error) {
+			if c, ok := i.(InterpretableConst); ok {
+				_, isMap := c.Value().(traits.Mapper)
+				inlined = inlined || isMap
+			}
+			return i, nil
+		}
+		prg, vars, err := program(t, &testCase{expr: tc.expr}, InlineSmallMaps(2), observer)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		out := prg.Eval(vars)
+		if out.Equal(tc.out) != types.True {
+			t.Errorf("%s: got %v, wanted %v", tc.expr, out, tc.out)
+		}
+		if inlined != tc.inlined {
+			t.Errorf("%s: got inlined %t, wanted %t", tc.expr, inlined, tc.inlined)
+		}
+	}
+}
+
+func TestInterpreter_ArithmeticBackend(t *testing.T) {
+	tests := []struct {
+		expr    string
+		backend ArithmeticBackend
+		out     ref.Val
+		err     string
+	}{
+		{expr: `9223372036854775807 + 1`, backend: IEEE754Backend(), out: types.Int(math.MinInt64)},
+		{expr: `9223372036854775807 + 1`, backend: BigDecimalBackend(64), err: "integer overflow"},
+		{expr: `-9223372036854775808 / -1`, backend: BigDecimalBackend(64), err: "integer overflow"},
+		{expr: `7 / 2 * 2 - 1`, backend: BigDecimalBackend(64), out: types.Int(5)},
+		{expr: `1 / 0`, backend: BigDecimalBackend(64), err: "divide by zero"},
+		{expr: `1.0 + 0.001`, backend: BigDecimalBackend(8), out: types.Double(1.0)},
+		{expr: `1.0 + 0.001`, backend: BigDecimalBackend(64), out: types.Double(1.001)},
+		{expr: `1.0 / 0.0`, backend: BigDecimalBackend(64), out: types.Double(math.Inf(1))},
+		{expr: `0.1 + 0.2 - 0.3`, backend: IEEE754Backend(), out: types.Double(math.Ldexp(1, -54))},
+		{expr: `0.1 + 0.2 - 0.3`, backend: BigDecimalBackend(128), out: types.Double(math.Ldexp(1, -55))},
+		{expr: `1e308 * 10.0 / 10.0`, backend: IEEE754Backend(), out: types.Double(math.Inf(1))},
+		{expr: `1e308 * 10.0 / 10.0`, backend: BigDecimalBackend(64), out: types.Double(1e308)},
+		{expr: `double(string(1e308 * 10.0)) / 10.0`, backend: BigDecimalBackend(64), out: types.Double(math.Inf(1))},
+		{expr: `'a' + 'b'`, backend: BigDecimalBackend(64), out: types.String("ab")},
+	}
+	for _, tst := range tests {
+		tc := tst
+		prg, vars, err := program(t, &testCase{expr: tc.expr}, WithArithmeticBackend(tc.backend))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		out := prg.Eval(vars)
+		if tc.err != "" {
+			if !types.IsError(out) || out.(*types.Err).String() != tc.err {
+				t.Errorf("%s: got %v, wanted error %q", tc.expr, out, tc.err)
+			}
+			continue
+		}
+		if out.Equal(tc.out) != types.True {
+			t.Errorf("%s: got %v, wanted %v", tc.expr, out, tc.out)
+		}
+	}
+}
+
+func TestInterpreter_PanicRecovery(t *testing.T) {
+	tc := &testCase{
+		expr:      `1 + explode(x.y)`,
+		unchecked: true,
+		funcs: []*functions.Overload{
+			{
+				Operator: "explode",
+				Unary: func(arg ref.Val) ref.Val {
+					var elems []ref.Val
+					return elems[int(arg.(types.Int))]
+				},
+			},
+		},
+		in: map[string]interface{}{"x": map[string]int{"y": 3}},
+	}
+	parsed, errs := parser.Parse(common.NewTextSource(tc.expr))
+	if len(errs.GetErrors()) != 0 {
+		t.Fatal(errs.ToDisplayString())
+	}
+	var loggedID int64
+	var loggedStack []byte
+	logger := func(id int64, recovered interface{}, stack []byte) {
+		loggedID, loggedStack = id, stack
+	}
+	prg, vars, err := program(t, tc, WithPanicRecovery(WithPanicLogger(logger)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := prg.Eval(vars)
+	if !types.IsError(out) {
+		t.Fatalf("got %v, wanted error", out)
+	}
+	evalErr, ok := out.(*types.Err).Value().(EvalError)
+	if !ok {
+		t.Fatalf("got error %v, wanted EvalError", out)
+	}
+	if evalErr.Code != ErrInternalPanic {
+		t.Errorf("got code %v, wanted ErrInternalPanic", evalErr.Code)
+	}
+	if evalErr.ID != parsed.GetExpr().GetId() {
+		t.Errorf("got id %d, wanted the id of the root", evalErr.ID)
+	}
+	if loggedID != evalErr.ID || len(loggedStack) == 0 {
+		t.Errorf("got logged id %d and a %d byte stack, wanted id %d and a stack trace",
+			loggedID, len(loggedStack), evalErr.ID)
+	}
+
+	// Attribute resolution remains intact.
+	tc = &testCase{expr: `x.y + 1`, unchecked: true, in: tc.in}
+	prg, vars, err = program(t, tc, WithPanicRecovery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := prg.Eval(vars); out.Equal(types.Int(4)) != types.True {
+		t.Errorf("got %v, wanted 4", out)
+	}
+
+	// Expressions whose root is a select are recovered as a whole.
+	tc = &testCase{
+		expr:      `x.y`,
+		unchecked: true,
+		in: map[string]interface{}{
+			"x": func() interface{} { panic("unavailable") },
+		},
+	}
+	prg, vars, err = program(t, tc, WithPanicRecovery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = prg.Eval(vars)
+	if !types.IsError(out) || ErrorCodeOf(out.(*types.Err)) != ErrInternalPanic {
+		t.Errorf("got %v, wanted an ErrInternalPanic error", out)
+	}
+
+	// Decorators which inspect the nodes below the root are unaffected.
+	tc = &testCase{expr: `x.y == 3 || x.y > 5`, unchecked: true,
+		in: map[string]interface{}{"x": map[string]int{"y": 3}}}
+	state := NewEvalState()
+	prg, vars, err = program(t, tc, ExhaustiveEval(state), WithPanicRecovery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := prg.Eval(vars); out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+	if ids := len(state.IDs()); ids != 9 {
+		t.Errorf("got %d state ids, wanted 9", ids)
+	}
+}
+
+func TestInterpreter_TimeoutBudget(t *testing.T) {
+	tc := &testCase{
+		expr: `[1, 2, 3, 4, 5, 6, 7, 8].map(x, [1, 2, 3, 4].map(y, x * y)).size() == 8`,
+		out:  types.True,
+	}
+	prg, vars, err := program(t, tc, WithTimeoutBudget(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := prg.Eval(vars); out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out := prg.Eval(NewContextActivation(ctx, vars))
+	if !types.IsError(out) || out.(*types.Err).String() != "operation interrupted: context canceled" {
+		t.Errorf("got %v, wanted interrupted error", out)
+	}
+
+	// The same program observes the context of each evaluation.
+	if out := prg.Eval(NewContextActivation(context.Background(), vars)); out != types.True {
+		t.Errorf("got %v with a live context, wanted true", out)
+	}
+}
+
+func TestInterpreter_ElasticDeadline(t *testing.T) {
+	tc := &testCase{
+		expr: `[1, 2, 3, 4].map(x, x * 2).size() == 4`,
+		out:  types.True,
+	}
+	graced, vars, err := program(t, tc, decElasticDeadline(100, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict, _, err := program(t, tc, decTimeoutBudget(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// A 100% grace period extends the deadline by roughly another 100ms.
+	gracedVars := NewContextActivation(ctx, vars)
+	<-ctx.Done()
+	if out := graced.Eval(gracedVars); out != types.True {
+		t.Errorf("got %v within the grace period, wanted true", out)
+	}
+	if out := strict.Eval(NewContextActivation(ctx, vars)); !types.IsError(out) {
+		t.Errorf("got %v without a grace period, wanted interrupted error", out)
+	}
+	// An evaluation beginning after the deadline has no budget to extend.
+	if out := graced.Eval(NewContextActivation(ctx, vars)); !types.IsError(out) {
+		t.Errorf("got %v for an evaluation begun after the deadline, wanted interrupted error", out)
+	}
+	time.Sleep(150 * time.Millisecond)
+	out := graced.Eval(gracedVars)
+	if !types.IsError(out) ||
+		out.(*types.Err).String() != "operation interrupted: context deadline exceeded" {
+		t.Errorf("got %v after the grace period, wanted interrupted error", out)
+	}
+
+	// Each evaluation is granted its own grace period.
+	fresh, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	freshVars := NewContextActivation(fresh, vars)
+	<-fresh.Done()
+	if out := graced.Eval(freshVars); out != types.True {
+		t.Errorf("got %v within the grace period of a later evaluation, wanted true", out)
+	}
+
+	cancelled, cancel := context.WithTimeout(context.Background(), time.Hour)
+	cancel()
+	if out := graced.Eval(NewContextActivation(cancelled, vars)); !types.IsError(out) {
+		t.Errorf("got %v for a cancelled context, wanted interrupted error", out)
+	}
+}
+
+func TestInterpreter_MaxCallDepth(t *testing.T) {
+	// walk(n) evaluates the program recursively on n - 1 until n reaches zero.
+	var prg Interpretable
+	walk := func(ctx context.Context, args ...ref.Val) ref.Val {
+		n := args[0].(types.Int)
+		if n == 0 {
+			return types.Int(0)
+		}
+		vars, _ := NewActivation(map[string]interface{}{"n": n - 1})
+		return prg.Eval(NewContextActivation(ctx, vars))
+	}
+	tc := &testCase{
+		expr:      `walk(n)`,
+		unchecked: true,
+		in:        map[string]interface{}{"n": 4},
+	}
+	var vars Activation
+	var err error
+	prg, vars, err = program(t, tc,
+		WithContextFunctions(map[string]functions.ContextFunctionOp{"walk": walk}),
+		WithMaxCallDepth(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := prg.Eval(vars); out != types.Int(0) {
+		t.Errorf("got %v, wanted 0 within the call depth limit", out)
+	}
+	if vars, err = NewActivation(map[string]interface{}{"n": 5}); err != nil {
+		t.Fatal(err)
+	}
+	out := prg.Eval(vars)
+	if !types.IsError(out) {
+		t.Fatalf("got %v, wanted call depth error", out)
+	}
+	evalErr, ok := out.(*types.Err).Value().(EvalError)
+	if !ok || evalErr.Code != ErrCallDepthExceeded {
+		t.Errorf("got error %v, wanted EvalError with code ErrCallDepthExceeded", out)
+	}
+	if out.(*types.Err).String() != "call depth exceeded: 5" {
+		t.Errorf("got error %v, wanted call depth exceeded: 5", out)
+	}
+
+	// The depth is tracked per evaluation, so concurrent evaluations do not add up.
+	if vars, err = NewActivation(map[string]interface{}{"n": 4}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	results := make([]ref.Val, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = prg.Eval(vars)
+		}(i)
+	}
+	wg.Wait()
+	for _, out := range results {
+		if out != types.Int(0) {
+			t.Errorf("got %v from a concurrent evaluation, wanted 0", out)
+		}
+	}
+}
+
+func TestInterpreter_Prefetch(t *testing.T) {
+	var loads []string
+	loader := func(name string, val ref.Val) func() ref.Val {
+		return func() ref.Val {
+			loads = append(loads, name)
+			return val
+		}
+	}
+	tc := &testCase{
+		expr:      `[1, 2].all(i, i < b) && a`,
+		unchecked: true,
+	}
+	prg, _, err := program(t, tc, WithPrefetch("a", "b", "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ := NewActivation(map[string]interface{}{
+		"a": loader("a", types.True),
+		"b": loader("b", types.Int(3)),
+	})
+	if out := prg.Eval(vars); out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+	// Each identifier is loaded once, in the prefetch order rather than the evaluation order.
+	if !reflect.DeepEqual(loads, []string{"a", "b"}) {
+		t.Errorf("got loads %v, wanted [a b]", loads)
+	}
+
+	// A failed prefetch is returned even though evaluation would not read the identifier.
+	loads = nil
+	tc.expr = `false && a`
+	prg, _, err = program(t, tc, WithPrefetch("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ = NewActivation(map[string]interface{}{
+		"a": loader("a", types.NewErr("load failed")),
+	})
+	out := prg.Eval(vars)
+	if !types.IsError(out) || out.(*types.Err).String() != "load failed" {
+		t.Errorf("got %v, wanted load failed error", out)
+	}
+
+	// Expressions whose root is a select prefetch before the select is evaluated.
+	loads = nil
+	tc.expr = `a.x`
+	prg, _, err = program(t, tc, WithPrefetch("b", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ = NewActivation(map[string]interface{}{
+		"a": loader("a", types.DefaultTypeAdapter.NativeToValue(map[string]int{"x": 1})),
+		"b": loader("b", types.Int(3)),
+	})
+	if out := prg.Eval(vars); out != types.Int(1) {
+		t.Errorf("got %v, wanted 1", out)
+	}
+	if !reflect.DeepEqual(loads, []string{"b", "a"}) {
+		t.Errorf("got loads %v, wanted [b a]", loads)
+	}
+}
+
+// testSpan records the attributes, events, and parent of a span. The remaining trace.Span methods
+// are those of a no-op span.
+type testSpan struct {
+	trace.Span
+	name   string
+	parent *testSpan
+	attrs  map[attribute.Key]attribute.Value
+	events []trace.Event
+	ended  bool
+}
+
+func (s *testSpan) SetAttributes(kvs ...attribute.KeyValue) {
+	for _, kv := range kvs {
+		s.attrs[kv.Key] = kv.Value
+	}
+}
+
+func (s *testSpan) AddEvent(name string, opts ...trace.EventOption) {
+	cfg := trace.NewEventConfig(opts...)
+	s.events = append(s.events, trace.Event{Name: name, Attributes: cfg.Attributes})
+}
+
+func (s *testSpan) End(opts ...trace.SpanOption) {
+	s.ended = true
+}
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string,
+	opts ...trace.SpanOption) (context.Context, trace.Span) {
+	span := &testSpan{
+		Span:  trace.SpanFromContext(context.Background()),
+		name:  name,
+		attrs: map[attribute.Key]attribute.Value{},
+	}
+	if parent, found := trace.SpanFromContext(ctx).(*testSpan); found {
+		span.parent = parent
+	}
+	span.SetAttributes(trace.NewSpanConfig(opts...).Attributes...)
+	t.spans = append(t.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func TestInterpreter_OTelTracing(t *testing.T) {
+	tc := &testCase{
+		expr:      `[1, 2, 3].exists(x, x == 2) && [1, 2].all(x, x > 0) && slow(1) && slow(2)`,
+		unchecked: true,
+		funcs: []*functions.Overload{
+			{
+				Operator: "slow",
+				Unary: func(arg ref.Val) ref.Val {
+					time.Sleep(2 * time.Millisecond)
+					return types.True
+				},
+			},
+		},
+	}
+	tracer := &testTracer{}
+	prg, vars, err := program(t, tc, WithOTelTracing(tracer, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, parent := tracer.Start(context.Background(), "request")
+	if out := prg.Eval(NewContextActivation(ctx, vars)); out != types.True {
+		t.Fatalf("got %v, wanted true", out)
+	}
+	if len(tracer.spans) != 3 {
+		t.Fatalf("got %d spans, wanted 3", len(tracer.spans))
+	}
+	exists, all := tracer.spans[1], tracer.spans[2]
+	if exists.parent != parent || all.parent != parent {
+		t.Errorf("got comprehension spans %+v, %+v, wanted children of the request span", exists, all)
+	}
+	if !exists.ended || exists.name != "cel.comprehension" ||
+		exists.attrs[AttrComprehensionIterations].AsInt64() != 2 ||
+		!exists.attrs[AttrComprehensionShortCircuit].AsBool() {
+		t.Errorf("got exists() span %+v", exists)
+	}
+	if all.attrs[AttrComprehensionIterations].AsInt64() != 2 ||
+		all.attrs[AttrComprehensionShortCircuit].AsBool() {
+		t.Errorf("got all() span %+v", all)
+	}
+	if exists.attrs[AttrExpressionID].AsInt64() == all.attrs[AttrExpressionID].AsInt64() {
+		t.Errorf("got the same expression id for both comprehensions: %+v, %+v", exists, all)
+	}
+	// Each call which exceeds the threshold is recorded as an event with its own id.
+	events := parent.(*testSpan).events
+	if len(events) != 2 {
+		t.Fatalf("got slow expression events %v, wanted one for each slow() call", events)
+	}
+	ids := map[int64]bool{}
+	for _, event := range events {
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range event.Attributes {
+			attrs[kv.Key] = kv.Value
+		}
+		if event.Name != SlowExpressionEvent || len(attrs) != 2 {
+			t.Errorf("got event %+v, wanted a slow expression event", event)
+		}
+		if us := attrs[AttrExpressionEvalTime].AsInt64(); us < 1000 {
+			t.Errorf("got eval time %dus, wanted at least 1000us", us)
+		}
+		ids[attrs[AttrExpressionID].AsInt64()] = true
+	}
+	if len(ids) != len(events) {
+		t.Errorf("got slow expression events %v, wanted distinct expression ids", events)
+	}
+}
+
+func TestInterpreter_Stats(t *testing.T) {
+	stats := NewStats()
+	tc := &testCase{
+		expr: `[1, 2, 3].exists(x, x == 2) || [1, 2].all(y, y > 0)`,
+	}
+	prg, vars, err := program(t, tc, stats.Decorator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		out := prg.Eval(vars)
+		stats.CountEval(out)
+		if out != types.True {
+			t.Fatalf("got %v, wanted true", out)
+		}
+	}
+	snap := stats.Snapshot()
+	want := StatsSnapshot{
+		TotalEvals:         2,
+		ComprehensionEvals: 2,
+		// Each evaluation short-circuits exists() and ||.
+		ShortCircuits: 4,
+		FunctionCalls: map[string]int64{
+			operators.Equals:           4,
+			operators.LogicalNot:       6,
+			operators.NotStrictlyFalse: 6,
+		},
+	}
+	if !reflect.DeepEqual(snap, want) {
+		t.Errorf("got snapshot %+v, wanted %+v", snap, want)
+	}
+
+	tc = &testCase{expr: `1 / x`, unchecked: true, in: map[string]interface{}{"x": 0}}
+	prg, vars, err = program(t, tc, stats.Decorator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats.CountEval(prg.Eval(vars))
+	if snap := stats.Snapshot(); snap.ErrorReturns != 1 || snap.FunctionCalls[operators.Divide] != 1 {
+		t.Errorf("got snapshot %+v, wanted an error return", snap)
+	}
+
+	stats.Reset()
+	if snap := stats.Snapshot(); !reflect.DeepEqual(snap, StatsSnapshot{FunctionCalls: map[string]int64{}}) {
+		t.Errorf("got snapshot %+v after Reset()", snap)
+	}
+}
+
+func TestInterpreter_Isolation(t *testing.T) {
+	tc := &testCase{
+		expr:      `[1, 2].all(x, slow(x) && x > 0) || boom(1)`,
+		unchecked: true,
+		funcs: []*functions.Overload{
+			{
+				Operator: "slow",
+				Unary: func(arg ref.Val) ref.Val {
+					time.Sleep(time.Duration(arg.(types.Int)) * 20 * time.Millisecond)
+					return types.True
+				},
+			},
+			{
+				Operator: "boom",
+				Unary: func(arg ref.Val) ref.Val {
+					panic("boom")
+				},
+			},
+		},
+	}
+	prg, vars, err := program(t, tc, WithIsolation(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := prg.Eval(vars); out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+
+	tc.expr = `[1, 2].all(x, slow(x) && x > 0) && boom(1)`
+	prg, vars, err = program(t, tc, WithIsolation(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := prg.Eval(vars)
+	if !types.IsError(out) || ErrorCodeOf(out.(*types.Err)) != ErrInternalPanic {
+		t.Errorf("got %v, wanted an internal panic error", out)
+	}
+
+	prg, vars, err = program(t, tc, WithIsolation(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = prg.Eval(vars)
+	if !types.IsError(out) || ErrorCodeOf(out.(*types.Err)) != ErrIsolationTimeout {
+		t.Errorf("got %v, wanted a timeout error", out)
+	}
+
+	// The abandoned evaluation observes the cancellation of its context.
+	tc.expr = `[1, 2, 3, 4].all(x, slow(x))`
+	var slowCalls int32
+	tc.funcs[0].Unary = func(arg ref.Val) ref.Val {
+		atomic.AddInt32(&slowCalls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return types.True
+	}
+	prg, vars, err = program(t, tc,
+		WithTimeoutBudget(1),
+		WithIsolation(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = prg.Eval(NewContextActivation(context.Background(), vars))
+	if !types.IsError(out) || ErrorCodeOf(out.(*types.Err)) != ErrIsolationTimeout {
+		t.Errorf("got %v, wanted a timeout error", out)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if calls := atomic.LoadInt32(&slowCalls); calls != 1 {
+		t.Errorf("got %d calls after the evaluation was abandoned, wanted 1", calls)
+	}
+
+	// Expressions whose root is a select are isolated as a whole.
+	tc = &testCase{expr: `a.b`, unchecked: true}
+	prg, _, err = program(t, tc, WithIsolation(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ = NewActivation(map[string]interface{}{
+		"a": func() interface{} {
+			time.Sleep(100 * time.Millisecond)
+			return map[string]int{"b": 1}
+		},
+	})
+	out = prg.Eval(vars)
+	if !types.IsError(out) || ErrorCodeOf(out.(*types.Err)) != ErrIsolationTimeout {
+		t.Errorf("got %v, wanted a timeout error", out)
+	}
+}
+
+func TestInterpreter_Retry(t *testing.T) {
+	var flakyCalls, brokenCalls int
+	tc := &testCase{
+		expr:      `flaky(2) && !broken(1)`,
+		unchecked: true,
+		funcs: []*functions.Overload{
+			{
+				Operator: "flaky",
+				Unary: func(arg ref.Val) ref.Val {
+					flakyCalls++
+					if flakyCalls <= int(arg.(types.Int)) {
+						return types.NewErr("unavailable")
+					}
+					return types.True
+				},
+				Transient: true,
+			},
+			{
+				Operator: "broken",
+				Unary: func(arg ref.Val) ref.Val {
+					brokenCalls++
+					return types.NewErr("broken")
+				},
+			},
+		},
+	}
+	prg, vars, err := program(t, tc, WithRetry(3, ExponentialBackoff(time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := prg.Eval(vars)
+	if !types.IsError(out) || out.(*types.Err).Error() != "broken" {
+		t.Errorf("got %v, wanted the broken() error", out)
+	}
+	if flakyCalls != 3 || brokenCalls != 1 {
+		t.Errorf("got %d flaky() and %d broken() calls, wanted 3 and 1", flakyCalls, brokenCalls)
+	}
+
+	// Retries which would outlast the deadline are not attempted.
+	flakyCalls = 0
+	tc.expr = `flaky(5)`
+	prg, vars, err = program(t, tc, WithRetry(10, ExponentialBackoff(10*time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if out := prg.Eval(NewContextActivation(ctx, vars)); !types.IsError(out) {
+		t.Errorf("got %v, wanted an error", out)
+	}
+	if flakyCalls != 3 {
+		t.Errorf("got %d flaky() calls, wanted 3", flakyCalls)
+	}
+
+	// Each evaluation observes its own deadline.
+	flakyCalls = 0
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if out := prg.Eval(NewContextActivation(ctx, vars)); out != types.True {
+		t.Errorf("got %v, wanted true within a longer deadline", out)
+	}
+	if flakyCalls != 6 {
+		t.Errorf("got %d flaky() calls, wanted 6", flakyCalls)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff(10 * time.Millisecond)
+	for attempt, want := range map[int]time.Duration{
+		1:   10 * time.Millisecond,
+		3:   40 * time.Millisecond,
+		100: math.MaxInt64,
+	} {
+		if got := b.Delay(attempt); got != want {
+			t.Errorf("Delay(%d) got %v, wanted %v", attempt, got, want)
+		}
+	}
+}
+
+func TestInterpreter_ResultCache(t *testing.T) {
+	var calls int
+	twice := &functions.Overload{
+		Operator: "twice",
+		Unary: func(arg ref.Val) ref.Val {
+			calls++
+			return arg.(types.Int) * 2
+		},
+		Pure: true,
+	}
+	tc := &testCase{
+		expr:      `twice(x) + size(m)`,
+		unchecked: true,
+		funcs:     []*functions.Overload{twice},
+	}
+	cache := NewLRUResultCache(2)
+	prg, _, err := program(t, tc, WithResultCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tst := range []struct {
+		x     int
+		m     map[string]int
+		out   types.Int
+		calls int
+	}{
+		{x: 1, m: map[string]int{"a": 1, "b": 2}, out: 4, calls: 1},
+		{x: 1, m: map[string]int{"b": 2, "a": 1}, out: 4, calls: 1},
+		{x: 2, m: map[string]int{"a": 1}, out: 5, calls: 2},
+		{x: 3, m: map[string]int{}, out: 6, calls: 3},
+		// The first result has been evicted.
+		{x: 1, m: map[string]int{"a": 1, "b": 2}, out: 4, calls: 4},
+	} {
+		vars, _ := NewActivation(map[string]interface{}{"x": tst.x, "m": tst.m})
+		if out := prg.Eval(vars); out != tst.out {
+			t.Errorf("Eval(x=%d) got %v, wanted %v", tst.x, out, tst.out)
+		}
+		if calls != tst.calls {
+			t.Errorf("Eval(x=%d) made %d calls in total, wanted %d", tst.x, calls, tst.calls)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("got %d cached results, wanted 2", cache.Len())
+	}
+
+	// The cache follows decorators which replace nodes, such as Optimize.
+	calls = 0
+	prg, _, err = program(t, tc, Optimize(), WithResultCache(NewLRUResultCache(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ := NewActivation(map[string]interface{}{"x": 1, "m": map[string]int{}})
+	prg.Eval(vars)
+	prg.Eval(vars)
+	if calls != 1 {
+		t.Errorf("got %d calls with Optimize, wanted 1", calls)
+	}
+
+	// Impure functions and volatile variables disable caching.
+	impure := *twice
+	impure.Pure = false
+	for _, prgTc := range []struct {
+		funcs    []*functions.Overload
+		volatile []string
+	}{
+		{funcs: []*functions.Overload{&impure}},
+		{funcs: []*functions.Overload{twice}, volatile: []string{"m"}},
+	} {
+		calls = 0
+		tc.funcs = prgTc.funcs
+		prg, _, err = program(t, tc, WithResultCache(cache, prgTc.volatile...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vars, _ := NewActivation(map[string]interface{}{"x": 1, "m": map[string]int{}})
+		prg.Eval(vars)
+		prg.Eval(vars)
+		if calls != 2 {
+			t.Errorf("got %d calls, wanted 2 uncached calls", calls)
+		}
+	}
+
+	// Expressions whose root is a select are cached as a whole.
+	cache = NewLRUResultCache(1)
+	prg, _, err = program(t, &testCase{expr: `a.b`, unchecked: true}, WithResultCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ = NewActivation(map[string]interface{}{"a": map[string]int{"b": 1}})
+	if out := prg.Eval(vars); out != types.Int(1) {
+		t.Errorf("got %v, wanted 1", out)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("got %d cached results, wanted 1", cache.Len())
+	}
+}
+
+func TestInterpreter_ContextFunctions(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "tenant-a")
+	tenant := func(ctx context.Context, args ...ref.Val) ref.Val {
+		prefix, _ := ctx.Value(ctxKey{}).(string)
+		return types.String(prefix + ":" + string(args[0].(types.String)))
+	}
+	tc := &testCase{
+		expr: `qualify("users") == "tenant-a:users" && "users".qualify() == "tenant-a:users"`,
+		env: []*exprpb.Decl{
+			decls.NewFunction("qualify",
+				decls.NewOverload("qualify_string",
+					[]*exprpb.Type{decls.String}, decls.String),
+				decls.NewInstanceOverload("string_qualify",
+					[]*exprpb.Type{decls.String}, decls.String)),
+		},
+	}
+	prg, vars, err := program(t, tc, WithContextFunctions(
+		map[string]functions.ContextFunctionOp{"qualify": tenant}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := prg.Eval(NewContextActivation(ctx, vars)); out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+
+	// Each evaluation receives its own context.
+	other := context.WithValue(context.Background(), ctxKey{}, "tenant-b")
+	if out := prg.Eval(NewContextActivation(other, vars)); out != types.False {
+		t.Errorf("got %v, wanted false with the context of another tenant", out)
+	}
+	partial, err := NewPartialActivation(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := prg.Eval(NewHierarchicalActivation(EmptyActivation(),
+		NewContextActivation(ctx, partial))); out != types.True {
+		t.Errorf("got %v, wanted true with a context in the child activation", out)
+	}
+	if _, isPartial := NewContextActivation(ctx, partial).(PartialActivation); !isPartial {
+		t.Error("got a context activation which is not partial for a partial activation")
+	}
+
+	// Overload ids take precedence over function names.
+	upper := func(ctx context.Context, args ...ref.Val) ref.Val {
+		return types.String(strings.ToUpper(string(args[0].(types.String))))
+	}
+	tc.expr = `qualify("users") == "tenant-a:users" && "users".qualify() == "USERS"`
+	prg, vars, err = program(t, tc, WithContextFunctions(
+		map[string]functions.ContextFunctionOp{"qualify": tenant, "string_qualify": upper}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := prg.Eval(NewContextActivation(ctx, vars)); out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+}
+
+func TestInterpreter_MemoryAdaptation(t *testing.T) {
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	tc := &testCase{
+		expr: `l.all(x, x >= 0)`,
+		env:  []*exprpb.Decl{decls.NewVar("l", decls.NewListType(decls.Int))},
+	}
+	prg, _, err := program(t, tc, WithMemoryAdaptation(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ := NewActivation(map[string]interface{}{"l": make([]int, 2500)})
+	if out := prg.Eval(vars); out != types.True {
+		t.Fatalf("got %v, wanted true", out)
+	}
+	// The collection may outlast the pause of the comprehension.
+	deadline := time.Now().Add(time.Second)
+	var after runtime.MemStats
+	for runtime.ReadMemStats(&after); after.NumForcedGC == before.NumForcedGC; runtime.ReadMemStats(&after) {
+		if time.Now().After(deadline) {
+			t.Fatal("got no forced garbage collection")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMemoryMonitor(t *testing.T) {
+	release := make(chan struct{})
+	var collections int32
+	m := newMemoryMonitor(0.5)
+	m.readStats = func(stats *runtime.MemStats) {
+		stats.HeapInuse = 90
+		stats.HeapSys = 100
+	}
+	m.gc = func() {
+		atomic.AddInt32(&collections, 1)
+		<-release
+	}
+	m.check(999)
+	if atomic.LoadInt32(&collections) != 0 {
+		t.Fatal("got a collection between checks")
+	}
+	// The pause is bounded even though the collection does not complete, and a running
+	// collection is not started again.
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		m.check(1000)
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("got a pause of %v, wanted at most %v", elapsed, maxMemoryPause)
+		}
+	}
+	if n := atomic.LoadInt32(&collections); n != 1 {
+		t.Errorf("got %d collections, wanted 1", n)
+	}
+	close(release)
+
+	m = newMemoryMonitor(0.95)
+	m.readStats = func(stats *runtime.MemStats) {
+		stats.HeapInuse = 90
+		stats.HeapSys = 100
+	}
+	m.gc = func() {
+		t.Error("got a collection below the threshold")
+	}
+	m.check(1000)
+}
+
+func TestInterpreter_ReplayProtection(t *testing.T) {
+	expr := `x + [1, 2].map(i, i * y).size() > 0`
+	store := &testNonceStore{seen: map[string]bool{}}
+	tc := &testCase{expr: expr, unchecked: true}
+	prg, _, err := program(t, tc, WithReplayProtection(store, []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eval := func(in map[string]interface{}) ref.Val {
+		vars, _ := NewActivation(in)
+		return prg.Eval(vars)
+	}
+	if out := eval(map[string]interface{}{"x": 1, "y": 2}); out != types.True {
+		t.Fatalf("got %v, wanted true", out)
+	}
+	out := eval(map[string]interface{}{"x": 1, "y": 2})
+	if e, isErr := out.(*types.Err); !isErr || e.Value() != ErrReplay {
+		t.Errorf("got %v, wanted ErrReplay", out)
+	}
+	// Variables which the expression does not reference do not distinguish evaluations.
+	out = eval(map[string]interface{}{"x": 1, "y": 2, "z": 3})
+	if e, isErr := out.(*types.Err); !isErr || e.Value() != ErrReplay {
+		t.Errorf("got %v, wanted ErrReplay", out)
+	}
+	if out := eval(map[string]interface{}{"x": 1, "y": 3}); out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+	if len(store.seen) != 2 {
+		t.Errorf("got %d nonces, wanted 2", len(store.seen))
+	}
+
+	// The nonce depends on the secret and on the expression.
+	other, _, err := program(t, tc, WithReplayProtection(store, []byte("other")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ := NewActivation(map[string]interface{}{"x": 1, "y": 2})
+	if out := other.Eval(vars); out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+
+	// Evaluations which fail do not record a nonce, so they may be retried.
+	for i := 0; i < 2; i++ {
+		if out := eval(map[string]interface{}{"x": 1, "y": "a"}); !types.IsError(out) ||
+			out.(*types.Err).Value() == ErrReplay {
+			t.Errorf("got %v, wanted the evaluation error", out)
+		}
+	}
+	if len(store.seen) != 3 {
+		t.Errorf("got %d nonces, wanted 3", len(store.seen))
+	}
+
+	store.err = errors.New("store unavailable")
+	out = eval(map[string]interface{}{"x": 2, "y": 2})
+	if e, isErr := out.(*types.Err); !isErr || e.Value() != store.err {
+		t.Errorf("got %v, wanted the store error", out)
+	}
+
+	for _, secret := range [][]byte{nil, {}} {
+		if _, _, err := program(t, tc, WithReplayProtection(store, secret)); err == nil {
+			t.Errorf("WithReplayProtection(%q) planned a program, wanted an error", secret)
+		}
+	}
+
+	// Expressions whose root is a select or an index are protected as a whole.
+	for _, expr := range []string{`a.b`, `a['b']`} {
+		store := &testNonceStore{seen: map[string]bool{}}
+		tc := &testCase{expr: expr, unchecked: true}
+		prg, _, err := program(t, tc, WithReplayProtection(store, []byte("secret")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vars, _ := NewActivation(map[string]interface{}{"a": map[string]int{"b": 1}})
+		if out := prg.Eval(vars); out.Equal(types.Int(1)) != types.True {
+			t.Errorf("%s: got %v, wanted 1", expr, out)
+		}
+		out := prg.Eval(vars)
+		if e, isErr := out.(*types.Err); !isErr || e.Value() != ErrReplay {
+			t.Errorf("%s: got %v, wanted ErrReplay", expr, out)
+		}
+	}
+}
+
+func TestInterpreter_Sampling(t *testing.T) {
+	tc := &testCase{expr: `x > 0`, unchecked: true}
+	passthrough := types.String("skipped")
+	evals := func(prg Interpretable, n int, in func(i int) map[string]interface{}) int {
+		count := 0
+		for i := 0; i < n; i++ {
+			vars, _ := NewActivation(in(i))
+			out := prg.Eval(vars)
+			switch out {
+			case types.True:
+				count++
+			case passthrough:
+			default:
+				t.Fatalf("got %v, wanted true or the passthrough value", out)
+			}
+		}
+		return count
+	}
+	fixed := func(int) map[string]interface{} { return map[string]interface{}{"x": 1} }
+	for _, tst := range []struct {
+		rate     float64
+		min, max int
+	}{
+		{rate: 0, min: 0, max: 0},
+		{rate: 1, min: 1000, max: 1000},
+		{rate: 0.5, min: 400, max: 600},
+	} {
+		prg, _, err := program(t, tc, WithSampling(tst.rate, passthrough))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := evals(prg, 1000, fixed); n < tst.min || n > tst.max {
+			t.Errorf("rate %v: got %d evaluations, wanted between %d and %d",
+				tst.rate, n, tst.min, tst.max)
+		}
+	}
+
+	// Deterministic decisions depend only on the value of the key.
+	byID := func(i int) map[string]interface{} {
+		return map[string]interface{}{"x": 1, "id": fmt.Sprintf("req-%d", i%100)}
+	}
+	var decisions [][]bool
+	for j := 0; j < 2; j++ {
+		prg, _, err := program(t, tc,
+			WithSampling(0.5, passthrough, WithDeterministicSampling("id")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sampled := make([]bool, 200)
+		for i := range sampled {
+			sampled[i] = evals(prg, 1, func(int) map[string]interface{} { return byID(i) }) == 1
+		}
+		decisions = append(decisions, sampled)
+		// Activations without the key are always evaluated.
+		if n := evals(prg, 10, fixed); n != 10 {
+			t.Errorf("got %d evaluations without the key, wanted 10", n)
+		}
+	}
+	count := 0
+	for i, sampled := range decisions[0] {
+		if sampled != decisions[1][i] || sampled != decisions[0][i%100] {
+			t.Fatalf("inconsistent decisions for %v", byID(i)["id"])
+		}
+		if sampled {
+			count++
+		}
+	}
+	if count < 60 || count > 140 {
+		t.Errorf("got %d of 200 evaluations, wanted about half", count)
+	}
+
+	// Expressions whose root is a select are not evaluated when they are passed through.
+	tc = &testCase{expr: `a.b`, unchecked: true}
+	prg, _, err := program(t, tc, WithSampling(0, passthrough))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ := NewActivation(map[string]interface{}{
+		"a": func() interface{} {
+			t.Error("resolved a variable of an evaluation which was passed through")
+			return map[string]int{"b": 1}
+		},
+	})
+	if out := prg.Eval(vars); out != passthrough {
+		t.Errorf("got %v, wanted the passthrough value", out)
+	}
+}
+
+type testNonceStore struct {
+	seen map[string]bool
+	err  error
+}
+
+func (s *testNonceStore) CheckAndStore(nonce string) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	if s.seen[nonce] {
+		return false, nil
+	}
+	s.seen[nonce] = true
+	return true, nil
+}
+
+func TestInterpreter_Sharding(t *testing.T) {
+	var active, maxActive int32
+	slow := &functions.Overload{
+		Operator: "slow",
+		Unary: func(arg ref.Val) ref.Val {
+			n := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return arg
+		},
+	}
+	in := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for _, tst := range []struct {
+		expr       string
+		out        interface{}
+		concurrent bool
+	}{
+		{expr: `l.map(x, slow(x) * 10)`,
+			out: []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, concurrent: true},
+		{expr: `l.filter(x, slow(x) % 3 == 0)`, out: []int{3, 6, 9}, concurrent: true},
+		{expr: `l.map(x, slow(x) % 2 == 0, x)`, out: []int{2, 4, 6, 8, 10}, concurrent: true},
+		{expr: `l.all(x, slow(x) > 0)`, out: true},
+		{expr: `l.exists(x, slow(x) > 9)`, out: true},
+		// The first failing partition determines the error, as in sequential evaluation.
+		{expr: `l.map(x, 10 / (slow(x) - 9))`, out: errors.New("divide by zero"),
+			concurrent: true},
+		// Lists at or below the threshold are not partitioned.
+		{expr: `l.filter(x, x < 4).map(x, slow(x))`, out: []int{1, 2, 3}},
+	} {
+		tc := &testCase{
+			expr: tst.expr,
+			env: []*exprpb.Decl{
+				decls.NewVar("l", decls.NewListType(decls.Int)),
+				decls.NewFunction("slow",
+					decls.NewOverload("slow", []*exprpb.Type{decls.Int}, decls.Int)),
+			},
+			funcs: []*functions.Overload{slow},
+		}
+		prg, _, err := program(t, tc, WithSharding(4, ShardThreshold(3)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		atomic.StoreInt32(&maxActive, 0)
+		vars, _ := NewActivation(map[string]interface{}{"l": in})
+		out := prg.Eval(vars)
+		switch want := tst.out.(type) {
+		case error:
+			if !types.IsError(out) || !strings.Contains(out.(*types.Err).Error(), want.Error()) {
+				t.Errorf("%s: got %v, wanted error %v", tst.expr, out, want)
+			}
+		default:
+			if out.Equal(types.DefaultTypeAdapter.NativeToValue(want)) != types.True {
+				t.Errorf("%s: got %v, wanted %v", tst.expr, out, want)
+			}
+		}
+		if got := atomic.LoadInt32(&maxActive) > 1; got != tst.concurrent {
+			t.Errorf("%s: got concurrent calls %t, wanted %t", tst.expr, got, tst.concurrent)
+		}
+	}
+}
+
+func TestInterpreter_ShardingObservers(t *testing.T) {
+	tc := &testCase{
+		expr: `l.map(x, x * 2)`,
+		env:  []*exprpb.Decl{decls.NewVar("l", decls.NewListType(decls.Int))},
+	}
+	stats := NewStats()
+	// Observers attached after the sharding decorator observe the sharded comprehension as a
+	// single evaluation.
+	prg, _, err := program(t, tc, WithSharding(4, ShardThreshold(3)), stats.Decorator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, _ := NewActivation(map[string]interface{}{"l": []int{1, 2, 3, 4, 5, 6, 7, 8}})
+	want := types.DefaultTypeAdapter.NativeToValue([]int{2, 4, 6, 8, 10, 12, 14, 16})
+	if out := prg.Eval(vars); out.Equal(want) != types.True {
+		t.Errorf("got %v, wanted %v", out, want)
+	}
+	if snap := stats.Snapshot(); snap.ComprehensionEvals != 1 {
+		t.Errorf("got %d comprehension evaluations, wanted 1", snap.ComprehensionEvals)
+	}
+}
+
+func TestInterpreter_SubExprDeduplication(t *testing.T) {
+	var calls int
+	twice := &functions.Overload{
+		Operator: "twice",
+		Unary: func(arg ref.Val) ref.Val {
+			calls++
+			return arg.(types.Int) * 2
+		},
+	}
+	for _, tst := range []struct {
+		expr  string
+		out   ref.Val
+		calls int
+	}{
+		{expr: `twice(x) + twice(x) == twice(x) * 2`, out: types.True, calls: 1},
+		{expr: `twice(x) + twice(x + 1)`, out: types.Int(10), calls: 2},
+		// Calls which refer to comprehension variables are evaluated for each iteration, while
+		// repeated comprehensions are evaluated once.
+		{expr: `[1, 2].map(i, twice(i)) == [1, 2].map(j, twice(j))`, out: types.True, calls: 4},
+		{expr: `[1, 2].map(i, twice(i)) == [1, 2].map(i, twice(i))`, out: types.True, calls: 2},
+		{expr: `[1, 2].all(i, twice(x) > i) && twice(x) == 4`, out: types.True, calls: 1},
+		// Expressions whose root is an index share results as a whole.
+		{expr: `[twice(x), twice(x)][1]`, out: types.Int(4), calls: 1},
+	} {
+		tc := &testCase{
+			expr:      tst.expr,
+			unchecked: true,
+			funcs:     []*functions.Overload{twice},
+		}
+		prg, _, err := program(t, tc, WithSubExprDeduplication())
+		if err != nil {
+			t.Fatal(err)
+		}
+		vars, _ := NewActivation(map[string]interface{}{"x": 2})
+		for i := 0; i < 2; i++ {
+			calls = 0
+			if out := prg.Eval(vars); out.Equal(tst.out) != types.True {
+				t.Errorf("%s: got %v, wanted %v", tst.expr, out, tst.out)
+			}
+			if calls != tst.calls {
+				t.Errorf("%s: got %d calls, wanted %d", tst.expr, calls, tst.calls)
+			}
+		}
+	}
+}
+
+func BenchmarkInterpreter_TimeoutBudget(b *testing.B) {
+	tc := &testCase{
+		expr: `[1, 2, 3, 4, 5, 6, 7, 8, 9, 10].all(x, [1, 2, 3, 4, 5, 6, 7, 8, 9, 10].exists(y, x * y < 0) == false)`,
+		out:  types.True,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	benchmarks := []struct {
+		name string
+		dec  []InterpretableDecorator
+	}{
+		{name: "NoBudget"},
+		{name: "PerCheck1", dec: []InterpretableDecorator{WithTimeoutBudget(1)}},
+		{name: "PerCheck100", dec: []InterpretableDecorator{WithTimeoutBudget(100)}},
+		{name: "PerCheck1000", dec: []InterpretableDecorator{WithTimeoutBudget(1000)}},
+	}
+	for _, bm := range benchmarks {
+		prg, vars, err := program(b, tc, bm.dec...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		vars = NewContextActivation(ctx, vars)
+		b.Run(bm.name, func(bb *testing.B) {
+			bb.ReportAllocs()
+			for i := 0; i < bb.N; i++ {
+				prg.Eval(vars)
+			}
+		})
+	}
+}
+
 func testContainer(name string) *containers.Container {
 	cont, _ := containers.NewContainer(containers.Name(name))
 	return cont
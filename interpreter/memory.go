@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/common/types/ref"
+)
+
+const (
+	// memoryCheckInterval is the number of comprehension iterations between heap measurements.
+	memoryCheckInterval = 1000
+
+	// maxMemoryPause bounds the time a comprehension waits for a garbage collection.
+	maxMemoryPause = 10 * time.Millisecond
+)
+
+// memoryMonitor pauses comprehensions for a garbage collection when the heap is under pressure.
+type memoryMonitor struct {
+	threshold float64
+	// readStats and gc are runtime.ReadMemStats and runtime.GC, replaced by tests.
+	readStats func(*runtime.MemStats)
+	gc        func()
+
+	mu sync.Mutex
+	// collected is non-nil while a garbage collection started by the monitor is running, and is
+	// closed when it completes.
+	collected chan struct{}
+}
+
+func newMemoryMonitor(threshold float64) *memoryMonitor {
+	return &memoryMonitor{
+		threshold: threshold,
+		readStats: runtime.ReadMemStats,
+		gc:        runtime.GC,
+	}
+}
+
+// check measures the heap after every memoryCheckInterval iterations of a comprehension, and
+// when the ratio of the heap in use to the heap obtained from the system exceeds the threshold,
+// waits for a garbage collection to complete, or for maxMemoryPause, whichever is sooner.
+func (m *memoryMonitor) check(iterations int64) {
+	if iterations%memoryCheckInterval != 0 {
+		return
+	}
+	var stats runtime.MemStats
+	m.readStats(&stats)
+	if stats.HeapSys == 0 || float64(stats.HeapInuse)/float64(stats.HeapSys) <= m.threshold {
+		return
+	}
+	timer := time.NewTimer(maxMemoryPause)
+	defer timer.Stop()
+	select {
+	case <-m.collect():
+	case <-timer.C:
+	}
+}
+
+// begin implements the foldObserver interface method.
+func (m *memoryMonitor) begin(vars Activation, id int64) foldObservation {
+	return &memoryCheck{monitor: m}
+}
+
+// partitioned implements the foldObserver interface method. Each partition of a sharded
+// evaluation counts its iterations separately.
+func (m *memoryMonitor) partitioned() foldObserver {
+	return m
+}
+
+// memoryCheck counts the iterations of an evaluation of a comprehension between heap
+// measurements.
+type memoryCheck struct {
+	monitor    *memoryMonitor
+	iterations int64
+}
+
+// next implements the foldObservation interface method.
+func (c *memoryCheck) next() ref.Val {
+	c.iterations++
+	c.monitor.check(c.iterations)
+	return nil
+}
+
+// end implements the foldObservation interface method.
+func (c *memoryCheck) end(iterations int64, shortCircuit bool) {}
+
+// collect starts a garbage collection unless one started by the monitor is already running, and
+// returns a channel which is closed when it completes.
+func (m *memoryMonitor) collect() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.collected != nil {
+		return m.collected
+	}
+	collected := make(chan struct{})
+	m.collected = collected
+	// The collection runs on its own goroutine so that the pause of the comprehension may be
+	// bounded; an unfinished collection continues after the comprehension resumes.
+	go func() {
+		m.gc()
+		m.mu.Lock()
+		m.collected = nil
+		m.mu.Unlock()
+		close(collected)
+	}()
+	return collected
+}
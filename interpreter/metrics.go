@@ -0,0 +1,177 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// MetricsHook receives measurements of program evaluations, so that they may be recorded with any
+// metrics library. The interpreter/prometheus package provides a MetricsHook which records them as
+// Prometheus metrics.
+//
+// The methods are called synchronously during evaluation and may be called concurrently, so
+// implementations should be fast and safe for concurrent use. Implementations which record only
+// some measurements may embed NopMetricsHook.
+type MetricsHook interface {
+	// RecordEval records an evaluation of the program whose expression has the given hash, with
+	// a nil error when the evaluation produced a value, the error value when it produced an
+	// error, and ErrUnknownResult when it produced an unknown value.
+	RecordEval(exprHash uint64, duration time.Duration, err error)
+
+	// RecordComprehension records the number of loop iterations of an evaluation of the
+	// comprehension with the given expression id.
+	RecordComprehension(exprID int64, iterations int)
+
+	// RecordFunctionCall records a call to the named function, which is the mangled function
+	// name for operators, such as `_+_`. The duration includes the evaluation of the arguments.
+	RecordFunctionCall(name string, duration time.Duration)
+}
+
+// ErrUnknownResult is the error passed to MetricsHook.RecordEval for evaluations which produce an
+// unknown value.
+var ErrUnknownResult = errors.New("unknown result")
+
+// NopMetricsHook is a MetricsHook which discards all measurements.
+type NopMetricsHook struct{}
+
+// RecordEval implements the MetricsHook interface method.
+func (NopMetricsHook) RecordEval(exprHash uint64, duration time.Duration, err error) {}
+
+// RecordComprehension implements the MetricsHook interface method.
+func (NopMetricsHook) RecordComprehension(exprID int64, iterations int) {}
+
+// RecordFunctionCall implements the MetricsHook interface method.
+func (NopMetricsHook) RecordFunctionCall(name string, duration time.Duration) {}
+
+// CallCounter is implemented by MetricsHooks which count function calls rather than timing them.
+// Programs planned with WithMetricsHook and such a hook increment the counter of each call instead
+// of calling RecordFunctionCall.
+type CallCounter interface {
+	// CallCounter returns the function which counts a call to the named function. It is called
+	// once for each call node when the program is planned, and the returned function is called
+	// for each evaluation of the node.
+	CallCounter(function string) func()
+}
+
+// MeteredProgram is an Interpretable which reports the duration and outcome of its evaluations to
+// a MetricsHook.
+type MeteredProgram struct {
+	Interpretable
+	hook     MetricsHook
+	exprHash uint64
+}
+
+// NewMeteredProgram returns a MeteredProgram which reports the evaluations of the Interpretable to
+// the hook, identifying the expression by the given hash. A nil hook is a NopMetricsHook.
+func NewMeteredProgram(i Interpretable, hook MetricsHook, exprHash uint64) *MeteredProgram {
+	if hook == nil {
+		hook = NopMetricsHook{}
+	}
+	return &MeteredProgram{Interpretable: i, hook: hook, exprHash: exprHash}
+}
+
+// Eval implements the Interpretable interface method.
+func (p *MeteredProgram) Eval(ctx Activation) ref.Val {
+	start := time.Now()
+	val := p.Interpretable.Eval(ctx)
+	var err error
+	switch v := val.(type) {
+	case types.Unknown:
+		err = ErrUnknownResult
+	case *types.Err:
+		err = v
+	}
+	p.hook.RecordEval(p.exprHash, time.Since(start), err)
+	return val
+}
+
+// Cost implements the Coster interface method.
+func (p *MeteredProgram) Cost() (min, max int64) {
+	return estimateCost(p.Interpretable)
+}
+
+// evalMeteredCall reports the evaluations of a function call to a MetricsHook.
+type evalMeteredCall struct {
+	InterpretableCall
+	hook MetricsHook
+}
+
+// Eval implements the Interpretable interface method.
+func (call *evalMeteredCall) Eval(ctx Activation) ref.Val {
+	start := time.Now()
+	val := call.InterpretableCall.Eval(ctx)
+	call.hook.RecordFunctionCall(call.Function(), time.Since(start))
+	return val
+}
+
+// Cost implements the Coster interface method.
+func (call *evalMeteredCall) Cost() (min, max int64) {
+	return estimateCost(call.InterpretableCall)
+}
+
+// evalHookCountedCall counts the evaluations of a function call with a counter resolved when the
+// program is planned.
+type evalHookCountedCall struct {
+	InterpretableCall
+	count func()
+}
+
+// Eval implements the Interpretable interface method.
+func (call *evalHookCountedCall) Eval(ctx Activation) ref.Val {
+	call.count()
+	return call.InterpretableCall.Eval(ctx)
+}
+
+// Cost implements the Coster interface method.
+func (call *evalHookCountedCall) Cost() (min, max int64) {
+	return estimateCost(call.InterpretableCall)
+}
+
+// foldMetrics reports the iterations of comprehensions to the hook.
+type foldMetrics struct {
+	hook MetricsHook
+}
+
+// begin implements the foldObserver interface method.
+func (f foldMetrics) begin(vars Activation, id int64) foldObservation {
+	return &foldMetricsObservation{hook: f.hook, id: id}
+}
+
+// partitioned implements the foldObserver interface method. The iterations of the partitions of a
+// sharded evaluation are reported as a single evaluation.
+func (f foldMetrics) partitioned() foldObserver {
+	return nil
+}
+
+// foldMetricsObservation reports the iterations of an evaluation of a comprehension to the hook.
+type foldMetricsObservation struct {
+	hook MetricsHook
+	id   int64
+}
+
+// next implements the foldObservation interface method.
+func (o *foldMetricsObservation) next() ref.Val {
+	return nil
+}
+
+// end implements the foldObservation interface method.
+func (o *foldMetricsObservation) end(iterations int64, shortCircuit bool) {
+	o.hook.RecordComprehension(o.id, int(iterations))
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// foldObserver observes the evaluations of a comprehension, such as to interrupt them when the
+// evaluation's context is done, or to report how many iterations they performed.
+//
+// Comprehensions hold a nil observer unless a decorator which observes them is in use, so that
+// unobserved comprehensions do no additional work per iteration.
+type foldObserver interface {
+	// begin is called before the first iteration of an evaluation of the comprehension with the
+	// given id, and returns the observation of that evaluation.
+	begin(vars Activation, id int64) foldObservation
+
+	// partitioned returns the observer of the partitions of a sharded evaluation, or nil when the
+	// observer only observes the evaluation as a whole.
+	partitioned() foldObserver
+}
+
+// foldObservation observes a single evaluation of a comprehension.
+type foldObservation interface {
+	// next is called before each iteration, and returns an error value to interrupt the
+	// evaluation, or nil to continue it.
+	next() ref.Val
+
+	// end is called once the evaluation completes or is interrupted, with the number of iterations
+	// which evaluated the loop step and whether the loop condition ended the evaluation early.
+	end(iterations int64, shortCircuit bool)
+}
+
+// observableFold is implemented by comprehensions to which observers may be attached.
+type observableFold interface {
+	// observe adds the observer to those of the comprehension.
+	observe(foldObserver)
+}
+
+// addFoldObserver combines the current observer, which may be nil, with another observer.
+func addFoldObserver(current, observer foldObserver) foldObserver {
+	switch obs := current.(type) {
+	case nil:
+		return observer
+	case foldObservers:
+		combined := make(foldObservers, len(obs), len(obs)+1)
+		copy(combined, obs)
+		return append(combined, observer)
+	}
+	return foldObservers{current, observer}
+}
+
+// foldObservers observes comprehensions with each of several observers.
+type foldObservers []foldObserver
+
+// begin implements the foldObserver interface method.
+func (observers foldObservers) begin(vars Activation, id int64) foldObservation {
+	obs := make(foldObservations, len(observers))
+	for i, observer := range observers {
+		obs[i] = observer.begin(vars, id)
+	}
+	return obs
+}
+
+// partitioned implements the foldObserver interface method.
+func (observers foldObservers) partitioned() foldObserver {
+	var partitioned foldObserver
+	for _, observer := range observers {
+		if p := observer.partitioned(); p != nil {
+			partitioned = addFoldObserver(partitioned, p)
+		}
+	}
+	return partitioned
+}
+
+// foldObservations observes an evaluation of a comprehension with each of several observations.
+type foldObservations []foldObservation
+
+// next implements the foldObservation interface method, returning the first error value.
+func (obs foldObservations) next() ref.Val {
+	for _, o := range obs {
+		if err := o.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// end implements the foldObservation interface method.
+func (obs foldObservations) end(iterations int64, shortCircuit bool) {
+	for _, o := range obs {
+		o.end(iterations, shortCircuit)
+	}
+}
@@ -31,6 +31,10 @@ import (
 type interpretablePlanner interface {
 	// Plan generates an Interpretable value (or error) from the input proto Expr.
 	Plan(expr *exprpb.Expr) (Interpretable, error)
+
+	// PlanRoot generates the Interpretable for a whole expression, applying the interceptors
+	// which decorators register for the root of the expression.
+	PlanRoot(expr *exprpb.Expr) (Interpretable, error)
 }
 
 // newPlanner creates an interpretablePlanner which references a Dispatcher, TypeProvider,
@@ -114,6 +118,32 @@ func (p *planner) Plan(expr *exprpb.Expr) (Interpretable, error) {
 	return nil, fmt.Errorf("unsupported expr: %v", expr)
 }
 
+// PlanRoot implements the interpretablePlanner interface. Before the expression is planned, each
+// decorator is invoked once with an *evalRoot for the expression, with which decorators that act
+// on the evaluation of the whole expression register their interceptors; the values returned for
+// the evalRoot are ignored. The planned expression is wrapped in the evalRoot when at least one
+// interceptor has been registered.
+//
+// Since the interceptors do not depend on the node at the root of the plan, they apply equally to
+// expressions whose root is an attribute, such as `a.b`, which is planned with the id of `a`.
+func (p *planner) PlanRoot(expr *exprpb.Expr) (Interpretable, error) {
+	root := &evalRoot{id: expr.GetId(), expr: expr}
+	for _, dec := range p.decorators {
+		if _, err := dec(root); err != nil {
+			return nil, err
+		}
+	}
+	plan, err := p.Plan(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(root.interceptors) == 0 {
+		return plan, nil
+	}
+	root.setPlan(plan)
+	return root, nil
+}
+
 // decorate applies the InterpretableDecorator functions to the given Interpretable.
 // Both the Interpretable and error generated by a Plan step are accepted as arguments
 // for convenience.
@@ -319,10 +349,12 @@ func (p *planner) planCallZero(expr *exprpb.Expr,
 		return nil, fmt.Errorf("no such overload: %s()", function)
 	}
 	return &evalZeroArity{
-		id:       expr.Id,
-		function: function,
-		overload: overload,
-		impl:     impl.Function,
+		id:        expr.Id,
+		function:  function,
+		overload:  overload,
+		impl:      impl.Function,
+		transient: impl.Transient,
+		pure:      impl.Pure,
 	}, nil
 }
 
@@ -334,20 +366,25 @@ func (p *planner) planCallUnary(expr *exprpb.Expr,
 	args []Interpretable) (Interpretable, error) {
 	var fn functions.UnaryOp
 	var trait int
+	var transient, pure bool
 	if impl != nil {
 		if impl.Unary == nil {
 			return nil, fmt.Errorf("no such overload: %s(arg)", function)
 		}
 		fn = impl.Unary
 		trait = impl.OperandTrait
+		transient = impl.Transient
+		pure = impl.Pure
 	}
 	return &evalUnary{
-		id:       expr.Id,
-		function: function,
-		overload: overload,
-		arg:      args[0],
-		trait:    trait,
-		impl:     fn,
+		id:        expr.Id,
+		function:  function,
+		overload:  overload,
+		arg:       args[0],
+		trait:     trait,
+		impl:      fn,
+		transient: transient,
+		pure:      pure,
 	}, nil
 }
 
@@ -359,21 +396,26 @@ func (p *planner) planCallBinary(expr *exprpb.Expr,
 	args []Interpretable) (Interpretable, error) {
 	var fn functions.BinaryOp
 	var trait int
+	var transient, pure bool
 	if impl != nil {
 		if impl.Binary == nil {
 			return nil, fmt.Errorf("no such overload: %s(lhs, rhs)", function)
 		}
 		fn = impl.Binary
 		trait = impl.OperandTrait
+		transient = impl.Transient
+		pure = impl.Pure
 	}
 	return &evalBinary{
-		id:       expr.Id,
-		function: function,
-		overload: overload,
-		lhs:      args[0],
-		rhs:      args[1],
-		trait:    trait,
-		impl:     fn,
+		id:        expr.Id,
+		function:  function,
+		overload:  overload,
+		lhs:       args[0],
+		rhs:       args[1],
+		trait:     trait,
+		impl:      fn,
+		transient: transient,
+		pure:      pure,
 	}, nil
 }
 
@@ -385,20 +427,25 @@ func (p *planner) planCallVarArgs(expr *exprpb.Expr,
 	args []Interpretable) (Interpretable, error) {
 	var fn functions.FunctionOp
 	var trait int
+	var transient, pure bool
 	if impl != nil {
 		if impl.Function == nil {
 			return nil, fmt.Errorf("no such overload: %s(...)", function)
 		}
 		fn = impl.Function
 		trait = impl.OperandTrait
+		transient = impl.Transient
+		pure = impl.Pure
 	}
 	return &evalVarArgs{
-		id:       expr.Id,
-		function: function,
-		overload: overload,
-		args:     args,
-		trait:    trait,
-		impl:     fn,
+		id:        expr.Id,
+		function:  function,
+		overload:  overload,
+		args:      args,
+		trait:     trait,
+		impl:      fn,
+		transient: transient,
+		pure:      pure,
 	}, nil
 }
 
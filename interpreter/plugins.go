@@ -0,0 +1,102 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/interpreter/functions"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// FunctionPlugin evaluates calls to a function in place of its standard implementation, such as
+// by offloading the computation to an accelerator.
+type FunctionPlugin interface {
+	// Supports returns true if the plugin can evaluate a call with arguments of the given types.
+	//
+	// The types describe the runtime values of the arguments: list and map arguments have dyn
+	// element types, and message arguments have object types named by their message type.
+	Supports(argTypes []*exprpb.Type) bool
+
+	// Eval evaluates the function on the arguments. A non-nil error becomes the error value
+	// produced by the call.
+	Eval(args []ref.Val) (ref.Val, error)
+}
+
+// pluginImpl returns a function implementation which invokes the plugin when it supports the
+// types of the arguments, and otherwise dispatches the call as the interpreter would have.
+//
+// The standard dispatch invokes impl, if bound, when the first argument has the required trait,
+// and otherwise attempts to invoke the function on a receiver-style first argument.
+func pluginImpl(plugin FunctionPlugin, function, overload string, trait int,
+	impl functions.FunctionOp) functions.FunctionOp {
+	return func(args ...ref.Val) ref.Val {
+		argTypes := make([]*exprpb.Type, len(args))
+		for i, arg := range args {
+			argTypes[i] = valueType(arg)
+		}
+		if plugin.Supports(argTypes) {
+			out, err := plugin.Eval(args)
+			if err != nil {
+				return types.NewErr(err.Error())
+			}
+			return out
+		}
+		if len(args) == 0 {
+			return impl()
+		}
+		if impl != nil && (trait == 0 || args[0].Type().HasTrait(trait)) {
+			return impl(args...)
+		}
+		if args[0].Type().HasTrait(traits.ReceiverType) {
+			return args[0].(traits.Receiver).Receive(function, overload, args[1:])
+		}
+		return types.NewErr("no such overload: %s", function)
+	}
+}
+
+// valueType returns the type of a runtime value as a checked type.
+func valueType(val ref.Val) *exprpb.Type {
+	switch val.Type() {
+	case types.BoolType:
+		return decls.Bool
+	case types.BytesType:
+		return decls.Bytes
+	case types.DoubleType:
+		return decls.Double
+	case types.DurationType:
+		return decls.Duration
+	case types.IntType:
+		return decls.Int
+	case types.ListType:
+		return decls.NewListType(decls.Dyn)
+	case types.MapType:
+		return decls.NewMapType(decls.Dyn, decls.Dyn)
+	case types.NullType:
+		return decls.Null
+	case types.StringType:
+		return decls.String
+	case types.TimestampType:
+		return decls.Timestamp
+	case types.TypeType:
+		return decls.NewTypeType(decls.Dyn)
+	case types.UintType:
+		return decls.Uint
+	}
+	return decls.NewObjectType(val.Type().TypeName())
+}
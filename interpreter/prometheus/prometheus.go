@@ -0,0 +1,208 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prometheus records the interpreter.MetricsHook measurements of CEL program evaluations
+// as Prometheus metrics.
+package prometheus
+
+import (
+	"time"
+
+	"github.com/google/cel-go/interpreter"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Evaluation status label values.
+const (
+	StatusOK      = "ok"
+	StatusError   = "error"
+	StatusUnknown = "unknown"
+)
+
+// evalStatuses holds the status label values, indexed by the evalOK, evalError, and evalUnknown
+// constants.
+var evalStatuses = []string{StatusOK, StatusError, StatusUnknown}
+
+const (
+	evalOK = iota
+	evalError
+	evalUnknown
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the buckets of the evaluation
+// duration histogram. They match the default buckets of the Prometheus client.
+var DefaultDurationBuckets = prom.DefBuckets
+
+// Option configures the Metrics created by NewMetrics.
+type Option func(*metricsConfig)
+
+type metricsConfig struct {
+	registerer prom.Registerer
+	buckets    []float64
+}
+
+// WithRegistry registers the metrics with the given registerer instead of
+// prometheus.DefaultRegisterer.
+func WithRegistry(r prom.Registerer) Option {
+	return func(c *metricsConfig) {
+		c.registerer = r
+	}
+}
+
+// WithDurationBuckets sets the upper bounds, in seconds and in increasing order, of the buckets of
+// the evaluation duration histogram. The default is DefaultDurationBuckets.
+func WithDurationBuckets(buckets ...float64) Option {
+	return func(c *metricsConfig) {
+		c.buckets = buckets
+	}
+}
+
+// Metrics is a prometheus.Collector of the following metrics, each name prefixed by the namespace
+// and an underscore when the namespace is non-empty:
+//
+//     cel_eval_total{status}                counter of program evaluations
+//     cel_eval_duration_seconds{status}     histogram of program evaluation latency
+//     cel_comprehension_iterations_total    counter of comprehension loop iterations
+//     cel_function_calls_total{function}    counter of function calls
+//
+// The status label is one of `ok`, `error`, or `unknown`. Operators are labelled by their
+// mangled function names, such as `_+_`.
+//
+// Programs are instrumented by planning them with the Decorator and wrapping the planned
+// Interpretable with Wrap; only wrapped evaluations are counted and timed. A single Metrics value
+// may be shared by any number of programs evaluated concurrently.
+//
+// Metrics implements interpreter.MetricsHook, and interpreter.CallCounter so that function calls
+// are counted without being timed. The expression hashes and ids passed to the hook methods are
+// not recorded.
+type Metrics struct {
+	// evals and durations hold the metrics of each status, indexed like evalStatuses.
+	evals     [3]prom.Counter
+	durations [3]prom.Observer
+
+	evalVec       *prom.CounterVec
+	durationVec   *prom.HistogramVec
+	iterations    prom.Counter
+	functionCalls *prom.CounterVec
+}
+
+// NewMetrics creates the metrics for the namespace and registers them with
+// prometheus.DefaultRegisterer, or with the registerer given by WithRegistry.
+//
+// If the registerer already holds metrics created by NewMetrics for the namespace, those metrics
+// are returned and the options other than WithRegistry are ignored, so the function may safely be
+// called more than once with the same namespace. Other registration failures, such as a conflict
+// with the metrics of another collector, are returned as errors.
+func NewMetrics(namespace string, opts ...Option) (*Metrics, error) {
+	c := &metricsConfig{registerer: prom.DefaultRegisterer, buckets: DefaultDurationBuckets}
+	for _, opt := range opts {
+		opt(c)
+	}
+	m := &Metrics{
+		evalVec: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "cel_eval_total",
+			Help:      "Number of CEL program evaluations by status.",
+		}, []string{"status"}),
+		durationVec: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Name:      "cel_eval_duration_seconds",
+			Help:      "Latency of CEL program evaluations by status.",
+			Buckets:   c.buckets,
+		}, []string{"status"}),
+		iterations: prom.NewCounter(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "cel_comprehension_iterations_total",
+			Help:      "Number of CEL comprehension loop iterations.",
+		}),
+		functionCalls: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "cel_function_calls_total",
+			Help:      "Number of CEL function calls by function.",
+		}, []string{"function"}),
+	}
+	for i, status := range evalStatuses {
+		m.evals[i] = m.evalVec.WithLabelValues(status)
+		m.durations[i] = m.durationVec.WithLabelValues(status)
+	}
+	if err := c.registerer.Register(m); err != nil {
+		if already, isAlready := err.(prom.AlreadyRegisteredError); isAlready {
+			if existing, isMetrics := already.ExistingCollector.(*Metrics); isMetrics {
+				return existing, nil
+			}
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+// Describe implements the prometheus.Collector interface method.
+func (m *Metrics) Describe(ch chan<- *prom.Desc) {
+	m.evalVec.Describe(ch)
+	m.durationVec.Describe(ch)
+	m.iterations.Describe(ch)
+	m.functionCalls.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface method.
+func (m *Metrics) Collect(ch chan<- prom.Metric) {
+	m.evalVec.Collect(ch)
+	m.durationVec.Collect(ch)
+	m.iterations.Collect(ch)
+	m.functionCalls.Collect(ch)
+}
+
+// Decorator returns an InterpretableDecorator which instruments comprehensions and function calls
+// to update the metrics. The counter of each function call is looked up when the program is
+// planned, so that counting a call is a single atomic update.
+//
+// Function calls are wrapped to count them, so this decorator should follow any decorators which
+// inspect the concrete type of call Interpretables.
+func (m *Metrics) Decorator() interpreter.InterpretableDecorator {
+	return interpreter.WithMetricsHook(m)
+}
+
+// Wrap returns a MeteredProgram which counts and times the evaluations of the Interpretable.
+func (m *Metrics) Wrap(i interpreter.Interpretable) *interpreter.MeteredProgram {
+	return interpreter.NewMeteredProgram(i, m, 0)
+}
+
+// RecordEval implements the interpreter.MetricsHook interface method.
+func (m *Metrics) RecordEval(exprHash uint64, duration time.Duration, err error) {
+	status := evalOK
+	switch {
+	case err == interpreter.ErrUnknownResult:
+		status = evalUnknown
+	case err != nil:
+		status = evalError
+	}
+	m.evals[status].Inc()
+	m.durations[status].Observe(duration.Seconds())
+}
+
+// RecordComprehension implements the interpreter.MetricsHook interface method.
+func (m *Metrics) RecordComprehension(exprID int64, iterations int) {
+	m.iterations.Add(float64(iterations))
+}
+
+// RecordFunctionCall implements the interpreter.MetricsHook interface method.
+func (m *Metrics) RecordFunctionCall(name string, duration time.Duration) {
+	m.functionCalls.WithLabelValues(name).Inc()
+}
+
+// CallCounter implements the interpreter.CallCounter interface method.
+func (m *Metrics) CallCounter(function string) func() {
+	return m.functionCalls.WithLabelValues(function).Inc
+}
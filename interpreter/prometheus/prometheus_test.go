@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/containers"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/interpreter"
+	"github.com/google/cel-go/parser"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prom.NewRegistry()
+	metrics, err := NewMetrics("test", WithRegistry(reg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := NewMetrics("test", WithRegistry(reg)); err != nil || again != metrics {
+		t.Errorf("got %v, %v for a registered namespace, wanted the registered metrics", again, err)
+	}
+	conflict := prom.NewCounter(prom.CounterOpts{Name: "other_cel_eval_total"})
+	if err := reg.Register(conflict); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMetrics("other", WithRegistry(reg)); err == nil {
+		t.Error("got no error for metrics which conflict with another collector")
+	}
+	parsed, errs := parser.Parse(common.NewTextSource(`[1, 2, 3].exists(x, x == 2) && 1 / y == 1`))
+	if len(errs.GetErrors()) != 0 {
+		t.Fatal(errs.ToDisplayString())
+	}
+	typeReg, err := types.NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	interp := interpreter.NewStandardInterpreter(containers.DefaultContainer, typeReg, typeReg,
+		interpreter.NewAttributeFactory(containers.DefaultContainer, typeReg, typeReg))
+	prg, err := interp.NewUncheckedInterpretable(parsed.GetExpr(), metrics.Decorator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped := metrics.Wrap(prg)
+	vars, _ := interpreter.NewActivation(map[string]interface{}{"y": 1})
+	if out := wrapped.Eval(vars); out != types.True {
+		t.Fatalf("got %v, wanted true", out)
+	}
+	vars, _ = interpreter.NewActivation(map[string]interface{}{"y": 0})
+	if out := wrapped.Eval(vars); !types.IsError(out) {
+		t.Fatalf("got %v, wanted an error", out)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&out, family); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{
+		"# TYPE test_cel_eval_total counter\n",
+		`test_cel_eval_total{status="ok"} 1`,
+		`test_cel_eval_total{status="error"} 1`,
+		`test_cel_eval_total{status="unknown"} 0`,
+		"# TYPE test_cel_eval_duration_seconds histogram\n",
+		`test_cel_eval_duration_seconds_bucket{status="ok",le="+Inf"} 1`,
+		`test_cel_eval_duration_seconds_count{status="error"} 1`,
+		// Each evaluation stops exists() after its second element.
+		"test_cel_comprehension_iterations_total 4\n",
+		`test_cel_function_calls_total{function="_/_"} 2`,
+		`test_cel_function_calls_total{function="_==_"} 6`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("got metrics %s, wanted %q", out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"runtime/debug"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// PanicRecoveryOption configures WithPanicRecovery.
+type PanicRecoveryOption func(*panicRecovery)
+
+// PanicLogger receives the panics recovered by WithPanicRecovery, with the id of the root of the
+// expression, the recovered value, and the stack trace of the goroutine which panicked.
+type PanicLogger func(id int64, recovered interface{}, stack []byte)
+
+// WithPanicLogger reports each recovered panic to the logger before the error value is returned.
+func WithPanicLogger(logger PanicLogger) PanicRecoveryOption {
+	return func(r *panicRecovery) {
+		r.logger = logger
+	}
+}
+
+// panicRecovery converts the panics raised while evaluating an expression into error values.
+type panicRecovery struct {
+	logger PanicLogger
+}
+
+func newPanicRecovery(opts ...PanicRecoveryOption) *panicRecovery {
+	r := &panicRecovery{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// intercept evaluates the expression, recovering from any panic on the evaluating goroutine.
+func (r *panicRecovery) intercept(root *evalRoot) rootInterceptor {
+	return func(vars Activation, eval func(Activation) ref.Val) (val ref.Val) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if r.logger != nil {
+					r.logger(root.ID(), rec, debug.Stack())
+				}
+				val = recoverEvalPanic(root.ID(), rec)
+			}
+		}()
+		return eval(vars)
+	}
+}
+
+// recoverEvalPanic converts a value recovered from a panic into an error value wrapping an
+// EvalError.
+func recoverEvalPanic(id int64, r interface{}) ref.Val {
+	return types.WrapErr(EvalError{
+		ID:   id,
+		Code: ErrInternalPanic,
+		Err:  types.NewErr("internal error: %v", r).(*types.Err),
+	})
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// ErrReplay is the error wrapped by the result of an evaluation rejected by WithReplayProtection
+// because an evaluation of the same expression with the same variables has already been seen.
+//
+// The error is available from the Value method of the types.Err result.
+var ErrReplay = errors.New("replayed evaluation")
+
+// NonceStore records the nonces of the evaluations seen by WithReplayProtection.
+//
+// Implementations must be safe for concurrent use, and are typically backed by a store shared
+// between the processes evaluating the expression, with entries expiring after the period in which
+// replays are to be detected.
+type NonceStore interface {
+	// CheckAndStore atomically records the nonce, returning false if it was already recorded.
+	CheckAndStore(nonce string) (bool, error)
+}
+
+// replayGuard records what the decorator has learned about the expression it planned.
+type replayGuard struct {
+	store    NonceStore
+	secret   []byte
+	exprHash [sha256.Size]byte
+
+	mu sync.RWMutex
+	// names holds the sorted candidate names of the variables referenced by the expression.
+	names []string
+}
+
+func newReplayGuard(store NonceStore, secret []byte) *replayGuard {
+	return &replayGuard{store: store, secret: secret}
+}
+
+// setExpr records the hash of the expression being planned.
+func (g *replayGuard) setExpr(expr *exprpb.Expr) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.exprHash = sha256.Sum256([]byte(structuralKey(expr)))
+}
+
+// addNames records variable names referenced by the expression.
+func (g *replayGuard) addNames(names []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, name := range names {
+		i := sort.SearchStrings(g.names, name)
+		if i < len(g.names) && g.names[i] == name {
+			continue
+		}
+		g.names = append(g.names, "")
+		copy(g.names[i+1:], g.names[i:])
+		g.names[i] = name
+	}
+}
+
+// nonce computes HMAC-SHA256(exprHash || activationHash) with the secret, returning false when a
+// variable value cannot be hashed.
+func (g *replayGuard) nonce(vars Activation) (string, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	act := sha256.New()
+	for _, name := range g.names {
+		writeString(act, name)
+		val, found := vars.ResolveName(name)
+		if !found {
+			writeUint(act, 0)
+			continue
+		}
+		writeUint(act, 1)
+		if !hashValue(act, val) {
+			return "", false
+		}
+	}
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write(g.exprHash[:])
+	mac.Write(act.Sum(nil))
+	return hex.EncodeToString(mac.Sum(nil)), true
+}
+
+// check records the nonce, returning an error value when the evaluation is a replay, or cannot be
+// recorded.
+func (g *replayGuard) check(nonce string) ref.Val {
+	fresh, err := g.store.CheckAndStore(nonce)
+	if err != nil {
+		return types.WrapErr(err)
+	}
+	if !fresh {
+		return types.WrapErr(ErrReplay)
+	}
+	return nil
+}
+
+// evalProtected evaluates the expression, returning its result unless the evaluation is a replay.
+// The nonce is only recorded once the evaluation produces a value, so that evaluations which fail
+// may be retried.
+func (g *replayGuard) evalProtected(vars Activation, eval func(Activation) ref.Val) ref.Val {
+	nonce, ok := g.nonce(vars)
+	if !ok {
+		return types.NewErr("replay protection: variable values cannot be hashed")
+	}
+	val := eval(vars)
+	if types.IsUnknownOrError(val) {
+		return val
+	}
+	if rejected := g.check(nonce); rejected != nil {
+		return rejected
+	}
+	return val
+}
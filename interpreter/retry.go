@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// BackoffPolicy determines how long WithRetry waits before retrying a failed function call.
+type BackoffPolicy interface {
+	// Delay returns the time to wait before the given retry, where the first retry is attempt 1.
+	Delay(attempt int) time.Duration
+}
+
+// ExponentialBackoff returns a BackoffPolicy which waits `base` before the first retry and
+// doubles the delay for each subsequent retry.
+func ExponentialBackoff(base time.Duration) BackoffPolicy {
+	return exponentialBackoff(base)
+}
+
+type exponentialBackoff time.Duration
+
+// Delay implements the BackoffPolicy interface method.
+func (b exponentialBackoff) Delay(attempt int) time.Duration {
+	delay := time.Duration(b)
+	for i := 1; i < attempt; i++ {
+		if delay > math.MaxInt64/2 {
+			return math.MaxInt64
+		}
+		delay *= 2
+	}
+	return delay
+}
+
+// retrier calls function implementations until they produce a value other than an error.
+type retrier struct {
+	maxAttempts int
+	backoff     BackoffPolicy
+}
+
+// call invokes the function with the context of the evaluation, retrying while it produces an
+// error, attempts remain, and waiting for the next attempt would not outlast the context. The last
+// error is returned when the retries are exhausted.
+func (r *retrier) call(ctx context.Context, invoke func(context.Context) ref.Val) ref.Val {
+	val := invoke(ctx)
+	for attempt := 1; attempt < r.maxAttempts && types.IsError(val); attempt++ {
+		var delay time.Duration
+		if r.backoff != nil {
+			delay = r.backoff.Delay(attempt)
+		}
+		if deadline, hasDeadline := ctx.Deadline(); hasDeadline && time.Until(deadline) < delay {
+			return val
+		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return val
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return val
+		}
+		val = invoke(ctx)
+	}
+	return val
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// SamplingOption configures WithSampling.
+type SamplingOption func(*sampler)
+
+// WithDeterministicSampling decides whether to evaluate an activation from a hash of the value of
+// the named variable rather than at random, so that activations with the same value of the
+// variable, such as the same request or user id, are either all evaluated or all passed through.
+//
+// Activations in which the variable is absent, or has a value which cannot be hashed such as an
+// error, are evaluated.
+func WithDeterministicSampling(hashKey string) SamplingOption {
+	return func(s *sampler) {
+		s.hashKey = hashKey
+	}
+}
+
+// sampler decides which evaluations of the expression are performed.
+type sampler struct {
+	rate        float64
+	passthrough ref.Val
+	hashKey     string
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newSampler(rate float64, passthrough ref.Val, opts ...SamplingOption) *sampler {
+	var seed [8]byte
+	// The seed only needs to differ between samplers; a failed read leaves it zero.
+	crand.Read(seed[:])
+	s := &sampler{
+		rate:        rate,
+		passthrough: passthrough,
+		rnd:         rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(seed[:])))),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// sampled reports whether the evaluation with the activation should be performed.
+func (s *sampler) sampled(vars Activation) bool {
+	if s.hashKey == "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.rnd.Float64() < s.rate
+	}
+	val, found := vars.ResolveName(s.hashKey)
+	if !found {
+		return true
+	}
+	h := sha256.New()
+	if !hashValue(h, val) {
+		return true
+	}
+	// The top 53 bits of the hash give a uniformly distributed fraction in [0, 1).
+	sum := h.Sum(nil)
+	return float64(binary.BigEndian.Uint64(sum)>>11)/(1<<53) < s.rate
+}
+
+// evalSampled evaluates the expression when the evaluation is sampled, and otherwise returns the
+// passthrough value.
+func (s *sampler) evalSampled(vars Activation, eval func(Activation) ref.Val) ref.Val {
+	if !s.sampled(vars) {
+		return s.passthrough
+	}
+	return eval(vars)
+}
@@ -0,0 +1,240 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"sync"
+
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+)
+
+// DefaultShardThreshold is the list size above which WithSharding partitions comprehensions when
+// no ShardThreshold option is supplied.
+const DefaultShardThreshold = 1000
+
+// ShardingOption configures WithSharding.
+type ShardingOption func(*foldSharding)
+
+// ShardThreshold sets the list size above which comprehensions are partitioned. Comprehensions
+// over lists of at most `n` elements are evaluated on the calling goroutine.
+func ShardThreshold(n int) ShardingOption {
+	return func(s *foldSharding) {
+		s.threshold = n
+	}
+}
+
+// foldSharding evaluates map and filter comprehensions over large lists in partitions.
+type foldSharding struct {
+	shards    int
+	threshold int
+	// slots bounds the number of goroutines evaluating partitions across all evaluations.
+	slots chan struct{}
+}
+
+func newFoldSharding(shards int, opts ...ShardingOption) *foldSharding {
+	s := &foldSharding{
+		shards:    shards,
+		threshold: DefaultShardThreshold,
+		slots:     make(chan struct{}, shards),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// evalShardedFold evaluates a map or filter comprehension over large lists in partitions, and
+// over other ranges as an evalFold.
+type evalShardedFold struct {
+	*evalFold
+	sharding *foldSharding
+}
+
+// Eval implements the Interpretable interface method.
+func (fold *evalShardedFold) Eval(ctx Activation) ref.Val {
+	foldRange := fold.iterRange.Eval(ctx)
+	if l, isList := foldRange.(traits.Lister); isList && fold.sharding.applies(l) {
+		return fold.sharding.eval(fold.evalFold, ctx, l)
+	}
+	if !foldRange.Type().HasTrait(traits.IterableType) {
+		return types.ValOrErr(foldRange, "got '%T', expected iterable type", foldRange)
+	}
+	return fold.evalRange(ctx, foldRange)
+}
+
+// applies reports whether the comprehension range is large enough to be partitioned.
+func (s *foldSharding) applies(l traits.Lister) bool {
+	size, isInt := l.Size().(types.Int)
+	return isInt && int(size) > s.threshold
+}
+
+// eval evaluates the comprehension over each partition of the list and concatenates the results
+// in the order of the partitions.
+//
+// Each partition is evaluated by a copy of the fold which starts from the empty accumulator, so
+// the concatenation equals the result of evaluating the fold over the whole list. The calling
+// goroutine evaluates the last partition, and any partition for which no goroutine is available.
+func (s *foldSharding) eval(fold *evalFold, ctx Activation, l traits.Lister) ref.Val {
+	var obs foldObservation
+	var partitioned foldObserver
+	if fold.observer != nil {
+		obs = fold.observer.begin(ctx, fold.id)
+		partitioned = fold.observer.partitioned()
+	}
+	size := int(l.Size().(types.Int))
+	shards := s.shards
+	if shards > size {
+		shards = size
+	}
+	results := make([]ref.Val, shards)
+	var wg sync.WaitGroup
+	for i := 0; i < shards; i++ {
+		lo, hi := i*size/shards, (i+1)*size/shards
+		elems := make([]ref.Val, hi-lo)
+		for j := range elems {
+			elems[j] = l.Get(types.Int(lo + j))
+		}
+		shard := *fold
+		shard.observer = partitioned
+		shardRange := types.NewRefValList(types.DefaultTypeAdapter, elems)
+		idx := i
+		if idx == shards-1 || !s.acquire() {
+			results[idx] = shard.evalRange(ctx, shardRange)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.release()
+			defer func() {
+				if r := recover(); r != nil {
+					results[idx] = recoverEvalPanic(fold.id, r)
+				}
+			}()
+			results[idx] = shard.evalRange(ctx, shardRange)
+		}()
+	}
+	wg.Wait()
+
+	res := mergeShards(results, size)
+	if obs != nil {
+		obs.end(int64(size), false)
+	}
+	return res
+}
+
+func (s *foldSharding) acquire() bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *foldSharding) release() {
+	<-s.slots
+}
+
+// mergeShards concatenates the lists produced by the partitions. As in sequential evaluation,
+// where an error or unknown accumulator is carried through the remaining iterations, the first
+// partition which does not produce a list determines the result.
+func mergeShards(results []ref.Val, size int) ref.Val {
+	merged := make([]ref.Val, 0, size)
+	for _, res := range results {
+		l, isList := res.(traits.Lister)
+		if !isList {
+			return res
+		}
+		for it := l.Iterator(); it.HasNext() == types.True; {
+			merged = append(merged, it.Next())
+		}
+	}
+	return types.NewRefValList(types.DefaultTypeAdapter, merged)
+}
+
+// isShardableFold reports whether the fold has the shape produced by the map and filter macros:
+// an accumulator which starts as an empty list, a loop condition which is always true, a step
+// which appends a single element to the accumulator, optionally guarded by a predicate, and a
+// result which is the accumulator.
+//
+// Only such folds merge correctly when partitioned. The all, exists, and exists_one macros and
+// hand-written folds do not have this shape and are evaluated sequentially.
+func isShardableFold(fold *evalFold) bool {
+	cond, isConst := fold.cond.(InterpretableConst)
+	if !isConst || cond.Value() != types.True {
+		return false
+	}
+	if !isListOfSize(fold.accu, 0) || !isAccuRef(fold.result, fold.accuVar) {
+		return false
+	}
+	if isAppendStep(fold.step, fold.accuVar) {
+		return true
+	}
+	step, isAttr := fold.step.(InterpretableAttribute)
+	if !isAttr {
+		return false
+	}
+	guard, isCond := step.Attr().(*conditionalAttribute)
+	if !isCond {
+		return false
+	}
+	truthy, isRel := guard.truthy.(*relativeAttribute)
+	return isRel && len(truthy.qualifiers) == 0 &&
+		isAppendStep(truthy.operand, fold.accuVar) &&
+		isAccuAttr(guard.falsy, fold.accuVar)
+}
+
+// isAppendStep reports whether the node computes `accu + [elem]`.
+func isAppendStep(i Interpretable, accuVar string) bool {
+	add, isBinary := i.(*evalBinary)
+	return isBinary && add.function == operators.Add &&
+		isAccuRef(add.lhs, accuVar) && isListOfSize(add.rhs, 1)
+}
+
+func isListOfSize(i Interpretable, size int) bool {
+	switch l := i.(type) {
+	case *evalList:
+		return len(l.elems) == size
+	case InterpretableConst:
+		lister, isList := l.Value().(traits.Lister)
+		return isList && lister.Size() == types.Int(size)
+	}
+	return false
+}
+
+func isAccuRef(i Interpretable, accuVar string) bool {
+	attr, isAttr := i.(InterpretableAttribute)
+	return isAttr && isAccuAttr(attr.Attr(), accuVar)
+}
+
+// isAccuAttr reports whether the attribute refers to the unqualified accumulator variable.
+func isAccuAttr(attr Attribute, accuVar string) bool {
+	if maybe, isMaybe := attr.(*maybeAttribute); isMaybe {
+		if len(maybe.attrs) != 1 {
+			return false
+		}
+		attr = maybe.attrs[0]
+	}
+	ns, isNs := attr.(NamespacedAttribute)
+	if !isNs || len(ns.Qualifiers()) != 0 {
+		return false
+	}
+	names := ns.CandidateVariableNames()
+	return len(names) != 0 && names[len(names)-1] == accuVar
+}
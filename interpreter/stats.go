@@ -0,0 +1,190 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Stats counts the work performed by the interpreter while evaluating programs.
+//
+// Programs are instrumented by planning them with the Decorator, and their evaluations are counted
+// with CountEval, as cel.StatProgram does. A single Stats value may be shared by any number of
+// programs, and programs may be evaluated concurrently. All counters are updated atomically, so
+// collecting stats never blocks an evaluation.
+type Stats struct {
+	// The counters are declared first to keep them 64-bit aligned for atomic access.
+	totalEvals         int64
+	comprehensionEvals int64
+	shortCircuits      int64
+	errorReturns       int64
+	unknownReturns     int64
+
+	// funcMu guards the function counter map, which is only modified while programs are planned.
+	// The counters themselves are updated atomically.
+	funcMu        sync.Mutex
+	functionCalls map[string]*int64
+}
+
+// StatsSnapshot is a copy of the counters within a Stats value.
+type StatsSnapshot struct {
+	// TotalEvals is the number of evaluations of wrapped programs.
+	TotalEvals int64
+
+	// ComprehensionEvals is the number of comprehension evaluations.
+	ComprehensionEvals int64
+
+	// ShortCircuits is the number of comprehensions which stopped before exhausting their range,
+	// plus the number of `&&` and `||` operators which did not evaluate their right operand.
+	ShortCircuits int64
+
+	// ErrorReturns is the number of evaluations of wrapped programs which returned an error.
+	ErrorReturns int64
+
+	// UnknownReturns is the number of evaluations of wrapped programs which returned an unknown.
+	UnknownReturns int64
+
+	// FunctionCalls is the number of calls to each function, keyed by function name. Operators
+	// are keyed by their mangled names, such as `_+_`.
+	FunctionCalls map[string]int64
+}
+
+// NewStats creates a Stats value with all counters set to zero.
+func NewStats() *Stats {
+	return &Stats{functionCalls: map[string]*int64{}}
+}
+
+// Decorator returns an InterpretableDecorator which instruments comprehensions, logical
+// operators, and function calls to update the stats.
+//
+// Function calls are wrapped to count them, so this decorator should follow any decorators which
+// inspect the concrete type of call Interpretables.
+func (s *Stats) Decorator() InterpretableDecorator {
+	return decStats(s)
+}
+
+// CountEval counts an evaluation of a program and its outcome.
+func (s *Stats) CountEval(val ref.Val) {
+	atomic.AddInt64(&s.totalEvals, 1)
+	switch {
+	case types.IsUnknown(val):
+		atomic.AddInt64(&s.unknownReturns, 1)
+	case types.IsError(val):
+		atomic.AddInt64(&s.errorReturns, 1)
+	}
+}
+
+// Reset sets all counters to zero.
+func (s *Stats) Reset() {
+	atomic.StoreInt64(&s.totalEvals, 0)
+	atomic.StoreInt64(&s.comprehensionEvals, 0)
+	atomic.StoreInt64(&s.shortCircuits, 0)
+	atomic.StoreInt64(&s.errorReturns, 0)
+	atomic.StoreInt64(&s.unknownReturns, 0)
+	s.funcMu.Lock()
+	defer s.funcMu.Unlock()
+	for _, c := range s.functionCalls {
+		atomic.StoreInt64(c, 0)
+	}
+}
+
+// Snapshot returns a copy of the counters.
+//
+// Each counter is read atomically, but the counters are not read at the same instant, so a copy
+// taken while programs are being evaluated may reflect part of an evaluation.
+func (s *Stats) Snapshot() StatsSnapshot {
+	snap := StatsSnapshot{
+		TotalEvals:         atomic.LoadInt64(&s.totalEvals),
+		ComprehensionEvals: atomic.LoadInt64(&s.comprehensionEvals),
+		ShortCircuits:      atomic.LoadInt64(&s.shortCircuits),
+		ErrorReturns:       atomic.LoadInt64(&s.errorReturns),
+		UnknownReturns:     atomic.LoadInt64(&s.unknownReturns),
+		FunctionCalls:      map[string]int64{},
+	}
+	s.funcMu.Lock()
+	defer s.funcMu.Unlock()
+	for fn, c := range s.functionCalls {
+		if n := atomic.LoadInt64(c); n != 0 {
+			snap.FunctionCalls[fn] = n
+		}
+	}
+	return snap
+}
+
+// functionCounter returns the counter for calls to the named function, creating it if needed.
+func (s *Stats) functionCounter(function string) *int64 {
+	s.funcMu.Lock()
+	defer s.funcMu.Unlock()
+	c, found := s.functionCalls[function]
+	if !found {
+		c = new(int64)
+		s.functionCalls[function] = c
+	}
+	return c
+}
+
+// foldStats counts the evaluations of comprehensions within the stats.
+type foldStats struct {
+	stats *Stats
+}
+
+// begin implements the foldObserver interface method.
+func (f foldStats) begin(vars Activation, id int64) foldObservation {
+	return f
+}
+
+// partitioned implements the foldObserver interface method. The partitions of a sharded
+// evaluation are counted as a single evaluation.
+func (f foldStats) partitioned() foldObserver {
+	return nil
+}
+
+// next implements the foldObservation interface method.
+func (f foldStats) next() ref.Val {
+	return nil
+}
+
+// end implements the foldObservation interface method.
+func (f foldStats) end(iterations int64, shortCircuit bool) {
+	atomic.AddInt64(&f.stats.comprehensionEvals, 1)
+	if shortCircuit {
+		atomic.AddInt64(&f.stats.shortCircuits, 1)
+	}
+}
+
+func (s *Stats) shortCircuit() {
+	atomic.AddInt64(&s.shortCircuits, 1)
+}
+
+// evalCountedCall counts the evaluations of a function call.
+type evalCountedCall struct {
+	InterpretableCall
+	count *int64
+}
+
+// Eval implements the Interpretable interface method.
+func (call *evalCountedCall) Eval(ctx Activation) ref.Val {
+	atomic.AddInt64(call.count, 1)
+	return call.InterpretableCall.Eval(ctx)
+}
+
+// Cost implements the Coster interface method.
+func (call *evalCountedCall) Cost() (min, max int64) {
+	return estimateCost(call.InterpretableCall)
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interpreter
+
+import (
+	"time"
+
+	"github.com/google/cel-go/common/types/ref"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attribute keys set by WithOTelTracing.
+const (
+	// AttrExpressionID is the id of the expression node a span or span event describes.
+	AttrExpressionID = attribute.Key("cel.expression.id")
+
+	// AttrExpressionEvalTime is the time, in microseconds, taken to evaluate a slow expression.
+	AttrExpressionEvalTime = attribute.Key("cel.expression.eval_time_us")
+
+	// AttrComprehensionIterations is the number of iterations for which a comprehension evaluated
+	// its loop step.
+	AttrComprehensionIterations = attribute.Key("cel.comprehension.iterations")
+
+	// AttrComprehensionShortCircuit indicates whether a comprehension stopped before exhausting
+	// its range because its loop condition became false.
+	AttrComprehensionShortCircuit = attribute.Key("cel.comprehension.short_circuit")
+)
+
+// SlowExpressionEvent is the name of the span event recorded by WithOTelTracing for each function
+// call which takes longer than the threshold to evaluate.
+const SlowExpressionEvent = "cel.expression.slow"
+
+// DefaultTracingThreshold is the evaluation time above which function calls are annotated on the
+// parent span when WithOTelTracing is given a non-positive threshold.
+const DefaultTracingThreshold = time.Millisecond
+
+// foldTracer creates a span for each evaluation of a comprehension.
+type foldTracer struct {
+	tracer trace.Tracer
+}
+
+// begin implements the foldObserver interface method, creating the span for the comprehension
+// with the given id as a child of the span within the context of the evaluation.
+func (t *foldTracer) begin(vars Activation, id int64) foldObservation {
+	_, span := t.tracer.Start(evaluationContext(vars), "cel.comprehension",
+		trace.WithAttributes(AttrExpressionID.Int64(id)))
+	return foldSpan{span: span}
+}
+
+// partitioned implements the foldObserver interface method. The partitions of a sharded
+// evaluation are covered by the span of the evaluation as a whole.
+func (t *foldTracer) partitioned() foldObserver {
+	return nil
+}
+
+// foldSpan is the span of an evaluation of a comprehension.
+type foldSpan struct {
+	span trace.Span
+}
+
+// next implements the foldObservation interface method.
+func (s foldSpan) next() ref.Val {
+	return nil
+}
+
+// end implements the foldObservation interface method, annotating the span with the
+// comprehension's iteration statistics and ending it.
+func (s foldSpan) end(iterations int64, shortCircuit bool) {
+	s.span.SetAttributes(
+		AttrComprehensionIterations.Int64(iterations),
+		AttrComprehensionShortCircuit.Bool(shortCircuit))
+	s.span.End()
+}
+
+// evalTimedCall records an event on the span within the context of the evaluation when a function
+// call takes longer than the threshold to evaluate.
+type evalTimedCall struct {
+	InterpretableCall
+	threshold time.Duration
+}
+
+// Eval implements the Interpretable interface method.
+func (call *evalTimedCall) Eval(ctx Activation) ref.Val {
+	start := time.Now()
+	val := call.InterpretableCall.Eval(ctx)
+	if elapsed := time.Since(start); elapsed > call.threshold {
+		trace.SpanFromContext(evaluationContext(ctx)).AddEvent(SlowExpressionEvent,
+			trace.WithAttributes(
+				AttrExpressionID.Int64(call.ID()),
+				AttrExpressionEvalTime.Int64(int64(elapsed/time.Microsecond))))
+	}
+	return val
+}
+
+// Cost implements the Coster interface method.
+func (call *evalTimedCall) Cost() (min, max int64) {
+	return estimateCost(call.InterpretableCall)
+}
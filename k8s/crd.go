@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The types within this file mirror the subset of the apiextensions.k8s.io/v1 API which is
+// relevant to type-checking CEL expressions. The field names and JSON tags match those of the
+// k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1 package so that the JSON form of a
+// CustomResourceDefinition may be decoded directly into these types, without introducing a
+// dependency on the Kubernetes client libraries.
+
+// CustomResourceDefinition describes a Kubernetes custom resource.
+type CustomResourceDefinition struct {
+	Spec CustomResourceDefinitionSpec `json:"spec"`
+}
+
+// CustomResourceDefinitionSpec describes the names and versions of a custom resource.
+type CustomResourceDefinitionSpec struct {
+	Group    string                            `json:"group"`
+	Names    CustomResourceDefinitionNames     `json:"names"`
+	Versions []CustomResourceDefinitionVersion `json:"versions"`
+}
+
+// CustomResourceDefinitionNames describes the names of a custom resource.
+type CustomResourceDefinitionNames struct {
+	Kind string `json:"kind"`
+}
+
+// CustomResourceDefinitionVersion describes a version of a custom resource.
+type CustomResourceDefinitionVersion struct {
+	Name   string                    `json:"name"`
+	Schema *CustomResourceValidation `json:"schema,omitempty"`
+}
+
+// CustomResourceValidation holds the schema of a custom resource version.
+type CustomResourceValidation struct {
+	OpenAPIV3Schema *JSONSchemaProps `json:"openAPIV3Schema,omitempty"`
+}
+
+// JSONSchemaProps is an OpenAPI v3 schema with the Kubernetes structural schema extensions.
+type JSONSchemaProps struct {
+	Type                   string                     `json:"type,omitempty"`
+	Format                 string                     `json:"format,omitempty"`
+	Properties             map[string]JSONSchemaProps `json:"properties,omitempty"`
+	Items                  *JSONSchemaProps           `json:"items,omitempty"`
+	AdditionalProperties   *JSONSchemaPropsOrBool     `json:"additionalProperties,omitempty"`
+	XPreserveUnknownFields *bool                      `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	XIntOrString           bool                       `json:"x-kubernetes-int-or-string,omitempty"`
+	XListMapKeys           []string                   `json:"x-kubernetes-list-map-keys,omitempty"`
+	XListType              *string                    `json:"x-kubernetes-list-type,omitempty"`
+}
+
+// JSONSchemaPropsOrBool is the value of the additionalProperties keyword, which is either a
+// boolean or a schema.
+type JSONSchemaPropsOrBool struct {
+	Allows bool
+	Schema *JSONSchemaProps
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface method.
+func (s *JSONSchemaPropsOrBool) UnmarshalJSON(data []byte) error {
+	var allows bool
+	if err := json.Unmarshal(data, &allows); err == nil {
+		*s = JSONSchemaPropsOrBool{Allows: allows}
+		return nil
+	}
+	var schema JSONSchemaProps
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return fmt.Errorf("additionalProperties must be a boolean or a schema: %v", err)
+	}
+	*s = JSONSchemaPropsOrBool{Allows: true, Schema: &schema}
+	return nil
+}
+
+// ParseCRD decodes the JSON form of a CustomResourceDefinition.
+func ParseCRD(data []byte) (*CustomResourceDefinition, error) {
+	crd := &CustomResourceDefinition{}
+	if err := json.Unmarshal(data, crd); err != nil {
+		return nil, err
+	}
+	return crd, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package k8s provides support for type-checking CEL expressions against Kubernetes custom
+// resources.
+package k8s
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// NewCRDTypeProvider returns a ref.TypeProvider which describes the OpenAPI v3 schemas of each
+// version of the custom resource as object types.
+//
+// The root type of each version is named `<group>.<version>.<kind>`, e.g.
+// `stable.example.com.v1.CronTab`, and nested object schemas are named by appending the property
+// path to the root type name, e.g. `stable.example.com.v1.CronTab.spec`. Schema types map to CEL
+// types as follows:
+//
+//   - `integer` to `int`, `number` to `double`, `string` to `string`, and `boolean` to `bool`.
+//   - `array` to `list(T)`, or to `map(string, T)` when `x-kubernetes-list-type` is `map`.
+//   - `object` with properties to an object type, and with `additionalProperties` to
+//     `map(string, T)`.
+//   - `x-kubernetes-preserve-unknown-fields`, `x-kubernetes-int-or-string`, and untyped schemas
+//     to `dyn`.
+//
+// Custom resource values are expected to be supplied to evaluation as JSON-like maps and lists.
+// Type names which are not defined by the custom resource are resolved against the standard
+// type registry.
+func NewCRDTypeProvider(crd *CustomResourceDefinition) (ref.TypeProvider, error) {
+	if crd == nil {
+		return nil, errors.New("custom resource definition must be non-nil")
+	}
+	spec := crd.Spec
+	if spec.Group == "" || spec.Names.Kind == "" {
+		return nil, errors.New("custom resource definition must specify a group and kind")
+	}
+	reg, err := types.NewRegistry()
+	if err != nil {
+		return nil, err
+	}
+	p := &crdTypeProvider{
+		TypeProvider: reg,
+		objects:      make(map[string]map[string]*exprpb.Type),
+	}
+	for _, v := range spec.Versions {
+		if v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+			continue
+		}
+		name := fmt.Sprintf("%s.%s.%s", spec.Group, v.Name, spec.Names.Kind)
+		p.declareSchema(name, v.Schema.OpenAPIV3Schema)
+	}
+	return p, nil
+}
+
+// crdTypeProvider resolves the object types declared within a custom resource definition and
+// delegates all other lookups to the embedded ref.TypeProvider.
+type crdTypeProvider struct {
+	ref.TypeProvider
+	// objects maps object type names to their field types.
+	objects map[string]map[string]*exprpb.Type
+}
+
+// FindType implements the ref.TypeProvider interface method.
+func (p *crdTypeProvider) FindType(typeName string) (*exprpb.Type, bool) {
+	if _, found := p.objects[typeName]; found {
+		return decls.NewTypeType(decls.NewObjectType(typeName)), true
+	}
+	return p.TypeProvider.FindType(typeName)
+}
+
+// FindFieldType implements the ref.TypeProvider interface method.
+//
+// The field type does not provide IsSet or GetFrom functions, so field selection and presence
+// tests are performed against the map representation of the custom resource.
+func (p *crdTypeProvider) FindFieldType(messageType string,
+	fieldName string) (*ref.FieldType, bool) {
+	fields, found := p.objects[messageType]
+	if !found {
+		return p.TypeProvider.FindFieldType(messageType, fieldName)
+	}
+	t, found := fields[fieldName]
+	if !found {
+		return nil, false
+	}
+	return &ref.FieldType{Type: t, SupportsPresence: true}, true
+}
+
+// NewValue implements the ref.TypeProvider interface method.
+func (p *crdTypeProvider) NewValue(typeName string, fields map[string]ref.Val) ref.Val {
+	if _, found := p.objects[typeName]; found {
+		return types.NewErr("custom resource types may not be constructed: %s", typeName)
+	}
+	return p.TypeProvider.NewValue(typeName, fields)
+}
+
+// declareSchema records the object types within the schema, using the given name for the
+// schema itself should it be an object with properties, and returns the CEL type of the schema.
+func (p *crdTypeProvider) declareSchema(name string, s *JSONSchemaProps) *exprpb.Type {
+	if s.XPreserveUnknownFields != nil && *s.XPreserveUnknownFields || s.XIntOrString {
+		return decls.Dyn
+	}
+	switch s.Type {
+	case "boolean":
+		return decls.Bool
+	case "integer":
+		return decls.Int
+	case "number":
+		return decls.Double
+	case "string":
+		return decls.String
+	case "array":
+		elem := decls.Dyn
+		if s.Items != nil {
+			elem = p.declareSchema(name+".@items", s.Items)
+		}
+		if s.XListType != nil && *s.XListType == "map" {
+			return decls.NewMapType(decls.String, elem)
+		}
+		return decls.NewListType(elem)
+	case "object":
+		if len(s.Properties) != 0 {
+			fields := make(map[string]*exprpb.Type, len(s.Properties))
+			for field, prop := range s.Properties {
+				prop := prop
+				fields[field] = p.declareSchema(name+"."+field, &prop)
+			}
+			p.objects[name] = fields
+			return decls.NewObjectType(name)
+		}
+		if ap := s.AdditionalProperties; ap != nil && ap.Schema != nil {
+			return decls.NewMapType(decls.String, p.declareSchema(name+".@values", ap.Schema))
+		}
+		return decls.NewMapType(decls.String, decls.Dyn)
+	}
+	return decls.Dyn
+}
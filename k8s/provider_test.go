@@ -0,0 +1,179 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+const cronTabCRD = `{
+  "apiVersion": "apiextensions.k8s.io/v1",
+  "kind": "CustomResourceDefinition",
+  "metadata": {"name": "crontabs.stable.example.com"},
+  "spec": {
+    "group": "stable.example.com",
+    "names": {"kind": "CronTab", "plural": "crontabs"},
+    "scope": "Namespaced",
+    "versions": [{
+      "name": "v1",
+      "served": true,
+      "storage": true,
+      "schema": {
+        "openAPIV3Schema": {
+          "type": "object",
+          "properties": {
+            "spec": {
+              "type": "object",
+              "properties": {
+                "cronSpec": {"type": "string"},
+                "image": {"type": "string"},
+                "replicas": {"type": "integer"},
+                "ratio": {"type": "number"},
+                "paused": {"type": "boolean"},
+                "port": {"x-kubernetes-int-or-string": true},
+                "labels": {
+                  "type": "object",
+                  "additionalProperties": {"type": "string"}
+                },
+                "args": {"type": "array", "items": {"type": "string"}},
+                "containers": {
+                  "type": "array",
+                  "x-kubernetes-list-type": "map",
+                  "x-kubernetes-list-map-keys": ["name"],
+                  "items": {
+                    "type": "object",
+                    "properties": {
+                      "name": {"type": "string"},
+                      "cpu": {"type": "integer"}
+                    }
+                  }
+                },
+                "extra": {
+                  "type": "object",
+                  "x-kubernetes-preserve-unknown-fields": true
+                }
+              }
+            }
+          }
+        }
+      }
+    }]
+  }
+}`
+
+func TestCRDTypeProvider(t *testing.T) {
+	crd, err := ParseCRD([]byte(cronTabCRD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewCRDTypeProvider(crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := "stable.example.com.v1.CronTab.spec"
+	if _, found := p.FindType("stable.example.com.v1.CronTab"); !found {
+		t.Error("FindType() did not find the root type")
+	}
+	if _, found := p.FindType("google.protobuf.Duration"); !found {
+		t.Error("FindType() did not find a well-known type")
+	}
+	tests := []struct {
+		field string
+		want  *exprpb.Type
+	}{
+		{field: "cronSpec", want: decls.String},
+		{field: "replicas", want: decls.Int},
+		{field: "ratio", want: decls.Double},
+		{field: "paused", want: decls.Bool},
+		{field: "port", want: decls.Dyn},
+		{field: "labels", want: decls.NewMapType(decls.String, decls.String)},
+		{field: "args", want: decls.NewListType(decls.String)},
+		{
+			field: "containers",
+			want:  decls.NewMapType(decls.String, decls.NewObjectType(spec+".containers.@items")),
+		},
+		{field: "extra", want: decls.Dyn},
+	}
+	for _, tc := range tests {
+		ft, found := p.FindFieldType(spec, tc.field)
+		if !found {
+			t.Errorf("FindFieldType(%q) not found", tc.field)
+			continue
+		}
+		if !proto.Equal(ft.Type, tc.want) {
+			t.Errorf("FindFieldType(%q) got %v, wanted %v", tc.field, ft.Type, tc.want)
+		}
+	}
+	if _, found := p.FindFieldType(spec, "missing"); found {
+		t.Error("FindFieldType() found an undeclared field")
+	}
+}
+
+func TestCRDTypeProvider_Eval(t *testing.T) {
+	crd, err := ParseCRD([]byte(cronTabCRD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewCRDTypeProvider(crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := cel.NewEnv(
+		cel.CustomTypeProvider(p),
+		cel.Declarations(
+			decls.NewVar("self", decls.NewObjectType("stable.example.com.v1.CronTab"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(
+		`self.spec.replicas > 1 && self.spec.cronSpec.startsWith('*') && !has(self.spec.paused)`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	if !proto.Equal(ast.ResultType(), decls.Bool) {
+		t.Errorf("got result type %v, wanted bool", ast.ResultType())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := prg.Eval(map[string]interface{}{
+		"self": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"cronSpec": "* * * * */5",
+				"replicas": 3,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != types.True {
+		t.Errorf("got %v, wanted true", out)
+	}
+
+	_, iss = env.Compile(`self.spec.replicas == 'three'`)
+	if iss.Err() == nil {
+		t.Error("got no error comparing an integer field to a string")
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/containers"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/parser"
+
+	"google.golang.org/protobuf/proto"
+
+	proto3pb "github.com/google/cel-go/test/proto3pb"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		expr string
+		out  string
+	}{
+		{expr: `x == 1 && y > 2.5`, out: `AND(EQ(x,1),GT(y,2.5))`},
+		{expr: `uint(-x) + 2u == 3u ? {true: false} : {}`,
+			out: `COND(EQ(ADD(uint(NEG(x)),2u),3u),{true:false},{})`},
+		{expr: `"a\"b" + 'c\n' == string(b"\xff\x00")`,
+			out: `EQ(ADD("a\"b","c\n"),string(b"\xff\x00"))`},
+		{expr: `[1.0, -2.0, 1e100, -9223372036854775808]`,
+			out: `[1.0,-2.0,1e+100,-9223372036854775808]`},
+		{expr: `{'k': m.f}['k'] in m && has(m.g)`,
+			out: `AND(IN(INDEX({"k":#sel(m,f)},"k"),m),#has(m,g))`},
+		{expr: `'abc'.size() + size([])`, out: `ADD(size@("abc"),size([]))`},
+		{expr: `TestAllTypes{single_int64: 1}.single_int64 != 0 || ns.z`,
+			out: `OR(NE(#sel(.google.expr.proto3.test.TestAllTypes{single_int64:1},single_int64),0),` +
+				`.google.expr.proto3.test.ns.z)`},
+		{expr: `[1].all(i, i > 0)`,
+			out: `#fold(i,[1],__result__,true,NOT_STRICTLY_FALSE(__result__),` +
+				`AND(__result__,GT(i,0)),__result__)`},
+		{expr: `AND(1)`, out: "`AND`(1)"},
+	}
+	env := newEnv(t)
+	for _, tst := range tests {
+		tc := tst
+		checked := check(t, env, tc.expr)
+		out := Marshal(checked)
+		if out != tc.out {
+			t.Errorf("Marshal(%s) got %s, wanted %s", tc.expr, out, tc.out)
+			continue
+		}
+		// The roundtrip preserves the text and the type of the expression.
+		rt, err := Unmarshal(out, newEnv(t))
+		if err != nil {
+			t.Errorf("Unmarshal(%s) failed: %v", out, err)
+			continue
+		}
+		if got := Marshal(rt); got != out {
+			t.Errorf("Marshal(Unmarshal(%s)) got %s", out, got)
+		}
+		want := checked.GetTypeMap()[checked.GetExpr().GetId()]
+		if got := rt.GetTypeMap()[rt.GetExpr().GetId()]; !proto.Equal(got, want) {
+			t.Errorf("Unmarshal(%s) got type %v, wanted %v", out, got, want)
+		}
+	}
+}
+
+func TestParse_Constants(t *testing.T) {
+	for _, s := range []string{
+		`null`, `#NaN`, `#+Inf`, `#-Inf`, `-0.0`, `18446744073709551615u`, `b""`,
+		`#duration(-5,-100)`, `#timestamp(1600000000,5)`,
+	} {
+		parsed, err := parse(s)
+		if err != nil {
+			t.Errorf("parse(%s) failed: %v", s, err)
+			continue
+		}
+		if got := Marshal(&exprpb.CheckedExpr{Expr: parsed.GetExpr()}); got != s {
+			t.Errorf("parse(%s) got %s on marshal", s, got)
+		}
+	}
+	parsed, err := parse(`#NaN`)
+	if err != nil || !math.IsNaN(parsed.GetExpr().GetConstExpr().GetDoubleValue()) {
+		t.Errorf("parse(#NaN) got %v, %v", parsed, err)
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{in: `AND(x`, err: "offset 5: expected ','"},
+		{in: `[1,2]]`, err: "offset 5: unexpected trailing input"},
+		{in: `#sel(x)`, err: "offset 6: expected ','"},
+		{in: `"abc`, err: "unterminated string"},
+		{in: `size@()`, err: "missing target"},
+		{in: `#fold(i,[],a,1,2)`, err: "got 2 comprehension expressions"},
+		{in: `EQ(z,1)`, err: "undeclared reference to 'z'"},
+	}
+	for _, tc := range tests {
+		_, err := Unmarshal(tc.in, newEnv(t))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Unmarshal(%s) got error %v, wanted %q", tc.in, err, tc.err)
+		}
+	}
+}
+
+func newEnv(t *testing.T) *checker.Env {
+	t.Helper()
+	reg, err := types.NewRegistry(&proto3pb.TestAllTypes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cont, err := containers.NewContainer(containers.Name("google.expr.proto3.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := checker.NewStandardEnv(cont, reg)
+	err = env.Add(
+		decls.NewVar("x", decls.Int),
+		decls.NewVar("y", decls.Double),
+		decls.NewVar("m", decls.NewMapType(decls.String, decls.Dyn)),
+		decls.NewVar("google.expr.proto3.test.ns.z", decls.Bool),
+		decls.NewFunction("AND",
+			decls.NewOverload("AND_int", []*exprpb.Type{decls.Int}, decls.Int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func check(t *testing.T, env *checker.Env, expr string) *exprpb.CheckedExpr {
+	t.Helper()
+	src := common.NewTextSource(expr)
+	parsed, errs := parser.Parse(src)
+	if len(errs.GetErrors()) != 0 {
+		t.Fatal(errs.ToDisplayString())
+	}
+	checked, errs := checker.Check(parsed, src, env)
+	if len(errs.GetErrors()) != 0 {
+		t.Fatal(errs.ToDisplayString())
+	}
+	return checked
+}
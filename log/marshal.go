@@ -0,0 +1,297 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package log writes checked expressions in a compact, single-line format suited to logging and
+// log indexing, and reads them back.
+//
+// Operators are written as upper-case mnemonics applied to their arguments, so that the
+// expression `x == 1 && y > 2.5` is written as `AND(EQ(x,1),GT(y,2.5))`. The remaining forms are:
+//
+//	null, true, false       null and bool constants
+//	1, 1u, 1.0, #NaN        int, uint, and double constants; #+Inf and #-Inf for infinities
+//	"a", b"a"               string and bytes constants, quoted as Go string literals
+//	#duration(s,n)          duration constant of s seconds and n nanoseconds
+//	#timestamp(s,n)         timestamp constant of s seconds and n nanoseconds since the epoch
+//	x, .a.b.c               identifiers, with a leading dot when fully qualified
+//	#sel(e,f), #has(e,f)    field selection and presence test of field f on e
+//	f(a,b), f@(t,a,b)       global call, and receiver call with target t
+//	[a,b], {k:v}            list and map construction
+//	.pkg.Msg{f:v}           message construction
+//	#fold(i,r,a,init,c,s,e) comprehension with the iteration variable i over range r, the
+//	                        accumulator a, and the init, condition, step, and result expressions
+//
+// Names which are not plain identifiers, such as functions named like a mnemonic, are enclosed in
+// backticks.
+package log
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/common/operators"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// mnemonics maps operator function names to their names in the log format.
+var mnemonics = map[string]string{
+	operators.Conditional:         "COND",
+	operators.LogicalAnd:          "AND",
+	operators.LogicalOr:           "OR",
+	operators.LogicalNot:          "NOT",
+	operators.Equals:              "EQ",
+	operators.NotEquals:           "NE",
+	operators.Less:                "LT",
+	operators.LessEquals:          "LE",
+	operators.Greater:             "GT",
+	operators.GreaterEquals:       "GE",
+	operators.Add:                 "ADD",
+	operators.Subtract:            "SUB",
+	operators.Multiply:            "MUL",
+	operators.Divide:              "DIV",
+	operators.Modulo:              "MOD",
+	operators.Negate:              "NEG",
+	operators.Index:               "INDEX",
+	operators.In:                  "IN",
+	operators.NotStrictlyFalse:    "NOT_STRICTLY_FALSE",
+	operators.OldIn:               "OLD_IN",
+	operators.OldNotStrictlyFalse: "OLD_NOT_STRICTLY_FALSE",
+}
+
+// functions maps mnemonics to the operator function names.
+var functions = map[string]string{}
+
+func init() {
+	for fn, mnemonic := range mnemonics {
+		functions[mnemonic] = fn
+	}
+}
+
+// Marshal writes the checked expression in the log format.
+//
+// Identifiers, qualified names selected as fields, message types, and functions are written with
+// their fully qualified names as resolved by the checker.
+func Marshal(checked *exprpb.CheckedExpr) string {
+	m := &marshaller{refs: checked.GetReferenceMap()}
+	m.expr(checked.GetExpr())
+	return m.String()
+}
+
+type marshaller struct {
+	strings.Builder
+	refs map[int64]*exprpb.Reference
+}
+
+func (m *marshaller) expr(e *exprpb.Expr) {
+	switch e.ExprKind.(type) {
+	case *exprpb.Expr_ConstExpr:
+		m.constant(e.GetConstExpr())
+	case *exprpb.Expr_IdentExpr:
+		if ref, found := m.refs[e.GetId()]; found && ref.GetName() != "" {
+			m.name(qualified(ref.GetName()))
+		} else {
+			m.name(e.GetIdentExpr().GetName())
+		}
+	case *exprpb.Expr_SelectExpr:
+		sel := e.GetSelectExpr()
+		if ref, found := m.refs[e.GetId()]; found && ref.GetName() != "" {
+			// The checker resolved the select chain to a qualified identifier.
+			m.name(qualified(ref.GetName()))
+			return
+		}
+		if sel.GetTestOnly() {
+			m.WriteString("#has(")
+		} else {
+			m.WriteString("#sel(")
+		}
+		m.expr(sel.GetOperand())
+		m.WriteByte(',')
+		m.name(sel.GetField())
+		m.WriteByte(')')
+	case *exprpb.Expr_CallExpr:
+		call := e.GetCallExpr()
+		fn := call.GetFunction()
+		if mnemonic, found := mnemonics[fn]; found {
+			m.WriteString(mnemonic)
+		} else if _, found := functions[fn]; found {
+			m.quotedName(fn)
+		} else if call.GetTarget() == nil {
+			m.name(qualified(fn))
+		} else {
+			m.name(fn)
+		}
+		if call.GetTarget() != nil {
+			m.WriteString("@(")
+			m.expr(call.GetTarget())
+			if len(call.GetArgs()) != 0 {
+				m.WriteByte(',')
+			}
+		} else {
+			m.WriteByte('(')
+		}
+		m.exprs(call.GetArgs())
+		m.WriteByte(')')
+	case *exprpb.Expr_ListExpr:
+		m.WriteByte('[')
+		m.exprs(e.GetListExpr().GetElements())
+		m.WriteByte(']')
+	case *exprpb.Expr_StructExpr:
+		st := e.GetStructExpr()
+		if st.GetMessageName() != "" {
+			m.name(qualified(st.GetMessageName()))
+		}
+		m.WriteByte('{')
+		for i, entry := range st.GetEntries() {
+			if i > 0 {
+				m.WriteByte(',')
+			}
+			if entry.GetMapKey() != nil {
+				m.expr(entry.GetMapKey())
+			} else {
+				m.name(entry.GetFieldKey())
+			}
+			m.WriteByte(':')
+			m.expr(entry.GetValue())
+		}
+		m.WriteByte('}')
+	case *exprpb.Expr_ComprehensionExpr:
+		comp := e.GetComprehensionExpr()
+		m.WriteString("#fold(")
+		m.name(comp.GetIterVar())
+		m.WriteByte(',')
+		m.expr(comp.GetIterRange())
+		m.WriteByte(',')
+		m.name(comp.GetAccuVar())
+		m.WriteByte(',')
+		m.exprs([]*exprpb.Expr{
+			comp.GetAccuInit(),
+			comp.GetLoopCondition(),
+			comp.GetLoopStep(),
+			comp.GetResult(),
+		})
+		m.WriteByte(')')
+	}
+}
+
+func (m *marshaller) exprs(exprs []*exprpb.Expr) {
+	for i, e := range exprs {
+		if i > 0 {
+			m.WriteByte(',')
+		}
+		m.expr(e)
+	}
+}
+
+func (m *marshaller) constant(c *exprpb.Constant) {
+	switch c.ConstantKind.(type) {
+	case *exprpb.Constant_NullValue:
+		m.WriteString("null")
+	case *exprpb.Constant_BoolValue:
+		m.WriteString(strconv.FormatBool(c.GetBoolValue()))
+	case *exprpb.Constant_Int64Value:
+		m.WriteString(strconv.FormatInt(c.GetInt64Value(), 10))
+	case *exprpb.Constant_Uint64Value:
+		m.WriteString(strconv.FormatUint(c.GetUint64Value(), 10))
+		m.WriteByte('u')
+	case *exprpb.Constant_DoubleValue:
+		m.WriteString(formatDouble(c.GetDoubleValue()))
+	case *exprpb.Constant_StringValue:
+		m.WriteString(strconv.Quote(c.GetStringValue()))
+	case *exprpb.Constant_BytesValue:
+		m.WriteByte('b')
+		m.WriteString(strconv.Quote(string(c.GetBytesValue())))
+	case *exprpb.Constant_DurationValue:
+		d := c.GetDurationValue()
+		m.WriteString("#duration(")
+		m.WriteString(strconv.FormatInt(d.GetSeconds(), 10))
+		m.WriteByte(',')
+		m.WriteString(strconv.FormatInt(int64(d.GetNanos()), 10))
+		m.WriteByte(')')
+	case *exprpb.Constant_TimestampValue:
+		ts := c.GetTimestampValue()
+		m.WriteString("#timestamp(")
+		m.WriteString(strconv.FormatInt(ts.GetSeconds(), 10))
+		m.WriteByte(',')
+		m.WriteString(strconv.FormatInt(int64(ts.GetNanos()), 10))
+		m.WriteByte(')')
+	}
+}
+
+// name writes the name, enclosing it in backticks if it is not a plain identifier.
+func (m *marshaller) name(name string) {
+	if isPlainName(name) {
+		m.WriteString(name)
+		return
+	}
+	m.quotedName(name)
+}
+
+func (m *marshaller) quotedName(name string) {
+	m.WriteByte('`')
+	m.WriteString(name)
+	m.WriteByte('`')
+}
+
+// formatDouble formats the double so that it is distinct from an int.
+func formatDouble(d float64) string {
+	switch {
+	case math.IsNaN(d):
+		return "#NaN"
+	case math.IsInf(d, 1):
+		return "#+Inf"
+	case math.IsInf(d, -1):
+		return "#-Inf"
+	}
+	s := strconv.FormatFloat(d, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// qualified adds a leading dot to qualified names so that they resolve from the root namespace
+// regardless of the container.
+func qualified(name string) string {
+	if strings.Contains(name, ".") && !strings.HasPrefix(name, ".") {
+		return "." + name
+	}
+	return name
+}
+
+// isPlainName returns true if the name consists of letters, digits, underscores, and dots, does
+// not start with a digit, and is not a constant keyword.
+func isPlainName(name string) bool {
+	if name == "" || isDigit(name[0]) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isNameChar(name[i]) {
+			return false
+		}
+	}
+	switch name {
+	case "null", "true", "false":
+		return false
+	}
+	return true
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '.' || isDigit(c) || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,456 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/common"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	dpb "google.golang.org/protobuf/types/known/durationpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	tpb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Unmarshal reads an expression written by Marshal and type-checks it within the environment.
+//
+// When the environment declares the identifiers and functions of the environment in which the
+// original expression was checked, the types of the expression are those of the original. Node
+// ids are assigned in the order the nodes appear in the log format, and source positions are
+// offsets within the string.
+func Unmarshal(s string, env *checker.Env) (*exprpb.CheckedExpr, error) {
+	parsed, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+	checked, errs := checker.Check(parsed, common.NewStringSource(s, "<log>"), env)
+	if len(errs.GetErrors()) != 0 {
+		return nil, errors.New(errs.ToDisplayString())
+	}
+	return checked, nil
+}
+
+// parse reads an expression in the log format.
+func parse(s string) (*exprpb.ParsedExpr, error) {
+	p := &reader{src: s, positions: map[int64]int32{}}
+	e, err := p.expr()
+	if err == nil && p.pos < len(s) {
+		err = p.errorf("unexpected trailing input")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &exprpb.ParsedExpr{
+		Expr: e,
+		SourceInfo: &exprpb.SourceInfo{
+			Location:  "<log>",
+			Positions: p.positions,
+		},
+	}, nil
+}
+
+type reader struct {
+	src       string
+	pos       int
+	nextID    int64
+	positions map[int64]int32
+}
+
+func (p *reader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("log: offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// newExpr returns an expression with the next id, positioned at the given offset.
+func (p *reader) newExpr(start int) *exprpb.Expr {
+	p.nextID++
+	p.positions[p.nextID] = int32(start)
+	return &exprpb.Expr{Id: p.nextID}
+}
+
+func (p *reader) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *reader) consume(token string) bool {
+	if strings.HasPrefix(p.src[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *reader) expect(token string) error {
+	if !p.consume(token) {
+		return p.errorf("expected '%s'", token)
+	}
+	return nil
+}
+
+func (p *reader) expr() (*exprpb.Expr, error) {
+	start := p.pos
+	c := p.peek()
+	switch {
+	case c == '[':
+		p.pos++
+		e := p.newExpr(start)
+		elems, err := p.exprs("]")
+		if err != nil {
+			return nil, err
+		}
+		e.ExprKind = &exprpb.Expr_ListExpr{ListExpr: &exprpb.Expr_CreateList{Elements: elems}}
+		return e, nil
+	case c == '{':
+		return p.createStruct(start, "")
+	case c == '"':
+		str, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return p.constant(start, &exprpb.Constant{
+			ConstantKind: &exprpb.Constant_StringValue{StringValue: str}}), nil
+	case c == 'b' && strings.HasPrefix(p.src[p.pos:], `b"`):
+		p.pos++
+		str, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return p.constant(start, &exprpb.Constant{
+			ConstantKind: &exprpb.Constant_BytesValue{BytesValue: []byte(str)}}), nil
+	case c == '-' || isDigit(c):
+		return p.number(start)
+	case c == '#':
+		return p.special(start)
+	case c == '`':
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return p.call(start, name)
+	case isNameChar(c):
+		name, _ := p.name()
+		switch name {
+		case "null":
+			return p.constant(start, &exprpb.Constant{
+				ConstantKind: &exprpb.Constant_NullValue{NullValue: structpb.NullValue_NULL_VALUE}}), nil
+		case "true", "false":
+			return p.constant(start, &exprpb.Constant{
+				ConstantKind: &exprpb.Constant_BoolValue{BoolValue: name == "true"}}), nil
+		}
+		switch p.peek() {
+		case '(', '@':
+			if fn, found := functions[name]; found {
+				name = fn
+			}
+			return p.call(start, name)
+		case '{':
+			return p.createStruct(start, name)
+		}
+		e := p.newExpr(start)
+		e.ExprKind = &exprpb.Expr_IdentExpr{IdentExpr: &exprpb.Expr_Ident{Name: name}}
+		return e, nil
+	}
+	return nil, p.errorf("unexpected input")
+}
+
+// exprs reads a comma-separated list of expressions up to and including the closing token.
+func (p *reader) exprs(closing string) ([]*exprpb.Expr, error) {
+	var exprs []*exprpb.Expr
+	if p.consume(closing) {
+		return exprs, nil
+	}
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if p.consume(closing) {
+			return exprs, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *reader) call(start int, function string) (*exprpb.Expr, error) {
+	e := p.newExpr(start)
+	call := &exprpb.Expr_Call{Function: function}
+	receiver := p.consume("@")
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args, err := p.exprs(")")
+	if err != nil {
+		return nil, err
+	}
+	if receiver {
+		if len(args) == 0 {
+			return nil, p.errorf("missing target of receiver call to '%s'", function)
+		}
+		call.Target = args[0]
+		args = args[1:]
+	}
+	call.Args = args
+	e.ExprKind = &exprpb.Expr_CallExpr{CallExpr: call}
+	return e, nil
+}
+
+// createStruct reads a map or, when the message name is non-empty, message construction.
+func (p *reader) createStruct(start int, messageName string) (*exprpb.Expr, error) {
+	e := p.newExpr(start)
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	st := &exprpb.Expr_CreateStruct{MessageName: messageName}
+	for !p.consume("}") {
+		if len(st.Entries) != 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		p.nextID++
+		entry := &exprpb.Expr_CreateStruct_Entry{Id: p.nextID}
+		p.positions[entry.Id] = int32(p.pos)
+		if messageName != "" {
+			field, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			entry.KeyKind = &exprpb.Expr_CreateStruct_Entry_FieldKey{FieldKey: field}
+		} else {
+			key, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			entry.KeyKind = &exprpb.Expr_CreateStruct_Entry_MapKey{MapKey: key}
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		val, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		entry.Value = val
+		st.Entries = append(st.Entries, entry)
+	}
+	e.ExprKind = &exprpb.Expr_StructExpr{StructExpr: st}
+	return e, nil
+}
+
+// special reads the forms which start with '#'.
+func (p *reader) special(start int) (*exprpb.Expr, error) {
+	p.pos++
+	switch {
+	case p.consume("NaN"):
+		return p.double(start, math.NaN()), nil
+	case p.consume("+Inf"):
+		return p.double(start, math.Inf(1)), nil
+	case p.consume("-Inf"):
+		return p.double(start, math.Inf(-1)), nil
+	case p.consume("sel("), p.consume("has("):
+		testOnly := strings.HasPrefix(p.src[start:], "#has")
+		e := p.newExpr(start)
+		operand, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		field, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		e.ExprKind = &exprpb.Expr_SelectExpr{SelectExpr: &exprpb.Expr_Select{
+			Operand:  operand,
+			Field:    field,
+			TestOnly: testOnly,
+		}}
+		return e, nil
+	case p.consume("duration("):
+		secs, nanos, err := p.secondsAndNanos()
+		if err != nil {
+			return nil, err
+		}
+		return p.constant(start, &exprpb.Constant{ConstantKind: &exprpb.Constant_DurationValue{
+			DurationValue: &dpb.Duration{Seconds: secs, Nanos: nanos}}}), nil
+	case p.consume("timestamp("):
+		secs, nanos, err := p.secondsAndNanos()
+		if err != nil {
+			return nil, err
+		}
+		return p.constant(start, &exprpb.Constant{ConstantKind: &exprpb.Constant_TimestampValue{
+			TimestampValue: &tpb.Timestamp{Seconds: secs, Nanos: nanos}}}), nil
+	case p.consume("fold("):
+		return p.comprehension(start)
+	}
+	return nil, p.errorf("unknown form")
+}
+
+func (p *reader) comprehension(start int) (*exprpb.Expr, error) {
+	e := p.newExpr(start)
+	comp := &exprpb.Expr_Comprehension{}
+	iterVar, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	comp.IterVar = iterVar
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	if comp.IterRange, err = p.expr(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	if comp.AccuVar, err = p.name(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	exprs, err := p.exprs(")")
+	if err != nil {
+		return nil, err
+	}
+	if len(exprs) != 4 {
+		return nil, p.errorf("got %d comprehension expressions, wanted 4", len(exprs))
+	}
+	comp.AccuInit, comp.LoopCondition, comp.LoopStep, comp.Result =
+		exprs[0], exprs[1], exprs[2], exprs[3]
+	e.ExprKind = &exprpb.Expr_ComprehensionExpr{ComprehensionExpr: comp}
+	return e, nil
+}
+
+func (p *reader) secondsAndNanos() (int64, int32, error) {
+	secs, err := strconv.ParseInt(p.token(), 10, 64)
+	if err != nil {
+		return 0, 0, p.errorf("invalid seconds: %v", err)
+	}
+	if err := p.expect(","); err != nil {
+		return 0, 0, err
+	}
+	nanos, err := strconv.ParseInt(p.token(), 10, 32)
+	if err != nil {
+		return 0, 0, p.errorf("invalid nanos: %v", err)
+	}
+	if err := p.expect(")"); err != nil {
+		return 0, 0, err
+	}
+	return secs, int32(nanos), nil
+}
+
+func (p *reader) number(start int) (*exprpb.Expr, error) {
+	tok := p.token()
+	switch {
+	case p.consume("u"):
+		v, err := strconv.ParseUint(tok, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid uint: %v", err)
+		}
+		return p.constant(start, &exprpb.Constant{
+			ConstantKind: &exprpb.Constant_Uint64Value{Uint64Value: v}}), nil
+	case strings.ContainsAny(tok, ".e"):
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, p.errorf("invalid double: %v", err)
+		}
+		return p.double(start, v), nil
+	}
+	v, err := strconv.ParseInt(tok, 10, 64)
+	if err != nil {
+		return nil, p.errorf("invalid int: %v", err)
+	}
+	return p.constant(start, &exprpb.Constant{
+		ConstantKind: &exprpb.Constant_Int64Value{Int64Value: v}}), nil
+}
+
+// token reads the characters of a number.
+func (p *reader) token() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if !isDigit(c) && c != '-' && c != '+' && c != '.' && c != 'e' {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *reader) double(start int, v float64) *exprpb.Expr {
+	return p.constant(start, &exprpb.Constant{
+		ConstantKind: &exprpb.Constant_DoubleValue{DoubleValue: v}})
+}
+
+func (p *reader) constant(start int, c *exprpb.Constant) *exprpb.Expr {
+	e := p.newExpr(start)
+	e.ExprKind = &exprpb.Expr_ConstExpr{ConstExpr: c}
+	return e
+}
+
+// quoted reads a double-quoted Go string literal.
+func (p *reader) quoted() (string, error) {
+	start := p.pos
+	for i := start + 1; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case '"':
+			p.pos = i + 1
+			str, err := strconv.Unquote(p.src[start:p.pos])
+			if err != nil {
+				return "", p.errorf("invalid string: %v", err)
+			}
+			return str, nil
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// name reads a plain or backtick-quoted name.
+func (p *reader) name() (string, error) {
+	start := p.pos
+	if p.consume("`") {
+		end := strings.IndexByte(p.src[p.pos:], '`')
+		if end < 0 {
+			return "", p.errorf("unterminated name")
+		}
+		p.pos += end + 1
+		return p.src[start+1 : p.pos-1], nil
+	}
+	for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a name")
+	}
+	return p.src[start:p.pos], nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/google/cel-go/cel"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	lookuppb "github.com/google/cel-go/proto/v1"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// Client evaluates checked expressions using a remote LookupService.
+//
+// The client maintains a fixed-size pool of connections to the service and distributes calls
+// across them in round-robin order. A Client is safe for concurrent use.
+type Client struct {
+	conns   []*grpc.ClientConn
+	clients []lookuppb.LookupServiceClient
+	next    uint32
+}
+
+// NewClient dials poolSize connections to the LookupService at the target address.
+//
+// When poolSize is less than one, a single connection is used.
+func NewClient(target string, poolSize int, opts ...grpc.DialOption) (*Client, error) {
+	if poolSize < 1 {
+		poolSize = 1
+	}
+	c := &Client{
+		conns:   make([]*grpc.ClientConn, 0, poolSize),
+		clients: make([]lookuppb.LookupServiceClient, 0, poolSize),
+	}
+	for i := 0; i < poolSize; i++ {
+		conn, err := grpc.Dial(target, opts...)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.conns = append(c.conns, conn)
+		c.clients = append(c.clients, lookuppb.NewLookupServiceClient(conn))
+	}
+	return c, nil
+}
+
+// Evaluate evaluates the checked expression remotely using the given variables.
+//
+// The variables must be encodable as a JSON object. The deadline and cancellation of the context
+// are propagated to the server.
+func (c *Client) Evaluate(ctx context.Context,
+	ast *cel.Ast, vars map[string]interface{}) (*structpb.Value, error) {
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		return nil, err
+	}
+	req := &lookuppb.EvaluateRequest{}
+	req.CheckedExpr, err = proto.Marshal(checked)
+	if err != nil {
+		return nil, err
+	}
+	if len(vars) != 0 {
+		activation, err := json.Marshal(vars)
+		if err != nil {
+			return nil, err
+		}
+		req.Activation = string(activation)
+	}
+	resp, err := c.pick().Evaluate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetResult(), nil
+}
+
+// Close closes all pooled connections, returning the first error encountered.
+func (c *Client) Close() error {
+	var firstErr error
+	for _, conn := range c.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// pick returns the next client in round-robin order.
+func (c *Client) pick() lookuppb.LookupServiceClient {
+	i := atomic.AddUint32(&c.next, 1) - 1
+	return c.clients[i%uint32(len(c.clients))]
+}
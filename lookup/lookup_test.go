@@ -0,0 +1,136 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lookup
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	lookuppb "github.com/google/cel-go/proto/v1"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func newTestEnv(t *testing.T) *cel.Env {
+	t.Helper()
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("name", decls.String),
+		decls.NewVar("tags", decls.NewListType(decls.String))))
+	if err != nil {
+		t.Fatalf("cel.NewEnv() failed: %v", err)
+	}
+	return env
+}
+
+func compile(t *testing.T, env *cel.Env, src string) *cel.Ast {
+	t.Helper()
+	ast, iss := env.Compile(src)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	return ast
+}
+
+func startServer(t *testing.T, env *cel.Env) (string, func()) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() failed: %v", err)
+	}
+	s := grpc.NewServer()
+	lookuppb.RegisterLookupServiceServer(s, NewServer(env))
+	go s.Serve(lis)
+	return lis.Addr().String(), s.Stop
+}
+
+func TestClientEvaluate(t *testing.T) {
+	env := newTestEnv(t)
+	addr, stop := startServer(t, env)
+	defer stop()
+	c, err := NewClient(addr, 2, grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	defer c.Close()
+
+	ast := compile(t, env, `"admin" in tags ? name + "!" : name`)
+	for i := 0; i < 3; i++ {
+		out, err := c.Evaluate(context.Background(), ast, map[string]interface{}{
+			"name": "alice",
+			"tags": []string{"admin"},
+		})
+		if err != nil {
+			t.Fatalf("Evaluate() failed: %v", err)
+		}
+		want := structpb.NewStringValue("alice!")
+		if !proto.Equal(out, want) {
+			t.Errorf("Evaluate() got %v, wanted %v", out, want)
+		}
+	}
+}
+
+func TestServerEvaluateErrors(t *testing.T) {
+	env := newTestEnv(t)
+	srv := NewServer(env)
+	checked, err := cel.AstToCheckedExpr(compile(t, env, `name.size()`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkedBytes, err := proto.Marshal(checked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		req  *lookuppb.EvaluateRequest
+		code codes.Code
+	}{
+		{req: &lookuppb.EvaluateRequest{}, code: codes.InvalidArgument},
+		{
+			req:  &lookuppb.EvaluateRequest{CheckedExpr: []byte{0xff}},
+			code: codes.InvalidArgument,
+		},
+		{
+			req:  &lookuppb.EvaluateRequest{CheckedExpr: checkedBytes, Activation: `[1]`},
+			code: codes.InvalidArgument,
+		},
+		{
+			req:  &lookuppb.EvaluateRequest{CheckedExpr: checkedBytes},
+			code: codes.FailedPrecondition,
+		},
+	}
+	for i, tc := range tests {
+		_, err := srv.Evaluate(context.Background(), tc.req)
+		if status.Code(err) != tc.code {
+			t.Errorf("%d: Evaluate() got error %v, wanted code %v", i, err, tc.code)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = srv.Evaluate(ctx, &lookuppb.EvaluateRequest{
+		CheckedExpr: checkedBytes,
+		Activation:  `{"name": "bob"}`,
+	})
+	if status.Code(err) != codes.Canceled {
+		t.Errorf("Evaluate() got error %v, wanted code %v", err, codes.Canceled)
+	}
+}
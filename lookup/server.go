@@ -0,0 +1,118 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lookup provides a gRPC server and client for evaluating checked CEL expressions
+// remotely via the LookupService.
+package lookup
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	lookuppb "github.com/google/cel-go/proto/v1"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+var jsonValueType = reflect.TypeOf(&structpb.Value{})
+
+// Server implements the LookupService by evaluating checked expressions within a CEL environment.
+type Server struct {
+	env  *cel.Env
+	opts []cel.ProgramOption
+}
+
+// NewServer creates a Server which plans the expressions it receives using the given environment
+// and program options.
+//
+// The environment must declare the functions and types referenced by the checked expressions
+// sent to the server.
+func NewServer(env *cel.Env, opts ...cel.ProgramOption) *Server {
+	return &Server{env: env, opts: opts}
+}
+
+// Evaluate implements LookupService.Evaluate.
+//
+// Evaluation is abandoned when the request context is cancelled or its deadline, which gRPC
+// propagates from the client, is exceeded.
+func (s *Server) Evaluate(ctx context.Context,
+	in *lookuppb.EvaluateRequest) (*lookuppb.EvaluateResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if len(in.GetCheckedExpr()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no checked expression")
+	}
+	checked := &exprpb.CheckedExpr{}
+	if err := proto.Unmarshal(in.GetCheckedExpr(), checked); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid checked expression: %v", err)
+	}
+	vars, err := parseActivation(in.GetActivation())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid activation: %v", err)
+	}
+	prg, err := s.env.Program(cel.CheckedExprToAst(checked), s.opts...)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "program construction failed: %v", err)
+	}
+	type result struct {
+		val ref.Val
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		val, _, err := prg.Eval(vars)
+		done <- result{val: val, err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	case res := <-done:
+		if res.err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "evaluation failed: %v", res.err)
+		}
+		out, err := res.val.ConvertToNative(jsonValueType)
+		if err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition,
+				"result is not representable as JSON: %v", err)
+		}
+		return &lookuppb.EvaluateResponse{Result: out.(*structpb.Value)}, nil
+	}
+}
+
+// parseActivation converts a JSON object into a map of variable name to value.
+//
+// JSON numbers are always represented as CEL doubles.
+func parseActivation(activation string) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	if activation == "" {
+		return vars, nil
+	}
+	obj := &structpb.Struct{}
+	if err := protojson.Unmarshal([]byte(activation), obj); err != nil {
+		return nil, err
+	}
+	for name, val := range obj.GetFields() {
+		vars[name] = types.DefaultTypeAdapter.NativeToValue(val)
+	}
+	return vars, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package muttest generates mutants of checked CEL expressions for mutation testing.
+//
+// Mutation testing measures the adequacy of a set of test inputs for an expression: a good set of
+// inputs produces a different result for the original expression than for each of its mutants.
+package muttest
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/walk"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Mutant is a program compiled from a single mutation of an expression.
+type Mutant struct {
+	// Program is the planned form of the mutated expression.
+	Program cel.Program
+
+	// MutationDesc describes the mutation and its location within the original expression.
+	MutationDesc string
+}
+
+// Mutate generates the mutants of a checked expression which type-check within the environment.
+//
+// The following mutations are applied to each applicable node of the expression:
+//
+//   - bool constants are flipped.
+//   - `&&` is replaced with `||`.
+//   - `==` is replaced with `!=`.
+//   - `<` is replaced with `<=`.
+//   - int constants are replaced with `0`, and with the constant plus and minus one.
+//
+// Mutants which fail to type-check or plan are omitted from the result.
+func Mutate(checked *exprpb.CheckedExpr, env *cel.Env) []*Mutant {
+	src := common.NewInfoSource(checked.GetSourceInfo())
+	var muts []*mutation
+	walk.PreOrder(checked.GetExpr(), func(e *exprpb.Expr) bool {
+		muts = append(muts, mutationsOf(e)...)
+		return true
+	})
+	var mutants []*Mutant
+	for _, m := range muts {
+		expr := proto.Clone(checked.GetExpr()).(*exprpb.Expr)
+		walk.PreOrder(expr, func(e *exprpb.Expr) bool {
+			if e.GetId() == m.id {
+				m.apply(e)
+			}
+			return true
+		})
+		ast := cel.ParsedExprToAst(&exprpb.ParsedExpr{
+			Expr:       expr,
+			SourceInfo: checked.GetSourceInfo(),
+		})
+		ast, iss := env.Check(ast)
+		if iss.Err() != nil {
+			continue
+		}
+		prg, err := env.Program(ast)
+		if err != nil {
+			continue
+		}
+		mutants = append(mutants, &Mutant{
+			Program:      prg,
+			MutationDesc: fmt.Sprintf("%s at %s", m.desc, location(src, checked, m.id)),
+		})
+	}
+	return mutants
+}
+
+// mutation describes a rewrite of the expression node with the given id.
+type mutation struct {
+	id    int64
+	desc  string
+	apply func(*exprpb.Expr)
+}
+
+// functionReplacements maps function names to their mutated replacement.
+var functionReplacements = map[string]string{
+	operators.LogicalAnd: operators.LogicalOr,
+	operators.Equals:     operators.NotEquals,
+	operators.Less:       operators.LessEquals,
+}
+
+func mutationsOf(e *exprpb.Expr) []*mutation {
+	id := e.GetId()
+	switch e.GetExprKind().(type) {
+	case *exprpb.Expr_ConstExpr:
+		switch c := e.GetConstExpr().GetConstantKind().(type) {
+		case *exprpb.Constant_BoolValue:
+			return []*mutation{{
+				id:    id,
+				desc:  fmt.Sprintf("flip bool constant %t", c.BoolValue),
+				apply: setConst(&exprpb.Constant{ConstantKind: &exprpb.Constant_BoolValue{BoolValue: !c.BoolValue}}),
+			}}
+		case *exprpb.Constant_Int64Value:
+			var muts []*mutation
+			for _, v := range []int64{0, c.Int64Value + 1, c.Int64Value - 1} {
+				if v == c.Int64Value {
+					continue
+				}
+				muts = append(muts, &mutation{
+					id:    id,
+					desc:  fmt.Sprintf("replace int constant %d with %d", c.Int64Value, v),
+					apply: setConst(&exprpb.Constant{ConstantKind: &exprpb.Constant_Int64Value{Int64Value: v}}),
+				})
+			}
+			return muts
+		}
+	case *exprpb.Expr_CallExpr:
+		fn := e.GetCallExpr().GetFunction()
+		if repl, found := functionReplacements[fn]; found {
+			return []*mutation{{
+				id:   id,
+				desc: fmt.Sprintf("replace %s with %s", fn, repl),
+				apply: func(e *exprpb.Expr) {
+					e.GetCallExpr().Function = repl
+				},
+			}}
+		}
+	}
+	return nil
+}
+
+func setConst(c *exprpb.Constant) func(*exprpb.Expr) {
+	return func(e *exprpb.Expr) {
+		e.ExprKind = &exprpb.Expr_ConstExpr{ConstExpr: c}
+	}
+}
+
+// location formats the source location of the expression id as `line:column` when known, and
+// otherwise as the expression id.
+func location(src common.Source, checked *exprpb.CheckedExpr, id int64) string {
+	if offset, found := checked.GetSourceInfo().GetPositions()[id]; found {
+		if loc, found := src.OffsetLocation(offset); found {
+			return fmt.Sprintf("%d:%d", loc.Line(), loc.Column()+1)
+		}
+	}
+	return fmt.Sprintf("expr id %d", id)
+}
+
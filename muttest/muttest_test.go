@@ -0,0 +1,77 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package muttest
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+)
+
+func TestMutate(t *testing.T) {
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("x", decls.Int),
+		decls.NewVar("ok", decls.Bool)))
+	if err != nil {
+		t.Fatalf("cel.NewEnv() failed: %v", err)
+	}
+	ast, iss := env.Compile(`x < 2 && ok == true`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutants := Mutate(checked, env)
+	var descs []string
+	for _, m := range mutants {
+		descs = append(descs, m.MutationDesc)
+	}
+	sort.Strings(descs)
+	want := []string{
+		"flip bool constant true at 1:16",
+		"replace _<_ with _<=_ at 1:3",
+		"replace _&&_ with _||_ at 1:7",
+		"replace _==_ with _!=_ at 1:13",
+		"replace int constant 2 with 0 at 1:5",
+		"replace int constant 2 with 1 at 1:5",
+		"replace int constant 2 with 3 at 1:5",
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(descs, want) {
+		t.Errorf("got mutations %v, wanted %v", descs, want)
+	}
+
+	// The input x = 1, ok = true kills only some of the mutants.
+	vars := map[string]interface{}{"x": 1, "ok": true}
+	killed := 0
+	for _, m := range mutants {
+		out, _, err := m.Program.Eval(vars)
+		if err != nil {
+			t.Fatalf("%s: Eval() failed: %v", m.MutationDesc, err)
+		}
+		if out != types.True {
+			killed++
+		}
+	}
+	if killed != 4 {
+		t.Errorf("got %d killed mutants, wanted 4", killed)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package normalize provides rewrites which produce a canonical form of an expression, so that
+// expressions which differ only in the order of commutative operands compare as equal.
+package normalize
+
+import (
+	"sort"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/walk"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// SortConditions returns a copy of the expression in which the operands of every chain of
+// logical AND and logical OR operations are sorted by their cel.HashExpression fingerprint.
+//
+// For example, `b && a && c` and `c && (a && b)` are both rewritten to the same expression.
+// Since the CEL logical operators are commutative, the rewrite does not change the result of
+// expressions whose functions are free of side-effects.
+//
+// The rewritten chain is left-associative, and reuses the ids of the original call nodes.
+func SortConditions(e *exprpb.Expr) *exprpb.Expr {
+	return StableSort(e, func(*exprpb.Expr) bool { return false })
+}
+
+// StableSort returns a copy of the expression in which the operands of every chain of logical
+// AND and logical OR operations are sorted as with SortConditions, with the exception that the
+// operands for which hasSideEffects returns true retain their positions within the chain.
+//
+// Operands with side-effects partition a chain into runs of operands without side-effects, and
+// only the operands within each run are sorted. As a result, the relative order of operands with
+// side-effects, and the set of operands which precede each of them, is preserved.
+func StableSort(e *exprpb.Expr, hasSideEffects func(*exprpb.Expr) bool) *exprpb.Expr {
+	if e == nil {
+		return nil
+	}
+	out := proto.Clone(e).(*exprpb.Expr)
+	s := &sorter{hasSideEffects: hasSideEffects}
+	s.visit(out)
+	return out
+}
+
+type sorter struct {
+	hasSideEffects func(*exprpb.Expr) bool
+}
+
+// visit sorts the logical operator chains within the expression in place.
+func (s *sorter) visit(e *exprpb.Expr) {
+	call := e.GetCallExpr()
+	if call != nil && call.GetTarget() == nil && len(call.GetArgs()) == 2 &&
+		(call.GetFunction() == operators.LogicalAnd ||
+			call.GetFunction() == operators.LogicalOr) {
+		s.sortChain(e)
+		return
+	}
+	for _, c := range walk.Children(e) {
+		s.visit(c)
+	}
+}
+
+// sortChain sorts the operands of the logical operator chain rooted at the expression.
+func (s *sorter) sortChain(e *exprpb.Expr) {
+	fn := e.GetCallExpr().GetFunction()
+	var ids []int64
+	var operands []*exprpb.Expr
+	s.collect(fn, e, &ids, &operands)
+
+	keys := make(map[*exprpb.Expr]uint64, len(operands))
+	for _, op := range operands {
+		s.visit(op)
+		keys[op] = hashKey(op)
+	}
+	start := 0
+	for i := 0; i <= len(operands); i++ {
+		if i < len(operands) && !s.hasSideEffects(operands[i]) {
+			continue
+		}
+		run := operands[start:i]
+		sort.SliceStable(run, func(a, b int) bool {
+			return keys[run[a]] < keys[run[b]]
+		})
+		start = i + 1
+	}
+
+	// Rebuild a left-associative chain, with the root call retaining the id of the original root.
+	chain := operands[0]
+	for i, op := range operands[1:] {
+		id := e.GetId()
+		if i < len(ids) {
+			id = ids[len(ids)-1-i]
+		}
+		chain = &exprpb.Expr{
+			Id: id,
+			ExprKind: &exprpb.Expr_CallExpr{
+				CallExpr: &exprpb.Expr_Call{
+					Function: fn,
+					Args:     []*exprpb.Expr{chain, op},
+				},
+			},
+		}
+	}
+	e.ExprKind = chain.GetExprKind()
+}
+
+// collect gathers the operands of a chain of calls to the logical operator fn in order, along
+// with the ids of the calls within the chain excluding the root.
+func (s *sorter) collect(fn string, e *exprpb.Expr, ids *[]int64, operands *[]*exprpb.Expr) {
+	for _, arg := range e.GetCallExpr().GetArgs() {
+		call := arg.GetCallExpr()
+		if call != nil && call.GetTarget() == nil && call.GetFunction() == fn &&
+			len(call.GetArgs()) == 2 {
+			*ids = append(*ids, arg.GetId())
+			s.collect(fn, arg, ids, operands)
+			continue
+		}
+		*operands = append(*operands, arg)
+	}
+}
+
+// hashKey returns the cel.HashExpression fingerprint of the expression.
+func hashKey(e *exprpb.Expr) uint64 {
+	return cel.HashExpression(cel.ParsedExprToAst(&exprpb.ParsedExpr{Expr: e}))
+}
@@ -0,0 +1,180 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package normalize
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/parser"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestSortConditions(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{a: `a && b && c`, b: `b && a && c`},
+		{a: `a && b && c`, b: `c && (a && b)`},
+		{a: `a || b`, b: `b || a`},
+		{a: `(a || b) && c`, b: `c && (b || a)`},
+		{a: `[x > 1 && y < 2]`, b: `[y < 2 && x > 1]`},
+		{a: `f(x > 1 || y < 2)`, b: `f(y < 2 || x > 1)`},
+		{a: `l.all(i, i > x && i < y)`, b: `l.all(i, i < y && i > x)`},
+	}
+	for _, tc := range tests {
+		a, b := SortConditions(parse(t, tc.a)), SortConditions(parse(t, tc.b))
+		if hashKey(a) != hashKey(b) {
+			t.Errorf("SortConditions(%q) and SortConditions(%q) differ, wanted equal", tc.a, tc.b)
+		}
+	}
+}
+
+func TestSortConditions_Distinct(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{a: `a && (b || c)`, b: `(a && b) || c`},
+		{a: `a && b`, b: `a || b`},
+		{a: `a && b && c`, b: `a && b && d`},
+	}
+	for _, tc := range tests {
+		a, b := SortConditions(parse(t, tc.a)), SortConditions(parse(t, tc.b))
+		if hashKey(a) == hashKey(b) {
+			t.Errorf("SortConditions(%q) and SortConditions(%q) are equal, wanted distinct",
+				tc.a, tc.b)
+		}
+	}
+}
+
+func TestSortConditions_PreservesInput(t *testing.T) {
+	e := parse(t, `c && b && a`)
+	want := unparse(t, e)
+	SortConditions(e)
+	if got := unparse(t, e); got != want {
+		t.Errorf("input modified to %q, wanted %q", got, want)
+	}
+}
+
+func TestSortConditions_UniqueIDs(t *testing.T) {
+	e := SortConditions(parse(t, `d && c && (b || a) && e`))
+	ids := map[int64]bool{}
+	var visit func(*exprpb.Expr)
+	visit = func(e *exprpb.Expr) {
+		if ids[e.GetId()] {
+			t.Errorf("duplicate id %d", e.GetId())
+		}
+		ids[e.GetId()] = true
+		for _, arg := range e.GetCallExpr().GetArgs() {
+			visit(arg)
+		}
+	}
+	visit(e)
+	if len(ids) != 9 {
+		t.Errorf("got %d ids, wanted 9", len(ids))
+	}
+}
+
+func TestSortConditions_Eval(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Declarations(
+			decls.NewVar("x", decls.Int),
+			decls.NewVar("m", decls.NewMapType(decls.String, decls.Int))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]interface{}{"x": 2, "m": map[string]int{}}
+	tests := []string{
+		`x > 1 && m.missing == 1 && x < 3`,
+		`x < 1 || m.missing == 1 || x > 1`,
+		`x > 1 && m.missing == 1 && x > 3`,
+		`x > 1 && x < 3 || x == 0`,
+	}
+	for _, tc := range tests {
+		ast, iss := env.Compile(tc)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		sorted := cel.ParsedExprToAst(&exprpb.ParsedExpr{
+			Expr:       SortConditions(ast.Expr()),
+			SourceInfo: ast.SourceInfo(),
+		})
+		want := eval(t, env, ast, vars)
+		got := eval(t, env, sorted, vars)
+		if got != want {
+			t.Errorf("%s: got %v after sorting, wanted %v", tc, got, want)
+		}
+	}
+}
+
+func TestStableSort(t *testing.T) {
+	impure := func(e *exprpb.Expr) bool {
+		return e.GetCallExpr().GetFunction() == "f"
+	}
+	out := unparse(t, StableSort(parse(t, `f(2) && c && f(1)`), impure))
+	if out != `f(2) && c && f(1)` {
+		t.Errorf("got %q, wanted operands with side-effects to retain their order", out)
+	}
+
+	// Operands within each run are sorted consistently.
+	a := StableSort(parse(t, `c && b && f(1) && a && d`), impure)
+	b := StableSort(parse(t, `b && c && f(1) && d && a`), impure)
+	if hashKey(a) != hashKey(b) {
+		t.Errorf("got %q and %q, wanted equal", unparse(t, a), unparse(t, b))
+	}
+	// Operands do not move across an operand with side-effects.
+	c := StableSort(parse(t, `b && f(1) && c && d && a`), impure)
+	if hashKey(a) == hashKey(c) {
+		t.Errorf("got %q, wanted operands to remain on either side of f(1)", unparse(t, c))
+	}
+	// Without side-effects, all three are equal.
+	if hashKey(SortConditions(parse(t, `b && f(1) && c && d && a`))) != hashKey(SortConditions(a)) {
+		t.Error("SortConditions() did not sort across f(1)")
+	}
+}
+
+func eval(t *testing.T, env *cel.Env, ast *cel.Ast, vars map[string]interface{}) interface{} {
+	t.Helper()
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := prg.Eval(vars)
+	if err != nil {
+		return err.Error()
+	}
+	return out.Value()
+}
+
+func parse(t *testing.T, expr string) *exprpb.Expr {
+	t.Helper()
+	p, iss := parser.Parse(common.NewTextSource(expr))
+	if len(iss.GetErrors()) != 0 {
+		t.Fatal(iss.ToDisplayString())
+	}
+	return p.GetExpr()
+}
+
+func unparse(t *testing.T, e *exprpb.Expr) string {
+	t.Helper()
+	out, err := parser.Unparse(e, &exprpb.SourceInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -0,0 +1,204 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package optimize rewrites checked expressions into simpler equivalent forms by applying a
+// sequence of optimization passes.
+package optimize
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/walk"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Pass is a rewrite of a checked expression.
+type Pass interface {
+	// Name identifies the pass within reports.
+	Name() string
+
+	// Apply rewrites the checked expression. The pass may modify its input in place, and may leave
+	// type map and reference map entries for ids it removed from the expression, since the
+	// Pipeline removes them after each pass.
+	Apply(checked *exprpb.CheckedExpr) (*exprpb.CheckedExpr, error)
+}
+
+// Pipeline applies a sequence of passes to a checked expression.
+type Pipeline struct {
+	passes []Pass
+}
+
+// NewPipeline creates a Pipeline which applies the passes in order.
+func NewPipeline(passes ...Pass) *Pipeline {
+	return &Pipeline{passes: passes}
+}
+
+// Run applies the passes to a copy of the checked expression and returns the optimized copy.
+func (p *Pipeline) Run(checked *exprpb.CheckedExpr) (*exprpb.CheckedExpr, error) {
+	out, _, err := p.run(checked, nil)
+	return out, err
+}
+
+// run applies each pass in turn, invoking the observer with the expression before and after the
+// pass along with the number of type map entries removed.
+func (p *Pipeline) run(checked *exprpb.CheckedExpr,
+	observe func(pass Pass, before, after *exprpb.CheckedExpr, removed int)) (
+	*exprpb.CheckedExpr, int, error) {
+	current := proto.Clone(checked).(*exprpb.CheckedExpr)
+	total := 0
+	for _, pass := range p.passes {
+		var before *exprpb.CheckedExpr
+		if observe != nil {
+			before = proto.Clone(current).(*exprpb.CheckedExpr)
+		}
+		next, err := pass.Apply(current)
+		if err != nil {
+			return nil, 0, fmt.Errorf("optimization pass %s failed: %v", pass.Name(), err)
+		}
+		removed := pruneMaps(next)
+		total += removed
+		if observe != nil {
+			observe(pass, before, next, removed)
+		}
+		current = next
+	}
+	return current, total, nil
+}
+
+// pruneMaps removes the type map and reference map entries whose ids are not present within the
+// expression, and returns the number of type map entries removed.
+func pruneMaps(checked *exprpb.CheckedExpr) int {
+	ids := map[int64]bool{}
+	walk.PreOrder(checked.GetExpr(), func(e *exprpb.Expr) bool {
+		ids[e.GetId()] = true
+		return true
+	})
+	removed := 0
+	for id := range checked.GetTypeMap() {
+		if !ids[id] {
+			delete(checked.TypeMap, id)
+			removed++
+		}
+	}
+	for id := range checked.GetReferenceMap() {
+		if !ids[id] {
+			delete(checked.ReferenceMap, id)
+		}
+	}
+	return removed
+}
+
+// DeadBranchElimination returns a Pass which removes the operands which cannot affect the result
+// of an expression: `x && false` and `false && x` become `false`, `x || true` and `true || x`
+// become `true`, and a conditional with a literal condition becomes the selected branch.
+//
+// The pass only recognizes boolean literals, so it is most effective after constant folding.
+func DeadBranchElimination() Pass {
+	return &deadBranchElimination{}
+}
+
+type deadBranchElimination struct{}
+
+// Name implements the Pass interface method.
+func (*deadBranchElimination) Name() string {
+	return "DeadBranchElimination"
+}
+
+// Apply implements the Pass interface method.
+func (*deadBranchElimination) Apply(checked *exprpb.CheckedExpr) (*exprpb.CheckedExpr, error) {
+	checked.Expr = eliminateDeadBranches(checked.GetExpr())
+	return checked, nil
+}
+
+func eliminateDeadBranches(e *exprpb.Expr) *exprpb.Expr {
+	if e == nil {
+		return nil
+	}
+	switch e.GetExprKind().(type) {
+	case *exprpb.Expr_CallExpr:
+		call := e.GetCallExpr()
+		call.Target = eliminateDeadBranches(call.GetTarget())
+		for i, arg := range call.GetArgs() {
+			call.Args[i] = eliminateDeadBranches(arg)
+		}
+		args := call.GetArgs()
+		switch {
+		case call.GetFunction() == operators.LogicalAnd && len(args) == 2:
+			if absorbing := absorbingOperand(args, false); absorbing != nil {
+				return absorbing
+			}
+		case call.GetFunction() == operators.LogicalOr && len(args) == 2:
+			if absorbing := absorbingOperand(args, true); absorbing != nil {
+				return absorbing
+			}
+		case call.GetFunction() == operators.Conditional && len(args) == 3:
+			if cond, ok := boolLiteral(args[0]); ok {
+				if cond {
+					return args[1]
+				}
+				return args[2]
+			}
+		}
+	case *exprpb.Expr_ComprehensionExpr:
+		comp := e.GetComprehensionExpr()
+		comp.IterRange = eliminateDeadBranches(comp.GetIterRange())
+		comp.AccuInit = eliminateDeadBranches(comp.GetAccuInit())
+		comp.LoopCondition = eliminateDeadBranches(comp.GetLoopCondition())
+		comp.LoopStep = eliminateDeadBranches(comp.GetLoopStep())
+		comp.Result = eliminateDeadBranches(comp.GetResult())
+	case *exprpb.Expr_ListExpr:
+		list := e.GetListExpr()
+		for i, elem := range list.GetElements() {
+			list.Elements[i] = eliminateDeadBranches(elem)
+		}
+	case *exprpb.Expr_SelectExpr:
+		sel := e.GetSelectExpr()
+		sel.Operand = eliminateDeadBranches(sel.GetOperand())
+	case *exprpb.Expr_StructExpr:
+		for _, entry := range e.GetStructExpr().GetEntries() {
+			if entry.GetMapKey() != nil {
+				entry.KeyKind = &exprpb.Expr_CreateStruct_Entry_MapKey{
+					MapKey: eliminateDeadBranches(entry.GetMapKey()),
+				}
+			}
+			entry.Value = eliminateDeadBranches(entry.GetValue())
+		}
+	}
+	return e
+}
+
+// absorbingOperand returns the operand which is the literal value that determines the result of
+// a logical operator, or nil if there is no such operand.
+func absorbingOperand(args []*exprpb.Expr, absorbing bool) *exprpb.Expr {
+	for _, arg := range args {
+		if val, ok := boolLiteral(arg); ok && val == absorbing {
+			return arg
+		}
+	}
+	return nil
+}
+
+// boolLiteral returns the value of the expression if it is a boolean literal.
+func boolLiteral(e *exprpb.Expr) (bool, bool) {
+	c, ok := e.GetConstExpr().GetConstantKind().(*exprpb.Constant_BoolValue)
+	if !ok {
+		return false, false
+	}
+	return c.BoolValue, true
+}
+
@@ -0,0 +1,196 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimize
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+	"github.com/google/cel-go/interpreter/functions"
+	"github.com/google/cel-go/parser"
+
+	"google.golang.org/protobuf/proto"
+
+	proto3pb "github.com/google/cel-go/test/proto3pb"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestDeadBranchElimination(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{in: `x > 1 && false`, out: `false`},
+		{in: `true || x > 1`, out: `true`},
+		{in: `x > 1 && true`, out: `x > 1 && true`},
+		{in: `true ? x : x + 1`, out: `x`},
+		{in: `[false ? 1 : x, x < 2 || true]`, out: `[x, true]`},
+	}
+	for _, tst := range tests {
+		tc := tst
+		t.Run(tc.in, func(t *testing.T) {
+			checked := compile(t, tc.in)
+			in := unparse(t, checked)
+			out, err := NewPipeline(DeadBranchElimination()).Run(checked)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := unparse(t, out); got != tc.out {
+				t.Errorf("got %s, wanted %s", got, tc.out)
+			}
+			if len(out.GetTypeMap()) != countNodes(out.GetExpr()) {
+				t.Errorf("got %d type map entries for %d nodes", len(out.GetTypeMap()),
+					countNodes(out.GetExpr()))
+			}
+			if got := unparse(t, checked); got != in {
+				t.Errorf("input modified to %s", got)
+			}
+		})
+	}
+}
+
+func TestRunWithReport(t *testing.T) {
+	checked := compile(t, `true ? (x > 1 && false) : x < 1`)
+	out, report, err := RunWithReport(NewPipeline(DeadBranchElimination(), noopPass{}), checked,
+		types.NewEmptyRegistry(), types.DefaultTypeAdapter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := unparse(t, out); got != `false` {
+		t.Errorf("got %s, wanted false", got)
+	}
+	if len(report.PassResults) != 2 {
+		t.Fatalf("got %d pass results, wanted 2", len(report.PassResults))
+	}
+	r := report.PassResults[0]
+	if r.PassName != "DeadBranchElimination" || r.NodesEliminated != 9 ||
+		r.TypeMapEntriesRemoved != 9 {
+		t.Errorf("got result %+v", r)
+	}
+	if !proto.Equal(r.OriginalExpr, checked.GetExpr()) || !proto.Equal(r.OptimizedExpr, out.GetExpr()) {
+		t.Errorf("got original %v and optimized %v", r.OriginalExpr, r.OptimizedExpr)
+	}
+	if r := report.PassResults[1]; r.NodesEliminated != 0 || r.TypeMapEntriesRemoved != 0 {
+		t.Errorf("got result %+v for a pass with no changes", r)
+	}
+	savings := report.TotalSavings()
+	if savings.NodesEliminated != 9 || savings.EstimatedCostReduction <= 0 {
+		t.Errorf("got savings %+v", savings)
+	}
+
+	failing := NewPipeline(failingPass{})
+	if _, _, err := RunWithReport(failing, checked, types.NewEmptyRegistry(),
+		types.DefaultTypeAdapter, nil); err == nil {
+		t.Error("got no error for a failing pass")
+	}
+}
+
+func TestRunWithReportEnvironment(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Container("google.expr.proto3.test"),
+		cel.Types(&proto3pb.TestAllTypes{}),
+		cel.Declarations(
+			decls.NewVar("x", decls.Int),
+			decls.NewFunction("double",
+				decls.NewOverload("double_int", []*exprpb.Type{decls.Int}, decls.Int))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(`false && TestAllTypes{single_int64: double(x)}.single_int64 > 1`)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disp := interpreter.NewDispatcher()
+	disp.Add(functions.StandardOverloads()...)
+	disp.Add(&functions.Overload{
+		Operator: "double_int",
+		Unary: func(arg ref.Val) ref.Val {
+			return arg.(types.Int) * 2
+		},
+	})
+	pipeline := NewPipeline(DeadBranchElimination())
+	_, report, err := RunWithReport(pipeline, checked, env.TypeProvider(), env.TypeAdapter(), disp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if savings := report.TotalSavings(); savings.EstimatedCostReduction <= 0 {
+		t.Errorf("got savings %+v, wanted a cost reduction", savings)
+	}
+
+	// Without the environment's types the original expression cannot be planned.
+	_, report, err = RunWithReport(pipeline, checked, types.NewEmptyRegistry(),
+		types.DefaultTypeAdapter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if savings := report.TotalSavings(); savings.EstimatedCostReduction != 0 {
+		t.Errorf("got savings %+v, wanted no cost estimate", savings)
+	}
+}
+
+type noopPass struct{}
+
+func (noopPass) Name() string {
+	return "Noop"
+}
+
+func (noopPass) Apply(checked *exprpb.CheckedExpr) (*exprpb.CheckedExpr, error) {
+	return checked, nil
+}
+
+type failingPass struct{}
+
+func (failingPass) Name() string {
+	return "Failing"
+}
+
+func (failingPass) Apply(checked *exprpb.CheckedExpr) (*exprpb.CheckedExpr, error) {
+	return nil, errors.New("failed")
+}
+
+func compile(t *testing.T, expr string) *exprpb.CheckedExpr {
+	t.Helper()
+	env, err := cel.NewEnv(cel.Declarations(decls.NewVar("x", decls.Int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		t.Fatal(iss.Err())
+	}
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checked
+}
+
+func unparse(t *testing.T, checked *exprpb.CheckedExpr) string {
+	t.Helper()
+	out, err := parser.Unparse(checked.GetExpr(), checked.GetSourceInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
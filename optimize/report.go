@@ -0,0 +1,142 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimize
+
+import (
+	"github.com/google/cel-go/common/containers"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/walk"
+	"github.com/google/cel-go/interpreter"
+	"github.com/google/cel-go/interpreter/functions"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// PassResult describes the changes made by a single optimization pass.
+type PassResult struct {
+	// PassName is the Name() of the pass.
+	PassName string
+
+	// NodesEliminated is the reduction in the number of expression nodes, which is negative if the
+	// pass grew the expression.
+	NodesEliminated int
+
+	// TypeMapEntriesRemoved is the number of type map entries for ids no longer in the expression.
+	TypeMapEntriesRemoved int
+
+	// OriginalExpr is the expression prior to the pass.
+	OriginalExpr *exprpb.Expr
+
+	// OptimizedExpr is the expression produced by the pass.
+	OptimizedExpr *exprpb.Expr
+}
+
+// OptimizationReport describes the changes made by each pass of a Pipeline.
+type OptimizationReport struct {
+	// PassResults holds one result per pass in the order in which the passes were applied.
+	PassResults []PassResult
+
+	// originalCost and optimizedCost are the estimated maximum evaluation costs of the expression
+	// before and after optimization.
+	originalCost  int64
+	optimizedCost int64
+}
+
+// OptimizationSavings summarizes the effect of all passes within an OptimizationReport.
+type OptimizationSavings struct {
+	// NodesEliminated is the reduction in the number of expression nodes.
+	NodesEliminated int
+
+	// EstimatedCostReduction is the reduction in the maximum evaluation cost estimated by the
+	// interpreter, or zero if the cost of the expression could not be estimated.
+	EstimatedCostReduction int64
+}
+
+// TotalSavings returns the combined savings of all passes.
+func (r *OptimizationReport) TotalSavings() OptimizationSavings {
+	savings := OptimizationSavings{
+		EstimatedCostReduction: r.originalCost - r.optimizedCost,
+	}
+	for _, result := range r.PassResults {
+		savings.NodesEliminated += result.NodesEliminated
+	}
+	return savings
+}
+
+// RunWithReport applies the pipeline to a copy of the checked expression, and returns the
+// optimized copy along with a report of the changes made by each pass.
+//
+// The evaluation costs in the report are estimated by planning the expression with the type
+// provider, adapter, and dispatcher of the environment the expression was checked against, so that
+// messages and custom functions are planned as they would be by a program. A nil dispatcher plans
+// the expression with the standard functions only.
+func RunWithReport(pipeline *Pipeline, checked *exprpb.CheckedExpr,
+	provider ref.TypeProvider, adapter ref.TypeAdapter, dispatcher interpreter.Dispatcher) (
+	*exprpb.CheckedExpr, *OptimizationReport, error) {
+	report := &OptimizationReport{}
+	out, _, err := pipeline.run(checked,
+		func(pass Pass, before, after *exprpb.CheckedExpr, removed int) {
+			report.PassResults = append(report.PassResults, PassResult{
+				PassName:              pass.Name(),
+				NodesEliminated:       countNodes(before.GetExpr()) - countNodes(after.GetExpr()),
+				TypeMapEntriesRemoved: removed,
+				OriginalExpr:          before.GetExpr(),
+				// Subsequent passes may modify the expression in place.
+				OptimizedExpr: proto.Clone(after.GetExpr()).(*exprpb.Expr),
+			})
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+	if dispatcher == nil {
+		dispatcher = interpreter.NewDispatcher()
+		dispatcher.Add(functions.StandardOverloads()...)
+	}
+	interp := interpreter.NewInterpreter(dispatcher, containers.DefaultContainer, provider, adapter,
+		interpreter.NewAttributeFactory(containers.DefaultContainer, adapter, provider))
+	origCost, origOK := estimateCost(interp, checked)
+	optCost, optOK := estimateCost(interp, out)
+	if origOK && optOK {
+		report.originalCost = origCost
+		report.optimizedCost = optCost
+	}
+	return out, report, nil
+}
+
+func countNodes(e *exprpb.Expr) int {
+	count := 0
+	walk.PreOrder(e, func(*exprpb.Expr) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// estimateCost returns the maximum cost estimated by planning the checked expression with the
+// interpreter.
+func estimateCost(interp interpreter.Interpreter, checked *exprpb.CheckedExpr) (int64, bool) {
+	i, err := interp.NewInterpretable(checked)
+	if err != nil {
+		return 0, false
+	}
+	c, ok := i.(interpreter.Coster)
+	if !ok {
+		return 0, false
+	}
+	_, max := c.Cost()
+	return max, true
+}
@@ -20,6 +20,8 @@ import (
 	"github.com/antlr/antlr4/runtime/Go/antlr"
 	"github.com/google/cel-go/common"
 
+	"google.golang.org/protobuf/proto"
+
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
 )
 
@@ -27,6 +29,9 @@ type parserHelper struct {
 	source    common.Source
 	nextID    int64
 	positions map[int64]int32
+	exprPool  *sync.Pool
+	// macroCalls is nil unless the calls replaced by macros are recorded.
+	macroCalls map[int64]*exprpb.Expr
 }
 
 func newParserHelper(source common.Source) *parserHelper {
@@ -41,7 +46,23 @@ func (p *parserHelper) getSourceInfo() *exprpb.SourceInfo {
 	return &exprpb.SourceInfo{
 		Location:    p.source.Description(),
 		Positions:   p.positions,
-		LineOffsets: p.source.LineOffsets()}
+		LineOffsets: p.source.LineOffsets(),
+		MacroCalls:  p.macroCalls}
+}
+
+// addMacroCall records the call with the given id which a macro replaced with the expression
+// with the given id. The target and arguments are copied, since they are also part of the
+// expansion.
+func (p *parserHelper) addMacroCall(exprID, callID int64, function string,
+	target *exprpb.Expr, args ...*exprpb.Expr) {
+	call := &exprpb.Expr_Call{Function: function}
+	if target != nil {
+		call.Target = proto.Clone(target).(*exprpb.Expr)
+	}
+	for _, arg := range args {
+		call.Args = append(call.Args, proto.Clone(arg).(*exprpb.Expr))
+	}
+	p.macroCalls[exprID] = &exprpb.Expr{Id: callID, ExprKind: &exprpb.Expr_CallExpr{CallExpr: call}}
 }
 
 func (p *parserHelper) newLiteral(ctx interface{}, value *exprpb.Constant) *exprpb.Expr {
@@ -174,10 +195,15 @@ func (p *parserHelper) newComprehension(ctx interface{}, iterVar string,
 
 func (p *parserHelper) newExpr(ctx interface{}) *exprpb.Expr {
 	id, isID := ctx.(int64)
-	if isID {
-		return &exprpb.Expr{Id: id}
+	if !isID {
+		id = p.id(ctx)
+	}
+	if p.exprPool != nil {
+		e := p.exprPool.Get().(*exprpb.Expr)
+		e.Id = id
+		return e
 	}
-	return &exprpb.Expr{Id: p.id(ctx)}
+	return &exprpb.Expr{Id: id}
 }
 
 func (p *parserHelper) id(ctx interface{}) int64 {
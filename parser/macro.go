@@ -138,6 +138,9 @@ func makeVarArgMacroKey(name string, receiverStyle bool) string {
 // MacroExpander converts the target and args of a function call that matches a Macro.
 //
 // Note: when the Macros.IsReceiverStyle() is true, the target argument will be nil.
+//
+// An expander which returns a nil expression and a nil error leaves the call unexpanded, such as
+// when a receiver-style macro applies only to a particular target.
 type MacroExpander func(eh ExprHelper,
 	target *exprpb.Expr,
 	args []*exprpb.Expr) (*exprpb.Expr, *common.Error)
@@ -48,13 +48,33 @@ func Parse(source common.Source) (*exprpb.ParsedExpr, *common.Errors) {
 
 // ParseWithMacros converts a source input and macros set to a parsed expression.
 func ParseWithMacros(source common.Source, macros []Macro) (*exprpb.ParsedExpr, *common.Errors) {
+	return parseWithPool(source, macros, nil, false)
+}
+
+// ParseWithMacroCalls converts a source input and macros set to a parsed expression, recording the
+// call replaced by each macro expansion in the SourceInfo.MacroCalls of the result, keyed by the id
+// of the expansion. Unparse uses the recorded calls to reconstruct the macros.
+func ParseWithMacroCalls(source common.Source, macros []Macro) (*exprpb.ParsedExpr, *common.Errors) {
+	return parseWithPool(source, macros, nil, true)
+}
+
+// parseWithPool parses the source, allocating expression nodes from the exprPool when non-nil.
+func parseWithPool(source common.Source,
+	macros []Macro,
+	exprPool *sync.Pool,
+	recordMacroCalls bool) (*exprpb.ParsedExpr, *common.Errors) {
 	macroMap := make(map[string]Macro)
 	for _, m := range macros {
 		macroMap[m.MacroKey()] = m
 	}
+	helper := newParserHelper(source)
+	helper.exprPool = exprPool
+	if recordMacroCalls {
+		helper.macroCalls = make(map[int64]*exprpb.Expr)
+	}
 	p := parser{
 		errors: &parseErrors{common.NewErrors(source)},
-		helper: newParserHelper(source),
+		helper: helper,
 		macros: macroMap,
 	}
 	e := p.parse(source.Content())
@@ -646,5 +666,12 @@ func (p *parser) expandMacro(exprID int64, function string, target *exprpb.Expr,
 		}
 		return p.reportError(p.helper.getLocation(exprID), err.Message), true
 	}
+	// A nil expression indicates that the expander declined to expand the call.
+	if expr == nil {
+		return nil, false
+	}
+	if p.helper.macroCalls != nil {
+		p.helper.addMacroCall(expr.GetId(), exprID, function, target, args...)
+	}
 	return expr, true
 }
@@ -0,0 +1,192 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/walk"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// ExprPool retains the parse results of frequently parsed expressions to avoid parsing the same
+// source text repeatedly.
+//
+// The pool retains the parse result for up to `capacity` distinct source texts. Subsequent calls
+// to Get for a retained source copy the retained result rather than parsing the source again.
+// Copies are built from expression nodes recycled through a sync.Pool: expressions returned from
+// Get should be returned to the pool with Put once they are no longer referenced.
+//
+// The ExprPool is safe for concurrent use.
+type ExprPool struct {
+	capacity int
+	exprs    *sync.Pool
+
+	mu        sync.RWMutex
+	templates map[string]*exprpb.ParsedExpr
+}
+
+// NewExprPool creates an ExprPool which retains the parse results of up to `capacity` distinct
+// source texts.
+func NewExprPool(capacity int) *ExprPool {
+	return &ExprPool{
+		capacity: capacity,
+		exprs: &sync.Pool{
+			New: func() interface{} {
+				return &exprpb.Expr{}
+			},
+		},
+		templates: make(map[string]*exprpb.ParsedExpr),
+	}
+}
+
+// Get returns the parsed form of the source text, parsed with the standard macros.
+func (c *ExprPool) Get(src string) (*exprpb.ParsedExpr, error) {
+	c.mu.RLock()
+	tmpl, found := c.templates[src]
+	c.mu.RUnlock()
+	if !found {
+		parsed, errs := parseWithPool(common.NewTextSource(src), AllMacros, c.exprs, false)
+		if len(errs.GetErrors()) != 0 {
+			return nil, errors.New(errs.ToDisplayString())
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if len(c.templates) >= c.capacity {
+			return parsed, nil
+		}
+		tmpl = parsed
+		c.templates[src] = tmpl
+	}
+	return &exprpb.ParsedExpr{
+		Expr:       c.copyExpr(tmpl.GetExpr()),
+		SourceInfo: proto.Clone(tmpl.GetSourceInfo()).(*exprpb.SourceInfo),
+	}, nil
+}
+
+// Put resets the expression nodes of the parsed expression and returns them for reuse by later
+// calls to Get.
+//
+// The parsed expression must not be used after it has been returned to the pool.
+func (c *ExprPool) Put(parsed *exprpb.ParsedExpr) {
+	c.put(parsed.GetExpr())
+	parsed.Expr = nil
+}
+
+// newExpr returns a recycled expression node with the given id.
+func (c *ExprPool) newExpr(id int64) *exprpb.Expr {
+	e := c.exprs.Get().(*exprpb.Expr)
+	e.Id = id
+	return e
+}
+
+// copyExpr deep copies the expression graph using recycled expression nodes.
+func (c *ExprPool) copyExpr(e *exprpb.Expr) *exprpb.Expr {
+	if e == nil {
+		return nil
+	}
+	cpy := c.newExpr(e.GetId())
+	switch e.GetExprKind().(type) {
+	case *exprpb.Expr_ConstExpr:
+		cpy.ExprKind = &exprpb.Expr_ConstExpr{
+			ConstExpr: proto.Clone(e.GetConstExpr()).(*exprpb.Constant)}
+	case *exprpb.Expr_IdentExpr:
+		cpy.ExprKind = &exprpb.Expr_IdentExpr{
+			IdentExpr: &exprpb.Expr_Ident{Name: e.GetIdentExpr().GetName()}}
+	case *exprpb.Expr_SelectExpr:
+		sel := e.GetSelectExpr()
+		cpy.ExprKind = &exprpb.Expr_SelectExpr{
+			SelectExpr: &exprpb.Expr_Select{
+				Operand:  c.copyExpr(sel.GetOperand()),
+				Field:    sel.GetField(),
+				TestOnly: sel.GetTestOnly()}}
+	case *exprpb.Expr_CallExpr:
+		call := e.GetCallExpr()
+		cpy.ExprKind = &exprpb.Expr_CallExpr{
+			CallExpr: &exprpb.Expr_Call{
+				Target:   c.copyExpr(call.GetTarget()),
+				Function: call.GetFunction(),
+				Args:     c.copyExprs(call.GetArgs())}}
+	case *exprpb.Expr_ListExpr:
+		cpy.ExprKind = &exprpb.Expr_ListExpr{
+			ListExpr: &exprpb.Expr_CreateList{
+				Elements: c.copyExprs(e.GetListExpr().GetElements())}}
+	case *exprpb.Expr_StructExpr:
+		st := e.GetStructExpr()
+		entries := make([]*exprpb.Expr_CreateStruct_Entry, len(st.GetEntries()))
+		for i, entry := range st.GetEntries() {
+			cpyEntry := &exprpb.Expr_CreateStruct_Entry{
+				Id:    entry.GetId(),
+				Value: c.copyExpr(entry.GetValue())}
+			switch entry.GetKeyKind().(type) {
+			case *exprpb.Expr_CreateStruct_Entry_FieldKey:
+				cpyEntry.KeyKind = &exprpb.Expr_CreateStruct_Entry_FieldKey{
+					FieldKey: entry.GetFieldKey()}
+			case *exprpb.Expr_CreateStruct_Entry_MapKey:
+				cpyEntry.KeyKind = &exprpb.Expr_CreateStruct_Entry_MapKey{
+					MapKey: c.copyExpr(entry.GetMapKey())}
+			}
+			entries[i] = cpyEntry
+		}
+		cpy.ExprKind = &exprpb.Expr_StructExpr{
+			StructExpr: &exprpb.Expr_CreateStruct{
+				MessageName: st.GetMessageName(),
+				Entries:     entries}}
+	case *exprpb.Expr_ComprehensionExpr:
+		comp := e.GetComprehensionExpr()
+		cpy.ExprKind = &exprpb.Expr_ComprehensionExpr{
+			ComprehensionExpr: &exprpb.Expr_Comprehension{
+				IterVar:       comp.GetIterVar(),
+				IterRange:     c.copyExpr(comp.GetIterRange()),
+				AccuVar:       comp.GetAccuVar(),
+				AccuInit:      c.copyExpr(comp.GetAccuInit()),
+				LoopCondition: c.copyExpr(comp.GetLoopCondition()),
+				LoopStep:      c.copyExpr(comp.GetLoopStep()),
+				Result:        c.copyExpr(comp.GetResult())}}
+	}
+	return cpy
+}
+
+func (c *ExprPool) copyExprs(exprs []*exprpb.Expr) []*exprpb.Expr {
+	if len(exprs) == 0 {
+		return []*exprpb.Expr{}
+	}
+	cpy := make([]*exprpb.Expr, len(exprs))
+	for i, e := range exprs {
+		cpy[i] = c.copyExpr(e)
+	}
+	return cpy
+}
+
+// put resets the expression graph and returns its nodes to the pool.
+func (c *ExprPool) put(e *exprpb.Expr) {
+	if e == nil {
+		return
+	}
+	var nodes []*exprpb.Expr
+	walk.PreOrder(e, func(n *exprpb.Expr) bool {
+		nodes = append(nodes, n)
+		return true
+	})
+	for _, n := range nodes {
+		n.Reset()
+		c.exprs.Put(n)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/common"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const poolTestExpr = `a.b.c == 1 && d.e > 2.0 || f in [1, 2, 3] && g.exists(x, x.startsWith('y'))`
+
+func TestExprPool(t *testing.T) {
+	want, errs := Parse(common.NewTextSource(poolTestExpr))
+	if len(errs.GetErrors()) != 0 {
+		t.Fatal(errs.ToDisplayString())
+	}
+	pool := NewExprPool(1)
+	for i := 0; i < 3; i++ {
+		got, err := pool.Get(poolTestExpr)
+		if err != nil {
+			t.Fatalf("pool.Get() failed: %v", err)
+		}
+		if !proto.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+		pool.Put(got)
+	}
+
+	// Sources beyond the pool capacity are parsed on each call.
+	got, err := pool.Get(`x + 1`)
+	if err != nil {
+		t.Fatalf("pool.Get() failed: %v", err)
+	}
+	want, _ = Parse(common.NewTextSource(`x + 1`))
+	if !proto.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+	pool.Put(got)
+
+	if _, err := pool.Get(`1 +`); err == nil {
+		t.Error("got nil, wanted parse error")
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	src := common.NewTextSource(poolTestExpr)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Parse(src)
+	}
+}
+
+func BenchmarkExprPool(b *testing.B) {
+	pool := NewExprPool(1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		parsed, err := pool.Get(poolTestExpr)
+		if err != nil {
+			b.Fatal(err)
+		}
+		pool.Put(parsed)
+	}
+}
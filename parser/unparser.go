@@ -35,6 +35,9 @@ import (
 // - Floating point values are converted to the small number of digits needed to represent the value.
 // - Spacing around punctuation marks may be lost.
 // - Parentheses will only be applied when they affect operator precedence.
+//
+// Comprehensions can only be unparsed when the source info records the macro calls they expand, as
+// produced by ParseWithMacroCalls.
 func Unparse(expr *exprpb.Expr, info *exprpb.SourceInfo) (string, error) {
 	un := &unparser{info: info}
 	err := un.visit(expr)
@@ -48,15 +51,17 @@ func Unparse(expr *exprpb.Expr, info *exprpb.SourceInfo) (string, error) {
 type unparser struct {
 	str    strings.Builder
 	offset int32
-	// TODO: use the source info to rescontruct macros into function calls.
+	// info supplies the macro calls which reconstruct macro expansions.
 	info *exprpb.SourceInfo
 }
 
 func (un *unparser) visit(expr *exprpb.Expr) error {
+	if call, found := un.info.GetMacroCalls()[expr.GetId()]; found {
+		return un.visitCall(call)
+	}
 	switch expr.ExprKind.(type) {
 	case *exprpb.Expr_CallExpr:
 		return un.visitCall(expr)
-	// TODO: Comprehensions are currently not supported.
 	case *exprpb.Expr_ComprehensionExpr:
 		return un.visitComprehension(expr)
 	case *exprpb.Expr_ConstExpr:
@@ -221,8 +226,7 @@ func (un *unparser) visitCallUnary(expr *exprpb.Expr) error {
 }
 
 func (un *unparser) visitComprehension(expr *exprpb.Expr) error {
-	// TODO: introduce a macro expansion map between the top-level comprehension id and the
-	// function call that the macro replaces.
+	// Comprehensions have no syntax of their own, and are only unparsed from their macro calls.
 	return fmt.Errorf("unimplemented : %v", expr)
 }
 
@@ -84,10 +84,6 @@ func TestUnparse_Identical(t *testing.T) {
 		"cond_binop":          `(x < 5) ? x : 5`,
 		"cond_binop_binop":    `(x > 5) ? (x - 5) : 0`,
 		"cond_cond_binop":     `(x > 5) ? ((x > 10) ? (x - 10) : 5) : 0`,
-		//"comp_all":            `[1, 2, 3].all(x, x > 0)`,
-		//"comp_exists":         `[1, 2, 3].exists(x, x > 0)`,
-		//"comp_map":            `[1, 2, 3].map(x, x >= 2, x * 4)`,
-		//"comp_exists_one":     `[1, 2, 3].exists_one(x, x >= 2)`,
 	}
 
 	for name, in := range tests {
@@ -148,3 +144,37 @@ func TestUnparse_Equivalent(t *testing.T) {
 		})
 	}
 }
+
+func TestUnparse_MacroCalls(t *testing.T) {
+	tests := map[string]string{
+		"comp_all":        `[1, 2, 3].all(x, x > 0)`,
+		"comp_exists":     `[1, 2, 3].exists(x, x > 0)`,
+		"comp_map":        `[1, 2, 3].map(x, x >= 2, x * 4)`,
+		"comp_exists_one": `[1, 2, 3].exists_one(x, x >= 2)`,
+		"comp_nested":     `a.exists(x, x.b.all(y, y > x.c)) && has(a.d)`,
+	}
+
+	for name, in := range tests {
+		t.Run(name, func(tt *testing.T) {
+			p, iss := ParseWithMacroCalls(common.NewTextSource(in), AllMacros)
+			if len(iss.GetErrors()) > 0 {
+				tt.Fatal(iss.ToDisplayString())
+			}
+			out, err := Unparse(p.GetExpr(), p.GetSourceInfo())
+			if err != nil {
+				tt.Fatal(err)
+			}
+			if out != in {
+				tt.Errorf("Got '%s', wanted '%s'", out, in)
+			}
+		})
+	}
+
+	p, iss := Parse(common.NewTextSource(tests["comp_all"]))
+	if len(iss.GetErrors()) > 0 {
+		t.Fatal(iss.ToDisplayString())
+	}
+	if _, err := Unparse(p.GetExpr(), p.GetSourceInfo()); err == nil {
+		t.Error("Unparse() got no error for a comprehension without its macro call")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package quote escapes CEL expression sources as string literals of other languages, so that
+// expressions can be embedded within YAML documents, JSON documents, and SQL statements.
+//
+// Expression sources are expected to be valid UTF-8, as produced by the parser's sources.
+package quote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ForYAML returns the source as a YAML flow scalar which a YAML parser reads as the source.
+//
+// Single-line sources of printable characters are enclosed in single quotes, with embedded single
+// quotes doubled. Since YAML folds line breaks within single-quoted scalars, other sources are
+// written as double-quoted scalars with backslash escapes.
+func ForYAML(src string) string {
+	for _, r := range src {
+		if !unicode.IsPrint(r) && r != '\t' {
+			return yamlDoubleQuoted(src)
+		}
+	}
+	return "'" + strings.ReplaceAll(src, "'", "''") + "'"
+}
+
+func yamlDoubleQuoted(src string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range src {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			switch {
+			case unicode.IsPrint(r):
+				buf.WriteRune(r)
+			case r <= 0xFFFF:
+				fmt.Fprintf(&buf, `\u%04X`, r)
+			default:
+				fmt.Fprintf(&buf, `\U%08X`, r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// ForJSON returns the source as a JSON string literal.
+//
+// Unlike json.Marshal, the characters `<`, `>`, and `&` are not escaped, so that expressions remain
+// legible within JSON documents.
+func ForJSON(src string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// Encoding a string cannot fail.
+	_ = enc.Encode(src)
+	// Remove the newline which the encoder appends.
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// ForSQL returns the source as a standard SQL string literal, enclosed in single quotes with
+// embedded single quotes doubled.
+//
+// Backslashes are not escaped, as standard SQL does not treat them specially. Dialects which do,
+// such as MySQL without the NO_BACKSLASH_ESCAPES mode, are not supported.
+func ForSQL(src string) string {
+	return "'" + strings.ReplaceAll(src, "'", "''") + "'"
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quote
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var sources = []string{
+	``,
+	`a == 'b'`,
+	`"it's" + '\n' == x`,
+	"x.all(i,\n\ti < 10)\r\n",
+	`a < b && c > d || e & f`,
+	"'é' + '\u2028' + '\u0085' + '\x00' + '\U0001F600'",
+}
+
+func TestForYAML(t *testing.T) {
+	want := []string{
+		`''`,
+		`'a == ''b'''`,
+		`'"it''s" + ''\n'' == x'`,
+		`"x.all(i,\n\ti < 10)\r\n"`,
+		`'a < b && c > d || e & f'`,
+		"\"'é' + '\\u2028' + '\\u0085' + '\\u0000' + '\U0001F600'\"",
+	}
+	for i, src := range sources {
+		if got := ForYAML(src); got != want[i] {
+			t.Errorf("ForYAML(%q) got %s, wanted %s", src, got, want[i])
+		}
+	}
+}
+
+func TestForJSON(t *testing.T) {
+	for _, src := range sources {
+		quoted := ForJSON(src)
+		var got string
+		if err := json.Unmarshal([]byte(quoted), &got); err != nil {
+			t.Errorf("ForJSON(%q) got invalid JSON %s: %v", src, quoted, err)
+			continue
+		}
+		if got != src {
+			t.Errorf("ForJSON(%q) got %s, which parses as %q", src, quoted, got)
+		}
+	}
+	if got := ForJSON(`a < b && c > d`); got != `"a < b && c > d"` {
+		t.Errorf("ForJSON() escaped HTML characters: %s", got)
+	}
+}
+
+func TestForSQL(t *testing.T) {
+	want := []string{
+		`''`,
+		`'a == ''b'''`,
+		`'"it''s" + ''\n'' == x'`,
+		"'x.all(i,\n\ti < 10)\r\n'",
+		`'a < b && c > d || e & f'`,
+		"'''é'' + ''\u2028'' + ''\u0085'' + ''\x00'' + ''\U0001F600'''",
+	}
+	for i, src := range sources {
+		if got := ForSQL(src); got != want[i] {
+			t.Errorf("ForSQL(%q) got %s, wanted %s", src, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stats reports aggregate metrics over a corpus of checked CEL expressions.
+package stats
+
+import (
+	"math"
+	"sort"
+
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/common/walk"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Statistics summarizes the functions, types, and shapes of a corpus of checked expressions.
+type Statistics struct {
+	functions      map[string]int
+	types          map[string]int
+	depths         []int
+	nodeCounts     []int
+	comprehensions int
+}
+
+// Collect computes the Statistics for the expressions with a single walk over each expression.
+func Collect(exprs []*exprpb.CheckedExpr) *Statistics {
+	s := &Statistics{
+		functions: make(map[string]int),
+		types:     make(map[string]int),
+	}
+	for _, c := range exprs {
+		w := &walker{stats: s, typeMap: c.GetTypeMap()}
+		w.walk(c.GetExpr(), 1)
+		s.depths = append(s.depths, w.maxDepth)
+		s.nodeCounts = append(s.nodeCounts, w.nodeCount)
+	}
+	sort.Ints(s.nodeCounts)
+	return s
+}
+
+// FunctionFrequency returns the number of calls to each function, keyed by function name.
+func (s *Statistics) FunctionFrequency() map[string]int {
+	return copyCounts(s.functions)
+}
+
+// TypeFrequency returns the number of expression nodes of each type, keyed by the formatted type
+// name.
+func (s *Statistics) TypeFrequency() map[string]int {
+	return copyCounts(s.types)
+}
+
+// AverageDepth returns the mean depth of the expressions, where a lone literal has a depth of one.
+func (s *Statistics) AverageDepth() float64 {
+	if len(s.depths) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, d := range s.depths {
+		sum += d
+	}
+	return float64(sum) / float64(len(s.depths))
+}
+
+// P99NodeCount returns the 99th percentile of the number of nodes per expression using the
+// nearest-rank method.
+func (s *Statistics) P99NodeCount() int {
+	if len(s.nodeCounts) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(0.99 * float64(len(s.nodeCounts))))
+	return s.nodeCounts[rank-1]
+}
+
+// ComprehensionCount returns the total number of comprehensions within the expressions.
+func (s *Statistics) ComprehensionCount() int {
+	return s.comprehensions
+}
+
+type walker struct {
+	stats     *Statistics
+	typeMap   map[int64]*exprpb.Type
+	maxDepth  int
+	nodeCount int
+}
+
+func (w *walker) walk(e *exprpb.Expr, depth int) {
+	if e == nil {
+		return
+	}
+	w.nodeCount++
+	if depth > w.maxDepth {
+		w.maxDepth = depth
+	}
+	if t, found := w.typeMap[e.GetId()]; found {
+		w.stats.types[checker.FormatCheckedType(t)]++
+	}
+	switch e.GetExprKind().(type) {
+	case *exprpb.Expr_CallExpr:
+		w.stats.functions[e.GetCallExpr().GetFunction()]++
+	case *exprpb.Expr_ComprehensionExpr:
+		w.stats.comprehensions++
+	}
+	for _, c := range walk.Children(e) {
+		w.walk(c, depth+1)
+	}
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	cpy := make(map[string]int, len(counts))
+	for k, v := range counts {
+		cpy[k] = v
+	}
+	return cpy
+}
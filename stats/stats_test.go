@@ -0,0 +1,72 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestCollect(t *testing.T) {
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("x", decls.Int),
+		decls.NewVar("names", decls.NewListType(decls.String))))
+	if err != nil {
+		t.Fatalf("cel.NewEnv() failed: %v", err)
+	}
+	var exprs []*exprpb.CheckedExpr
+	for _, src := range []string{
+		`true`,
+		`x + 1 > 2`,
+		`names.exists(n, n.startsWith('a'))`,
+	} {
+		ast, iss := env.Compile(src)
+		if iss.Err() != nil {
+			t.Fatal(iss.Err())
+		}
+		checked, err := cel.AstToCheckedExpr(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exprs = append(exprs, checked)
+	}
+	s := Collect(exprs)
+
+	funcs := s.FunctionFrequency()
+	if funcs["_+_"] != 1 || funcs["_>_"] != 1 || funcs["startsWith"] != 1 {
+		t.Errorf("got function frequency %v, wanted _+_, _>_, and startsWith once each", funcs)
+	}
+	typs := s.TypeFrequency()
+	if typs["bool"] == 0 || typs["int"] != 4 || typs["list(string)"] != 1 {
+		t.Errorf("got type frequency %v, wanted bool, four ints, and one list(string)", typs)
+	}
+	if s.ComprehensionCount() != 1 {
+		t.Errorf("got %d comprehensions, wanted 1", s.ComprehensionCount())
+	}
+	// Depths: `true` is 1, `x + 1 > 2` is 3, and the comprehension is at least 4.
+	if avg := s.AverageDepth(); avg < 8.0/3 {
+		t.Errorf("got average depth %v, wanted at least 8/3", avg)
+	}
+	if p99 := s.P99NodeCount(); p99 <= 5 {
+		t.Errorf("got p99 node count %d, wanted the size of the comprehension", p99)
+	}
+	if Collect(nil).P99NodeCount() != 0 {
+		t.Error("got non-zero p99 node count for an empty corpus")
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transpiler provides the configuration shared by the translators of CEL expressions into
+// other languages, and an importer which translates Rego policies into CEL.
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/common/walk"
+
+	"google.golang.org/protobuf/proto"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Supported dialect names.
+const (
+	DialectSQL  = "sql"
+	DialectRego = "rego"
+)
+
+// UnsupportedBehavior determines how a transpiler handles CEL constructs which have no
+// equivalent in the target language.
+type UnsupportedBehavior int
+
+const (
+	// Error fails the transpilation.
+	Error UnsupportedBehavior = iota
+
+	// Warn transpiles the remainder of the expression and reports a warning for the construct.
+	Warn
+
+	// BestEffort emits an approximation of the construct without reporting it.
+	BestEffort
+)
+
+// String returns the name of the behavior.
+func (b UnsupportedBehavior) String() string {
+	switch b {
+	case Error:
+		return "Error"
+	case Warn:
+		return "Warn"
+	case BestEffort:
+		return "BestEffort"
+	}
+	return fmt.Sprintf("UnsupportedBehavior(%d)", int(b))
+}
+
+// Config controls how a CEL expression is transpiled.
+type Config struct {
+	// IdentMapping renames identifiers, keyed by the fully-qualified CEL identifier name.
+	IdentMapping map[string]string
+
+	// FunctionMapping renames functions, keyed by the CEL function name.
+	FunctionMapping map[string]string
+
+	// UnsupportedBehavior determines how unsupported constructs are handled.
+	UnsupportedBehavior UnsupportedBehavior
+
+	// DialectVersion selects a version of the target language, with the empty string denoting the
+	// transpiler's default.
+	DialectVersion string
+}
+
+// Apply returns a copy of the expression in which the identifiers and functions named by the
+// config's mappings are renamed.
+//
+// Qualified identifiers which the parser represents as field selections, such as `a.b.c`, are
+// renamed as a whole when the qualified name is present within IdentMapping.
+func (c Config) Apply(e *exprpb.Expr) *exprpb.Expr {
+	if e == nil {
+		return nil
+	}
+	out := proto.Clone(e).(*exprpb.Expr)
+	c.apply(out)
+	return out
+}
+
+func (c Config) apply(e *exprpb.Expr) {
+	walk.PreOrder(e, func(n *exprpb.Expr) bool {
+		switch n.GetExprKind().(type) {
+		case *exprpb.Expr_IdentExpr:
+			ident := n.GetIdentExpr()
+			if name, found := c.IdentMapping[ident.GetName()]; found {
+				ident.Name = name
+			}
+		case *exprpb.Expr_SelectExpr:
+			sel := n.GetSelectExpr()
+			if qname, found := qualifiedName(n); found && !sel.GetTestOnly() {
+				if name, found := c.IdentMapping[qname]; found {
+					n.ExprKind = &exprpb.Expr_IdentExpr{IdentExpr: &exprpb.Expr_Ident{Name: name}}
+					return false
+				}
+			}
+		case *exprpb.Expr_CallExpr:
+			call := n.GetCallExpr()
+			if name, found := c.FunctionMapping[call.GetFunction()]; found {
+				call.Function = name
+			}
+		}
+		return true
+	})
+}
+
+// qualifiedName returns the dot-separated name of an identifier or chain of field selections.
+func qualifiedName(e *exprpb.Expr) (string, bool) {
+	switch e.GetExprKind().(type) {
+	case *exprpb.Expr_IdentExpr:
+		return e.GetIdentExpr().GetName(), true
+	case *exprpb.Expr_SelectExpr:
+		sel := e.GetSelectExpr()
+		if prefix, found := qualifiedName(sel.GetOperand()); found {
+			return prefix + "." + sel.GetField(), true
+		}
+	}
+	return "", false
+}
+
+// dialect describes the constraints a target language places on a Config.
+type dialect struct {
+	// name matches the valid (possibly qualified) names within the dialect.
+	name *regexp.Regexp
+	// reserved holds the words which may not be used as a name or a segment of a name.
+	reserved map[string]bool
+	// caseInsensitive indicates whether reserved words match regardless of case.
+	caseInsensitive bool
+}
+
+// qualifiedIdent matches a dot-separated sequence of identifiers.
+var qualifiedIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+var dialects = map[string]*dialect{
+	DialectSQL: {
+		name: qualifiedIdent,
+		reserved: wordSet("ALL", "AND", "AS", "BETWEEN", "BY", "CASE", "CAST", "DISTINCT",
+			"ELSE", "END", "EXISTS", "FALSE", "FROM", "GROUP", "HAVING", "IN", "IS", "JOIN",
+			"LIKE", "LIMIT", "NOT", "NULL", "ON", "OR", "ORDER", "SELECT", "THEN", "TRUE", "UNION",
+			"WHEN", "WHERE"),
+		caseInsensitive: true,
+	},
+	DialectRego: {
+		name: qualifiedIdent,
+		reserved: wordSet("as", "default", "else", "false", "import", "not", "null", "package",
+			"some", "true", "with"),
+	},
+}
+
+func wordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// Validate checks that the config may be used with the named dialect, either `sql` or `rego`.
+//
+// The mapped identifier and function names must be valid, possibly dot-qualified, names in the
+// dialect and must not be reserved words, and the UnsupportedBehavior must be a known value. The
+// DialectVersion is interpreted by each transpiler and is not checked.
+func Validate(config Config, dialectName string) error {
+	d, found := dialects[dialectName]
+	if !found {
+		return fmt.Errorf("unknown dialect: %q", dialectName)
+	}
+	switch config.UnsupportedBehavior {
+	case Error, Warn, BestEffort:
+	default:
+		return fmt.Errorf("invalid unsupported behavior: %v", config.UnsupportedBehavior)
+	}
+	if err := d.validateMapping("identifier", config.IdentMapping); err != nil {
+		return err
+	}
+	return d.validateMapping("function", config.FunctionMapping)
+}
+
+func (d *dialect) validateMapping(kind string, mapping map[string]string) error {
+	keys := make([]string, 0, len(mapping))
+	for k := range mapping {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "" {
+			return fmt.Errorf("%s mapping has an empty key", kind)
+		}
+		v := mapping[k]
+		if !d.name.MatchString(v) {
+			return fmt.Errorf("%s mapping %q -> %q: invalid name", kind, k, v)
+		}
+		for _, word := range strings.Split(v, ".") {
+			if d.caseInsensitive {
+				word = strings.ToUpper(word)
+			}
+			if d.reserved[word] {
+				return fmt.Errorf("%s mapping %q -> %q: reserved word", kind, k, v)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/parser"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+func TestApply(t *testing.T) {
+	config := Config{
+		IdentMapping: map[string]string{
+			"user":         "u",
+			"request.auth": "auth_claims",
+		},
+		FunctionMapping: map[string]string{
+			"startsWith": "starts_with",
+			"size":       "length",
+		},
+	}
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{in: `user.name.startsWith('a')`, out: `u.name.starts_with("a")`},
+		{in: `size(request.auth.groups) > 0`, out: `length(auth_claims.groups) > 0`},
+		{in: `request.path == user`, out: `request.path == u`},
+		{in: `has(request.auth)`, out: `has(request.auth)`},
+		{in: `[user, {'k': user}]`, out: `[u, {"k": u}]`},
+	}
+	for _, tc := range tests {
+		in := parse(t, tc.in)
+		before := unparse(t, in)
+		got := unparse(t, config.Apply(in))
+		if got != tc.out {
+			t.Errorf("Apply(%q) got %q, wanted %q", tc.in, got, tc.out)
+		}
+		if after := unparse(t, in); after != before {
+			t.Errorf("Apply(%q) modified its input to %q", tc.in, after)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		config  Config
+		dialect string
+		err     string
+	}{
+		{config: Config{}, dialect: DialectSQL},
+		{config: Config{}, dialect: DialectRego},
+		{config: Config{}, dialect: "cobol", err: "unknown dialect"},
+		{config: Config{UnsupportedBehavior: 7}, dialect: DialectSQL,
+			err: "invalid unsupported behavior"},
+		{
+			config: Config{
+				IdentMapping:        map[string]string{"user": "users.name", "req": "input.request"},
+				FunctionMapping:     map[string]string{"size": "LENGTH"},
+				UnsupportedBehavior: BestEffort,
+				DialectVersion:      "postgres-12",
+			},
+			dialect: DialectSQL,
+		},
+		{config: Config{IdentMapping: map[string]string{"user": "users.select"}},
+			dialect: DialectSQL, err: "reserved word"},
+		{config: Config{IdentMapping: map[string]string{"user": "users.select"}},
+			dialect: DialectRego},
+		{config: Config{FunctionMapping: map[string]string{"f": "default"}},
+			dialect: DialectRego, err: "reserved word"},
+		{config: Config{FunctionMapping: map[string]string{"f": "my-func"}},
+			dialect: DialectRego, err: "invalid name"},
+		{config: Config{IdentMapping: map[string]string{"": "x"}},
+			dialect: DialectSQL, err: "empty key"},
+	}
+	for _, tc := range tests {
+		err := Validate(tc.config, tc.dialect)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("Validate(%+v, %s) failed: %v", tc.config, tc.dialect, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Validate(%+v, %s) got error %v, wanted %q", tc.config, tc.dialect, err, tc.err)
+		}
+	}
+}
+
+func parse(t *testing.T, expr string) *exprpb.Expr {
+	t.Helper()
+	p, iss := parser.Parse(common.NewTextSource(expr))
+	if len(iss.GetErrors()) != 0 {
+		t.Fatal(iss.ToDisplayString())
+	}
+	return p.GetExpr()
+}
+
+func unparse(t *testing.T, e *exprpb.Expr) string {
+	t.Helper()
+	out, err := parser.Unparse(e, &exprpb.SourceInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -0,0 +1,1045 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transpiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/parser"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// ErrUnsupportedRegoFeature is the error returned by OPAImporter.Import for a Rego construct which
+// has no CEL translation.
+type ErrUnsupportedRegoFeature struct {
+	// Feature names the construct, such as `negation` or `recursion`.
+	Feature string
+
+	// Line is the line of the Rego source on which the construct appears, starting at 1.
+	Line int
+}
+
+// Error implements the error interface method.
+func (e *ErrUnsupportedRegoFeature) Error() string {
+	return fmt.Sprintf("line %d: unsupported rego feature: %s", e.Line, e.Feature)
+}
+
+// OPAImporter translates the rules of a Rego module into CEL expressions, to aid the migration of
+// policies from OPA to CEL.
+//
+// The importer supports a subset of Rego:
+//
+//     - rules of the form `name { body }`, `name = value { body }`, and `default name = value`,
+//       with the optional `if` keyword before the body;
+//     - assignments `x := expr`, which are inlined into the statements which follow them;
+//     - comparisons, arithmetic, and membership with `in`;
+//     - iteration with `some x in collection` and with the `_` wildcard, as in `input.roles[_]`;
+//     - references to other rules of the module, and the built-in functions `count`,
+//       `startswith`, `endswith`, `contains`, and `re_match`.
+//
+// Recursion, unification with `=`, negation with `not`, functions, partial rules, comprehensions,
+// `else`, `every`, and `with` produce an ErrUnsupportedRegoFeature error.
+//
+// CEL comprehensions iterate the elements of lists and the keys of maps, while Rego iteration binds
+// the values of objects. Iteration over a collection which is not a literal therefore tests
+// whether the collection is a map when evaluated, and binds the value of each key if it is.
+type OPAImporter struct {
+	src string
+}
+
+// NewOPAImporter creates an OPAImporter for the Rego module source.
+func NewOPAImporter(regoSrc string) *OPAImporter {
+	return &OPAImporter{src: regoSrc}
+}
+
+// Import returns one parsed CEL expression for each rule name of the module, in the order in
+// which the names first appear. The source location of each expression is the rule's path, such
+// as `data.authz.allow`, and the source info records the macro calls of the expression, so that
+// it may be converted back to CEL source with parser.Unparse.
+//
+// Rules whose values are all `true` and which have no default, or a default of `false`, are
+// translated to the disjunction of their bodies. Other rules are translated to a conditional
+// which yields the value of the first rule whose body holds, or else the default value, which is
+// null when no default is given.
+func (imp *OPAImporter) Import() ([]*exprpb.ParsedExpr, error) {
+	toks, err := lexRego(imp.src)
+	if err != nil {
+		return nil, err
+	}
+	p := &regoParser{toks: toks}
+	mod, err := p.module()
+	if err != nil {
+		return nil, err
+	}
+	t := &regoTranslator{
+		mod:    mod,
+		cache:  map[string]string{},
+		active: map[string]bool{},
+	}
+	var out []*exprpb.ParsedExpr
+	for _, name := range mod.order {
+		celSrc, err := t.rule(name)
+		if err != nil {
+			return nil, err
+		}
+		location := "data." + mod.pkg + "." + name
+		parsed, errs := parser.ParseWithMacroCalls(
+			common.NewStringSource(celSrc, location), parser.AllMacros)
+		if len(errs.GetErrors()) > 0 {
+			return nil, fmt.Errorf("rule %s: invalid translation %q: %s",
+				name, celSrc, errs.ToDisplayString())
+		}
+		out = append(out, parsed)
+	}
+	return out, nil
+}
+
+// Lexing.
+
+type regoTokenKind int
+
+const (
+	regoEOF regoTokenKind = iota
+	regoNewline
+	regoIdent
+	regoNumber
+	regoString
+	regoOp
+)
+
+type regoToken struct {
+	kind regoTokenKind
+	// text is the token text, or the decoded value of a string.
+	text string
+	line int
+}
+
+var regoOps = []string{":=", "==", "!=", "<=", ">=",
+	"{", "}", "[", "]", "(", ")", ".", ",", ";", ":", "=", "<", ">", "+", "-", "*", "/", "%",
+	"|", "&"}
+
+// lexRego splits Rego source into tokens. Line breaks within parentheses and brackets are dropped,
+// while others are kept as statement separators.
+func lexRego(src string) ([]regoToken, error) {
+	var toks []regoToken
+	line, depth := 1, 0
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			if depth == 0 {
+				toks = append(toks, regoToken{kind: regoNewline, line: line})
+			}
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) ||
+				unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			toks = append(toks, regoToken{kind: regoIdent, text: src[start:i], line: line})
+		case unicode.IsDigit(rune(c)):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.' ||
+				src[i] == 'e' || src[i] == 'E' ||
+				((src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E'))) {
+				i++
+			}
+			toks = append(toks, regoToken{kind: regoNumber, text: src[start:i], line: line})
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			var s string
+			if err := json.Unmarshal([]byte(src[i:end+1]), &s); err != nil {
+				return nil, fmt.Errorf("line %d: invalid string: %s", line, src[i:end+1])
+			}
+			toks = append(toks, regoToken{kind: regoString, text: s, line: line})
+			i = end + 1
+		case c == '`':
+			end := strings.IndexByte(src[i+1:], '`')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			s := src[i+1 : i+1+end]
+			toks = append(toks, regoToken{kind: regoString, text: s, line: line})
+			line += strings.Count(s, "\n")
+			i += end + 2
+		default:
+			op := ""
+			for _, o := range regoOps {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+			}
+			switch op {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				if depth > 0 {
+					depth--
+				}
+			}
+			toks = append(toks, regoToken{kind: regoOp, text: op, line: line})
+			i += len(op)
+		}
+	}
+	return append(toks, regoToken{kind: regoEOF, line: line}), nil
+}
+
+// Parsing.
+
+type regoModule struct {
+	pkg   string
+	order []string
+	rules map[string][]*regoRule
+}
+
+type regoRule struct {
+	name      string
+	isDefault bool
+	// value is nil for rules whose value is true.
+	value regoTerm
+	// body is nil for rules which always hold.
+	body []*regoStmt
+	line int
+}
+
+type regoStmtKind int
+
+const (
+	regoExprStmt regoStmtKind = iota
+	regoAssignStmt
+	regoSomeStmt
+)
+
+type regoStmt struct {
+	kind regoStmtKind
+	// name is the variable assigned or bound by iteration.
+	name string
+	// expr is the statement's expression, the assigned value, or the iterated collection.
+	expr regoTerm
+	line int
+}
+
+type regoTerm interface{}
+
+type regoVar struct {
+	name string
+	line int
+}
+
+type regoLit struct {
+	cel string
+}
+
+type regoRef struct {
+	operand regoTerm
+	field   string
+	index   regoTerm
+}
+
+type regoCall struct {
+	fn   string
+	args []regoTerm
+	line int
+}
+
+type regoBinary struct {
+	op       string
+	lhs, rhs regoTerm
+}
+
+type regoNeg struct {
+	operand regoTerm
+}
+
+type regoArray struct {
+	elems []regoTerm
+}
+
+type regoObject struct {
+	keys, values []regoTerm
+}
+
+type regoParser struct {
+	toks []regoToken
+	pos  int
+}
+
+func (p *regoParser) peek() regoToken {
+	return p.toks[p.pos]
+}
+
+func (p *regoParser) next() regoToken {
+	tok := p.toks[p.pos]
+	if tok.kind != regoEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the given operator or keyword.
+func (p *regoParser) accept(text string) bool {
+	tok := p.peek()
+	if (tok.kind == regoOp || tok.kind == regoIdent) && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *regoParser) isNext(text string) bool {
+	tok := p.peek()
+	return (tok.kind == regoOp || tok.kind == regoIdent) && tok.text == text
+}
+
+func (p *regoParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *regoParser) unexpected() error {
+	tok := p.peek()
+	switch tok.kind {
+	case regoEOF:
+		return fmt.Errorf("line %d: unexpected end of input", tok.line)
+	case regoNewline:
+		return fmt.Errorf("line %d: unexpected end of line", tok.line)
+	}
+	return fmt.Errorf("line %d: unexpected %q", tok.line, tok.text)
+}
+
+func (p *regoParser) skipNewlines() {
+	for p.peek().kind == regoNewline {
+		p.pos++
+	}
+}
+
+func (p *regoParser) ident() (string, error) {
+	tok := p.peek()
+	if tok.kind != regoIdent {
+		return "", p.unexpected()
+	}
+	p.pos++
+	return tok.text, nil
+}
+
+func (p *regoParser) dottedName() (string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	for p.accept(".") {
+		part, err := p.ident()
+		if err != nil {
+			return "", err
+		}
+		name += "." + part
+	}
+	return name, nil
+}
+
+func (p *regoParser) endOfLine() error {
+	switch p.peek().kind {
+	case regoNewline, regoEOF:
+		return nil
+	}
+	return p.unexpected()
+}
+
+func (p *regoParser) module() (*regoModule, error) {
+	p.skipNewlines()
+	if err := p.expect("package"); err != nil {
+		return nil, err
+	}
+	pkg, err := p.dottedName()
+	if err != nil {
+		return nil, err
+	}
+	mod := &regoModule{pkg: pkg, rules: map[string][]*regoRule{}}
+	for {
+		p.skipNewlines()
+		if p.peek().kind == regoEOF {
+			return mod, nil
+		}
+		if line := p.peek().line; p.accept("import") {
+			path, err := p.dottedName()
+			if err != nil {
+				return nil, err
+			}
+			if path != "rego.v1" && path != "future.keywords" &&
+				!strings.HasPrefix(path, "future.keywords.") {
+				return nil, &ErrUnsupportedRegoFeature{Feature: "import of " + path, Line: line}
+			}
+			if err := p.endOfLine(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		r, err := p.rule()
+		if err != nil {
+			return nil, err
+		}
+		if _, found := mod.rules[r.name]; !found {
+			mod.order = append(mod.order, r.name)
+		}
+		mod.rules[r.name] = append(mod.rules[r.name], r)
+	}
+}
+
+func (p *regoParser) rule() (*regoRule, error) {
+	r := &regoRule{line: p.peek().line}
+	r.isDefault = p.accept("default")
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	r.name = name
+	switch {
+	case p.isNext("("):
+		return nil, &ErrUnsupportedRegoFeature{Feature: "functions", Line: r.line}
+	case p.isNext("[") || p.isNext("contains"):
+		return nil, &ErrUnsupportedRegoFeature{Feature: "partial rules", Line: r.line}
+	}
+	if p.accept("=") || p.accept(":=") {
+		if r.value, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if r.isDefault {
+		if r.value == nil {
+			return nil, p.unexpected()
+		}
+		return r, p.endOfLine()
+	}
+	p.accept("if")
+	if p.accept("{") {
+		if r.body, err = p.body(); err != nil {
+			return nil, err
+		}
+		if p.isNext("else") {
+			return nil, &ErrUnsupportedRegoFeature{Feature: "else", Line: p.peek().line}
+		}
+	} else if r.value == nil {
+		return nil, p.unexpected()
+	}
+	return r, p.endOfLine()
+}
+
+// body parses the statements of a rule body up to and including its closing brace.
+func (p *regoParser) body() ([]*regoStmt, error) {
+	var stmts []*regoStmt
+	for {
+		for p.peek().kind == regoNewline || p.isNext(";") {
+			p.pos++
+		}
+		if p.accept("}") {
+			if len(stmts) == 0 {
+				return []*regoStmt{{expr: &regoLit{cel: "true"}, line: p.peek().line}}, nil
+			}
+			return stmts, nil
+		}
+		s, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s)
+		if !p.isNext("}") && !p.isNext(";") && p.peek().kind != regoNewline {
+			return nil, p.unexpected()
+		}
+	}
+}
+
+func (p *regoParser) stmt() (*regoStmt, error) {
+	s := &regoStmt{line: p.peek().line}
+	switch {
+	case p.isNext("not"):
+		return nil, &ErrUnsupportedRegoFeature{Feature: "negation", Line: s.line}
+	case p.isNext("every"):
+		return nil, &ErrUnsupportedRegoFeature{Feature: "every", Line: s.line}
+	case p.accept("some"):
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if p.isNext(",") {
+			return nil, &ErrUnsupportedRegoFeature{Feature: "some with key and value", Line: s.line}
+		}
+		if !p.accept("in") {
+			return nil, &ErrUnsupportedRegoFeature{Feature: "some without in", Line: s.line}
+		}
+		s.kind, s.name = regoSomeStmt, name
+		s.expr, err = p.expr()
+		return s, err
+	case p.peek().kind == regoIdent && p.toks[p.pos+1].text == ":=":
+		s.kind, s.name = regoAssignStmt, p.next().text
+		p.next()
+		var err error
+		s.expr, err = p.expr()
+		return s, err
+	}
+	var err error
+	if s.expr, err = p.expr(); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.isNext("="):
+		return nil, &ErrUnsupportedRegoFeature{Feature: "unification", Line: s.line}
+	case p.isNext("|"):
+		return nil, &ErrUnsupportedRegoFeature{Feature: "set union", Line: s.line}
+	case p.isNext("with"):
+		return nil, &ErrUnsupportedRegoFeature{Feature: "with", Line: s.line}
+	}
+	return s, nil
+}
+
+var regoComparisons = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "in": true,
+}
+
+func (p *regoParser) expr() (regoTerm, error) {
+	lhs, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); (tok.kind == regoOp || tok.kind == regoIdent) && regoComparisons[tok.text] {
+		p.next()
+		rhs, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &regoBinary{op: tok.text, lhs: lhs, rhs: rhs}, nil
+	}
+	return lhs, nil
+}
+
+func (p *regoParser) additive() (regoTerm, error) {
+	lhs, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		switch {
+		case p.isNext("+") || p.isNext("-"):
+			p.next()
+			rhs, err := p.multiplicative()
+			if err != nil {
+				return nil, err
+			}
+			lhs = &regoBinary{op: tok.text, lhs: lhs, rhs: rhs}
+		default:
+			return lhs, nil
+		}
+	}
+}
+
+func (p *regoParser) multiplicative() (regoTerm, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		switch {
+		case p.isNext("&"):
+			return nil, &ErrUnsupportedRegoFeature{Feature: "set intersection", Line: tok.line}
+		case p.isNext("*") || p.isNext("/") || p.isNext("%"):
+			p.next()
+			rhs, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			lhs = &regoBinary{op: tok.text, lhs: lhs, rhs: rhs}
+		default:
+			return lhs, nil
+		}
+	}
+}
+
+func (p *regoParser) unary() (regoTerm, error) {
+	if p.accept("-") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &regoNeg{operand: operand}, nil
+	}
+	return p.postfix()
+}
+
+func (p *regoParser) postfix() (regoTerm, error) {
+	t, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			field, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			t = &regoRef{operand: t, field: field}
+		case p.accept("["):
+			index, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			t = &regoRef{operand: t, index: index}
+		case p.isNext("("):
+			line := p.next().line
+			fn, isName := regoQualifiedName(t)
+			if !isName {
+				return nil, fmt.Errorf("line %d: invalid function call", line)
+			}
+			args, err := p.terms(")")
+			if err != nil {
+				return nil, err
+			}
+			t = &regoCall{fn: fn, args: args, line: line}
+		default:
+			return t, nil
+		}
+	}
+}
+
+func (p *regoParser) primary() (regoTerm, error) {
+	tok := p.next()
+	switch tok.kind {
+	case regoNumber:
+		if _, err := strconv.ParseFloat(tok.text, 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid number: %s", tok.line, tok.text)
+		}
+		return &regoLit{cel: tok.text}, nil
+	case regoString:
+		return &regoLit{cel: strconv.Quote(tok.text)}, nil
+	case regoIdent:
+		switch tok.text {
+		case "true", "false", "null":
+			return &regoLit{cel: tok.text}, nil
+		}
+		return &regoVar{name: tok.text, line: tok.line}, nil
+	case regoOp:
+		switch tok.text {
+		case "(":
+			t, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return t, p.expect(")")
+		case "[":
+			elems, err := p.terms("]")
+			return &regoArray{elems: elems}, err
+		case "{":
+			return p.objectOrSet(tok.line)
+		}
+	}
+	p.pos--
+	return nil, p.unexpected()
+}
+
+// terms parses a comma-separated list of terms up to and including the closing token.
+func (p *regoParser) terms(closing string) ([]regoTerm, error) {
+	var terms []regoTerm
+	for {
+		p.skipNewlines()
+		if p.accept(closing) {
+			return terms, nil
+		}
+		t, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+		p.skipNewlines()
+		if p.isNext("|") {
+			return nil, &ErrUnsupportedRegoFeature{Feature: "comprehensions", Line: p.peek().line}
+		}
+		if !p.accept(",") && !p.isNext(closing) {
+			return nil, p.unexpected()
+		}
+	}
+}
+
+// objectOrSet parses an object or set literal following its opening brace. Sets are translated to
+// lists.
+func (p *regoParser) objectOrSet(line int) (regoTerm, error) {
+	obj := &regoObject{}
+	var set []regoTerm
+	for {
+		p.skipNewlines()
+		if p.accept("}") {
+			if set != nil {
+				return &regoArray{elems: set}, nil
+			}
+			return obj, nil
+		}
+		t, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipNewlines()
+		switch {
+		case p.isNext("|"):
+			return nil, &ErrUnsupportedRegoFeature{Feature: "comprehensions", Line: line}
+		case p.accept(":") && set == nil:
+			v, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			obj.keys = append(obj.keys, t)
+			obj.values = append(obj.values, v)
+		case len(obj.keys) == 0:
+			set = append(set, t)
+		default:
+			return nil, p.unexpected()
+		}
+		p.skipNewlines()
+		if !p.accept(",") && !p.isNext("}") {
+			return nil, p.unexpected()
+		}
+	}
+}
+
+// regoQualifiedName returns the dotted name of a variable or chain of field references.
+func regoQualifiedName(t regoTerm) (string, bool) {
+	switch t := t.(type) {
+	case *regoVar:
+		return t.name, true
+	case *regoRef:
+		if t.index != nil {
+			return "", false
+		}
+		if prefix, found := regoQualifiedName(t.operand); found {
+			return prefix + "." + t.field, true
+		}
+	}
+	return "", false
+}
+
+// Translation.
+
+type regoTranslator struct {
+	mod *regoModule
+	// cache holds the translations of rules, and active the rules being translated.
+	cache  map[string]string
+	active map[string]bool
+	// wildcards counts the `_` wildcards translated so far, for naming their iteration variables.
+	wildcards int
+}
+
+// regoWildcard is the iteration over a collection introduced by an `_` index.
+type regoWildcard struct {
+	coll, iterVar string
+}
+
+// regoBuiltins translates Rego built-in functions into CEL, given the translated arguments.
+var regoBuiltins = map[string]func(args []string) string{
+	"count":      func(args []string) string { return "size(" + args[0] + ")" },
+	"startswith": func(args []string) string { return args[0] + ".startsWith(" + args[1] + ")" },
+	"endswith":   func(args []string) string { return args[0] + ".endsWith(" + args[1] + ")" },
+	"contains":   func(args []string) string { return args[0] + ".contains(" + args[1] + ")" },
+	"re_match":   func(args []string) string { return args[1] + ".matches(" + args[0] + ")" },
+}
+
+var regoBuiltinArgCounts = map[string]int{
+	"count": 1, "startswith": 2, "endswith": 2, "contains": 2, "re_match": 2,
+}
+
+func (t *regoTranslator) rule(name string) (string, error) {
+	if celSrc, found := t.cache[name]; found {
+		return celSrc, nil
+	}
+	rules := t.mod.rules[name]
+	if t.active[name] {
+		return "", &ErrUnsupportedRegoFeature{Feature: "recursion", Line: rules[0].line}
+	}
+	t.active[name] = true
+	defer delete(t.active, name)
+
+	var conds, values []string
+	var def *regoRule
+	allTrue := true
+	for _, r := range rules {
+		if r.isDefault {
+			if def != nil {
+				return "", fmt.Errorf("line %d: multiple defaults for rule %s", r.line, name)
+			}
+			def = r
+			continue
+		}
+		cond, vars, iterated, err := t.body(r.body, map[string]string{})
+		if err != nil {
+			return "", err
+		}
+		value := "true"
+		if r.value != nil {
+			if iterated {
+				vars = map[string]string{}
+			}
+			var wild []regoWildcard
+			value, wild, err = t.term(r.value, vars)
+			if err != nil {
+				return "", err
+			}
+			if len(wild) > 0 {
+				return "", &ErrUnsupportedRegoFeature{Feature: "wildcard in rule value", Line: r.line}
+			}
+		}
+		allTrue = allTrue && value == "true"
+		conds = append(conds, cond)
+		values = append(values, value)
+	}
+	defValue := "null"
+	if def != nil {
+		var wild []regoWildcard
+		var err error
+		defValue, wild, err = t.term(def.value, map[string]string{})
+		if err != nil {
+			return "", err
+		}
+		if len(wild) > 0 {
+			return "", &ErrUnsupportedRegoFeature{Feature: "wildcard in rule value", Line: def.line}
+		}
+	} else if allTrue {
+		defValue = "false"
+	}
+
+	var celSrc string
+	switch {
+	case len(conds) == 0:
+		celSrc = defValue
+	case allTrue && defValue == "false":
+		celSrc = strings.Join(conds, " || ")
+	default:
+		var buf strings.Builder
+		for i, cond := range conds {
+			fmt.Fprintf(&buf, "%s ? %s : ", cond, values[i])
+		}
+		buf.WriteString(defValue)
+		celSrc = buf.String()
+	}
+	t.cache[name] = celSrc
+	return celSrc, nil
+}
+
+// body translates a rule body to the conjunction of its statements, returning the variables in
+// scope at its end and whether the body iterates over a collection.
+func (t *regoTranslator) body(stmts []*regoStmt,
+	vars map[string]string) (string, map[string]string, bool, error) {
+	if len(stmts) == 0 {
+		return "true", vars, false, nil
+	}
+	s := stmts[0]
+	expr, wild, err := t.term(s.expr, vars)
+	if err != nil {
+		return "", nil, false, err
+	}
+	inner := vars
+	switch s.kind {
+	case regoAssignStmt:
+		inner = withRegoVar(vars, s.name, expr)
+	case regoSomeStmt:
+		inner = withRegoVar(vars, s.name, regoElement(s.expr, expr, s.name))
+	}
+	rest, end, iterated, err := t.body(stmts[1:], inner)
+	if err != nil {
+		return "", nil, false, err
+	}
+	out := rest
+	switch s.kind {
+	case regoExprStmt:
+		if rest != "true" {
+			out = expr + " && " + rest
+		} else {
+			out = expr
+		}
+	case regoSomeStmt:
+		out = fmt.Sprintf("%s.exists(%s, %s)", expr, s.name, rest)
+		iterated = true
+	}
+	for i := len(wild) - 1; i >= 0; i-- {
+		out = fmt.Sprintf("%s.exists(%s, %s)", wild[i].coll, wild[i].iterVar, out)
+		iterated = true
+	}
+	return out, end, iterated, nil
+}
+
+// regoElement translates the element of a collection bound by Rego iteration, given the CEL
+// iteration variable over the translated collection. Rego binds the values of objects, where CEL
+// iterates their keys.
+func regoElement(coll regoTerm, collSrc, iterVar string) string {
+	switch coll.(type) {
+	case *regoArray:
+		return iterVar
+	case *regoObject:
+		return collSrc + "[" + iterVar + "]"
+	}
+	return fmt.Sprintf("(type(%s) == map ? %s[%s] : %s)", collSrc, collSrc, iterVar, iterVar)
+}
+
+func withRegoVar(vars map[string]string, name, celSrc string) map[string]string {
+	out := make(map[string]string, len(vars)+1)
+	for k, v := range vars {
+		out[k] = v
+	}
+	out[name] = celSrc
+	return out
+}
+
+// term translates a Rego term, returning the wildcard iterations which must enclose it.
+func (t *regoTranslator) term(term regoTerm, vars map[string]string) (string, []regoWildcard, error) {
+	var wild []regoWildcard
+	var translate func(term regoTerm) (string, error)
+	translate = func(term regoTerm) (string, error) {
+		switch term := term.(type) {
+		case *regoLit:
+			return term.cel, nil
+		case *regoVar:
+			if celSrc, found := vars[term.name]; found {
+				return celSrc, nil
+			}
+			switch term.name {
+			case "input", "data":
+				return term.name, nil
+			case "_":
+				return "", fmt.Errorf("line %d: wildcard outside of a reference", term.line)
+			}
+			if _, found := t.mod.rules[term.name]; found {
+				celSrc, err := t.rule(term.name)
+				return "(" + celSrc + ")", err
+			}
+			return "", fmt.Errorf("line %d: undefined variable: %s", term.line, term.name)
+		case *regoRef:
+			operand, err := translate(term.operand)
+			if err != nil {
+				return "", err
+			}
+			if term.index == nil {
+				return operand + "." + term.field, nil
+			}
+			if v, isVar := term.index.(*regoVar); isVar && v.name == "_" {
+				iterVar := fmt.Sprintf("_%d", t.wildcards)
+				t.wildcards++
+				wild = append(wild, regoWildcard{coll: operand, iterVar: iterVar})
+				return regoElement(term.operand, operand, iterVar), nil
+			}
+			index, err := translate(term.index)
+			if err != nil {
+				return "", err
+			}
+			return operand + "[" + index + "]", nil
+		case *regoCall:
+			fn, found := regoBuiltins[term.fn]
+			if !found {
+				return "", &ErrUnsupportedRegoFeature{
+					Feature: "built-in function " + term.fn,
+					Line:    term.line,
+				}
+			}
+			if len(term.args) != regoBuiltinArgCounts[term.fn] {
+				return "", fmt.Errorf("line %d: %s expects %d arguments, got %d",
+					term.line, term.fn, regoBuiltinArgCounts[term.fn], len(term.args))
+			}
+			args, err := translateRegoTerms(translate, term.args)
+			if err != nil {
+				return "", err
+			}
+			return fn(args), nil
+		case *regoBinary:
+			lhs, err := translate(term.lhs)
+			if err != nil {
+				return "", err
+			}
+			rhs, err := translate(term.rhs)
+			if err != nil {
+				return "", err
+			}
+			return "(" + lhs + " " + term.op + " " + rhs + ")", nil
+		case *regoNeg:
+			operand, err := translate(term.operand)
+			if err != nil {
+				return "", err
+			}
+			return "-" + operand, nil
+		case *regoArray:
+			elems, err := translateRegoTerms(translate, term.elems)
+			if err != nil {
+				return "", err
+			}
+			return "[" + strings.Join(elems, ", ") + "]", nil
+		case *regoObject:
+			keys, err := translateRegoTerms(translate, term.keys)
+			if err != nil {
+				return "", err
+			}
+			values, err := translateRegoTerms(translate, term.values)
+			if err != nil {
+				return "", err
+			}
+			entries := make([]string, len(keys))
+			for i, k := range keys {
+				entries[i] = k + ": " + values[i]
+			}
+			return "{" + strings.Join(entries, ", ") + "}", nil
+		}
+		return "", fmt.Errorf("unexpected term: %v", term)
+	}
+	celSrc, err := translate(term)
+	return celSrc, wild, err
+}
+
+func translateRegoTerms(translate func(regoTerm) (string, error),
+	terms []regoTerm) ([]string, error) {
+	out := make([]string, len(terms))
+	for i, term := range terms {
+		var err error
+		if out[i], err = translate(term); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
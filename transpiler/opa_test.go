@@ -0,0 +1,273 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transpiler
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/debug"
+	"github.com/google/cel-go/parser"
+)
+
+const authzRego = `
+package authz
+
+import future.keywords.in
+
+default allow = false
+
+# Admins may do anything.
+allow {
+	input.user.role == "admin"
+}
+
+allow if {
+	some group in input.user.groups
+	startswith(group, "ops-")
+	input.request.method in ["GET", "HEAD"]
+}
+
+allow {
+	is_owner
+	count(input.request.path) > 1
+}
+
+is_owner {
+	owner := input.resource.owner
+	owner == input.user.name
+}
+
+has_tag {
+	input.resource.tags[_] == "public"
+}
+
+labelled {
+	some label in input.resource.labels
+	label == "public"
+}
+
+level = "high" { input.request.size > 1024 }
+level = "low" { input.request.size <= 1024 }
+default level = "unknown"
+`
+
+func TestOPAImporter(t *testing.T) {
+	exprs, err := NewOPAImporter(authzRego).Import()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLocations := []string{
+		"data.authz.allow", "data.authz.is_owner", "data.authz.has_tag", "data.authz.labelled",
+		"data.authz.level",
+	}
+	if len(exprs) != len(wantLocations) {
+		t.Fatalf("Import() got %d expressions, wanted %d", len(exprs), len(wantLocations))
+	}
+	for i, e := range exprs {
+		if loc := e.GetSourceInfo().GetLocation(); loc != wantLocations[i] {
+			t.Errorf("Import()[%d] got location %s, wanted %s", i, loc, wantLocations[i])
+		}
+		celSrc, err := parser.Unparse(e.GetExpr(), e.GetSourceInfo())
+		if err != nil {
+			t.Errorf("Unparse(Import()[%d]) failed: %v", i, err)
+			continue
+		}
+		reparsed, errs := parser.Parse(common.NewTextSource(celSrc))
+		if len(errs.GetErrors()) > 0 {
+			t.Errorf("Unparse(Import()[%d]) got invalid CEL %q: %s", i, celSrc, errs.ToDisplayString())
+		}
+		if got, want := debug.ToDebugString(reparsed.GetExpr()), debug.ToDebugString(e.GetExpr());
+			got != want {
+			t.Errorf("Unparse(Import()[%d]) got %q, which parses to %s, wanted %s", i, celSrc, got, want)
+		}
+	}
+	if iterVar := exprs[2].GetExpr().GetComprehensionExpr().GetIterVar(); iterVar != "_0" {
+		t.Errorf("Import() got iteration variable %q for has_tag, wanted _0", iterVar)
+	}
+
+	env, err := cel.NewEnv(cel.Declarations(decls.NewVar("input", decls.Dyn)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rule  int
+		input map[string]interface{}
+		want  interface{}
+	}{
+		{
+			rule:  0,
+			input: map[string]interface{}{"user": map[string]interface{}{"role": "admin"}},
+			want:  true,
+		},
+		{
+			rule: 0,
+			input: map[string]interface{}{
+				"user": map[string]interface{}{
+					"role":   "dev",
+					"groups": []string{"dev", "ops-east"},
+				},
+				"request": map[string]interface{}{"method": "GET"},
+			},
+			want: true,
+		},
+		{
+			rule: 0,
+			input: map[string]interface{}{
+				"user": map[string]interface{}{
+					"role":   "dev",
+					"groups": []string{"dev"},
+					"name":   "alice",
+				},
+				"request":  map[string]interface{}{"method": "POST", "path": "/a"},
+				"resource": map[string]interface{}{"owner": "alice"},
+			},
+			want: true,
+		},
+		{
+			rule: 0,
+			input: map[string]interface{}{
+				"user": map[string]interface{}{
+					"role":   "dev",
+					"groups": []string{"ops-west"},
+					"name":   "bob",
+				},
+				"request":  map[string]interface{}{"method": "POST", "path": "/a"},
+				"resource": map[string]interface{}{"owner": "alice"},
+			},
+			want: false,
+		},
+		{
+			rule: 2,
+			input: map[string]interface{}{
+				"resource": map[string]interface{}{"tags": []string{"internal", "public"}},
+			},
+			want: true,
+		},
+		{
+			rule: 2,
+			input: map[string]interface{}{
+				"resource": map[string]interface{}{
+					"tags": map[string]interface{}{"public": "no", "env": "public"},
+				},
+			},
+			want: true,
+		},
+		{
+			rule: 3,
+			input: map[string]interface{}{
+				"resource": map[string]interface{}{"labels": []string{"internal", "public"}},
+			},
+			want: true,
+		},
+		{
+			rule: 3,
+			input: map[string]interface{}{
+				"resource": map[string]interface{}{
+					"labels": map[string]interface{}{"visibility": "public"},
+				},
+			},
+			want: true,
+		},
+		{
+			rule: 3,
+			input: map[string]interface{}{
+				"resource": map[string]interface{}{
+					"labels": map[string]interface{}{"public": "no"},
+				},
+			},
+			want: false,
+		},
+		{
+			rule:  4,
+			input: map[string]interface{}{"request": map[string]interface{}{"size": 2048}},
+			want:  "high",
+		},
+	}
+	for _, tc := range tests {
+		prg, err := env.Program(cel.ParsedExprToAst(exprs[tc.rule]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _, err := prg.Eval(map[string]interface{}{"input": tc.input})
+		if err != nil {
+			t.Fatalf("rule %d: Eval(%v) failed: %v", tc.rule, tc.input, err)
+		}
+		if out.Value() != tc.want {
+			t.Errorf("rule %d: Eval(%v) got %v, wanted %v", tc.rule, tc.input, out, tc.want)
+		}
+	}
+}
+
+func TestOPAImporterUnsupported(t *testing.T) {
+	tests := []struct {
+		rego    string
+		feature string
+		line    int
+	}{
+		{
+			rego:    "package p\nallow {\n\tnot input.denied\n}",
+			feature: "negation",
+			line:    3,
+		},
+		{
+			rego:    "package p\nallow {\n\tinput.x = y\n}",
+			feature: "unification",
+			line:    3,
+		},
+		{
+			rego:    "package p\nallow { a }\na { allow }",
+			feature: "recursion",
+			line:    2,
+		},
+		{
+			rego:    "package p\nf(x) { x > 1 }",
+			feature: "functions",
+			line:    2,
+		},
+		{
+			rego:    "package p\nallow { count([x | x := input.xs[_]]) > 0 }",
+			feature: "comprehensions",
+			line:    2,
+		},
+		{
+			rego:    "package p\nallow { input.a | input.b }",
+			feature: "set union",
+			line:    2,
+		},
+		{
+			rego:    "package p\nallow { lower(input.x) == \"a\" }",
+			feature: "built-in function lower",
+			line:    2,
+		},
+	}
+	for _, tc := range tests {
+		_, err := NewOPAImporter(tc.rego).Import()
+		unsupported, ok := err.(*ErrUnsupportedRegoFeature)
+		if !ok {
+			t.Errorf("Import(%q) got error %v, wanted ErrUnsupportedRegoFeature", tc.rego, err)
+			continue
+		}
+		if unsupported.Feature != tc.feature || unsupported.Line != tc.line {
+			t.Errorf("Import(%q) got %v, wanted feature %s at line %d",
+				tc.rego, err, tc.feature, tc.line)
+		}
+	}
+	if _, err := NewOPAImporter("package p\nallow { input.x == y }").Import(); err == nil {
+		t.Error("Import() got no error for an undefined variable")
+	}
+}